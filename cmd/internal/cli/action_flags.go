@@ -27,6 +27,11 @@ var (
 	DNS                string
 	Security           []string
 	CgroupsPath        string
+	CPUs               string
+	CPUSetCPUs         string
+	Memory             string
+	MemoryReservation  string
+	MemorySwap         string
 	VMRAM              string
 	VMCPU              string
 	VMIP               string
@@ -35,6 +40,7 @@ var (
 	SingularityEnv     []string
 	SingularityEnvFile string
 	NoMount            []string
+	CDIDevices         []string
 
 	IsBoot          bool
 	IsFakeroot      bool
@@ -63,6 +69,10 @@ var (
 	PidNamespace  bool
 	IpcNamespace  bool
 
+	CPUShares   int
+	PidsLimit   int
+	BlkioWeight int
+
 	AllowSUID bool
 	KeepPrivs bool
 	NoPrivs   bool
@@ -237,6 +247,86 @@ var actionApplyCgroupsFlag = cmdline.Flag{
 	EnvKeys:      []string{"APPLY_CGROUPS"},
 }
 
+// --cpus
+var actionCPUsFlag = cmdline.Flag{
+	ID:           "actionCPUsFlag",
+	Value:        &CPUs,
+	DefaultValue: "",
+	Name:         "cpus",
+	Usage:        "number of CPUs available to the container, may be fractional (root only)",
+	EnvKeys:      []string{"CPUS"},
+}
+
+// --cpu-shares
+var actionCPUSharesFlag = cmdline.Flag{
+	ID:           "actionCPUSharesFlag",
+	Value:        &CPUShares,
+	DefaultValue: 0,
+	Name:         "cpu-shares",
+	Usage:        "CPU shares (relative weight) of the container (root only)",
+	EnvKeys:      []string{"CPU_SHARES"},
+}
+
+// --cpuset-cpus
+var actionCPUSetCPUsFlag = cmdline.Flag{
+	ID:           "actionCPUSetCPUsFlag",
+	Value:        &CPUSetCPUs,
+	DefaultValue: "",
+	Name:         "cpuset-cpus",
+	Usage:        "list of CPUs the container can run on (e.g. 0-3,6) (root only)",
+	EnvKeys:      []string{"CPUSET_CPUS"},
+}
+
+// --memory
+var actionMemoryFlag = cmdline.Flag{
+	ID:           "actionMemoryFlag",
+	Value:        &Memory,
+	DefaultValue: "",
+	Name:         "memory",
+	Usage:        "memory limit of the container (e.g. 512M, 2G) (root only)",
+	EnvKeys:      []string{"MEMORY"},
+}
+
+// --memory-reservation
+var actionMemoryReservationFlag = cmdline.Flag{
+	ID:           "actionMemoryReservationFlag",
+	Value:        &MemoryReservation,
+	DefaultValue: "",
+	Name:         "memory-reservation",
+	Usage:        "memory soft limit of the container (root only)",
+	EnvKeys:      []string{"MEMORY_RESERVATION"},
+}
+
+// --memory-swap
+var actionMemorySwapFlag = cmdline.Flag{
+	ID:           "actionMemorySwapFlag",
+	Value:        &MemorySwap,
+	DefaultValue: "",
+	Name:         "memory-swap",
+	Usage:        "memory plus swap limit of the container, -1 for unlimited swap, requires --memory (root only)",
+	EnvKeys:      []string{"MEMORY_SWAP"},
+}
+
+// --pids-limit
+var actionPidsLimitFlag = cmdline.Flag{
+	ID:           "actionPidsLimitFlag",
+	Value:        &PidsLimit,
+	DefaultValue: 0,
+	Name:         "pids-limit",
+	Usage:        "maximum number of processes in the container (root only)",
+	EnvKeys:      []string{"PIDS_LIMIT"},
+}
+
+// --blkio-weight
+var actionBlkioWeightFlag = cmdline.Flag{
+	ID:           "actionBlkioWeightFlag",
+	Value:        &BlkioWeight,
+	DefaultValue: 0,
+	Name:         "blkio-weight",
+	Usage:        "block I/O relative weight of the container, between 10 and 1000 (root only)",
+	EnvKeys:      []string{"BLKIO_WEIGHT"},
+}
+
 // --vm-ram
 var actionVMRAMFlag = cmdline.Flag{
 	ID:           "actionVMRAMFlag",
@@ -385,6 +475,17 @@ var actionNvCCLIFlag = cmdline.Flag{
 	EnvKeys:      []string{"NVCCLI"},
 }
 
+// --device
+var actionDeviceFlag = cmdline.Flag{
+	ID:           "actionDeviceFlag",
+	Value:        &CDIDevices,
+	DefaultValue: []string{},
+	Name:         "device",
+	Usage:        "fully-qualified CDI device name(s) (vendor.com/class=name) to add to the container, as defined by the CDI spec files in /etc/cdi and /var/run/cdi",
+	EnvKeys:      []string{"DEVICE"},
+	Tag:          "<name>",
+}
+
 // --rocm flag to automatically bind
 var actionRocmFlag = cmdline.Flag{
 	ID:           "actionRocmFlag",
@@ -653,11 +754,15 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&actionAppFlag, actionsCmd...)
 		cmdManager.RegisterFlagForCmd(&actionApplyCgroupsFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionBindFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionBlkioWeightFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionCleanEnvFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionCompatFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionContainAllFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionContainFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionContainLibsFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionCPUsFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionCPUSetCPUsFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionCPUSharesFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionDisableCacheFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionDNSFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionDropCapsFlag, actionsInstanceCmd...)
@@ -667,6 +772,9 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&actionHostnameFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionIpcNamespaceFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionKeepPrivsFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionMemoryFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionMemoryReservationFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionMemorySwapFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionNetNamespaceFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionNetworkArgsFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionNetworkFlag, actionsInstanceCmd...)
@@ -679,7 +787,9 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&actionNvidiaFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionNvCCLIFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionRocmFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionDeviceFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionOverlayFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionPidsLimitFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&commonPromptForPassphraseFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&commonPEMFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionPidNamespaceFlag, actionsCmd...)
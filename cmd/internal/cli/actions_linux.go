@@ -7,7 +7,6 @@ package cli
 
 import (
 	"fmt"
-	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -16,7 +15,10 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/hpcng/singularity/internal/app/singularity"
 	"github.com/hpcng/singularity/internal/pkg/buildcfg"
+	"github.com/hpcng/singularity/internal/pkg/cdi"
+	"github.com/hpcng/singularity/internal/pkg/cgroups"
 	"github.com/hpcng/singularity/internal/pkg/image/unpacker"
 	"github.com/hpcng/singularity/internal/pkg/instance"
 	"github.com/hpcng/singularity/internal/pkg/plugin"
@@ -378,6 +380,9 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 		// which is important to maintain security.
 		sylog.Fatalf("while setting GPU configuration: %s", err)
 	}
+	if err := setCDIConfig(engineConfig); err != nil {
+		sylog.Fatalf("while setting CDI devices configuration: %s", err)
+	}
 
 	engineConfig.SetAddCaps(AddCaps)
 	engineConfig.SetDropCaps(DropCaps)
@@ -405,6 +410,39 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 		engineConfig.SetCgroupsPath(CgroupsPath)
 	})
 
+	limits := cgroups.ResourceLimits{
+		CPUs:              CPUs,
+		CPUShares:         CPUShares,
+		CPUSetCPUs:        CPUSetCPUs,
+		Memory:            Memory,
+		MemoryReservation: MemoryReservation,
+		MemorySwap:        MemorySwap,
+		PidsLimit:         PidsLimit,
+		BlkioWeight:       BlkioWeight,
+	}
+	if limits.IsSet() {
+		// resource limits are applied by the privileged part of the
+		// runtime, cgroups delegation to unprivileged users is not
+		// supported yet
+		if !isPrivileged {
+			sylog.Fatalf("Resource limit flags (--cpus, --memory, ...) require root privileges, rootless cgroups are not supported")
+		}
+		if IsFakeroot || UserNamespace {
+			sylog.Fatalf("Resource limit flags (--cpus, --memory, ...) can't be applied to a container running in a user namespace")
+		}
+		if CgroupsPath != "" {
+			sylog.Fatalf("Resource limit flags (--cpus, --memory, ...) can't be used with --apply-cgroups")
+		}
+		resources, err := limits.Resources()
+		if err != nil {
+			sylog.Fatalf("Invalid resource limit: %s", err)
+		}
+		if err := cgroups.CheckResources(resources); err != nil {
+			sylog.Fatalf("Resource limits can't be enforced: %s", err)
+		}
+		generator.SetLinuxResources(resources)
+	}
+
 	if IsWritable && IsWritableTmpfs {
 		sylog.Warningf("Disabling --writable-tmpfs flag, mutually exclusive with --writable")
 		engineConfig.SetWritableTmpfs(false)
@@ -496,6 +534,18 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 			sylog.Fatalf("instance %s already exists", name)
 		}
 
+		policy, err := instance.ParseRestartPolicy(instanceStartRestart)
+		if err != nil {
+			sylog.Fatalf("Invalid --restart value: %s", err)
+		}
+		if policy.Mode != instance.RestartNo {
+			engineConfig.SetRestartPolicy(policy.String())
+		}
+
+		if err := setHealthCheck(engineConfig); err != nil {
+			sylog.Fatalf("%s", err)
+		}
+
 		if IsBoot {
 			UtsNamespace = true
 			NetNamespace = true
@@ -698,48 +748,27 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 	}
 
 	if engineConfig.GetInstance() {
-		stdout, stderr, err := instance.SetLogFile(name, int(uid), instance.LogSubDir)
-		if err != nil {
-			sylog.Fatalf("failed to create instance log files: %s", err)
+		opts := singularity.InstanceStartOptions{
+			ProcName:    procname,
+			UID:         int(uid),
+			UseSuid:     useSuid,
+			LoadOverlay: loadOverlay,
 		}
 
-		start, err := stderr.Seek(0, io.SeekEnd)
-		if err != nil {
-			sylog.Warningf("failed to get standard error stream offset: %s", err)
+		start := singularity.StartInstance
+		if engineConfig.GetRestartPolicy() != "" || engineConfig.GetHealthCmd() != "" {
+			start = singularity.StartSupervisedInstance
 		}
-
-		cmdErr := starter.Run(
-			procname,
-			cfg,
-			starter.UseSuid(useSuid),
-			starter.WithStdout(stdout),
-			starter.WithStderr(stderr),
-			starter.LoadOverlayModule(loadOverlay),
-		)
-
-		if sylog.GetLevel() != 0 {
-			// starter can exit a bit before all errors has been reported
-			// by instance process, wait a bit to catch all errors
-			time.Sleep(100 * time.Millisecond)
-
-			end, err := stderr.Seek(0, io.SeekEnd)
-			if err != nil {
-				sylog.Warningf("failed to get standard error stream offset: %s", err)
-			}
-			if end-start > 0 {
-				output := make([]byte, end-start)
-				stderr.ReadAt(output, start)
-				fmt.Println(string(output))
-			}
+		if err := start(cfg, opts, os.Stdout); err != nil {
+			sylog.Fatalf("failed to start instance: %s", err)
 		}
 
-		if cmdErr != nil {
-			sylog.Fatalf("failed to start instance: %s", cmdErr)
-		} else {
-			sylog.Verbosef("you will find instance output here: %s", stdout.Name())
-			sylog.Verbosef("you will find instance error here: %s", stderr.Name())
-			sylog.Infof("instance started successfully")
+		logErrPath, logOutPath, err := instance.GetLogFilePaths(name, instance.LogSubDir)
+		if err == nil {
+			sylog.Verbosef("you will find instance output here: %s", logOutPath)
+			sylog.Verbosef("you will find instance error here: %s", logErrPath)
 		}
+		sylog.Infof("instance started successfully")
 	} else {
 		err := starter.Exec(
 			procname,
@@ -751,6 +780,40 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 	}
 }
 
+// setHealthCheck sets the instance health check from the --health-* options,
+// or from the image %healthcheck section if there is no --health-cmd.
+func setHealthCheck(engineConfig *singularityConfig.EngineConfig) error {
+	interval, err := time.ParseDuration(instanceStartHealthInterval)
+	if err != nil {
+		return fmt.Errorf("invalid --health-interval value: %s", err)
+	}
+	hc := instance.HealthCheck{
+		Cmd:      instanceStartHealthCmd,
+		Interval: interval,
+		Retries:  instanceStartHealthRetries,
+	}
+	if err := hc.Check(); err != nil {
+		return err
+	}
+
+	if hc.Cmd == "" {
+		image := engineConfig.GetImage()
+		ok, err := singularity.ImageHasHealthcheck(image)
+		if err != nil {
+			sylog.Warningf("Could not look for a healthcheck in image %s: %s", image, err)
+		}
+		if !ok {
+			return nil
+		}
+		hc.Cmd = instance.HealthcheckPath
+	}
+
+	engineConfig.SetHealthCmd(hc.Cmd)
+	engineConfig.SetHealthInterval(hc.Interval)
+	engineConfig.SetHealthRetries(hc.Retries)
+	return nil
+}
+
 // SetGPUConfig sets up EngineConfig entries for NV / ROCm usage, if requested.
 func SetGPUConfig(engineConfig *singularityConfig.EngineConfig) error {
 	if engineConfig.File.AlwaysUseNv && !NoNvidia {
@@ -787,6 +850,30 @@ func SetGPUConfig(engineConfig *singularityConfig.EngineConfig) error {
 	return nil
 }
 
+// setCDIConfig sets up EngineConfig entries for the CDI devices requested
+// with --device. Only the environment variables of the devices are set
+// here, their device nodes, mounts and hooks are resolved by the runtime
+// from the CDI spec files.
+func setCDIConfig(engineConfig *singularityConfig.EngineConfig) error {
+	if len(CDIDevices) == 0 {
+		return nil
+	}
+
+	registry, err := cdi.Load(cdi.DefaultSpecDirs...)
+	if err != nil {
+		return err
+	}
+	edits, err := registry.Resolve(CDIDevices)
+	if err != nil {
+		return err
+	}
+	engineConfig.SetCDIDevices(CDIDevices)
+
+	// --env variables will take precedence over device variables
+	SingularityEnv = append(edits.Env, SingularityEnv...)
+	return nil
+}
+
 // setNvCCLIConfig sets up EngineConfig entries for NVIDIA GPU configuration via nvidia-container-cli
 func setNvCCLIConfig(engineConfig *singularityConfig.EngineConfig) (err error) {
 	sylog.Debugf("Using nvidia-container-cli for GPU setup")
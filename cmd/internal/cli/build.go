@@ -1,5 +1,5 @@
 // Copyright (c) 2020, Control Command Inc. All rights reserved.
-// Copyright (c) 2018-2020, Sylabs Inc. All rights reserved.
+// Copyright (c) 2018-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -7,10 +7,12 @@
 package cli
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"runtime"
+	"strconv"
 
 	ocitypes "github.com/containers/image/v5/types"
 	"github.com/hpcng/singularity/docs"
@@ -29,27 +31,36 @@ import (
 )
 
 var buildArgs struct {
-	sections      []string
-	bindPaths     []string
-	arch          string
-	builderURL    string
-	libraryURL    string
-	keyServerURL  string
-	webURL        string
-	detached      bool
-	encrypt       bool
-	fakeroot      bool
-	fixPerms      bool
-	isJSON        bool
-	noCleanUp     bool
-	noTest        bool
-	remote        bool
-	sandbox       bool
-	update        bool
-	nvidia        bool
-	nvccli        bool
-	rocm          bool
-	writableTmpfs bool // For test section only
+	sections        []string
+	bindPaths       []string
+	buildVarArgs    []string
+	buildVarArgFile string
+	arch            string
+	compression     string
+	progress        string
+	target          string
+	jobs            int
+	builderURL      string
+	libraryURL      string
+	keyServerURL    string
+	webURL          string
+	detached        bool
+	encrypt         bool
+	fakeroot        bool
+	fixPerms        bool
+	isJSON          bool
+	noCleanUp       bool
+	noSBOM          bool
+	noTest          bool
+	remote          bool
+	reproducible    bool
+	sandbox         bool
+	update          bool
+	nvidia          bool
+	nvccli          bool
+	rocm            bool
+	stepCache       bool
+	writableTmpfs   bool // For test section only
 }
 
 // -s|--sandbox
@@ -251,6 +262,97 @@ var buildBindFlag = cmdline.Flag{
 		"Multiple bind paths can be given by a comma separated list. (not supported with remote build)",
 }
 
+// --build-arg
+var buildVarArgsFlag = cmdline.Flag{
+	ID:           "buildVarArgsFlag",
+	Value:        &buildArgs.buildVarArgs,
+	DefaultValue: cmdline.StringArray{}, // to allow commas in values
+	Name:         "build-arg",
+	Usage:        "defines variable=value to replace {{ variable }} entries in build definition file",
+}
+
+// --build-arg-file
+var buildVarArgFileFlag = cmdline.Flag{
+	ID:           "buildVarArgFileFlag",
+	Value:        &buildArgs.buildVarArgFile,
+	DefaultValue: "",
+	Name:         "build-arg-file",
+	Usage:        "specifies a file containing variable=value lines to replace {{ variable }} entries in build definition file",
+}
+
+// --compression
+var buildCompressionFlag = cmdline.Flag{
+	ID:           "buildCompressionFlag",
+	Value:        &buildArgs.compression,
+	DefaultValue: "",
+	Name:         "compression",
+	Usage:        "compression algorithm of the SIF root filesystem: gzip, xz, lz4 or zstd, with an optional level for gzip and zstd (e.g. zstd:19). Defaults to the 'mksquashfs compression' configuration value",
+	Tag:          "<algorithm[:level]>",
+	EnvKeys:      []string{"COMPRESSION"},
+}
+
+// --progress
+var buildProgressFlag = cmdline.Flag{
+	ID:           "buildProgressFlag",
+	Value:        &buildArgs.progress,
+	DefaultValue: "auto",
+	Name:         "progress",
+	Usage:        "build progress output: auto, or json to write line-delimited JSON build events to stdout (not supported with remote build)",
+	Tag:          "<auto|json>",
+	EnvKeys:      []string{"BUILD_PROGRESS"},
+}
+
+// --jobs
+var buildJobsFlag = cmdline.Flag{
+	ID:           "buildJobsFlag",
+	Value:        &buildArgs.jobs,
+	DefaultValue: 1,
+	Name:         "jobs",
+	Usage:        "maximum number of independent stages of a multi-stage definition built concurrently (not supported with remote build)",
+	EnvKeys:      []string{"BUILD_JOBS"},
+}
+
+// --target
+var buildTargetFlag = cmdline.Flag{
+	ID:           "buildTargetFlag",
+	Value:        &buildArgs.target,
+	DefaultValue: "",
+	Name:         "target",
+	Usage:        "build the named stage of a multi-stage definition instead of the last one, only the stages it needs are built (not supported with remote build)",
+	Tag:          "<stage>",
+	EnvKeys:      []string{"BUILD_TARGET"},
+}
+
+// --no-sbom
+var buildNoSBOMFlag = cmdline.Flag{
+	ID:           "buildNoSBOMFlag",
+	Value:        &buildArgs.noSBOM,
+	DefaultValue: false,
+	Name:         "no-sbom",
+	Usage:        "do not generate the SPDX software bill of materials of the installed packages",
+	EnvKeys:      []string{"NO_SBOM"},
+}
+
+// --reproducible
+var buildReproducibleFlag = cmdline.Flag{
+	ID:           "buildReproducibleFlag",
+	Value:        &buildArgs.reproducible,
+	DefaultValue: false,
+	Name:         "reproducible",
+	Usage:        "build an image which only depends on the build inputs, with timestamps set to SOURCE_DATE_EPOCH if set or to the Unix epoch (not supported with remote or encrypted build)",
+	EnvKeys:      []string{"REPRODUCIBLE"},
+}
+
+// --step-cache
+var buildStepCacheFlag = cmdline.Flag{
+	ID:           "buildStepCacheFlag",
+	Value:        &buildArgs.stepCache,
+	DefaultValue: false,
+	Name:         "step-cache",
+	Usage:        "cache the root filesystem after the %files and %post sections and reuse it when rebuilding unchanged sections (not supported with remote build)",
+	EnvKeys:      []string{"STEP_CACHE"},
+}
+
 // --writable-tmpfs
 var buildWritableTmpfsFlag = cmdline.Flag{
 	ID:           "buildWritableTmpfsFlag",
@@ -296,6 +398,15 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&buildRocmFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildBindFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildWritableTmpfsFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildVarArgsFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildVarArgFileFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildStepCacheFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildCompressionFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildProgressFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildJobsFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildTargetFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildReproducibleFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildNoSBOMFlag, buildCmd)
 	})
 }
 
@@ -389,9 +500,52 @@ func checkBuildTarget(path string) error {
 	return nil
 }
 
+// readBuildVarArgs returns the build arguments passed with --build-arg-file,
+// overridden by the ones passed with --build-arg.
+func readBuildVarArgs() (map[string]string, error) {
+	args := make(map[string]string)
+
+	if buildArgs.buildVarArgFile != "" {
+		f, err := os.Open(buildArgs.buildVarArgFile)
+		if err != nil {
+			return nil, fmt.Errorf("while opening build argument file: %v", err)
+		}
+		defer f.Close()
+
+		args, err = parser.ReadBuildArgs(f)
+		if err != nil {
+			return nil, fmt.Errorf("while reading %s: %v", buildArgs.buildVarArgFile, err)
+		}
+	}
+
+	cmdArgs, err := parser.ParseBuildArgs(buildArgs.buildVarArgs)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range cmdArgs {
+		args[k] = v
+	}
+
+	return args, nil
+}
+
+// sourceDateEpoch returns the Unix time set by the SOURCE_DATE_EPOCH
+// environment variable, and whether it is set.
+func sourceDateEpoch() (int64, bool, error) {
+	value, ok := os.LookupEnv("SOURCE_DATE_EPOCH")
+	if !ok || value == "" {
+		return 0, false, nil
+	}
+	epoch, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || epoch < 0 {
+		return 0, false, fmt.Errorf("invalid SOURCE_DATE_EPOCH value %q: must be a non-negative Unix time", value)
+	}
+	return epoch, true, nil
+}
+
 // definitionFromSpec is specifically for parsing specs for the remote builder
 // it uses a different version the the definition struct and parser
-func definitionFromSpec(spec string) (types.Definition, error) {
+func definitionFromSpec(spec string, buildVarArgs map[string]string) (types.Definition, error) {
 	// Try spec as URI first
 	def, err := types.NewDefinitionFromURI(spec)
 	if err == nil {
@@ -408,15 +562,20 @@ func definitionFromSpec(spec string) (types.Definition, error) {
 	if isValid {
 		sylog.Debugf("Found valid definition: %s\n", spec)
 		// File exists and contains valid definition
-		var defFile *os.File
-		defFile, err = os.Open(spec)
+		raw, err := ioutil.ReadFile(spec)
 		if err != nil {
 			return types.Definition{}, err
 		}
 
-		defer defFile.Close()
+		raw, unused, err := parser.SubstituteBuildArgs(raw, buildVarArgs)
+		if err != nil {
+			return types.Definition{}, fmt.Errorf("while substituting build arguments: %v", err)
+		}
+		for _, arg := range unused {
+			sylog.Warningf("Build argument %s is not used by definition %s", arg, spec)
+		}
 
-		return parser.ParseDefinitionFile(defFile)
+		return parser.ParseDefinitionFile(bytes.NewReader(raw))
 	}
 
 	// File exists and does NOT contain a valid definition
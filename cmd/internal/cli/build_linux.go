@@ -9,6 +9,7 @@ package cli
 import (
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	osExec "os/exec"
@@ -27,6 +28,7 @@ import (
 	"github.com/hpcng/singularity/internal/pkg/util/interactive"
 	"github.com/hpcng/singularity/internal/pkg/util/starter"
 	"github.com/hpcng/singularity/internal/pkg/util/user"
+	"github.com/hpcng/singularity/pkg/build/events"
 	"github.com/hpcng/singularity/pkg/build/types"
 	"github.com/hpcng/singularity/pkg/image"
 	"github.com/hpcng/singularity/pkg/runtime/engine/config"
@@ -134,6 +136,49 @@ func runBuild(cmd *cobra.Command, args []string) {
 		os.Setenv("SINGULARITY_WRITABLE_TMPFS", "1")
 	}
 
+	if buildArgs.compression != "" {
+		if buildArgs.remote {
+			sylog.Fatalf("--compression option is not supported for remote build")
+		}
+		if buildArgs.sandbox {
+			sylog.Fatalf("--compression option is not supported for sandbox build")
+		}
+	}
+
+	switch buildArgs.progress {
+	case "auto":
+	case "json":
+		if buildArgs.remote {
+			sylog.Fatalf("--progress=json option is not supported for remote build")
+		}
+	default:
+		sylog.Fatalf("Unsupported --progress value %q: must be auto or json", buildArgs.progress)
+	}
+
+	epoch, epochSet, err := sourceDateEpoch()
+	if err != nil {
+		sylog.Fatalf("%s", err)
+	}
+	if epochSet && !buildArgs.remote {
+		sylog.Verbosef("SOURCE_DATE_EPOCH is set, building a reproducible image")
+		buildArgs.reproducible = true
+	}
+	if buildArgs.reproducible && buildArgs.remote {
+		sylog.Fatalf("--reproducible option is not supported for remote build")
+	}
+
+	if buildArgs.jobs < 1 {
+		sylog.Fatalf("--jobs value must be at least 1")
+	}
+	if buildArgs.remote {
+		if buildArgs.jobs > 1 {
+			sylog.Fatalf("--jobs option is not supported for remote build")
+		}
+		if buildArgs.target != "" {
+			sylog.Fatalf("--target option is not supported for remote build")
+		}
+	}
+
 	if buildArgs.arch != runtime.GOARCH && !buildArgs.remote {
 		sylog.Fatalf("Requested architecture (%s) does not match host (%s). Cannot build locally.", buildArgs.arch, runtime.GOARCH)
 	}
@@ -149,7 +194,7 @@ func runBuild(cmd *cobra.Command, args []string) {
 	if buildArgs.remote {
 		runBuildRemote(cmd.Context(), cmd, dest, spec)
 	} else {
-		runBuildLocal(cmd.Context(), cmd, dest, spec)
+		runBuildLocal(cmd.Context(), cmd, dest, spec, epoch)
 	}
 	sylog.Infof("Build complete: %s", dest)
 }
@@ -182,7 +227,12 @@ func runBuildRemote(ctx context.Context, cmd *cobra.Command, dst, spec string) {
 		sylog.Fatalf("Unable to submit build job: %v", remoteWarning)
 	}
 
-	def, err := definitionFromSpec(spec)
+	buildVarArgs, err := readBuildVarArgs()
+	if err != nil {
+		sylog.Fatalf("While reading build arguments: %v", err)
+	}
+
+	def, err := definitionFromSpec(spec, buildVarArgs)
 	if err != nil {
 		sylog.Fatalf("Unable to build from %s: %v", spec, err)
 	}
@@ -256,12 +306,15 @@ func runBuildRemote(ctx context.Context, cmd *cobra.Command, dst, spec string) {
 	}
 }
 
-func runBuildLocal(ctx context.Context, cmd *cobra.Command, dst, spec string) {
+func runBuildLocal(ctx context.Context, cmd *cobra.Command, dst, spec string, epoch int64) {
 	var keyInfo *cryptkey.KeyInfo
 	if buildArgs.encrypt || promptForPassphrase || cmd.Flags().Lookup("pem-path").Changed {
 		if os.Getuid() != 0 {
 			sylog.Fatalf("You must be root to build an encrypted container")
 		}
+		if buildArgs.reproducible {
+			sylog.Fatalf("Reproducible build of an encrypted container is not supported")
+		}
 
 		k, err := getEncryptionMaterial(cmd)
 		if err != nil {
@@ -295,8 +348,13 @@ func runBuildLocal(ctx context.Context, cmd *cobra.Command, dst, spec string) {
 		sylog.Fatalf("While creating Docker credentials: %v", err)
 	}
 
+	buildVarArgs, err := readBuildVarArgs()
+	if err != nil {
+		sylog.Fatalf("While reading build arguments: %v", err)
+	}
+
 	// parse definition to determine build source
-	defs, err := build.MakeAllDefs(spec)
+	defs, err := build.MakeAllDefs(spec, buildVarArgs)
 	if err != nil {
 		sylog.Fatalf("Unable to build from %s: %v", spec, err)
 	}
@@ -335,12 +393,25 @@ func runBuildLocal(ctx context.Context, cmd *cobra.Command, dst, spec string) {
 
 	}
 
+	var handler events.Handler
+	var scriptOutput io.Writer
+	if buildArgs.progress == "json" {
+		// keep stdout for build events only, the output of the section
+		// scripts goes to stderr along with the log messages
+		handler = events.NewJSONHandler(os.Stdout)
+		scriptOutput = os.Stderr
+	}
+
 	b, err := build.New(
 		defs,
 		build.Config{
-			Dest:      dst,
-			Format:    buildFormat,
-			NoCleanUp: buildArgs.noCleanUp,
+			Dest:        dst,
+			Format:      buildFormat,
+			NoCleanUp:   buildArgs.noCleanUp,
+			Compression: buildArgs.compression,
+			Events:      handler,
+			Jobs:        buildArgs.jobs,
+			Target:      buildArgs.target,
 			Opts: types.Options{
 				ImgCache:          imgCache,
 				TmpDir:            tmpDir,
@@ -349,6 +420,7 @@ func runBuildLocal(ctx context.Context, cmd *cobra.Command, dst, spec string) {
 				Force:             forceOverwrite,
 				Sections:          buildArgs.sections,
 				NoTest:            buildArgs.noTest,
+				Stdout:            scriptOutput,
 				NoHTTPS:           noHTTPS,
 				LibraryURL:        buildArgs.libraryURL,
 				LibraryAuthToken:  authToken,
@@ -357,6 +429,10 @@ func runBuildLocal(ctx context.Context, cmd *cobra.Command, dst, spec string) {
 				EncryptionKeyInfo: keyInfo,
 				FixPerms:          buildArgs.fixPerms,
 				SandboxTarget:     sandboxTarget,
+				StepCache:         buildArgs.stepCache,
+				Reproducible:      buildArgs.reproducible,
+				SourceDateEpoch:   epoch,
+				NoSBOM:            buildArgs.noSBOM,
 			},
 		})
 	if err != nil {
@@ -0,0 +1,37 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"github.com/hpcng/singularity/docs"
+	"github.com/hpcng/singularity/internal/app/singularity"
+	"github.com/hpcng/singularity/pkg/cmdline"
+	"github.com/hpcng/singularity/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterCmd(CpCmd)
+	})
+}
+
+// CpCmd is the 'cp' command that copies files out of an image.
+var CpCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(2),
+
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := singularity.Copy(args[0], args[1]); err != nil {
+			sylog.Fatalf("Unable to copy from image: %s", err)
+		}
+	},
+
+	Use:     docs.CpUse,
+	Short:   docs.CpShort,
+	Long:    docs.CpLong,
+	Example: docs.CpExample,
+}
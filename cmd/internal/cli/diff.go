@@ -0,0 +1,54 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+
+	"github.com/hpcng/singularity/docs"
+	"github.com/hpcng/singularity/internal/app/singularity"
+	"github.com/hpcng/singularity/pkg/cmdline"
+	"github.com/hpcng/singularity/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+var diffJSON bool
+
+// -j|--json
+var diffJSONFlag = cmdline.Flag{
+	ID:           "diffJSONFlag",
+	Value:        &diffJSON,
+	DefaultValue: false,
+	Name:         "json",
+	ShortHand:    "j",
+	Usage:        "print structured json instead of a list of changes",
+}
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterCmd(DiffCmd)
+
+		cmdManager.RegisterFlagForCmd(&diffJSONFlag, DiffCmd)
+	})
+}
+
+// DiffCmd is the 'diff' command that shows the differences between two
+// images.
+var DiffCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(2),
+
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := singularity.Diff(args[0], args[1], diffJSON, os.Stdout); err != nil {
+			sylog.Fatalf("Unable to compare images: %s", err)
+		}
+	},
+
+	Use:     docs.DiffUse,
+	Short:   docs.DiffShort,
+	Long:    docs.DiffLong,
+	Example: docs.DiffExample,
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hpcng/singularity/docs"
+	"github.com/hpcng/singularity/internal/app/singularity"
+	"github.com/hpcng/singularity/internal/pkg/buildcfg"
+	"github.com/hpcng/singularity/pkg/cmdline"
+	"github.com/hpcng/singularity/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+var eclConfigFile string
+
+// --config
+var eclCheckConfigFlag = cmdline.Flag{
+	ID:           "eclCheckConfigFlag",
+	Value:        &eclConfigFile,
+	DefaultValue: buildcfg.ECL_FILE,
+	Name:         "config",
+	Usage:        "path of the ECL configuration file to check the image against",
+}
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterCmd(EclCmd)
+		cmdManager.RegisterSubCmd(EclCmd, EclCheckCmd)
+
+		cmdManager.RegisterFlagForCmd(&eclCheckConfigFlag, EclCheckCmd)
+	})
+}
+
+// EclCmd is the 'ecl' command that groups execution control list commands.
+var EclCmd = &cobra.Command{
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return errors.New("Invalid command")
+	},
+	DisableFlagsInUseLine: true,
+
+	Use:     docs.EclUse,
+	Short:   docs.EclShort,
+	Long:    docs.EclLong,
+	Example: docs.EclExample,
+}
+
+// EclCheckCmd is the 'ecl check' command that explains the ECL decision for an image.
+var EclCheckCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(1),
+
+	Run: func(cmd *cobra.Command, args []string) {
+		doEclCheckCmd(args[0])
+	},
+
+	Use:     docs.EclCheckUse,
+	Short:   docs.EclCheckShort,
+	Long:    docs.EclCheckLong,
+	Example: docs.EclCheckExample,
+}
+
+func doEclCheckCmd(path string) {
+	ecl, d, err := singularity.EclCheck(eclConfigFile, path)
+	if err != nil {
+		sylog.Fatalf("Unable to check image: %s", err)
+	}
+
+	if !ecl.Activated {
+		sylog.Warningf("ECL is not activated in %s, images are not checked at run time", eclConfigFile)
+	}
+
+	// Validation ensures execgroups and rules are not used together.
+	kind := "Rule"
+	if len(ecl.ExecGroups) > 0 {
+		kind = "Execgroup"
+	}
+
+	for _, r := range d.Results {
+		match := "no match"
+		if r.Matched {
+			match = "match"
+		}
+		fmt.Printf("%s %q (%s): %s: %s\n", kind, r.Name, r.Action, match, strings.Join(r.Reasons, ", "))
+	}
+
+	decision := "denied"
+	if d.Allow {
+		decision = "allowed"
+	}
+
+	if d.Default {
+		fmt.Printf("No rule matched, default action applies: image %s\n", decision)
+	} else if len(d.Results) > 0 {
+		fmt.Printf("%s %q applies: image %s\n", kind, d.Results[len(d.Results)-1].Name, decision)
+	}
+
+	if !d.Allow {
+		sylog.Fatalf("Image %s is denied by the ECL", path)
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"github.com/hpcng/singularity/docs"
+	"github.com/hpcng/singularity/internal/app/singularity"
+	"github.com/hpcng/singularity/pkg/cmdline"
+	"github.com/hpcng/singularity/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterCmd(ExportCmd)
+
+		cmdManager.RegisterFlagForCmd(&commonTmpDirFlag, ExportCmd)
+	})
+}
+
+// ExportCmd is the 'export' command that converts an image into an OCI
+// image archive or layout.
+var ExportCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(2),
+
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := singularity.Export(cmd.Context(), args[0], args[1], tmpDir); err != nil {
+			sylog.Fatalf("Unable to export image: %s", err)
+		}
+		sylog.Infof("Export complete: %s", args[1])
+	},
+
+	Use:     docs.ExportUse,
+	Short:   docs.ExportShort,
+	Long:    docs.ExportLong,
+	Example: docs.ExportExample,
+}
@@ -1,4 +1,4 @@
-// Copyright (c) 2018-2020, Sylabs Inc. All rights reserved.
+// Copyright (c) 2018-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -11,9 +11,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"runtime"
 	"sort"
@@ -21,6 +23,7 @@ import (
 
 	"github.com/hpcng/sif/pkg/sif"
 	"github.com/hpcng/singularity/docs"
+	"github.com/hpcng/singularity/internal/pkg/image/squashfs"
 	"github.com/hpcng/singularity/internal/pkg/util/env"
 	"github.com/hpcng/singularity/pkg/cmdline"
 	"github.com/hpcng/singularity/pkg/image"
@@ -38,12 +41,15 @@ var (
 	allData     bool
 	runscript   bool
 	startscript bool
+	healthcheck bool
 	testfile    bool
 	environment bool
 	helpfile    bool
 	listApps    bool
 	labels      bool
 	deffile     bool
+	compression bool
+	sbomfmt     bool
 	jsonfmt     bool
 )
 
@@ -116,6 +122,15 @@ var inspectStartscriptFlag = cmdline.Flag{
 	Usage:        "show the startscript for the image",
 }
 
+// --healthcheck
+var inspectHealthcheckFlag = cmdline.Flag{
+	ID:           "inspectHealthcheckFlag",
+	Value:        &healthcheck,
+	DefaultValue: false,
+	Name:         "healthcheck",
+	Usage:        "show the healthcheck for the image",
+}
+
 // -t|--test
 var inspectTestFlag = cmdline.Flag{
 	ID:           "inspectTestFlag",
@@ -146,6 +161,24 @@ var inspectHelpfileFlag = cmdline.Flag{
 	Usage:        "inspect the runscript helpfile, if it exists",
 }
 
+// --compression
+var inspectCompressionFlag = cmdline.Flag{
+	ID:           "inspectCompressionFlag",
+	Value:        &compression,
+	DefaultValue: false,
+	Name:         "compression",
+	Usage:        "show the compression algorithm of the image root filesystem",
+}
+
+// --sbom
+var inspectSBOMFlag = cmdline.Flag{
+	ID:           "inspectSBOMFlag",
+	Value:        &sbomfmt,
+	DefaultValue: false,
+	Name:         "sbom",
+	Usage:        "show the SPDX software bill of materials of the image, if it exists",
+}
+
 // --all
 var inspectAllFlag = cmdline.Flag{
 	ID:           "inspectAllFlag",
@@ -167,9 +200,13 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&inspectLabelsFlag, InspectCmd)
 		cmdManager.RegisterFlagForCmd(&inspectRunscriptFlag, InspectCmd)
 		cmdManager.RegisterFlagForCmd(&inspectStartscriptFlag, InspectCmd)
+		cmdManager.RegisterFlagForCmd(&inspectHealthcheckFlag, InspectCmd)
 		cmdManager.RegisterFlagForCmd(&inspectTestFlag, InspectCmd)
 		cmdManager.RegisterFlagForCmd(&inspectAppsListFlag, InspectCmd)
+		cmdManager.RegisterFlagForCmd(&inspectCompressionFlag, InspectCmd)
+		cmdManager.RegisterFlagForCmd(&inspectSBOMFlag, InspectCmd)
 		cmdManager.RegisterFlagForCmd(&inspectAllFlag, InspectCmd)
+		cmdManager.RegisterFlagForCmd(&commonTmpDirFlag, InspectCmd)
 	})
 }
 
@@ -184,6 +221,9 @@ type command struct {
 	metadata    *inspect.Metadata
 	sifMetadata *inspect.Metadata
 	img         *image.Image
+	// rootfs is the temporary directory holding the metadata files
+	// extracted from a squashfs root filesystem
+	rootfs string
 }
 
 func newCommand(allData bool, appName string, img *image.Image) *command {
@@ -207,13 +247,20 @@ func newCommand(allData bool, appName string, img *image.Image) *command {
 		} else if err != image.ErrNoSection {
 			sylog.Warningf("Unable to read %s SIF descriptor: %s", metadataJSON, err)
 		} else {
-			if runtime.GOOS != "linux" {
-				sylog.Fatalf("Could not inspect %s: %s SIF descriptor not found", img.Path, metadataJSON)
-			}
 			sylog.Debugf("No %s SIF descriptor found", metadataJSON)
 		}
-	} else if runtime.GOOS != "linux" {
-		sylog.Fatalf("Could not inspect image %s on this platform, only SIF and sandbox images are supported", img.Path)
+	}
+
+	if img.Type != image.SANDBOX && command.sifMetadata == nil {
+		rootfs, err := extractMetadata(img, tmpDir)
+		if err == nil {
+			command.rootfs = rootfs
+			prefix = rootfs
+		} else if runtime.GOOS != "linux" {
+			sylog.Fatalf("Could not inspect image %s on this platform: %s", img.Path, err)
+		} else {
+			sylog.Debugf("Unable to read metadata from root filesystem, running container: %s", err)
+		}
 	}
 
 	pathPrefix := filepath.Join(prefix, "/.singularity.d")
@@ -310,6 +357,8 @@ func (c *command) setAttribute(section, value, file string) error {
 		}
 	case "startscript":
 		c.metadata.Data.Attributes.Startscript = value
+	case "healthcheck":
+		c.metadata.Data.Attributes.Healthcheck = value
 	case "environment":
 		if app != "" {
 			c.metadata.Data.Attributes.Apps[app].Environment[file] = value
@@ -327,13 +376,17 @@ func (c *command) getMetadata() (*inspect.Metadata, error) {
 	if c.sifMetadata != nil {
 		return c.metadata, nil
 	}
+	if c.rootfs != "" {
+		defer os.RemoveAll(c.rootfs)
+	}
 
 	args := []string{"/bin/sh", "-c", c.script}
 	prefix := ""
 	outBuf := new(bytes.Buffer)
 
-	// Execute the compound script.
-	if c.img.Type == image.SANDBOX {
+	// Execute the compound script, directly for sandbox images and
+	// metadata extracted from the root filesystem.
+	if c.img.Type == image.SANDBOX || c.rootfs != "" {
 		os.Setenv("PATH", env.DefaultPath)
 
 		// look for sh
@@ -351,6 +404,9 @@ func (c *command) getMetadata() (*inspect.Metadata, error) {
 		}
 		outBuf.Write(out)
 		prefix = c.img.Path
+		if c.rootfs != "" {
+			prefix = c.rootfs
+		}
 	} else {
 		// single file image, run singularity exec with the compound script
 		out, err := singularityExec(c.img.Path, args)
@@ -463,6 +519,17 @@ func (c *command) addStartscriptCommand() {
 	}
 }
 
+func (c *command) addHealthcheckCommand() {
+	if c.sifMetadata == nil {
+		c.addSingleFileCommand("healthcheck", "healthcheck")
+		return
+	}
+
+	if c.appName == "" {
+		c.metadata.Attributes.Healthcheck = c.sifMetadata.Attributes.Healthcheck
+	}
+}
+
 func (c *command) addTestCommand() {
 	if c.sifMetadata == nil {
 		c.addSingleFileCommand("test", "test")
@@ -542,6 +609,80 @@ func (c *command) addDefinitionCommand() {
 	}
 }
 
+func (c *command) addCompressionCommand() {
+	if c.appName != "" {
+		return
+	}
+	if c.sifMetadata != nil && c.sifMetadata.Attributes.Compression != "" {
+		c.metadata.Attributes.Compression = c.sifMetadata.Attributes.Compression
+		return
+	}
+
+	// images built without the compression metadata, the level
+	// can't be retrieved from the squashfs super block
+	comp, err := inspectSquashfsCompression(c.img)
+	if err != nil {
+		sylog.Warningf("Unable to inspect compression: %s", err)
+		return
+	}
+	c.metadata.Attributes.Compression = comp
+}
+
+// extractMetadata copies the regular files of the /.singularity.d and
+// /scif/apps/*/scif directories of the squashfs root filesystem of img to
+// a temporary directory created in tmpDir, so they are inspected without
+// running the container. Symbolic links are resolved inside the root
+// filesystem.
+func extractMetadata(img *image.Image, tmpDir string) (string, error) {
+	fsys, err := squashfs.FromImage(img)
+	if err != nil {
+		return "", err
+	}
+
+	dirs := []string{".singularity.d"}
+	apps, err := fs.ReadDir(fsys, "scif/apps")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	for _, app := range apps {
+		dirs = append(dirs, path.Join("scif/apps", app.Name(), "scif"))
+	}
+
+	rootfs, err := ioutil.TempDir(tmpDir, "inspect-")
+	if err != nil {
+		return "", fmt.Errorf("could not create temporary directory: %s", err)
+	}
+
+	for _, dir := range dirs {
+		err := fs.WalkDir(fsys, dir, func(name string, d fs.DirEntry, err error) error {
+			if errors.Is(err, fs.ErrNotExist) && name == dir {
+				return fs.SkipDir
+			} else if err != nil {
+				return err
+			}
+			dest := filepath.Join(rootfs, filepath.FromSlash(name))
+			if d.IsDir() {
+				return os.MkdirAll(dest, 0o755)
+			}
+			// symbolic links to directories are not followed
+			if fi, err := fs.Stat(fsys, name); err != nil || !fi.Mode().IsRegular() {
+				return nil
+			}
+			data, err := fs.ReadFile(fsys, name)
+			if err != nil {
+				return err
+			}
+			return ioutil.WriteFile(dest, data, 0o644)
+		})
+		if err != nil {
+			os.RemoveAll(rootfs)
+			return "", fmt.Errorf("while reading %s: %s", dir, err)
+		}
+	}
+
+	return rootfs, nil
+}
+
 func getInspectMetadataFromSIF(img *image.Image) (*inspect.Metadata, error) {
 	r, err := image.NewSectionReader(img, metadataJSON, -1)
 	if err != nil {
@@ -588,6 +729,55 @@ func inspectDeffilePartition(img *image.Image) (string, error) {
 	return string(data), nil
 }
 
+// inspectSquashfsCompression returns the compression algorithm read from the
+// super block of a squashfs root filesystem, or an empty string if the root
+// filesystem is not a squashfs filesystem.
+func inspectSquashfsCompression(img *image.Image) (string, error) {
+	if img.Type == image.SANDBOX {
+		return "", nil
+	}
+
+	part, err := img.GetRootFsPartition()
+	if err != nil {
+		return "", err
+	}
+	if part.Type != image.SQUASHFS {
+		return "", nil
+	}
+
+	r, err := image.NewPartitionReader(img, part.Name, -1)
+	if err != nil {
+		return "", fmt.Errorf("while reading root filesystem partition: %s", err)
+	}
+	b := make([]byte, 512)
+	n, err := io.ReadFull(r, b)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", fmt.Errorf("while reading root filesystem partition: %s", err)
+	}
+
+	return image.GetSquashfsComp(b[:n])
+}
+
+// inspectSBOM returns the SPDX software bill of materials of the image,
+// stored as a SIF data object or in the container for sandboxes.
+func inspectSBOM(img *image.Image) ([]byte, error) {
+	switch img.Type {
+	case image.SIF:
+		r, err := image.NewSectionReader(img, image.SIFDescSBOMJSON, -1)
+		if err != nil {
+			return nil, fmt.Errorf("no SBOM found in %s, it may have been built with --no-sbom or by an older version", img.Path)
+		}
+		return ioutil.ReadAll(r)
+	case image.SANDBOX:
+		data, err := ioutil.ReadFile(filepath.Join(img.Path, ".singularity.d", image.SIFDescSBOMJSON))
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no SBOM found in %s, it may have been built with --no-sbom or by an older version", img.Path)
+		}
+		return data, err
+	}
+	return nil, fmt.Errorf("SBOM is only available for SIF and sandbox images")
+}
+
 func printSortedApp(m map[string]*inspect.AppAttributes) {
 	sorted := make([]string, 0, len(m))
 	for k := range m {
@@ -612,7 +802,7 @@ func printSortedMap(m map[string]string, fn func(key string)) {
 
 // returns true if flags for other forms of information are unset.
 func defaultToLabels() bool {
-	return !(helpfile || deffile || runscript || startscript || testfile || environment || listApps)
+	return !(helpfile || deffile || runscript || startscript || healthcheck || testfile || environment || listApps || compression)
 }
 
 // InspectCmd represents the 'inspect' command.
@@ -632,6 +822,15 @@ var InspectCmd = &cobra.Command{
 			sylog.Fatalf("Failed to open image %s: %s", args[0], err)
 		}
 
+		if sbomfmt {
+			data, err := inspectSBOM(img)
+			if err != nil {
+				sylog.Fatalf("Unable to inspect SBOM: %s", err)
+			}
+			fmt.Printf("%s\n", data)
+			return
+		}
+
 		if allData {
 			// display all data in JSON format only
 			jsonfmt = true
@@ -672,6 +871,13 @@ var InspectCmd = &cobra.Command{
 			}
 		}
 
+		if healthcheck || allData {
+			if AppName == "" {
+				sylog.Debugf("Inspection of healthcheck selected.")
+				inspectCmd.addHealthcheckCommand()
+			}
+		}
+
 		if testfile || allData {
 			sylog.Debugf("Inspection of test selected.")
 			inspectCmd.addTestCommand()
@@ -682,6 +888,11 @@ var InspectCmd = &cobra.Command{
 			inspectCmd.addEnvironmentCommand()
 		}
 
+		if compression || allData {
+			sylog.Debugf("Inspection of compression selected.")
+			inspectCmd.addCompressionCommand()
+		}
+
 		if listApps || allData {
 			sylog.Debugf("Listing all apps in container")
 		}
@@ -722,6 +933,12 @@ var InspectCmd = &cobra.Command{
 			if inspectData.Data.Attributes.Startscript != "" {
 				fmt.Printf("%s\n", inspectData.Data.Attributes.Startscript)
 			}
+			if inspectData.Data.Attributes.Healthcheck != "" {
+				fmt.Printf("%s\n", inspectData.Data.Attributes.Healthcheck)
+			}
+			if inspectData.Data.Attributes.Compression != "" {
+				fmt.Printf("%s\n", inspectData.Data.Attributes.Compression)
+			}
 			if inspectData.Data.Attributes.Test != "" {
 				fmt.Printf("%s\n", inspectData.Data.Attributes.Test)
 			} else if appAttr != nil && appAttr.Test != "" {
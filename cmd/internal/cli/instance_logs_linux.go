@@ -0,0 +1,123 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+
+	"github.com/hpcng/singularity/docs"
+	"github.com/hpcng/singularity/internal/app/singularity"
+	"github.com/hpcng/singularity/pkg/cmdline"
+	"github.com/hpcng/singularity/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&instanceLogsUserFlag, instanceLogsCmd)
+		cmdManager.RegisterFlagForCmd(&instanceLogsFollowFlag, instanceLogsCmd)
+		cmdManager.RegisterFlagForCmd(&instanceLogsTailFlag, instanceLogsCmd)
+		cmdManager.RegisterFlagForCmd(&instanceLogsSinceFlag, instanceLogsCmd)
+		cmdManager.RegisterFlagForCmd(&instanceLogsTimestampsFlag, instanceLogsCmd)
+	})
+}
+
+// -u|--user
+var instanceLogsUser string
+
+var instanceLogsUserFlag = cmdline.Flag{
+	ID:           "instanceLogsUserFlag",
+	Value:        &instanceLogsUser,
+	DefaultValue: "",
+	Name:         "user",
+	ShortHand:    "u",
+	Usage:        `if running as root, show logs of an instance from "<username>"`,
+	Tag:          "<username>",
+	EnvKeys:      []string{"USER"},
+}
+
+// -f|--follow
+var instanceLogsFollow bool
+
+var instanceLogsFollowFlag = cmdline.Flag{
+	ID:           "instanceLogsFollowFlag",
+	Value:        &instanceLogsFollow,
+	DefaultValue: false,
+	Name:         "follow",
+	ShortHand:    "f",
+	Usage:        "keep printing new log entries until the instance exits",
+}
+
+// --tail
+var instanceLogsTail int
+
+var instanceLogsTailFlag = cmdline.Flag{
+	ID:           "instanceLogsTailFlag",
+	Value:        &instanceLogsTail,
+	DefaultValue: -1,
+	Name:         "tail",
+	Usage:        "number of lines to show from the end of the logs, all lines if negative",
+	Tag:          "<N>",
+}
+
+// --since
+var instanceLogsSince string
+
+var instanceLogsSinceFlag = cmdline.Flag{
+	ID:           "instanceLogsSinceFlag",
+	Value:        &instanceLogsSince,
+	DefaultValue: "",
+	Name:         "since",
+	Usage:        "show log entries since a timestamp (e.g. 2021-06-01T10:30:00Z) or a relative duration (e.g. 10m)",
+	Tag:          "<time>",
+}
+
+// -t|--timestamps
+var instanceLogsTimestamps bool
+
+var instanceLogsTimestampsFlag = cmdline.Flag{
+	ID:           "instanceLogsTimestampsFlag",
+	Value:        &instanceLogsTimestamps,
+	DefaultValue: false,
+	Name:         "timestamps",
+	ShortHand:    "t",
+	Usage:        "prefix log entries with the time they were logged",
+}
+
+// singularity instance logs
+var instanceLogsCmd = &cobra.Command{
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		uid := os.Getuid()
+		if instanceLogsUser != "" && uid != 0 {
+			sylog.Fatalf("Only root user can show logs of user's instances")
+		}
+
+		opts := singularity.InstanceLogsOptions{
+			Follow:     instanceLogsFollow,
+			Tail:       instanceLogsTail,
+			Timestamps: instanceLogsTimestamps,
+		}
+		if instanceLogsSince != "" {
+			since, err := singularity.ParseLogsSince(instanceLogsSince)
+			if err != nil {
+				sylog.Fatalf("Invalid --since value: %v", err)
+			}
+			opts.Since = since
+		}
+
+		err := singularity.PrintInstanceLogs(cmd.Context(), os.Stdout, os.Stderr, args[0], instanceLogsUser, opts)
+		if err != nil {
+			sylog.Fatalf("Could not get instance logs: %v", err)
+		}
+	},
+	DisableFlagsInUseLine: true,
+
+	Use:     docs.InstanceLogsUse,
+	Short:   docs.InstanceLogsShort,
+	Long:    docs.InstanceLogsLong,
+	Example: docs.InstanceLogsExample,
+}
@@ -1,4 +1,4 @@
-// Copyright (c) 2018-2020, Sylabs Inc. All rights reserved.
+// Copyright (c) 2018-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -8,6 +8,7 @@ package cli
 import (
 	"github.com/hpcng/singularity/docs"
 	"github.com/hpcng/singularity/internal/app/singularity"
+	"github.com/hpcng/singularity/internal/pkg/instance"
 	"github.com/hpcng/singularity/pkg/cmdline"
 	"github.com/hpcng/singularity/pkg/sylog"
 	"github.com/spf13/cobra"
@@ -16,6 +17,10 @@ import (
 func init() {
 	addCmdInit(func(cmdManager *cmdline.CommandManager) {
 		cmdManager.RegisterFlagForCmd(&instanceStartPidFileFlag, instanceStartCmd)
+		cmdManager.RegisterFlagForCmd(&instanceStartRestartFlag, instanceStartCmd)
+		cmdManager.RegisterFlagForCmd(&instanceStartHealthCmdFlag, instanceStartCmd)
+		cmdManager.RegisterFlagForCmd(&instanceStartHealthIntervalFlag, instanceStartCmd)
+		cmdManager.RegisterFlagForCmd(&instanceStartHealthRetriesFlag, instanceStartCmd)
 	})
 }
 
@@ -31,6 +36,58 @@ var instanceStartPidFileFlag = cmdline.Flag{
 	EnvKeys:      []string{"PID_FILE"},
 }
 
+// --restart
+var instanceStartRestart string
+
+var instanceStartRestartFlag = cmdline.Flag{
+	ID:           "instanceStartRestartFlag",
+	Value:        &instanceStartRestart,
+	DefaultValue: "",
+	Name:         "restart",
+	Usage:        "restart policy when the instance exits: no, on-failure[:N] to restart up to N times on non zero exit status, or always",
+	Tag:          "<policy>",
+	EnvKeys:      []string{"RESTART"},
+}
+
+// --health-cmd
+var instanceStartHealthCmd string
+
+var instanceStartHealthCmdFlag = cmdline.Flag{
+	ID:           "instanceStartHealthCmdFlag",
+	Value:        &instanceStartHealthCmd,
+	DefaultValue: "",
+	Name:         "health-cmd",
+	Usage:        "shell command run inside the instance to check its health, overrides the image %healthcheck",
+	Tag:          "<command>",
+	EnvKeys:      []string{"HEALTH_CMD"},
+}
+
+// --health-interval
+var instanceStartHealthInterval string
+
+var instanceStartHealthIntervalFlag = cmdline.Flag{
+	ID:           "instanceStartHealthIntervalFlag",
+	Value:        &instanceStartHealthInterval,
+	DefaultValue: instance.DefaultHealthInterval.String(),
+	Name:         "health-interval",
+	Usage:        "interval between two health checks (e.g. 30s, 1m)",
+	Tag:          "<duration>",
+	EnvKeys:      []string{"HEALTH_INTERVAL"},
+}
+
+// --health-retries
+var instanceStartHealthRetries int
+
+var instanceStartHealthRetriesFlag = cmdline.Flag{
+	ID:           "instanceStartHealthRetriesFlag",
+	Value:        &instanceStartHealthRetries,
+	DefaultValue: instance.DefaultHealthRetries,
+	Name:         "health-retries",
+	Usage:        "number of consecutive failed health checks for the instance to be unhealthy",
+	Tag:          "<N>",
+	EnvKeys:      []string{"HEALTH_RETRIES"},
+}
+
 // singularity instance start
 var instanceStartCmd = &cobra.Command{
 	Args:                  cobra.MinimumNArgs(2),
@@ -0,0 +1,90 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+
+	"github.com/hpcng/singularity/docs"
+	"github.com/hpcng/singularity/internal/app/singularity"
+	"github.com/hpcng/singularity/pkg/cmdline"
+	"github.com/hpcng/singularity/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&instanceStatsUserFlag, instanceStatsCmd)
+		cmdManager.RegisterFlagForCmd(&instanceStatsJSONFlag, instanceStatsCmd)
+		cmdManager.RegisterFlagForCmd(&instanceStatsNoStreamFlag, instanceStatsCmd)
+	})
+}
+
+// -u|--user
+var instanceStatsUser string
+
+var instanceStatsUserFlag = cmdline.Flag{
+	ID:           "instanceStatsUserFlag",
+	Value:        &instanceStatsUser,
+	DefaultValue: "",
+	Name:         "user",
+	ShortHand:    "u",
+	Usage:        `if running as root, show stats of instances from "<username>"`,
+	Tag:          "<username>",
+	EnvKeys:      []string{"USER"},
+}
+
+// -j|--json
+var instanceStatsJSON bool
+
+var instanceStatsJSONFlag = cmdline.Flag{
+	ID:           "instanceStatsJSONFlag",
+	Value:        &instanceStatsJSON,
+	DefaultValue: false,
+	Name:         "json",
+	ShortHand:    "j",
+	Usage:        "print structured json instead of a table",
+	EnvKeys:      []string{"JSON"},
+}
+
+// --no-stream
+var instanceStatsNoStream bool
+
+var instanceStatsNoStreamFlag = cmdline.Flag{
+	ID:           "instanceStatsNoStreamFlag",
+	Value:        &instanceStatsNoStream,
+	DefaultValue: false,
+	Name:         "no-stream",
+	Usage:        "print resource usage once instead of refreshing it every second",
+	EnvKeys:      []string{"NO_STREAM"},
+}
+
+// singularity instance stats
+var instanceStatsCmd = &cobra.Command{
+	Args: cobra.RangeArgs(0, 1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := "*"
+		if len(args) > 0 {
+			name = args[0]
+		}
+
+		uid := os.Getuid()
+		if instanceStatsUser != "" && uid != 0 {
+			sylog.Fatalf("Only root user can show stats of user's instances")
+		}
+
+		err := singularity.PrintInstanceStats(cmd.Context(), os.Stdout, name, instanceStatsUser, instanceStatsJSON, instanceStatsNoStream)
+		if err != nil {
+			sylog.Fatalf("Could not get instance stats: %v", err)
+		}
+	},
+	DisableFlagsInUseLine: true,
+
+	Use:     docs.InstanceStatsUse,
+	Short:   docs.InstanceStatsShort,
+	Long:    docs.InstanceStatsLong,
+	Example: docs.InstanceStatsExample,
+}
@@ -0,0 +1,32 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+
+	"github.com/hpcng/singularity/internal/app/singularity"
+	"github.com/hpcng/singularity/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+// singularity instance supervise, run by instance start with a restart
+// policy, the instance configuration is read from the standard input and
+// the start status is reported on file descriptor 3
+var instanceSuperviseCmd = &cobra.Command{
+	Args: cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		status := os.NewFile(3, "status")
+		if err := singularity.SuperviseInstance(os.Stdin, status); err != nil {
+			sylog.Fatalf("Instance supervisor failed: %s", err)
+		}
+	},
+	DisableFlagsInUseLine: true,
+
+	Hidden: true,
+	Use:    "supervise",
+	Short:  "Start an instance and restart it according to its restart policy",
+}
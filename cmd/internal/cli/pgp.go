@@ -7,12 +7,14 @@
 package cli
 
 import (
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"time"
 
 	"github.com/hpcng/singularity/internal/pkg/buildcfg"
 
@@ -145,7 +147,7 @@ func isGlobal(e *openpgp.Entity) bool {
 }
 
 // outputVerify outputs a textual representation of r to stdout.
-func outputVerify(f *sif.FileImage, r integrity.VerifyResult) bool {
+func outputVerify(f *sif.FileImage, r singularity.VerifyResult) bool {
 	e := r.Entity()
 
 	// Print signing entity info.
@@ -167,6 +169,30 @@ func outputVerify(f *sif.FileImage, r integrity.VerifyResult) bool {
 
 		// Always print fingerprint.
 		fmt.Printf("%-18v Fingerprint: %X\n", prefix, e.PrimaryKey.Fingerprint)
+
+		// Print time stamp and key status, if applicable.
+		if ts := r.Timestamp(); !ts.IsZero() {
+			fmt.Printf("%-18v Timestamp: %v\n", prefix, ts.Format(time.RFC3339))
+		}
+		if status := r.KeyStatus(); status != "" && status != singularity.KeyValid {
+			fmt.Printf("%-18v Key status: %v\n", prefix, status)
+		}
+	}
+
+	// Print signing certificate info.
+	if chain := r.Certificates(); len(chain) > 0 {
+		prefix := color.New(color.FgGreen).Sprint("[X.509]")
+
+		fmt.Printf("%-18v Signing certificate: %v\n", prefix, chain[0].Subject)
+		fmt.Printf("%-18v Issuer: %v\n", prefix, chain[0].Issuer)
+		fmt.Printf("%-18v Fingerprint: %X\n", prefix, sha256.Sum256(chain[0].Raw))
+
+		if ts := r.Timestamp(); !ts.IsZero() {
+			fmt.Printf("%-18v Timestamp: %v\n", prefix, ts.Format(time.RFC3339))
+		}
+		if status := r.KeyStatus(); status != "" && status != singularity.KeyValid {
+			fmt.Printf("%-18v Certificate status: %v\n", prefix, status)
+		}
 	}
 
 	// Print table of signed objects.
@@ -217,6 +243,8 @@ type keyEntity struct {
 	Fingerprint string
 	KeyLocal    bool
 	KeyCheck    bool
+	KeyStatus   string
+	Timestamp   string `json:",omitempty"`
 	DataCheck   bool
 }
 
@@ -228,8 +256,8 @@ type keyList struct {
 
 // getJSONCallback returns a singularity.VerifyCallback that appends to kl.
 func getJSONCallback(kl *keyList) singularity.VerifyCallback {
-	return func(f *sif.FileImage, r integrity.VerifyResult) bool {
-		name, fp := "unknown", ""
+	return func(f *sif.FileImage, r singularity.VerifyResult) bool {
+		name, fp, status, ts := "unknown", "", "unknown", ""
 		var keyLocal, keyCheck bool
 
 		// Increment signature count.
@@ -245,6 +273,20 @@ func getJSONCallback(kl *keyList) singularity.VerifyCallback {
 			keyCheck = true
 		}
 
+		// If signing certificate is determined, note its subject and SHA-256 fingerprint.
+		if chain := r.Certificates(); len(chain) > 0 {
+			name = chain[0].Subject.String()
+			sum := sha256.Sum256(chain[0].Raw)
+			fp = hex.EncodeToString(sum[:])
+			keyCheck = true
+		}
+		if r.KeyStatus() != "" {
+			status = string(r.KeyStatus())
+		}
+		if t := r.Timestamp(); !t.IsZero() {
+			ts = t.Format(time.RFC3339)
+		}
+
 		// For each verified object, append an entry to the list.
 		for _, id := range r.Verified() {
 			od, _, err := f.GetFromDescrID(id)
@@ -259,6 +301,8 @@ func getJSONCallback(kl *keyList) singularity.VerifyCallback {
 				Fingerprint: fp,
 				KeyLocal:    keyLocal,
 				KeyCheck:    keyCheck,
+				KeyStatus:   status,
+				Timestamp:   ts,
 				DataCheck:   true,
 			}
 			kl.SignerKeys = append(kl.SignerKeys, &key{ke})
@@ -278,6 +322,8 @@ func getJSONCallback(kl *keyList) singularity.VerifyCallback {
 				Fingerprint: fp,
 				KeyLocal:    keyLocal,
 				KeyCheck:    keyCheck,
+				KeyStatus:   status,
+				Timestamp:   ts,
 				DataCheck:   false,
 			}
 			kl.SignerKeys = append(kl.SignerKeys, &key{ke})
@@ -38,6 +38,8 @@ const (
 	HTTPSProtocol = "https"
 	// OrasProtocol holds the oras URI.
 	OrasProtocol = "oras"
+	// DockerProtocol holds the docker registry URI.
+	DockerProtocol = "docker"
 )
 
 var (
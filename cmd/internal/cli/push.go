@@ -11,6 +11,7 @@ import (
 
 	"github.com/hpcng/singularity/docs"
 	"github.com/hpcng/singularity/internal/app/singularity"
+	"github.com/hpcng/singularity/internal/pkg/client/oci"
 	"github.com/hpcng/singularity/internal/pkg/client/oras"
 	"github.com/hpcng/singularity/internal/pkg/remote/endpoint"
 	"github.com/hpcng/singularity/internal/pkg/util/uri"
@@ -71,6 +72,9 @@ func init() {
 
 		cmdManager.RegisterFlagForCmd(&dockerUsernameFlag, PushCmd)
 		cmdManager.RegisterFlagForCmd(&dockerPasswordFlag, PushCmd)
+
+		cmdManager.RegisterFlagForCmd(&commonNoHTTPSFlag, PushCmd)
+		cmdManager.RegisterFlagForCmd(&commonTmpDirFlag, PushCmd)
 	})
 }
 
@@ -132,6 +136,19 @@ var PushCmd = &cobra.Command{
 				sylog.Fatalf("Unable to push image to oci registry: %v", err)
 			}
 			sylog.Infof("Upload complete")
+		case DockerProtocol:
+			if cmd.Flag(pushDescriptionFlag.Name).Changed {
+				sylog.Warningf("Description is not supported for push to docker. Ignoring it.")
+			}
+			ociAuth, err := makeDockerCredentials(cmd)
+			if err != nil {
+				sylog.Fatalf("Unable to make docker oci credentials: %s", err)
+			}
+
+			if err := oci.Push(cmd.Context(), file, dest, tmpDir, ociAuth, noHTTPS); err != nil {
+				sylog.Fatalf("Unable to push image to oci registry: %v", err)
+			}
+			sylog.Infof("Upload complete")
 		default:
 			sylog.Fatalf("Unsupported transport type: %s", transport)
 		}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/hpcng/singularity/docs"
 	"github.com/hpcng/singularity/internal/app/singularity"
+	"github.com/hpcng/singularity/internal/pkg/util/x509sig"
 	"github.com/hpcng/singularity/pkg/cmdline"
 	"github.com/hpcng/singularity/pkg/sylog"
 	"github.com/hpcng/singularity/pkg/sypgp"
@@ -17,8 +18,11 @@ import (
 )
 
 var (
-	privKey int // -k encryption key (index from 'keys list') specification
-	signAll bool
+	privKey  int // -k encryption key (index from 'keys list') specification
+	signAll  bool
+	tsaURL   string
+	certPath string
+	keyPath  string
 )
 
 // -g|--group-id
@@ -82,6 +86,34 @@ var signAllFlag = cmdline.Flag{
 	Deprecated:   "now the default behavior",
 }
 
+// --tsa-url
+var signTSAURLFlag = cmdline.Flag{
+	ID:           "signTSAURLFlag",
+	Value:        &tsaURL,
+	DefaultValue: "",
+	Name:         "tsa-url",
+	Usage:        "time stamp signatures with the RFC 3161 time stamping authority at this URL",
+	EnvKeys:      []string{"TSA_URL"},
+}
+
+// --certificate
+var signCertificateFlag = cmdline.Flag{
+	ID:           "signCertificateFlag",
+	Value:        &certPath,
+	DefaultValue: "",
+	Name:         "certificate",
+	Usage:        "sign with the X.509 certificate in this PEM file, followed by any intermediate certificates",
+}
+
+// --key
+var signKeyFlag = cmdline.Flag{
+	ID:           "signKeyFlag",
+	Value:        &keyPath,
+	DefaultValue: "",
+	Name:         "key",
+	Usage:        "sign with the unencrypted private key of the X.509 certificate in this PEM file",
+}
+
 func init() {
 	addCmdInit(func(cmdManager *cmdline.CommandManager) {
 		cmdManager.RegisterCmd(SignCmd)
@@ -92,6 +124,9 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&signSifDescIDFlag, SignCmd)
 		cmdManager.RegisterFlagForCmd(&signKeyIdxFlag, SignCmd)
 		cmdManager.RegisterFlagForCmd(&signAllFlag, SignCmd)
+		cmdManager.RegisterFlagForCmd(&signTSAURLFlag, SignCmd)
+		cmdManager.RegisterFlagForCmd(&signCertificateFlag, SignCmd)
+		cmdManager.RegisterFlagForCmd(&signKeyFlag, SignCmd)
 	})
 }
 
@@ -114,15 +149,35 @@ var SignCmd = &cobra.Command{
 func doSignCmd(cmd *cobra.Command, cpath string) {
 	var opts []singularity.SignOpt
 
-	// Set entity selector option, and ensure the entity is decrypted.
-	var f sypgp.EntitySelector
-	if cmd.Flag(signKeyIdxFlag.Name).Changed {
-		f = selectEntityAtIndex(privKey)
+	if certPath != "" || keyPath != "" {
+		// Set certificate option.
+		if certPath == "" || keyPath == "" {
+			sylog.Fatalf("Both --%s and --%s are required to sign with a certificate", signCertificateFlag.Name, signKeyFlag.Name)
+		}
+		if cmd.Flag(signKeyIdxFlag.Name).Changed {
+			sylog.Fatalf("--%s cannot be used with --%s", signKeyIdxFlag.Name, signCertificateFlag.Name)
+		}
+
+		certs, err := x509sig.LoadCertificates(certPath)
+		if err != nil {
+			sylog.Fatalf("Failed to load certificate: %s", err)
+		}
+		key, err := x509sig.LoadPrivateKey(keyPath)
+		if err != nil {
+			sylog.Fatalf("Failed to load private key: %s", err)
+		}
+		opts = append(opts, singularity.OptSignCertificate(certs, key))
 	} else {
-		f = selectEntityInteractive()
+		// Set entity selector option, and ensure the entity is decrypted.
+		var f sypgp.EntitySelector
+		if cmd.Flag(signKeyIdxFlag.Name).Changed {
+			f = selectEntityAtIndex(privKey)
+		} else {
+			f = selectEntityInteractive()
+		}
+		f = decryptSelectedEntityInteractive(f)
+		opts = append(opts, singularity.OptSignEntitySelector(f))
 	}
-	f = decryptSelectedEntityInteractive(f)
-	opts = append(opts, singularity.OptSignEntitySelector(f))
 
 	// Set group option, if applicable.
 	if cmd.Flag(signSifGroupIDFlag.Name).Changed || cmd.Flag(signOldSifGroupIDFlag.Name).Changed {
@@ -134,6 +189,11 @@ func doSignCmd(cmd *cobra.Command, cpath string) {
 		opts = append(opts, singularity.OptSignObjects(sifDescID))
 	}
 
+	// Set time stamping option, if applicable.
+	if tsaURL != "" {
+		opts = append(opts, singularity.OptSignTimestamp(tsaURL))
+	}
+
 	// Sign the image.
 	fmt.Printf("Signing image: %s\n", cpath)
 	if err := singularity.Sign(cpath, opts...); err != nil {
@@ -7,12 +7,16 @@
 package cli
 
 import (
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"fmt"
+	"io/ioutil"
 	"os"
 
 	"github.com/hpcng/singularity/docs"
 	"github.com/hpcng/singularity/internal/app/singularity"
 	"github.com/hpcng/singularity/internal/pkg/remote/endpoint"
+	"github.com/hpcng/singularity/internal/pkg/util/x509sig"
 	"github.com/hpcng/singularity/pkg/cmdline"
 	"github.com/hpcng/singularity/pkg/sylog"
 	"github.com/spf13/cobra"
@@ -25,6 +29,10 @@ var (
 	jsonVerify   bool   // -j flag
 	verifyAll    bool
 	verifyLegacy bool
+	verifyTSA    bool
+	tsaCAFile    string
+	caBundle     string
+	crlFiles     []string
 )
 
 // -u|--url
@@ -118,6 +126,44 @@ var verifyLegacyFlag = cmdline.Flag{
 	Usage:        "enable verification of (insecure) legacy signatures",
 }
 
+// --timestamp
+var verifyTimestampFlag = cmdline.Flag{
+	ID:           "verifyTimestampFlag",
+	Value:        &verifyTSA,
+	DefaultValue: false,
+	Name:         "timestamp",
+	Usage:        "verify the RFC 3161 time stamps of signatures, and check signing keys at their time",
+}
+
+// --tsa-ca
+var verifyTSACAFlag = cmdline.Flag{
+	ID:           "verifyTSACAFlag",
+	Value:        &tsaCAFile,
+	DefaultValue: "",
+	Name:         "tsa-ca",
+	Usage:        "PEM file of the root certificates of time stamping authorities, instead of the system roots (implies --timestamp)",
+	EnvKeys:      []string{"TSA_CA"},
+}
+
+// --ca-bundle
+var verifyCABundleFlag = cmdline.Flag{
+	ID:           "verifyCABundleFlag",
+	Value:        &caBundle,
+	DefaultValue: "",
+	Name:         "ca-bundle",
+	Usage:        "verify X.509 certificate signatures against the root certificates in this PEM file",
+	EnvKeys:      []string{"CA_BUNDLE"},
+}
+
+// --crl
+var verifyCRLFlag = cmdline.Flag{
+	ID:           "verifyCRLFlag",
+	Value:        &crlFiles,
+	DefaultValue: []string{},
+	Name:         "crl",
+	Usage:        "check X.509 signing certificates against the certificate revocation list in this PEM or DER file (implies --ca-bundle)",
+}
+
 func init() {
 	addCmdInit(func(cmdManager *cmdline.CommandManager) {
 		cmdManager.RegisterCmd(VerifyCmd)
@@ -131,6 +177,10 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&verifyJSONFlag, VerifyCmd)
 		cmdManager.RegisterFlagForCmd(&verifyAllFlag, VerifyCmd)
 		cmdManager.RegisterFlagForCmd(&verifyLegacyFlag, VerifyCmd)
+		cmdManager.RegisterFlagForCmd(&verifyTimestampFlag, VerifyCmd)
+		cmdManager.RegisterFlagForCmd(&verifyTSACAFlag, VerifyCmd)
+		cmdManager.RegisterFlagForCmd(&verifyCABundleFlag, VerifyCmd)
+		cmdManager.RegisterFlagForCmd(&verifyCRLFlag, VerifyCmd)
 	})
 }
 
@@ -153,8 +203,32 @@ var VerifyCmd = &cobra.Command{
 func doVerifyCmd(cmd *cobra.Command, cpath string) {
 	var opts []singularity.VerifyOpt
 
-	// Set keyserver option, if applicable.
-	if !localVerify {
+	// Set certificate options, if applicable.
+	if len(crlFiles) > 0 && caBundle == "" {
+		sylog.Fatalf("--%s requires --%s", verifyCRLFlag.Name, verifyCABundleFlag.Name)
+	}
+	if caBundle != "" {
+		roots, err := x509sig.LoadCertPool(caBundle)
+		if err != nil {
+			sylog.Fatalf("While loading CA bundle: %s", err)
+		}
+		opts = append(opts, singularity.OptVerifyCertificates(roots))
+
+		var crls []*pkix.CertificateList
+		for _, path := range crlFiles {
+			crl, err := x509sig.LoadCRL(path)
+			if err != nil {
+				sylog.Fatalf("While loading certificate revocation list: %s", err)
+			}
+			crls = append(crls, crl)
+		}
+		if len(crls) > 0 {
+			opts = append(opts, singularity.OptVerifyCRLs(crls...))
+		}
+	}
+
+	// Set keyserver option, if applicable. X.509 signatures are verified without a keyserver.
+	if !localVerify && caBundle == "" {
 		co, err := getKeyserverClientOpts(keyServerURI, endpoint.KeyserverVerifyOp)
 		if err != nil {
 			sylog.Fatalf("Error while getting keyserver client config: %v", err)
@@ -183,6 +257,21 @@ func doVerifyCmd(cmd *cobra.Command, cpath string) {
 		opts = append(opts, singularity.OptVerifyLegacy())
 	}
 
+	// Set time stamp option, if applicable.
+	if tsaCAFile != "" {
+		b, err := ioutil.ReadFile(tsaCAFile)
+		if err != nil {
+			sylog.Fatalf("While reading time stamping authority certificates: %s", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(b) {
+			sylog.Fatalf("No certificate found in %s", tsaCAFile)
+		}
+		opts = append(opts, singularity.OptVerifyTimestamp(roots))
+	} else if verifyTSA {
+		opts = append(opts, singularity.OptVerifyTimestamp(nil))
+	}
+
 	// Set callback option.
 	if jsonVerify {
 		var kl keyList
@@ -1,4 +1,4 @@
-// Copyright (c) 2017-2020, Sylabs Inc. All rights reserved.
+// Copyright (c) 2017-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -61,7 +61,41 @@ Enterprise Performance Computing (EPC)`
       library://  an image library (default https://cloud.sylabs.io/library)
       docker://   a Docker/OCI registry (default Docker Hub)
       shub://     a Singularity registry (default Singularity Hub)
-      oras://     an OCI registry that holds SIF files using ORAS`
+      oras://     an OCI registry that holds SIF files using ORAS
+
+  STEP CACHE:
+
+  With the --step-cache option, the root filesystem of a definition file build
+  is stored in the image cache after the %files and %post sections. Later
+  builds restore it instead of running the bootstrap and these sections again,
+  as long as the header, the %setup, %files and %post sections, and the host
+  files copied by %files are unchanged. Cached steps can be removed with
+  'singularity cache clean --type build'.
+
+  MULTI-STAGE BUILDS:
+
+  Only the stages needed by the last stage of a multi-stage definition file,
+  through '%files from <stage>' sections, are built. The --target option
+  builds the named stage and the stages it needs instead. Stages which don't
+  depend on each other are built concurrently with the --jobs option.
+
+  REPRODUCIBLE BUILDS:
+
+  With the --reproducible option, or when the SOURCE_DATE_EPOCH environment
+  variable is set, building the same inputs gives identical images. File
+  modification times newer than SOURCE_DATE_EPOCH (or the Unix epoch if not
+  set) are clamped to it, the build date label and the SIF header and
+  descriptor times are set to it, and the SIF ID is derived from the image
+  content. SIF reproducible builds require squashfs-tools 4.4 or later.
+
+  SOFTWARE BILL OF MATERIALS:
+
+  After the %post section, the packages installed with dpkg, rpm, apk, pip
+  and conda are listed in an SPDX document, stored in the image as
+  /.singularity.d/sbom.spdx.json and as a SIF data object covered by
+  'singularity sign'. It is shown by 'singularity inspect --sbom', and is not
+  generated with the --no-sbom option. rpm packages are only listed if the
+  rpm command is installed on the host.`
 
 	BuildExample string = `
 
@@ -127,6 +161,10 @@ Enterprise Performance Computing (EPC)`
       %startscript
           echo "Define actions for container to perform when started as an instance."
 
+      %healthcheck
+          echo "Define a command run periodically inside a running instance to check"
+          echo "its health, a non-zero exit code marks the check as failed."
+
       %labels
           HELLO MOTO
           KEY VALUE
@@ -144,6 +182,24 @@ Enterprise Performance Computing (EPC)`
       %help
           This is a text file to be displayed with the run-help command.
 
+      %arguments
+          VERSION=1.0
+          HOST_DIR=/opt
+
+  BUILD ARGUMENTS:
+
+      {{ VARIABLE }} entries in the header and any section of a definition file
+      are replaced by the value of the VARIABLE build argument. Default values
+      are set in the %arguments section and can be overridden with the
+      --build-arg and --build-arg-file options. The resolved values are
+      recorded in the definition file embedded in the image.
+
+          Bootstrap: docker
+          From: alpine:{{ VERSION }}
+
+          %arguments
+              VERSION=3.14
+
   COMMANDS:
 
       Build a sif file from a Singularity recipe file:
@@ -155,7 +211,20 @@ Enterprise Performance Computing (EPC)`
       Build a base sandbox from DockerHub, make changes to it, then build sif
           $ singularity build --sandbox /tmp/debian docker://debian:latest
           $ singularity exec --writable /tmp/debian apt-get install python
-          $ singularity build /tmp/debian2.sif /tmp/debian`
+          $ singularity build /tmp/debian2.sif /tmp/debian
+
+      Rebuild a sif file reusing the cached %post section of a recipe file:
+          $ singularity build --step-cache /tmp/debian0.sif /path/to/debian.def
+
+      Build a sif file overriding build arguments of a recipe file:
+          $ singularity build --build-arg VERSION=3.15 /tmp/alpine.sif /path/to/alpine.def
+          $ singularity build --build-arg-file args.txt /tmp/alpine.sif /path/to/alpine.def
+
+      Build a reproducible sif file from a Singularity recipe file:
+          $ SOURCE_DATE_EPOCH=$(git log -1 --format=%ct) singularity build /tmp/debian0.sif /path/to/debian.def
+
+      Build the devel stage of a multi-stage recipe file, two stages at a time:
+          $ singularity build --jobs 2 --target devel /tmp/devel.sif /path/to/multistage.def`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// Cache
@@ -164,7 +233,13 @@ Enterprise Performance Computing (EPC)`
 	CacheShort string = `Manage the local cache`
 	CacheLong  string = `
   Manage your local Singularity cache. You can list/clean using the specific 
-  types.`
+  types.
+
+  The size of the cache can be limited with the SINGULARITY_CACHE_MAXSIZE
+  environment variable (e.g. 20G), and the size of individual cache types with
+  SINGULARITY_CACHE_QUOTA (e.g. library=10G,oci-tmp=5G). When a new entry would
+  exceed a limit, the least recently used entries are removed from the cache.
+  OCI blobs are accounted in the cache size but are not removed automatically.`
 	CacheExample string = `
   All group commands have their own help output:
 
@@ -181,7 +256,8 @@ Enterprise Performance Computing (EPC)`
   SINGULARITY_CACHEDIR is not set). By default the entire cache is cleaned, use
   --days and --type flags to override this behavior. Note: if you use Singularity
   as root, cache will be stored in '/root/.singularity/.cache', to clean that
-  cache, you will need to run 'cache clean' as root, or with 'sudo'.`
+  cache, you will need to run 'cache clean' as root, or with 'sudo'. Entries
+  being downloaded or used by another Singularity process are skipped.`
 	CacheCleanExample string = `
   All group commands have their own help output:
 
@@ -196,7 +272,9 @@ Enterprise Performance Computing (EPC)`
 	CacheListShort string = `List your local Singularity cache`
 	CacheListLong  string = `
   This will list your local cache (stored at $HOME/.singularity/cache if
-  SINGULARITY_CACHEDIR is not set).`
+  SINGULARITY_CACHEDIR is not set), along with the number of times images
+  were found in the cache (hits) or had to be downloaded (misses). With
+  --verbose, hits, misses and quotas are reported for each cache type.`
 	CacheListExample string = `
   All group commands have their own help output:
 
@@ -345,6 +423,49 @@ Enterprise Performance Computing (EPC)`
 	DeleteExample string = `
   $ singularity delete --arch=amd64 library://username/project/image:1.0`
 
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// diff
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	DiffUse   string = `diff [diff options...] <image1> <image2>`
+	DiffShort string = `Show the differences between two images`
+	DiffLong  string = `
+  The 'diff' command compares two SIF, squashfs or sandbox images. It lists
+  the files added (A), removed (D) and modified (M) in the second image, with
+  their type, mode, size or link target changes, and the differences between
+  the labels, environment, runscript and definition file of the images.
+
+  SIF and squashfs images are read directly, without being extracted or
+  mounted. File ownership and modification times are not compared.
+
+  Encrypted images can't be compared.`
+	DiffExample string = `
+  $ singularity diff old.sif new.sif
+  $ singularity diff my.sif my_sandbox/
+  $ singularity diff --json old.sif new.sif`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// cp
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	CpUse   string = `cp <image>:<path> <destination>`
+	CpShort string = `Copy a file or directory out of an image`
+	CpLong  string = `
+  The 'cp' command copies a file or directory from the root filesystem of a SIF
+  or squashfs image to the host. The image is read directly, without mounting
+  it, so neither privileges, squashfs-tools nor FUSE are required.
+
+  The path in the container must be absolute, symbolic links are resolved
+  inside the container. If the destination is an existing directory the file
+  is copied into it, otherwise the destination must not exist.
+
+  Directories are copied recursively with their symbolic links, hard links,
+  permissions and modification times. File ownership is not preserved, the
+  setuid and setgid bits are cleared, and device and socket files are skipped.
+
+  Encrypted images are not supported.`
+	CpExample string = `
+  $ singularity cp my.sif:/etc/os-release .
+  $ singularity cp my.sif:/opt/app ./app`
+
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// capability
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -483,6 +604,42 @@ Enterprise Performance Computing (EPC)`
   $ singularity exec instance://my_instance ps -ef
   $ singularity exec library://centos cat /etc/os-release`
 
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// export
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	ExportUse   string = `export [export options...] <image> <destination>`
+	ExportShort string = `Export an image to an OCI or Docker image archive`
+	ExportLong  string = `
+  The 'export' command converts a SIF or sandbox image into an OCI image, so
+  it can be used with Docker, Podman or other OCI tools. Supported
+  destinations include:
+
+  oci-archive:
+      oci-archive:path/to/archive.tar[:tag]
+
+  docker-archive:
+      docker-archive:path/to/archive.tar[:name:tag]
+
+  oci:
+      oci:path/to/layout[:tag]
+
+  The root filesystem of the image is exported as a single layer. The image
+  configuration is built from the image labels, environment and runscript,
+  which becomes the image entrypoint, and the definition file used to build
+  the image is stored in the 'org.sylabs.singularity.deffile' label.
+
+  Encrypted images can't be exported.`
+	ExportExample string = `
+  To an OCI archive
+  $ singularity export my.sif oci-archive:my.tar
+
+  To a Docker archive, loaded by docker
+  $ singularity export my.sif docker-archive:my.tar:my-image:latest
+  $ docker load -i my.tar
+
+  To an OCI image layout directory
+  $ singularity export my.sif oci:my-layout:latest`
+
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// instance
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -534,6 +691,17 @@ Enterprise Performance Computing (EPC)`
   will be executed with the instance start command as well. You can optionally
   pass arguments to startscript
 
+  The --restart option sets a restart policy for the instance: with
+  on-failure[:N] the instance is restarted when it exits with a non zero
+  status, up to N times if specified, and with always it is restarted
+  whatever its exit status, until it is stopped with instance stop. The
+  number of restarts is reported by instance list --json.
+
+  If the image was built with a %healthcheck section, or if the --health-cmd
+  option is set, the health check command is run inside the instance every
+  --health-interval. The instance becomes unhealthy after --health-retries
+  consecutive failed checks, its health status is shown by instance list.
+
   singularity instance start accepts the following container formats` + formats
 	InstanceStartExample string = `
   $ singularity instance start /tmp/my-sql.sif mysql
@@ -549,7 +717,11 @@ Enterprise Performance Computing (EPC)`
   Singularity my-sql.sif>
 
   $ singularity instance stop /tmp/my-sql.sif mysql
-  Stopping /tmp/my-sql.sif mysql`
+  Stopping /tmp/my-sql.sif mysql
+
+  $ singularity instance start --restart on-failure:5 /tmp/my-sql.sif mysql
+
+  $ singularity instance start --health-cmd "mysqladmin ping" --health-interval 10s /tmp/my-sql.sif mysql`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// instance stop
@@ -576,6 +748,51 @@ Enterprise Performance Computing (EPC)`
   $ singularity instance stop -s TERM mysql1
   $ singularity instance stop -s 15 mysql1`
 
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// instance stats
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	InstanceStatsUse   string = `stats [stats options...] [<instance name glob>]`
+	InstanceStatsShort string = `Display resource usage of running instances`
+	InstanceStatsLong  string = `
+  The instance stats command displays the CPU, memory, block I/O and process
+  usage of running instances, refreshed every second. Resource usage is read
+  from the cgroup of the instance, so it is only available for instances
+  started with cgroup limits (e.g. with --apply-cgroups or --memory), other
+  instances are displayed with '--' values. A CPU usage of 100% corresponds
+  to one fully used CPU.
+
+  With --json, the resource usage is printed as one JSON document per line
+  while streaming, or as a single indented JSON document with --no-stream.`
+	InstanceStatsExample string = `
+  $ sudo singularity instance start --apply-cgroups limits.toml my-sql.sif mysql
+  $ sudo singularity instance stats --no-stream
+  INSTANCE NAME    PID      CPU %    MEM USAGE / LIMIT        MEM %     BLOCK I/O               PIDS
+  mysql            23845    0.52%    180.34 MiB / 1.00 GiB    17.61%    12.40 MiB / 4.00 KiB    27
+
+  $ sudo singularity instance stats --json mysql`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// instance logs
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	InstanceLogsUse   string = `logs [logs options...] <instance name>`
+	InstanceLogsShort string = `Display the output of a running instance`
+	InstanceLogsLong  string = `
+  The instance logs command prints the standard output and error logs of a
+  running instance, to standard output and error respectively. Logs written
+  with the basic, kubernetes or json log formats are parsed to only print the
+  logged data, entries of both logs are then printed in chronological order.
+
+  Lines written without a log format (e.g. by an instance started with
+  'singularity instance start') don't record the time they were logged, they
+  are printed in the order they were written and are never discarded by
+  --since. With --follow, such lines are timestamped when they are read.`
+	InstanceLogsExample string = `
+  $ singularity instance start mysql.sif mysql
+  $ singularity instance logs --tail 20 mysql
+
+  Print new log entries of the last 10 minutes and keep following them:
+  $ singularity instance logs --since 10m --timestamps --follow mysql`
+
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// pull
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -627,6 +844,14 @@ Enterprise Performance Computing (EPC)`
   oras:
       oras://registry/namespace/repo:tag
 
+  docker:
+      docker://registry/namespace/repo:tag
+
+  Pushing to docker:// converts the root filesystem of a SIF or sandbox image
+  into an OCI image layer, with an image configuration built from the image
+  labels, environment and runscript, so it can be run by Docker, Podman or
+  Kubernetes.
+
 
   NOTE: It's always good practice to sign your containers before
   pushing them to the library. An auth token is required to push to the library,
@@ -636,7 +861,10 @@ Enterprise Performance Computing (EPC)`
   $ singularity push /home/user/my.sif library://user/collection/my.sif:latest
 
   To supported OCI registry
-  $ singularity push /home/user/my.sif oras://registry/namespace/image:tag`
+  $ singularity push /home/user/my.sif oras://registry/namespace/image:tag
+
+  To OCI registry as an OCI image
+  $ singularity push /home/user/my.sif docker://registry/namespace/image:tag`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// search
@@ -721,10 +949,27 @@ Enterprise Performance Computing (EPC)`
   The sign command allows a user to add one or more digital signatures to a SIF
   image. By default, one digital signature is added for each object group in
   the file.
+
+  With --tsa-url, an RFC 3161 time-stamp token is requested for each signature
+  from the time stamping authority (TSA) at the given URL, and stored in the
+  image alongside the signature. It proves the signature was made before the
+  time stamp, so that it can be trusted after the signing key expires or is
+  retired.
+
+  With --certificate and --key, signatures are made with an X.509 certificate
+  and its private key, read from PEM files, instead of a PGP key. Intermediate
+  certificates following the signing certificate in the --certificate file are
+  stored in the image to build its chain at verification.
   
   To generate a key pair, see 'singularity help key newpair'`
 	SignExample string = `
-  $ singularity sign container.sif`
+  $ singularity sign container.sif
+
+  Time stamp the signature:
+  $ singularity sign --tsa-url http://timestamp.example.com container.sif
+
+  Sign with an X.509 code signing certificate:
+  $ singularity sign --certificate signer.pem --key signer.key container.sif`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// verify
@@ -737,9 +982,34 @@ Enterprise Performance Computing (EPC)`
   multiple data objects signed. By default the command searches for the primary 
   partition signature. If found, a list of all verification blocks applied on 
   the primary partition is gathered so that data integrity (hashing) and 
-  signature verification is done for all those blocks.`
+  signature verification is done for all those blocks.
+
+  The revocation signatures and expiration of the signing keys, including keys
+  fetched from a key server, are checked at the creation time of the
+  signatures, and signatures made with expired or revoked keys fail
+  verification. A key superseded or retired remains valid for the signatures
+  made before its revocation. The status of the signing keys is reported in
+  the KeyStatus field of the --json output.
+
+  With --timestamp, the RFC 3161 time-stamp token stored alongside each
+  signature is verified, and the signing keys are checked at the time of the
+  time stamp instead of the creation time of the signature, which is set by
+  the signer. The time stamping authority must be
+  certified by the system root certificates, or by the certificates of the PEM
+  file given with --tsa-ca.
+
+  With --ca-bundle, the X.509 certificate signatures are verified instead of
+  the PGP signatures. The signing certificates must be valid for code signing,
+  and chain to a root certificate of the given PEM file. Certificates listed in
+  the revocation lists given with --crl fail verification.`
 	VerifyExample string = `
-  $ singularity verify container.sif`
+  $ singularity verify container.sif
+
+  Verify time stamps issued by a private time stamping authority:
+  $ singularity verify --tsa-ca tsa-root.pem container.sif
+
+  Verify X.509 certificate signatures, and check certificate revocation:
+  $ singularity verify --ca-bundle ca.pem --crl ca.crl container.sif`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// Run-help
@@ -782,9 +1052,11 @@ Enterprise Performance Computing (EPC)`
   Inspect will show you labels, environment variables, apps and scripts associated 
   with the image determined by the flags you pass. By default, they will be shown in 
   plain text. If you would like to list them in json format, you should use the --json flag.
+  The --sbom flag prints the SPDX software bill of materials generated at build time.
   `
 	InspectExample string = `
   $ singularity inspect ubuntu.sif
+  $ singularity inspect --sbom ubuntu.sif
   
   If you want to list the applications (apps) installed in a container (located at
   /scif/apps) you should run inspect command with --list-apps <container-image> flag.
@@ -975,18 +1247,25 @@ Enterprise Performance Computing (EPC)`
 	OciResumeExample string = `
   $ singularity oci resume mycontainer`
 
-	OciMountUse   string = `mount <sif_image> <bundle_path>`
-	OciMountShort string = `Mount create an OCI bundle from SIF image (root user only)`
+	OciMountUse   string = `mount <image> <bundle_path>`
+	OciMountShort string = `Mount create an OCI bundle from an image (root user only)`
 	OciMountLong  string = `
-  Mount will mount and create an OCI bundle from a SIF image.`
+  Mount will mount and create an OCI bundle from a SIF image.
+
+  It also creates an OCI bundle from an OCI image referenced with a
+  docker://, oci: or oci-archive: URI. The image layers are unpacked in
+  the bundle root filesystem and the image entrypoint, command, environment,
+  working directory and volumes are set in the bundle configuration.`
 	OciMountExample string = `
-  $ singularity oci mount /tmp/example.sif /var/lib/singularity/bundles/example`
+  $ singularity oci mount /tmp/example.sif /var/lib/singularity/bundles/example
+  $ singularity oci mount docker://alpine /var/lib/singularity/bundles/alpine
+  $ singularity oci mount oci-archive:/tmp/alpine.tar /var/lib/singularity/bundles/alpine`
 
 	OciUmountUse   string = `umount <bundle_path>`
 	OciUmountShort string = `Umount delete bundle (root user only)`
 	OciUmountLong  string = `
   Umount will umount an OCI bundle previously mounted with singularity oci 
-  mount.`
+  mount, or remove the root filesystem unpacked from an OCI image.`
 	OciUmountExample string = `
   $ singularity oci umount /var/lib/singularity/bundles/example`
 
@@ -1061,4 +1340,40 @@ Enterprise Performance Computing (EPC)`
 
   To create a single EXT3 writable overlay image:
   $ singularity overlay create --size 1024 /tmp/my_overlay.img`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// ecl
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	EclUse   string = `ecl`
+	EclShort string = `Manage the execution control list (ECL)`
+	EclLong  string = `
+  The ecl command allows to check images against the execution control list
+  (ECL), which restricts the SIF images allowed to run, as configured in
+  ecl.toml.`
+	EclExample string = `
+  All ecl commands have their own help output:
+
+  $ singularity help ecl check
+  $ singularity ecl check --help`
+
+	EclCheckUse   string = `check [check options...] <image path>`
+	EclCheckShort string = `Explain whether an image is allowed to run by the ECL`
+	EclCheckLong  string = `
+  The ecl check command evaluates a SIF image against the execution control list
+  (ECL) as done when running it, even if the ECL is not activated, and explains
+  the decision.
+
+  With execgroups, the execgroup of the image and the result of its signature
+  check are shown. With rules, each rule evaluated in order is shown, along
+  with the criteria it matched or the first criterion it did not match. The
+  first matching rule applies, and the default action applies to images
+  matching no rule. Rules can match images by directory, SHA256 digest, label
+  values, signing key fingerprints and signer user ID or email patterns.
+
+  The command exits with an error if the image is denied.`
+	EclCheckExample string = `
+  $ singularity ecl check container.sif
+
+  Check an image against an ECL configuration before installing it:
+  $ singularity ecl check --config ./ecl.toml container.sif`
 )
@@ -1,4 +1,4 @@
-// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// Copyright (c) 2019-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -80,7 +80,11 @@ func (c ctx) testCommands(t *testing.T) {
 		{"Build", "build"},
 		{"Cache", "cache"},
 		{"Capability", "capability"},
+		{"Cp", "cp"},
+		{"Diff", "diff"},
+		{"ECL", "ecl"},
 		{"Exec", "exec"},
+		{"Export", "export"},
 		{"Instance", "instance"},
 		{"Key", "key"},
 		{"OCI", "oci"},
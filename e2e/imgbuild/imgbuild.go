@@ -1414,6 +1414,173 @@ func (c imgBuildTests) testWritableTmpfs(t *testing.T) {
 	)
 }
 
+// buildArguments checks that build arguments are substituted in the definition file
+func (c imgBuildTests) buildArguments(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	tmpdir, cleanup := c.tempDir(t, "build-arguments-test")
+	defer cleanup()
+
+	definition := "Bootstrap: localimage\nFrom: {{ IMAGE }}\n\n%arguments\n    GREETING=hello\n\n%post\n    echo {{ GREETING }} > /greeting\n"
+	defFile := e2e.RawDefFile(t, tmpdir, strings.NewReader(definition))
+	defer os.Remove(defFile)
+
+	argFile := e2e.RawDefFile(t, tmpdir, strings.NewReader("# build arguments\nGREETING=bonjour\n"))
+	defer os.Remove(argFile)
+
+	tests := []struct {
+		name     string
+		args     []string
+		greeting string
+		exit     int
+	}{
+		{
+			name:     "Default",
+			args:     []string{"--build-arg", "IMAGE=" + c.env.ImagePath},
+			greeting: "hello",
+		},
+		{
+			name:     "BuildArg",
+			args:     []string{"--build-arg", "IMAGE=" + c.env.ImagePath, "--build-arg", "GREETING=world"},
+			greeting: "world",
+		},
+		{
+			name:     "BuildArgFile",
+			args:     []string{"--build-arg-file", argFile, "--build-arg", "IMAGE=" + c.env.ImagePath},
+			greeting: "bonjour",
+		},
+		{
+			name: "MissingValue",
+			exit: 255,
+		},
+	}
+
+	for _, tt := range tests {
+		imagePath := filepath.Join(tmpdir, "image-"+tt.name)
+		args := append([]string{"-F"}, tt.args...)
+		args = append(args, imagePath, defFile)
+
+		if tt.exit != 0 {
+			c.env.RunSingularity(
+				t,
+				e2e.AsSubtest(tt.name),
+				e2e.WithProfile(e2e.RootProfile),
+				e2e.WithCommand("build"),
+				e2e.WithArgs(args...),
+				e2e.ExpectExit(tt.exit,
+					e2e.ExpectError(e2e.ContainMatch, "build argument(s) without value: IMAGE"),
+				),
+			)
+			continue
+		}
+
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.RootProfile),
+			e2e.WithCommand("build"),
+			e2e.WithArgs(args...),
+			e2e.PostRun(func(t *testing.T) {
+				if t.Failed() {
+					return
+				}
+				c.env.RunSingularity(
+					t,
+					e2e.WithProfile(e2e.UserProfile),
+					e2e.WithCommand("exec"),
+					e2e.WithArgs(imagePath, "cat", "/greeting"),
+					e2e.ExpectExit(0,
+						e2e.ExpectOutput(e2e.ExactMatch, tt.greeting),
+					),
+				)
+				c.env.RunSingularity(
+					t,
+					e2e.WithProfile(e2e.UserProfile),
+					e2e.WithCommand("inspect"),
+					e2e.WithArgs("--deffile", imagePath),
+					e2e.ExpectExit(0,
+						e2e.ExpectOutput(e2e.ContainMatch, "GREETING="+tt.greeting),
+					),
+				)
+			}),
+			e2e.ExpectExit(0),
+		)
+	}
+}
+
+// buildStepCache checks that the %post section isn't run again when rebuilding
+// with the step cache and an unchanged %post section
+func (c imgBuildTests) buildStepCache(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	tmpdir, cleanup := c.tempDir(t, "build-step-cache-test")
+	defer cleanup()
+
+	imgCacheDir, cleanCache := e2e.MakeCacheDir(t, c.env.TestDir)
+	defer cleanCache(t)
+	c.env.ImgCacheDir = imgCacheDir
+
+	post := "%post\n    cat /proc/sys/kernel/random/uuid > /post-run\n"
+
+	tests := []struct {
+		name       string
+		definition string
+		cached     bool
+	}{
+		{
+			name:       "FirstBuild",
+			definition: "Bootstrap: localimage\nFrom: %[1]s\n\n" + post + "\n%%runscript\n    echo first\n",
+		},
+		{
+			name:       "ChangedRunscript",
+			definition: "Bootstrap: localimage\nFrom: %[1]s\n\n" + post + "\n%%runscript\n    echo second\n",
+			cached:     true,
+		},
+		{
+			name:       "ChangedPost",
+			definition: "Bootstrap: localimage\nFrom: %[1]s\n\n" + post + "    true\n\n%%runscript\n    echo second\n",
+		},
+	}
+
+	var lastRun string
+
+	for _, tt := range tests {
+		definition := fmt.Sprintf(tt.definition, c.env.ImagePath)
+		defFile := e2e.RawDefFile(t, tmpdir, strings.NewReader(definition))
+		imagePath := filepath.Join(tmpdir, "image-"+tt.name)
+
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.RootProfile),
+			e2e.WithCommand("build"),
+			e2e.WithArgs("-F", "--step-cache", imagePath, defFile),
+			e2e.PostRun(func(t *testing.T) {
+				os.Remove(defFile)
+				if t.Failed() {
+					return
+				}
+
+				var postRun, stderr string
+				c.env.RunSingularity(
+					t,
+					e2e.WithProfile(e2e.UserProfile),
+					e2e.WithCommand("exec"),
+					e2e.WithArgs(imagePath, "cat", "/post-run"),
+					e2e.ExpectExit(0, e2e.GetStreams(&postRun, &stderr)),
+				)
+				if tt.cached && postRun != lastRun {
+					t.Errorf("%%post section was run while cached")
+				} else if !tt.cached && postRun == lastRun {
+					t.Errorf("%%post section was not run")
+				}
+				lastRun = postRun
+			}),
+			e2e.ExpectExit(0),
+		)
+	}
+}
+
 // E2ETests is the main func to trigger the test suite
 func E2ETests(env e2e.TestEnv) testhelper.Tests {
 	c := imgBuildTests{
@@ -1434,6 +1601,8 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 		"build with bind mount":           c.buildBindMount,            // build image with bind mount
 		"library host":                    c.buildLibraryHost,          // build image with hostname in library URI
 		"test with writable tmpfs":        c.testWritableTmpfs,         // build image, using writable tmpfs in the test step
+		"build arguments":                 c.buildArguments,            // build image with build arguments
+		"build step cache":                c.buildStepCache,            // rebuild image with cached build steps
 		"issue 3848":                      c.issue3848,                 // https://github.com/hpcng/singularity/issues/3848
 		"issue 4203":                      c.issue4203,                 // https://github.com/hpcng/singularity/issues/4203
 		"issue 4407":                      c.issue4407,                 // https://github.com/hpcng/singularity/issues/4407
@@ -15,6 +15,7 @@ import (
 	"strings"
 	"syscall"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/hpcng/singularity/e2e/internal/e2e"
@@ -344,6 +345,188 @@ func (c *ctx) applyCgroupsInstance(t *testing.T) {
 	)
 }
 
+func (c *ctx) instanceStats(t *testing.T) {
+	require.Cgroups(t)
+
+	if !c.profile.In(e2e.RootProfile) {
+		t.Skipf("%s requires %s profile, current profile: %s", t.Name(), e2e.RootProfile, c.profile)
+	}
+
+	// pick up a random name
+	instanceName := randomName(t)
+
+	c.env.RunSingularity(
+		t,
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs("--apply-cgroups", "testdata/cgroups/memory_limit.toml", c.env.ImagePath, instanceName),
+		e2e.ExpectExit(0),
+	)
+	defer c.stopInstance(t, instanceName)
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("table"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance stats"),
+		e2e.WithArgs("--no-stream", instanceName),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectOutput(e2e.ContainMatch, "MEM USAGE / LIMIT"),
+			e2e.ExpectOutput(e2e.ContainMatch, "/ 512.00 MiB"),
+		),
+	)
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("json"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance stats"),
+		e2e.WithArgs("--no-stream", "--json", instanceName),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectOutput(e2e.ContainMatch, `"limit": 536870912`),
+		),
+	)
+}
+
+func (c *ctx) resourceLimitsInstance(t *testing.T) {
+	require.Cgroups(t)
+
+	// pick up a random name
+	instanceName := randomName(t)
+
+	if !c.profile.In(e2e.RootProfile) {
+		c.env.RunSingularity(
+			t,
+			e2e.WithProfile(c.profile),
+			e2e.WithCommand("instance start"),
+			e2e.WithArgs("--memory", "512M", c.env.ImagePath, instanceName),
+			e2e.ExpectExit(
+				255,
+				e2e.ExpectError(e2e.ContainMatch, "require root privileges"),
+			),
+		)
+		return
+	}
+
+	c.env.RunSingularity(
+		t,
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs("--memory", "512M", "--pids-limit", "100", c.env.ImagePath, instanceName),
+		e2e.ExpectExit(0),
+	)
+	defer c.stopInstance(t, instanceName)
+
+	c.env.RunSingularity(
+		t,
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance stats"),
+		e2e.WithArgs("--no-stream", "--json", instanceName),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectOutput(e2e.ContainMatch, `"limit": 536870912`),
+			e2e.ExpectOutput(e2e.ContainMatch, `"limit": 100`),
+		),
+	)
+}
+
+func (c *ctx) restartInstance(t *testing.T) {
+	// pick up a random name
+	instanceName := randomName(t)
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("InvalidPolicy"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs("--restart", "sometimes", c.env.ImagePath, instanceName),
+		e2e.ExpectExit(
+			255,
+			e2e.ExpectError(e2e.ContainMatch, "unknown restart policy"),
+		),
+	)
+
+	c.env.RunSingularity(
+		t,
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs("--restart", "always", c.env.ImagePath, instanceName),
+		e2e.ExpectExit(0),
+	)
+	defer c.stopInstance(t, instanceName)
+
+	inst := c.getInstance(t, instanceName)
+	if inst == nil {
+		t.Fatalf("instance %s not found", instanceName)
+	}
+
+	if err := syscall.Kill(inst.Pid, syscall.SIGKILL); err != nil {
+		t.Fatalf("failed to send KILL signal to %d: %s", inst.Pid, err)
+	}
+
+	// wait for the supervisor to restart the instance
+	for i := 0; i < 50; i++ {
+		time.Sleep(200 * time.Millisecond)
+
+		restarted := c.getInstance(t, instanceName)
+		if restarted != nil && restarted.Restarts == 1 {
+			if restarted.Pid == inst.Pid {
+				t.Errorf("restarted instance has the same PID %d", inst.Pid)
+			}
+			return
+		}
+	}
+	t.Errorf("instance %s was not restarted", instanceName)
+}
+
+func (c *ctx) healthCheckInstance(t *testing.T) {
+	tests := []struct {
+		name     string
+		cmd      string
+		expected string
+	}{
+		{"Healthy", "true", "healthy"},
+		{"Unhealthy", "false", "unhealthy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// pick up a random name
+			instanceName := randomName(t)
+
+			c.env.RunSingularity(
+				t,
+				e2e.WithProfile(c.profile),
+				e2e.WithCommand("instance start"),
+				e2e.WithArgs(
+					"--health-cmd", tt.cmd,
+					"--health-interval", "1s",
+					"--health-retries", "1",
+					c.env.ImagePath, instanceName,
+				),
+				e2e.ExpectExit(0),
+			)
+			defer c.stopInstance(t, instanceName)
+
+			// wait for the first health checks
+			for i := 0; i < 50; i++ {
+				time.Sleep(200 * time.Millisecond)
+
+				inst := c.getInstance(t, instanceName)
+				if inst == nil {
+					t.Fatalf("instance %s not found", instanceName)
+				}
+				if inst.Health == tt.expected {
+					return
+				}
+			}
+			t.Errorf("instance %s health status is not %s", instanceName, tt.expected)
+		})
+	}
+}
+
 // E2ETests is the main func to trigger the test suite
 func E2ETests(env e2e.TestEnv) testhelper.Tests {
 	c := &ctx{
@@ -372,6 +555,10 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 				{"StopAll", c.testStopAll},
 				{"GhostInstance", c.testGhostInstance},
 				{"ApplyCgroupsInstance", c.applyCgroupsInstance},
+				{"InstanceStats", c.instanceStats},
+				{"ResourceLimitsInstance", c.resourceLimitsInstance},
+				{"RestartInstance", c.restartInstance},
+				{"HealthCheckInstance", c.healthCheckInstance},
 			}
 
 			profiles := []e2e.Profile{
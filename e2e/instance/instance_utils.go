@@ -1,4 +1,4 @@
-// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// Copyright (c) 2019-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -23,6 +23,8 @@ type instance struct {
 	Image    string `json:"img"`
 	Instance string `json:"instance"`
 	Pid      int    `json:"pid"`
+	Restarts int    `json:"restarts"`
+	Health   string `json:"health"`
 }
 
 type instanceList struct {
@@ -109,6 +111,30 @@ func (c *ctx) expectInstance(t *testing.T, name string, nb int) {
 	)
 }
 
+// Returns the instance with the provided name, if any.
+func (c *ctx) getInstance(t *testing.T, name string) (inst *instance) {
+	getInstanceFn := func(t *testing.T, r *e2e.SingularityCmdResult) {
+		var instances instanceList
+
+		if err := json.Unmarshal([]byte(r.Stdout), &instances); err != nil {
+			t.Errorf("Error while decoding JSON from 'instance list': %v", err)
+		}
+		if len(instances.Instances) == 1 {
+			inst = &instances.Instances[0]
+		}
+	}
+
+	c.env.RunSingularity(
+		t,
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance list"),
+		e2e.WithArgs([]string{"--json", name}...),
+		e2e.ExpectExit(0, getInstanceFn),
+	)
+
+	return
+}
+
 // Sends a deterministic message to an echo server and expects the same message
 // in response.
 func echo(t *testing.T, port int) {
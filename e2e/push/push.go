@@ -3,7 +3,7 @@
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
 
-// Package push tests only test the oras transport (and a invalid transport) against a local registry
+// Package push tests only test the oras and docker transports (and a invalid transport) against a local registry
 package push
 
 import (
@@ -131,6 +131,47 @@ func (c ctx) testPushCmd(t *testing.T) {
 	}
 }
 
+func (c ctx) testPushDockerCmd(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	e2e.EnsureRegistry(t)
+
+	tmpdir, err := ioutil.TempDir(c.env.TestDir, "docker_push_test.")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory for docker push test: %+v", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	dstURI := fmt.Sprintf("docker://%s/oci_push:test", c.env.TestRegistry)
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("push SIF"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("push"),
+		e2e.WithArgs("--no-https", c.env.ImagePath, dstURI),
+		e2e.ExpectExit(0),
+	)
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("pull pushed image"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("pull"),
+		e2e.WithArgs("--no-https", filepath.Join(tmpdir, "oci_push.sif"), dstURI),
+		e2e.ExpectExit(0),
+	)
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("run pulled image"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs(filepath.Join(tmpdir, "oci_push.sif"), "true"),
+		e2e.ExpectExit(0),
+	)
+}
+
 // E2ETests is the main func to trigger the test suite
 func E2ETests(env e2e.TestEnv) testhelper.Tests {
 	c := ctx{
@@ -140,5 +181,6 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 	return testhelper.Tests{
 		"invalid transport": c.testInvalidTransport,
 		"oras":              c.testPushCmd,
+		"docker":            c.testPushDockerCmd,
 	}
 }
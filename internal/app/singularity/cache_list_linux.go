@@ -1,4 +1,4 @@
-// Copyright (c) 2018-2020, Sylabs Inc. All rights reserved.
+// Copyright (c) 2018-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -72,6 +72,12 @@ func ListSingularityCache(imgCache *cache.Handle, cacheListTypes []string, cache
 	containersShown := false
 	blobsShown := false
 
+	var hits, misses uint64
+	stats, err := imgCache.Stats()
+	if err != nil {
+		return err
+	}
+
 	// If types requested includes "all" then we don't want to filter anything
 	if slice.ContainsString(cacheListTypes, "all") {
 		cacheListTypes = []string{}
@@ -116,6 +122,8 @@ func ListSingularityCache(imgCache *cache.Handle, cacheListTypes []string, cache
 		containerSpace += size
 		totalSpace += size
 		containersShown = true
+		hits += stats[cacheType].Hits
+		misses += stats[cacheType].Misses
 	}
 
 	if cacheListVerbose {
@@ -137,6 +145,34 @@ func ListSingularityCache(imgCache *cache.Handle, cacheListTypes []string, cache
 
 	fmt.Print(out.String())
 	fmt.Printf("Total space used: %s\n", fs.FindSize(totalSpace))
+	if maxSize := imgCache.MaxSize(); maxSize > 0 {
+		fmt.Printf("Maximum cache size: %s\n", fs.FindSize(maxSize))
+	}
+
+	if containersShown {
+		fmt.Printf("Cache hits: %d, misses: %d%s\n", hits, misses, hitRatio(hits, misses))
+	}
+	if cacheListVerbose && containersShown {
+		fmt.Printf("\n%-10s %-10s %-10s %s\n", "TYPE", "HITS", "MISSES", "QUOTA")
+		for _, cacheType := range cache.FileCacheTypes {
+			if len(cacheListTypes) > 0 && !slice.ContainsString(cacheListTypes, cacheType) {
+				continue
+			}
+			quota := "-"
+			if q := imgCache.Quota(cacheType); q > 0 {
+				quota = fs.FindSize(q)
+			}
+			fmt.Printf("%-10s %-10d %-10d %s\n", cacheType, stats[cacheType].Hits, stats[cacheType].Misses, quota)
+		}
+	}
 
 	return nil
 }
+
+// hitRatio returns the percentage of cache hits formatted for display.
+func hitRatio(hits, misses uint64) string {
+	if hits+misses == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%.1f%% hit ratio)", float64(hits)*100/float64(hits+misses))
+}
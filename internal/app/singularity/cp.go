@@ -0,0 +1,67 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/hpcng/singularity/internal/pkg/image/squashfs"
+	"github.com/hpcng/singularity/pkg/image"
+	"github.com/hpcng/singularity/pkg/sylog"
+)
+
+// parseCopySource returns the image path and the absolute path within the
+// container of a copy source in the image:path format.
+func parseCopySource(src string) (string, string, error) {
+	split := strings.SplitN(src, ":", 2)
+	if len(split) != 2 || split[0] == "" || !path.IsAbs(split[1]) {
+		return "", "", fmt.Errorf("invalid source %q, the format is <image>:<absolute path>", src)
+	}
+	return split[0], path.Clean(split[1]), nil
+}
+
+// Copy copies the file or directory src, in the image:path format, from a
+// SIF or squashfs image to the host path dest. If dest is an existing
+// directory the file is copied into it, otherwise dest must not exist. The
+// root filesystem is read directly from the image, without mounting it.
+func Copy(src, dest string) error {
+	imagePath, name, err := parseCopySource(src)
+	if err != nil {
+		return err
+	}
+
+	img, err := image.Init(imagePath, false)
+	if err != nil {
+		return fmt.Errorf("could not open image %s: %s", imagePath, err)
+	}
+	defer img.File.Close()
+
+	if img.Type == image.SANDBOX {
+		return fmt.Errorf("%s is a sandbox image, its files can be copied directly from the host", imagePath)
+	}
+
+	fsys, err := squashfs.FromImage(img)
+	if err != nil {
+		return fmt.Errorf("while reading %s: %s", imagePath, err)
+	}
+
+	if fi, err := os.Stat(dest); err == nil && fi.IsDir() && name != "/" {
+		dest = filepath.Join(dest, path.Base(name))
+	}
+
+	sylog.Debugf("Copying %s from %s to %s", name, imagePath, dest)
+
+	// paths of the filesystem are relative to the container root
+	rel := strings.TrimPrefix(name, "/")
+	if rel == "" {
+		rel = "."
+	}
+	return fsys.Extract(rel, dest)
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"testing"
+)
+
+func TestParseCopySource(t *testing.T) {
+	tests := []struct {
+		name        string
+		src         string
+		expectImage string
+		expectPath  string
+		expectError bool
+	}{
+		{name: "File", src: "my.sif:/etc/os-release", expectImage: "my.sif", expectPath: "/etc/os-release"},
+		{name: "Root", src: "my.sif:/", expectImage: "my.sif", expectPath: "/"},
+		{name: "Clean", src: "dir/my.sif:/opt//app/", expectImage: "dir/my.sif", expectPath: "/opt/app"},
+		{name: "PathColon", src: "my.sif:/opt/a:b", expectImage: "my.sif", expectPath: "/opt/a:b"},
+		{name: "NoPath", src: "my.sif", expectError: true},
+		{name: "RelativePath", src: "my.sif:etc/os-release", expectError: true},
+		{name: "NoImage", src: ":/etc/os-release", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image, path, err := parseCopySource(tt.src)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("unexpected success for %s", tt.src)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error for %s: %s", tt.src, err)
+			}
+			if image != tt.expectImage || path != tt.expectPath {
+				t.Errorf("unexpected source %s:%s, expected %s:%s", image, path, tt.expectImage, tt.expectPath)
+			}
+		})
+	}
+}
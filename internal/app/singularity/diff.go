@@ -0,0 +1,120 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/hpcng/singularity/internal/pkg/image/squashfs"
+	"github.com/hpcng/singularity/internal/pkg/imgdiff"
+	"github.com/hpcng/singularity/internal/pkg/ocisif"
+	"github.com/hpcng/singularity/pkg/image"
+	"github.com/hpcng/singularity/pkg/inspect"
+)
+
+// diffRootfs returns the root filesystem of the SIF, squashfs or sandbox
+// image img. The root filesystem of SIF and squashfs images is read
+// directly from the image file, which must stay open while it is used.
+func diffRootfs(img *image.Image) (imgdiff.FS, error) {
+	if img.Type == image.SANDBOX {
+		return imgdiff.Dir(img.Path), nil
+	}
+	return squashfs.FromImage(img)
+}
+
+// Diff compares the root filesystems and the metadata of the images
+// located at pathA and pathB, and writes the differences to w, in JSON
+// format if jsonFmt is set.
+func Diff(pathA, pathB string, jsonFmt bool, w io.Writer) error {
+	var roots [2]imgdiff.FS
+	var metadata [2]*inspect.Metadata
+
+	for i, path := range []string{pathA, pathB} {
+		img, err := image.Init(path, false)
+		if err != nil {
+			return fmt.Errorf("could not open image %s: %s", path, err)
+		}
+		defer img.File.Close()
+
+		roots[i], err = diffRootfs(img)
+		if err != nil {
+			return fmt.Errorf("while reading %s: %s", path, err)
+		}
+
+		metadata[i], err = ocisif.RootfsMetadata(roots[i])
+		if err != nil {
+			return fmt.Errorf("while reading metadata of %s: %s", path, err)
+		}
+	}
+
+	files, err := imgdiff.Files(roots[0], roots[1])
+	if err != nil {
+		return err
+	}
+
+	d := imgdiff.Diff{
+		Files:    files,
+		Metadata: imgdiff.MetadataChanges(metadata[0], metadata[1]),
+	}
+
+	if jsonFmt {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		return enc.Encode(d)
+	}
+
+	return writeDiff(w, d)
+}
+
+// diffMarks are the marks of the changes in the text output.
+var diffMarks = map[imgdiff.Kind]string{
+	imgdiff.Added:    "A",
+	imgdiff.Removed:  "D",
+	imgdiff.Modified: "M",
+}
+
+// writeDiff writes the differences d to w, one change per line.
+func writeDiff(w io.Writer, d imgdiff.Diff) error {
+	if len(d.Files) == 0 && len(d.Metadata) == 0 {
+		_, err := fmt.Fprintln(w, "No differences found")
+		return err
+	}
+
+	for _, c := range d.Files {
+		line := fmt.Sprintf("%s %s", diffMarks[c.Kind], c.Path)
+		if details := c.Details(); details != "" {
+			line += " (" + details + ")"
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+
+	for _, c := range d.Metadata {
+		line := fmt.Sprintf("%s %s", diffMarks[c.Kind], c.Field)
+		if c.Key != "" {
+			line += " " + c.Key
+		}
+		// labels are single line values, so they are shown inline
+		if c.Field == imgdiff.FieldLabel {
+			switch c.Kind {
+			case imgdiff.Added:
+				line += fmt.Sprintf(": %q", c.New)
+			case imgdiff.Removed:
+				line += fmt.Sprintf(": %q", c.Old)
+			default:
+				line += fmt.Sprintf(": %q -> %q", c.Old, c.New)
+			}
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+
+	"github.com/hpcng/singularity/internal/pkg/buildcfg"
+	"github.com/hpcng/singularity/internal/pkg/syecl"
+	"github.com/hpcng/singularity/pkg/image"
+	"github.com/hpcng/singularity/pkg/sypgp"
+)
+
+// EclCheck evaluates the SIF image at path against the execution control
+// list configuration file confPath, with the global keyring, as done when
+// running the image. The image is evaluated even if the ECL is not
+// activated, which is reported by the returned configuration.
+func EclCheck(confPath, path string) (*syecl.EclConfig, *syecl.Decision, error) {
+	ecl, err := syecl.LoadConfig(confPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("while loading ECL configuration: %s", err)
+	}
+	if err := ecl.ValidateConfig(); err != nil {
+		return nil, nil, fmt.Errorf("while validating ECL configuration: %s", err)
+	}
+
+	img, err := image.Init(path, false)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not open image %s: %s", path, err)
+	}
+	defer img.File.Close()
+
+	if img.Type != image.SIF {
+		return nil, nil, fmt.Errorf("%s is not a SIF image, the ECL only applies to SIF images", path)
+	}
+
+	keyring := sypgp.NewHandle(buildcfg.SINGULARITY_CONFDIR, sypgp.GlobalHandleOpt())
+	kr, err := keyring.LoadPubKeyring()
+	if err != nil {
+		return nil, nil, fmt.Errorf("while obtaining keyring for ECL: %s", err)
+	}
+
+	d, err := ecl.Check(img.File, kr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("while checking image with ECL: %s", err)
+	}
+	return &ecl, d, nil
+}
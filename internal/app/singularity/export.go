@@ -0,0 +1,84 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/containers/image/v5/copy"
+	dockerarchive "github.com/containers/image/v5/docker/archive"
+	ociarchive "github.com/containers/image/v5/oci/archive"
+	ocilayout "github.com/containers/image/v5/oci/layout"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/types"
+	"github.com/hpcng/singularity/internal/pkg/ocisif"
+	"github.com/hpcng/singularity/pkg/sylog"
+)
+
+// exportTransports are the supported export destination transports.
+var exportTransports = map[string]func(string) (types.ImageReference, error){
+	"oci-archive":    ociarchive.ParseReference,
+	"docker-archive": dockerarchive.ParseReference,
+	"oci":            ocilayout.ParseReference,
+}
+
+// parseExportDestination returns the image reference of an export
+// destination in the transport:path[:reference] format.
+func parseExportDestination(dest string) (types.ImageReference, error) {
+	split := strings.SplitN(dest, ":", 2)
+	if len(split) != 2 || split[1] == "" {
+		return nil, fmt.Errorf("invalid destination %q, the format is <transport>:<path>", dest)
+	}
+
+	parse, ok := exportTransports[split[0]]
+	if !ok {
+		return nil, fmt.Errorf("unsupported destination transport %q, supported transports are oci-archive, docker-archive and oci", split[0])
+	}
+
+	ref, err := parse(split[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid destination %s: %s", dest, err)
+	}
+	return ref, nil
+}
+
+// Export converts the SIF or sandbox image imagePath into an OCI image and
+// writes it to dest, an oci-archive:, docker-archive: or oci: destination.
+func Export(ctx context.Context, imagePath, dest, tmpDir string) error {
+	destRef, err := parseExportDestination(dest)
+	if err != nil {
+		return err
+	}
+
+	img, err := ocisif.Convert(imagePath, tmpDir)
+	if err != nil {
+		return fmt.Errorf("while converting %s to an OCI image: %s", imagePath, err)
+	}
+	defer img.Close()
+
+	policy := &signature.Policy{Default: []signature.PolicyRequirement{signature.NewPRInsecureAcceptAnything()}}
+	policyCtx, err := signature.NewPolicyContext(policy)
+	if err != nil {
+		return err
+	}
+	defer policyCtx.Destroy()
+
+	sylog.Infof("Exporting OCI image to %s", dest)
+
+	_, err = copy.Image(ctx, policyCtx, destRef, img.Reference, &copy.Options{
+		ReportWriter: sylog.Writer(),
+		DestinationCtx: &types.SystemContext{
+			BigFilesTemporaryDir: tmpDir,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to export image: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"testing"
+)
+
+func TestParseExportDestination(t *testing.T) {
+	tests := []struct {
+		name            string
+		dest            string
+		expectTransport string
+		expectError     bool
+	}{
+		{name: "OCIArchive", dest: "oci-archive:out.tar", expectTransport: "oci-archive"},
+		{name: "OCIArchiveTag", dest: "oci-archive:out.tar:v1", expectTransport: "oci-archive"},
+		{name: "DockerArchive", dest: "docker-archive:out.tar", expectTransport: "docker-archive"},
+		{name: "DockerArchiveName", dest: "docker-archive:out.tar:image:v1", expectTransport: "docker-archive"},
+		{name: "OCILayout", dest: "oci:layout:latest", expectTransport: "oci"},
+		{name: "NoTransport", dest: "out.tar", expectError: true},
+		{name: "NoPath", dest: "oci-archive:", expectError: true},
+		{name: "Docker", dest: "docker://alpine", expectError: true},
+		{name: "Unsupported", dest: "docker-daemon:alpine:latest", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref, err := parseExportDestination(tt.dest)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("unexpected success for %s", tt.dest)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error for %s: %s", tt.dest, err)
+			}
+			if name := ref.Transport().Name(); name != tt.expectTransport {
+				t.Errorf("unexpected transport %s, expected %s", name, tt.expectTransport)
+			}
+		})
+	}
+}
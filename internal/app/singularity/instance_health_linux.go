@@ -0,0 +1,125 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/hpcng/singularity/internal/pkg/instance"
+	"github.com/hpcng/singularity/pkg/image"
+	"github.com/hpcng/singularity/pkg/inspect"
+	"github.com/hpcng/singularity/pkg/sylog"
+)
+
+// ImageHasHealthcheck returns whether the image at path was built with a
+// %healthcheck section. Only SIF images with inspect metadata and sandbox
+// images can be checked, it returns false for other image formats.
+func ImageHasHealthcheck(path string) (bool, error) {
+	img, err := image.Init(path, false)
+	if err != nil {
+		return false, fmt.Errorf("could not open image %s: %v", path, err)
+	}
+	defer img.File.Close()
+
+	switch img.Type {
+	case image.SIF:
+		r, err := image.NewSectionReader(img, image.SIFDescInspectMetadataJSON, -1)
+		if err == image.ErrNoSection {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		metadata := new(inspect.Metadata)
+		if err := json.NewDecoder(r).Decode(metadata); err != nil {
+			return false, fmt.Errorf("while decoding inspect metadata: %v", err)
+		}
+		return metadata.Attributes.Healthcheck != "", nil
+	case image.SANDBOX:
+		fi, err := os.Stat(filepath.Join(img.Path, instance.HealthcheckPath))
+		if os.IsNotExist(err) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		return fi.Mode().IsRegular() && fi.Mode().Perm()&0o111 != 0, nil
+	}
+
+	return false, nil
+}
+
+// checkInstanceHealth runs the health check of the instance name every
+// health check interval and records its health status in the instance
+// file, until ctx is canceled.
+func checkInstanceHealth(ctx context.Context, name string, hc instance.HealthCheck) {
+	self, err := os.Executable()
+	if err != nil {
+		sylog.Errorf("Could not check health of instance %s: %s", name, err)
+		return
+	}
+
+	state := instance.NewHealthState()
+
+	ticker := time.NewTicker(hc.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := runHealthCheck(ctx, self, name, hc)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			sylog.Debugf("Health check of instance %s failed: %s", name, err)
+		}
+
+		if state.Update(err == nil, hc.Retries) {
+			sylog.Infof("Instance %s is %s", name, state.Status)
+			if err := setInstanceHealth(name, state.Status); err != nil {
+				sylog.Warningf("Could not record health status of instance %s: %s", name, err)
+			}
+		}
+	}
+}
+
+// runHealthCheck runs the health check command inside the instance name,
+// a check running longer than the health check interval fails.
+func runHealthCheck(ctx context.Context, self, name string, hc instance.HealthCheck) error {
+	ctx, cancel := context.WithTimeout(ctx, hc.Interval)
+	defer cancel()
+
+	args := append([]string{"exec", "instance://" + name}, hc.Args()...)
+	cmd := exec.CommandContext(ctx, self, args...)
+
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %s", hc.Interval)
+	} else if err != nil {
+		return fmt.Errorf("%v: %s", err, out)
+	}
+	return nil
+}
+
+// setInstanceHealth records the health status of the instance name in
+// its instance file.
+func setInstanceHealth(name, status string) error {
+	file, err := instance.Get(name, instance.SingSubDir)
+	if err != nil {
+		return err
+	}
+	file.Health = status
+	return file.Update()
+}
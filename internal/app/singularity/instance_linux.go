@@ -26,6 +26,9 @@ type instanceInfo struct {
 	IP         string `json:"ip"`
 	LogErrPath string `json:"logErrPath"`
 	LogOutPath string `json:"logOutPath"`
+	Restart    string `json:"restart,omitempty"`
+	Restarts   int    `json:"restarts"`
+	Health     string `json:"health,omitempty"`
 }
 
 // PrintInstanceList fetches instance list, applying name and
@@ -61,13 +64,13 @@ func PrintInstanceList(w io.Writer, name, user string, formatJSON bool, showLogs
 	}
 
 	if !formatJSON {
-		_, err := fmt.Fprintln(tabWriter, "INSTANCE NAME\tPID\tIP\tIMAGE")
+		_, err := fmt.Fprintln(tabWriter, "INSTANCE NAME\tPID\tIP\tIMAGE\tHEALTH")
 		if err != nil {
 			return fmt.Errorf("could not write list header: %v", err)
 		}
 
 		for _, i := range ii {
-			_, err = fmt.Fprintf(tabWriter, "%s\t%d\t%s\t%s\n", i.Name, i.Pid, i.IP, i.Image)
+			_, err = fmt.Fprintf(tabWriter, "%s\t%d\t%s\t%s\t%s\n", i.Name, i.Pid, i.IP, i.Image, i.Health)
 			if err != nil {
 				return fmt.Errorf("could not write instance info: %v", err)
 			}
@@ -83,6 +86,9 @@ func PrintInstanceList(w io.Writer, name, user string, formatJSON bool, showLogs
 		instances[i].IP = ii[i].IP
 		instances[i].LogErrPath = ii[i].LogErrPath
 		instances[i].LogOutPath = ii[i].LogOutPath
+		instances[i].Restart = ii[i].Restart
+		instances[i].Restarts = ii[i].Restarts
+		instances[i].Health = ii[i].Health
 	}
 
 	enc := json.NewEncoder(w)
@@ -168,6 +174,15 @@ func StopInstance(name, user string, sig syscall.Signal, timeout time.Duration)
 
 func killInstance(i *instance.File, sig syscall.Signal, stoppedPID chan<- int) {
 	sylog.Infof("Stopping %s instance of %s (PID=%d)\n", i.Name, i.Image, i.Pid)
+	if i.SupervisorPid > 0 {
+		// prevent the supervisor from restarting the instance, unless
+		// it exited and its PID was reused by another process
+		if st, err := proc.StartTime(i.SupervisorPid); err == nil && st == i.SupervisorStartTime {
+			syscall.Kill(i.SupervisorPid, syscall.SIGTERM)
+		} else {
+			sylog.Debugf("Instance %s supervisor (PID=%d) is not running", i.Name, i.SupervisorPid)
+		}
+	}
 	syscall.Kill(i.Pid, sig)
 
 	for {
@@ -0,0 +1,148 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"syscall"
+	"time"
+
+	"github.com/hpcng/singularity/internal/pkg/instance"
+)
+
+// logsPollInterval is the interval between two reads of the instance
+// log files when following them.
+const logsPollInterval = 250 * time.Millisecond
+
+// InstanceLogsOptions holds the options of PrintInstanceLogs.
+type InstanceLogsOptions struct {
+	// Follow keeps printing new log entries until the instance exits.
+	Follow bool
+	// Tail is the number of last entries of the merged log files to
+	// print, a negative value prints all entries.
+	Tail int
+	// Since discards entries logged before this time, if set.
+	Since time.Time
+	// Timestamps prefixes entries with the time they were logged.
+	Timestamps bool
+}
+
+// ParseLogsSince parses the value of the --since option, either a RFC 3339
+// timestamp (e.g. 2021-06-01T10:30:00Z) or a duration relative to now
+// (e.g. 10m).
+func ParseLogsSince(since string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, since); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(since)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("%q is neither a RFC 3339 timestamp nor a positive duration", since)
+	}
+	return time.Now().Add(-d), nil
+}
+
+// PrintInstanceLogs prints the logs of the instance name owned by user,
+// stdout entries are written to stdout and stderr entries to stderr. With
+// the follow option, it keeps printing new entries until the instance
+// exits or ctx is canceled.
+func PrintInstanceLogs(ctx context.Context, stdout, stderr io.Writer, name, user string, opts InstanceLogsOptions) error {
+	if err := instance.CheckName(name); err != nil {
+		return err
+	}
+	ii, err := instance.List(user, name, instance.SingSubDir)
+	if err != nil {
+		return fmt.Errorf("could not retrieve instance list: %v", err)
+	}
+	if len(ii) != 1 {
+		return fmt.Errorf("no instance found with name %s", name)
+	}
+	i := ii[0]
+
+	outFile := &instance.LogFile{Path: i.LogOutPath, Stream: "stdout"}
+	errFile := &instance.LogFile{Path: i.LogErrPath, Stream: "stderr"}
+
+	read := func(since time.Time, tail int) ([]instance.LogEntry, error) {
+		outEntries, err := outFile.ReadEntries()
+		if err != nil {
+			return nil, fmt.Errorf("while reading %s: %v", outFile.Path, err)
+		}
+		errEntries, err := errFile.ReadEntries()
+		if err != nil {
+			return nil, fmt.Errorf("while reading %s: %v", errFile.Path, err)
+		}
+		// streams are merged first so the tail applies to the
+		// interleaved entries
+		merged := instance.MergeLogEntries(outEntries, errEntries)
+		return instance.FilterLogEntries(merged, since, tail), nil
+	}
+
+	entries, err := read(opts.Since, opts.Tail)
+	if err != nil {
+		return err
+	}
+	if err := writeLogEntries(stdout, stderr, entries, opts.Timestamps, time.Time{}); err != nil {
+		return err
+	}
+	if !opts.Follow {
+		return nil
+	}
+
+	ticker := time.NewTicker(logsPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		// check before reading so entries logged right before
+		// the instance exited are printed
+		exited := syscall.Kill(i.Pid, 0) == syscall.ESRCH
+
+		entries, err := read(time.Time{}, -1)
+		if err != nil {
+			return err
+		}
+		if err := writeLogEntries(stdout, stderr, entries, opts.Timestamps, time.Now()); err != nil {
+			return err
+		}
+		if exited {
+			return nil
+		}
+	}
+}
+
+// writeLogEntries writes entries to the writer of their stream, prefixed
+// with their time if timestamps is true. Entries without time are prefixed
+// with now, unless it's zero.
+func writeLogEntries(stdout, stderr io.Writer, entries []instance.LogEntry, timestamps bool, now time.Time) error {
+	for _, e := range entries {
+		w := stdout
+		if e.Stream == "stderr" {
+			w = stderr
+		}
+
+		t := e.Time
+		if t.IsZero() {
+			t = now
+		}
+
+		var err error
+		if timestamps && !t.IsZero() {
+			_, err = fmt.Fprintf(w, "%s %s\n", t.Format(time.RFC3339Nano), e.Data)
+		} else {
+			_, err = fmt.Fprintln(w, e.Data)
+		}
+		if err != nil {
+			return fmt.Errorf("could not write log entry: %v", err)
+		}
+	}
+	return nil
+}
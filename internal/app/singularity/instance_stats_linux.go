@@ -0,0 +1,225 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hpcng/singularity/internal/pkg/cgroups"
+	"github.com/hpcng/singularity/internal/pkg/instance"
+	"github.com/hpcng/singularity/internal/pkg/util/fs"
+	"github.com/hpcng/singularity/pkg/sylog"
+)
+
+// statsInterval is the interval between two resource usage samples.
+const statsInterval = time.Second
+
+type instanceStats struct {
+	Instance      string         `json:"instance"`
+	Pid           int            `json:"pid"`
+	CPUPercent    float64        `json:"cpuPercent"`
+	MemoryPercent float64        `json:"memoryPercent"`
+	Stats         *cgroups.Stats `json:"stats"`
+
+	sampleTime time.Time
+}
+
+// instanceSample returns the resource usage of the instance i, it returns
+// nil stats if the instance is not running in its own cgroup.
+func instanceSample(i *instance.File) (*instanceStats, error) {
+	s := &instanceStats{
+		Instance:   i.Name,
+		Pid:        i.Pid,
+		sampleTime: time.Now(),
+	}
+
+	if !i.Cgroup {
+		return s, nil
+	}
+
+	manager, err := cgroups.GetManagerFromPid(i.Pid)
+	if err != nil {
+		return nil, fmt.Errorf("while getting cgroup of instance %s: %v", i.Name, err)
+	}
+	s.Stats, err = manager.Stats()
+	if err != nil {
+		return nil, fmt.Errorf("while getting resource usage of instance %s: %v", i.Name, err)
+	}
+
+	return s, nil
+}
+
+// computePercents computes the CPU and memory usage percentages of s,
+// the CPU usage is computed since the previous sample prev, if any.
+// A CPU usage of 100% corresponds to one fully used CPU.
+func (s *instanceStats) computePercents(prev *instanceStats, totalMemory uint64) {
+	if s.Stats == nil {
+		return
+	}
+
+	if prev != nil && prev.Stats != nil {
+		elapsed := s.sampleTime.Sub(prev.sampleTime)
+		if elapsed > 0 && s.Stats.CPU.Usage >= prev.Stats.CPU.Usage {
+			used := s.Stats.CPU.Usage - prev.Stats.CPU.Usage
+			s.CPUPercent = float64(used) / float64(elapsed.Nanoseconds()) * 100
+		}
+	}
+
+	limit := s.Stats.Memory.Limit
+	if limit == 0 || limit > totalMemory {
+		limit = totalMemory
+	}
+	if limit > 0 {
+		s.MemoryPercent = float64(s.Stats.Memory.Usage) / float64(limit) * 100
+	}
+}
+
+// sampleInstances returns the resource usage of instances matching name and
+// user, prev holds the previous samples indexed by instance PID in order to
+// compute CPU usage.
+func sampleInstances(name, user string, prev map[int]*instanceStats, totalMemory uint64) ([]*instanceStats, error) {
+	ii, err := instance.List(user, name, instance.SingSubDir)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve instance list: %v", err)
+	}
+
+	samples := make([]*instanceStats, 0, len(ii))
+	for _, i := range ii {
+		s, err := instanceSample(i)
+		if err != nil {
+			// the instance may have exited since it was listed
+			sylog.Debugf("Skipping instance %s: %v", i.Name, err)
+			continue
+		}
+		s.computePercents(prev[i.Pid], totalMemory)
+		samples = append(samples, s)
+	}
+
+	return samples, nil
+}
+
+// hostMemory returns the total memory of the host in bytes.
+func hostMemory() uint64 {
+	var info syscall.Sysinfo_t
+	if err := syscall.Sysinfo(&info); err != nil {
+		return 0
+	}
+	return uint64(info.Totalram) * uint64(info.Unit)
+}
+
+// PrintInstanceStats prints the resource usage of instances matching name
+// and user to the passed writer, in a regular or a JSON format (if formatJSON
+// is true). Usage is refreshed every second until ctx is canceled, unless
+// noStream is true in which case usage is printed once.
+func PrintInstanceStats(ctx context.Context, w io.Writer, name, user string, formatJSON, noStream bool) error {
+	totalMemory := hostMemory()
+
+	// a first sample is required to compute CPU usage
+	samples, err := sampleInstances(name, user, nil, totalMemory)
+	if err != nil {
+		return err
+	}
+	if len(samples) == 0 {
+		return fmt.Errorf("no instance found")
+	}
+
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		prev := make(map[int]*instanceStats, len(samples))
+		for _, s := range samples {
+			prev[s.Pid] = s
+		}
+
+		samples, err = sampleInstances(name, user, prev, totalMemory)
+		if err != nil {
+			return err
+		}
+
+		if formatJSON {
+			err = writeStatsJSON(w, samples, noStream)
+		} else {
+			err = writeStatsTable(w, samples, !noStream)
+		}
+		if err != nil || noStream {
+			return err
+		}
+	}
+}
+
+// writeStatsJSON writes samples as a JSON document, indented if indent is
+// true. When streaming, documents are not indented so each document is
+// written on a single line.
+func writeStatsJSON(w io.Writer, samples []*instanceStats, indent bool) error {
+	enc := json.NewEncoder(w)
+	if indent {
+		enc.SetIndent("", "\t")
+	}
+	err := enc.Encode(
+		map[string][]*instanceStats{
+			"instances": samples,
+		})
+	if err != nil {
+		return fmt.Errorf("could not encode instance stats: %v", err)
+	}
+	return nil
+}
+
+// writeStatsTable writes samples as a table, the terminal is cleared
+// first if clear is true.
+func writeStatsTable(w io.Writer, samples []*instanceStats, clear bool) error {
+	if clear {
+		// clear screen and move cursor to the top left corner
+		fmt.Fprint(w, "\033[2J\033[H")
+	}
+
+	tabWriter := tabwriter.NewWriter(w, 0, 8, 4, ' ', 0)
+
+	_, err := fmt.Fprintln(tabWriter, "INSTANCE NAME\tPID\tCPU %\tMEM USAGE / LIMIT\tMEM %\tBLOCK I/O\tPIDS")
+	if err != nil {
+		return fmt.Errorf("could not write stats header: %v", err)
+	}
+
+	for _, s := range samples {
+		if s.Stats == nil {
+			_, err = fmt.Fprintf(tabWriter, "%s\t%d\t--\t--\t--\t--\t--\n", s.Instance, s.Pid)
+		} else {
+			limit := "unlimited"
+			if s.Stats.Memory.Limit > 0 {
+				limit = fs.FindSize(int64(s.Stats.Memory.Limit))
+			}
+			_, err = fmt.Fprintf(tabWriter, "%s\t%d\t%.2f%%\t%s / %s\t%.2f%%\t%s / %s\t%d\n",
+				s.Instance,
+				s.Pid,
+				s.CPUPercent,
+				fs.FindSize(int64(s.Stats.Memory.Usage)),
+				limit,
+				s.MemoryPercent,
+				fs.FindSize(int64(s.Stats.BlkIO.ReadBytes)),
+				fs.FindSize(int64(s.Stats.BlkIO.WriteBytes)),
+				s.Stats.Pids.Current,
+			)
+		}
+		if err != nil {
+			return fmt.Errorf("could not write instance stats: %v", err)
+		}
+	}
+
+	return tabWriter.Flush()
+}
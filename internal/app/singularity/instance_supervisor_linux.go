@@ -0,0 +1,380 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/hpcng/singularity/internal/pkg/instance"
+	"github.com/hpcng/singularity/internal/pkg/util/starter"
+	"github.com/hpcng/singularity/pkg/runtime/engine/config"
+	singularityConfig "github.com/hpcng/singularity/pkg/runtime/engine/singularity/config"
+	"github.com/hpcng/singularity/pkg/sylog"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// restartMinDelay is the delay before the first restart of an instance,
+	// it doubles after each restart up to restartMaxDelay.
+	restartMinDelay = 100 * time.Millisecond
+	restartMaxDelay = 1 * time.Minute
+	// restartResetPeriod is the time after which a running instance is
+	// considered stable, the restart delay is reset to restartMinDelay
+	// when it exits.
+	restartResetPeriod = 10 * time.Second
+)
+
+// InstanceStartOptions holds the starter options used to start an instance.
+type InstanceStartOptions struct {
+	// ProcName is the name of the instance master process.
+	ProcName string
+	// UID is the user owning the instance log files.
+	UID int
+	// UseSuid runs the instance with the setuid starter.
+	UseSuid bool
+	// LoadOverlay loads the overlay kernel module.
+	LoadOverlay bool
+}
+
+// supervisorConfig is passed to the supervisor process on its standard input.
+type supervisorConfig struct {
+	Options  InstanceStartOptions
+	LogLevel int
+	Config   *config.Common
+}
+
+// supervisorResult is reported by the supervisor process once the instance
+// was started for the first time.
+type supervisorResult struct {
+	Output string
+	Error  string
+}
+
+// StartInstance starts the instance described by cfg. Errors reported by the
+// instance while starting are written to output if messages are not silenced.
+func StartInstance(cfg *config.Common, opts InstanceStartOptions, output io.Writer) error {
+	stdout, stderr, err := instance.SetLogFile(cfg.ContainerID, opts.UID, instance.LogSubDir)
+	if err != nil {
+		return fmt.Errorf("failed to create instance log files: %s", err)
+	}
+	defer stdout.Close()
+	defer stderr.Close()
+
+	start, err := stderr.Seek(0, io.SeekEnd)
+	if err != nil {
+		sylog.Warningf("failed to get standard error stream offset: %s", err)
+	}
+
+	cmdErr := starter.Run(
+		opts.ProcName,
+		cfg,
+		starter.UseSuid(opts.UseSuid),
+		starter.WithStdout(stdout),
+		starter.WithStderr(stderr),
+		starter.LoadOverlayModule(opts.LoadOverlay),
+	)
+
+	if sylog.GetLevel() != 0 {
+		// starter can exit a bit before all errors has been reported
+		// by instance process, wait a bit to catch all errors
+		time.Sleep(100 * time.Millisecond)
+
+		end, err := stderr.Seek(0, io.SeekEnd)
+		if err != nil {
+			sylog.Warningf("failed to get standard error stream offset: %s", err)
+		}
+		if end-start > 0 {
+			b := make([]byte, end-start)
+			stderr.ReadAt(b, start)
+			fmt.Fprintln(output, string(b))
+		}
+	}
+
+	return cmdErr
+}
+
+// StartSupervisedInstance starts the instance described by cfg from a
+// supervisor process restarting it according to its restart policy and
+// checking its health. The supervisor runs the instance supervise command
+// of the current executable and stays in the background once the instance
+// started.
+func StartSupervisedInstance(cfg *config.Common, opts InstanceStartOptions, output io.Writer) error {
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("could not determine executable path: %v", err)
+	}
+
+	sc := supervisorConfig{
+		Options:  opts,
+		LogLevel: sylog.GetLevel(),
+		Config:   cfg,
+	}
+	data, err := json.Marshal(sc)
+	if err != nil {
+		return fmt.Errorf("could not marshal supervisor configuration: %v", err)
+	}
+
+	_, stderr, err := instance.SetLogFile(cfg.ContainerID, opts.UID, instance.LogSubDir)
+	if err != nil {
+		return fmt.Errorf("failed to create instance log files: %s", err)
+	}
+	defer stderr.Close()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("could not create supervisor status pipe: %v", err)
+	}
+	defer r.Close()
+
+	cmd := exec.Command(self, "instance", "supervise")
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stderr = stderr
+	cmd.ExtraFiles = []*os.File{w}
+	cmd.Dir = "/"
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	if err := cmd.Start(); err != nil {
+		w.Close()
+		return fmt.Errorf("could not start supervisor: %v", err)
+	}
+	w.Close()
+
+	var res supervisorResult
+	if err := json.NewDecoder(r).Decode(&res); err != nil {
+		// the supervisor exited before reporting, its errors are in the log
+		cmd.Wait()
+		return fmt.Errorf("supervisor exited unexpectedly, see %s", stderr.Name())
+	}
+	cmd.Process.Release()
+
+	if res.Output != "" {
+		fmt.Fprint(output, res.Output)
+	}
+	if res.Error != "" {
+		return fmt.Errorf("%s", res.Error)
+	}
+	return nil
+}
+
+// SuperviseInstance reads a supervisor configuration from r, starts the
+// instance, checks its health and restarts it according to its restart
+// policy until it is stopped. The result of the first start is reported to
+// status which is closed afterwards.
+func SuperviseInstance(r io.Reader, status io.WriteCloser) error {
+	engineConfig := singularityConfig.NewConfig()
+	sc := supervisorConfig{
+		Config: &config.Common{EngineConfig: engineConfig},
+	}
+	if err := json.NewDecoder(r).Decode(&sc); err != nil {
+		status.Close()
+		return fmt.Errorf("could not read supervisor configuration: %v", err)
+	}
+	sylog.SetLevel(sc.LogLevel, false)
+
+	name := sc.Config.ContainerID
+
+	policy, err := instance.ParseRestartPolicy(engineConfig.GetRestartPolicy())
+	if err != nil {
+		status.Close()
+		return err
+	}
+
+	// instance master processes are orphaned once started, become their
+	// parent to get their exit status
+	if err := unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0); err != nil {
+		status.Close()
+		return fmt.Errorf("could not set child subreaper: %v", err)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+
+	// the temporary root filesystem is reused by restarted instances,
+	// remove it once the instance is not restarted anymore
+	if tempDir := engineConfig.GetDeleteTempDir(); tempDir != "" {
+		engineConfig.SetDeleteTempDir("")
+		defer os.RemoveAll(tempDir)
+	}
+
+	var health *instance.HealthCheck
+	if cmd := engineConfig.GetHealthCmd(); cmd != "" {
+		health = &instance.HealthCheck{
+			Cmd:      cmd,
+			Interval: engineConfig.GetHealthInterval(),
+			Retries:  engineConfig.GetHealthRetries(),
+		}
+	}
+
+	engineConfig.SetSupervisorPid(os.Getpid())
+
+	delay := restartMinDelay
+
+	for restarts := 0; ; restarts++ {
+		engineConfig.SetRestartCount(restarts)
+
+		var output bytes.Buffer
+		var w io.Writer = ioutil.Discard
+		if restarts == 0 {
+			w = &output
+		}
+
+		started := time.Now()
+
+		err := StartInstance(sc.Config, sc.Options, w)
+		if restarts == 0 {
+			reportSupervisorResult(status, output.String(), err)
+			if err != nil {
+				return err
+			}
+		} else if err != nil {
+			sylog.Errorf("Failed to restart instance %s: %s", name, err)
+		}
+
+		exitCode := 255
+		if err == nil {
+			exitCode, err = monitorInstance(name, health)
+			if err != nil {
+				return err
+			}
+		}
+		reapOrphans()
+		removeStaleInstance(name)
+
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+
+		if !policy.ShouldRestart(exitCode, restarts) {
+			sylog.Infof("Instance %s exited with status %d", name, exitCode)
+			return nil
+		}
+
+		if time.Since(started) >= restartResetPeriod {
+			delay = restartMinDelay
+		}
+
+		sylog.Infof("Instance %s exited with status %d, restarting in %s", name, exitCode, delay)
+
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(delay):
+		}
+
+		if delay *= 2; delay > restartMaxDelay {
+			delay = restartMaxDelay
+		}
+	}
+}
+
+// reportSupervisorResult writes the result of the first instance start
+// to status and closes it.
+func reportSupervisorResult(status io.WriteCloser, output string, err error) {
+	res := supervisorResult{Output: output}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	if err := json.NewEncoder(status).Encode(res); err != nil {
+		sylog.Warningf("could not report instance start status: %s", err)
+	}
+	status.Close()
+}
+
+// monitorInstance checks the health of the instance name, if health is
+// set, until its master process exits and returns its exit code.
+func monitorInstance(name string, health *instance.HealthCheck) (int, error) {
+	masterPid := -1
+	if file, err := instance.Get(name, instance.SingSubDir); err == nil {
+		masterPid = file.PPid
+	}
+
+	// health checks are children of the supervisor, they would be reaped
+	// while waiting for any child, so they only run with a known master
+	// process
+	if health != nil && masterPid > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			checkInstanceHealth(ctx, name, *health)
+			close(done)
+		}()
+		defer func() {
+			cancel()
+			<-done
+		}()
+	}
+
+	return waitInstance(name, masterPid)
+}
+
+// waitInstance waits for the master process of the instance name to exit
+// and returns its exit code. If the master process is unknown, it waits
+// for all processes adopted by the supervisor.
+func waitInstance(name string, masterPid int) (int, error) {
+	exitCode := 255
+
+	for {
+		var status syscall.WaitStatus
+
+		pid, err := syscall.Wait4(masterPid, &status, 0, nil)
+		if err == syscall.EINTR {
+			continue
+		} else if err == syscall.ECHILD {
+			return exitCode, nil
+		} else if err != nil {
+			return 0, fmt.Errorf("while waiting instance %s: %v", name, err)
+		}
+
+		if status.Signaled() {
+			exitCode = 128 + int(status.Signal())
+		} else {
+			exitCode = status.ExitStatus()
+		}
+		if pid == masterPid {
+			return exitCode, nil
+		}
+	}
+}
+
+// reapOrphans reaps exited processes adopted by the supervisor.
+func reapOrphans() {
+	for {
+		var status syscall.WaitStatus
+
+		pid, err := syscall.Wait4(-1, &status, syscall.WNOHANG, nil)
+		if err == syscall.EINTR {
+			continue
+		} else if err != nil || pid <= 0 {
+			return
+		}
+	}
+}
+
+// removeStaleInstance removes the instance file of name left by a master
+// process which didn't exit cleanly, so the instance can be restarted.
+func removeStaleInstance(name string) {
+	file, err := instance.Get(name, instance.SingSubDir)
+	if err != nil {
+		return
+	}
+	if syscall.Kill(file.PPid, 0) == syscall.ESRCH {
+		if err := file.Delete(); err != nil {
+			sylog.Warningf("could not remove stale instance file: %s", err)
+		}
+	}
+}
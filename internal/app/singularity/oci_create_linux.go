@@ -1,4 +1,4 @@
-// Copyright (c) 2018-2020, Sylabs Inc. All rights reserved.
+// Copyright (c) 2018-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -12,6 +12,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/hpcng/singularity/internal/pkg/cdi"
 	"github.com/hpcng/singularity/internal/pkg/runtime/engine/config/oci/generate"
 	"github.com/hpcng/singularity/internal/pkg/runtime/engine/oci"
 	"github.com/hpcng/singularity/internal/pkg/util/starter"
@@ -61,6 +62,24 @@ func OciCreate(containerID string, args *OciArgs) error {
 		return fmt.Errorf("failed to parse OCI specification file %s: %s", configJSON, err)
 	}
 
+	if len(args.CDIDevices) > 0 {
+		registry, err := cdi.Load(cdi.DefaultSpecDirs...)
+		if err != nil {
+			return fmt.Errorf("while loading CDI specs: %s", err)
+		}
+		edits, err := registry.Resolve(args.CDIDevices)
+		if err != nil {
+			return err
+		}
+		// the OCI engine only runs prestart, poststart and poststop hooks
+		if err := edits.CheckHooks(cdi.PrestartHook, cdi.PoststartHook, cdi.PoststopHook); err != nil {
+			return err
+		}
+		if err := edits.Apply(generator.Config); err != nil {
+			return fmt.Errorf("while applying CDI devices: %s", err)
+		}
+	}
+
 	engineConfig.EmptyProcess = args.EmptyProcess
 	engineConfig.SyncSocket = args.SyncSocketPath
 
@@ -1,4 +1,4 @@
-// Copyright (c) 2018-2020, Sylabs Inc. All rights reserved.
+// Copyright (c) 2018-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -26,6 +26,7 @@ type OciArgs struct {
 	SyncSocketPath string
 	PidFile        string
 	FromFile       string
+	CDIDevices     []string
 	KillSignal     string
 	KillTimeout    uint32
 	EmptyProcess   bool
@@ -1,4 +1,4 @@
-// Copyright (c) 2018-2019, Sylabs Inc. All rights reserved.
+// Copyright (c) 2018-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -6,21 +6,66 @@
 package singularity
 
 import (
-	ocibundle "github.com/hpcng/singularity/pkg/ocibundle/sif"
+	"fmt"
+	"path/filepath"
+
+	"github.com/containers/image/v5/types"
+	"github.com/hpcng/singularity/internal/pkg/cache"
+	"github.com/hpcng/singularity/pkg/ocibundle"
+	"github.com/hpcng/singularity/pkg/ocibundle/native"
+	sifbundle "github.com/hpcng/singularity/pkg/ocibundle/sif"
+	"github.com/hpcng/singularity/pkg/ocibundle/tools"
+	"github.com/hpcng/singularity/pkg/syfs"
+	"github.com/hpcng/singularity/pkg/util/fs/proc"
+	useragent "github.com/hpcng/singularity/pkg/util/user-agent"
 )
 
-// OciMount mount a SIF image to create an OCI bundle
-func OciMount(image string, bundle string) error {
-	d, err := ocibundle.FromSif(image, bundle, true)
+// OciMount mount a SIF image, or unpack a docker://, oci: or oci-archive:
+// image, to create an OCI bundle
+func OciMount(image string, bundle string, imgCache *cache.Handle) error {
+	var d ocibundle.Bundle
+	var err error
+
+	if native.IsImageRef(image) {
+		sysCtx := &types.SystemContext{
+			OSChoice:                "linux",
+			AuthFilePath:            syfs.DockerConf(),
+			DockerRegistryUserAgent: useragent.Value(),
+		}
+		d, err = native.FromImageRef(image, bundle, native.OptImgCache(imgCache), native.OptSysCtx(sysCtx))
+	} else {
+		d, err = sifbundle.FromSif(image, bundle, true)
+	}
 	if err != nil {
 		return err
 	}
 	return d.Create(nil)
 }
 
-// OciUmount umount SIF and delete OCI bundle
+// OciUmount umount SIF, or remove the unpacked image, and delete OCI bundle
 func OciUmount(bundle string) error {
-	d, err := ocibundle.FromSif("", bundle, true)
+	var d ocibundle.Bundle
+	var err error
+
+	// the root filesystem of a bundle created from a SIF image is mounted
+	rootFs, err := filepath.Abs(tools.RootFs(bundle).Path())
+	if err != nil {
+		return fmt.Errorf("failed to determine bundle path: %s", err)
+	}
+	rootFs, err = filepath.EvalSymlinks(rootFs)
+	if err != nil {
+		return fmt.Errorf("while resolving %s: %s", rootFs, err)
+	}
+	mountPoint, err := proc.ParentMount(rootFs)
+	if err != nil {
+		return fmt.Errorf("while searching mount point of %s: %s", rootFs, err)
+	}
+
+	if mountPoint == rootFs {
+		d, err = sifbundle.FromSif("", bundle, true)
+	} else {
+		d, err = native.FromImageRef("", bundle)
+	}
 	if err != nil {
 		return err
 	}
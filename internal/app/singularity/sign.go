@@ -6,13 +6,31 @@
 package singularity
 
 import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
 	"github.com/hpcng/sif/pkg/integrity"
 	"github.com/hpcng/sif/pkg/sif"
+	"github.com/hpcng/singularity/internal/pkg/util/timestamp"
+	"github.com/hpcng/singularity/internal/pkg/util/x509sig"
+	"github.com/hpcng/singularity/pkg/image"
 	"github.com/hpcng/singularity/pkg/sypgp"
 )
 
+var errEntityAndCertificate = errors.New("a PGP entity and an X.509 certificate cannot be used together")
+
 type signer struct {
-	opts []integrity.SignerOpt
+	opts   []integrity.SignerOpt
+	xopts  []x509sig.SignerOpt
+	pgp    bool
+	key    crypto.Signer
+	certs  []*x509.Certificate
+	tsaURL string
 }
 
 // SignOpt are used to configure s.
@@ -28,16 +46,29 @@ func OptSignEntitySelector(f sypgp.EntitySelector) SignOpt {
 		}
 
 		s.opts = append(s.opts, integrity.OptSignWithEntity(e))
+		s.pgp = true
 
 		return nil
 	}
 }
 
+// OptSignCertificate specifies that signature(s) be made with key, and its X.509 certificate,
+// instead of a PGP entity. The first of certs is the certificate of key, and the others are
+// intermediate certificates, stored with the signature(s) to build its certificate chain.
+func OptSignCertificate(certs []*x509.Certificate, key crypto.Signer) SignOpt {
+	return func(s *signer) error {
+		s.certs = certs
+		s.key = key
+		return nil
+	}
+}
+
 // OptSignGroup specifies that a signature be applied to cover all objects in the group with the
 // specified groupID. This may be called multiple times to add multiple group signatures.
 func OptSignGroup(groupID uint32) SignOpt {
 	return func(s *signer) error {
 		s.opts = append(s.opts, integrity.OptSignGroup(groupID))
+		s.xopts = append(s.xopts, x509sig.OptSignGroup(groupID))
 		return nil
 	}
 }
@@ -48,15 +79,68 @@ func OptSignGroup(groupID uint32) SignOpt {
 func OptSignObjects(ids ...uint32) SignOpt {
 	return func(s *signer) error {
 		s.opts = append(s.opts, integrity.OptSignObjects(ids...))
+		s.xopts = append(s.xopts, x509sig.OptSignObjects(ids...))
 		return nil
 	}
 }
 
+// OptSignTimestamp specifies that an RFC 3161 time-stamp token be requested for each signature
+// from the time stamping authority at url, and stored alongside the signature.
+func OptSignTimestamp(url string) SignOpt {
+	return func(s *signer) error {
+		s.tsaURL = url
+		return nil
+	}
+}
+
+// addTimestamps adds a time-stamp token requested from the TSA at url for each signature object
+// of f not in sigs.
+func addTimestamps(f *sif.FileImage, url string, sigs map[uint32]bool) error {
+	var ods []*sif.Descriptor
+	for i, od := range f.DescrArr {
+		if od.Used && od.Datatype == sif.DataSignature && !sigs[od.ID] {
+			ods = append(ods, &f.DescrArr[i])
+		}
+	}
+
+	for _, od := range ods {
+		digest := sha256.Sum256(od.GetData(f))
+		tsr, err := timestamp.Request(context.Background(), url, digest[:], crypto.SHA256)
+		if err != nil {
+			return fmt.Errorf("while requesting time-stamp token: %s", err)
+		}
+
+		entity, err := od.GetEntityString()
+		if err != nil {
+			return err
+		}
+
+		input := sif.DescriptorInput{
+			Datatype: sif.DataSignature,
+			Groupid:  sif.DescrUnusedGroup,
+			Link:     od.ID,
+			Size:     int64(len(tsr)),
+			Fname:    image.SIFDescTimestamp,
+			Fp:       bytes.NewReader(tsr),
+		}
+		if err := input.SetSignExtra(sif.HashSHA256, entity); err != nil {
+			return err
+		}
+		if err := f.AddObject(input); err != nil {
+			return fmt.Errorf("failed to add time-stamp token: %s", err)
+		}
+	}
+
+	return nil
+}
+
 // Sign adds one or more digital signatures to the SIF image found at path, according to opts. Key
-// material must be provided via OptSignEntitySelector.
+// material must be provided via OptSignEntitySelector, or OptSignCertificate to sign with an X.509
+// certificate.
 //
 // By default, one digital signature is added per object group in f. To override this behavior,
-// consider using OptSignGroup and/or OptSignObject.
+// consider using OptSignGroup and/or OptSignObject. To time stamp the signatures, use
+// OptSignTimestamp.
 func Sign(path string, opts ...SignOpt) error {
 	// Apply options to signer.
 	s := signer{}
@@ -65,6 +149,9 @@ func Sign(path string, opts ...SignOpt) error {
 			return err
 		}
 	}
+	if s.pgp && s.key != nil {
+		return errEntityAndCertificate
+	}
 
 	// Load container.
 	f, err := sif.LoadContainer(path, false)
@@ -73,10 +160,35 @@ func Sign(path string, opts ...SignOpt) error {
 	}
 	defer f.UnloadContainer()
 
+	// Note existing signatures, to time stamp only the new ones.
+	sigs := make(map[uint32]bool)
+	for _, od := range f.DescrArr {
+		if od.Used && od.Datatype == sif.DataSignature {
+			sigs[od.ID] = true
+		}
+	}
+
 	// Apply signature(s).
-	is, err := integrity.NewSigner(&f, s.opts...)
-	if err != nil {
-		return err
+	if s.key != nil {
+		xs, err := x509sig.NewSigner(&f, s.key, s.certs, s.xopts...)
+		if err != nil {
+			return err
+		}
+		if err := xs.Sign(); err != nil {
+			return err
+		}
+	} else {
+		is, err := integrity.NewSigner(&f, s.opts...)
+		if err != nil {
+			return err
+		}
+		if err := is.Sign(); err != nil {
+			return err
+		}
+	}
+
+	if s.tsaURL == "" {
+		return nil
 	}
-	return is.Sign()
+	return addTimestamps(&f, s.tsaURL, sigs)
 }
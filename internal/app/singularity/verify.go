@@ -8,13 +8,17 @@ package singularity
 
 import (
 	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/hex"
 	"errors"
 	"strings"
+	"time"
 
 	"github.com/hpcng/sif/pkg/integrity"
 	"github.com/hpcng/sif/pkg/sif"
 	"github.com/hpcng/singularity/internal/pkg/buildcfg"
+	"github.com/hpcng/singularity/internal/pkg/util/x509sig"
 	"github.com/hpcng/singularity/pkg/sypgp"
 	"github.com/sylabs/scs-key-client/client"
 	"golang.org/x/crypto/openpgp"
@@ -23,7 +27,9 @@ import (
 // TODO - error overlaps with ECL - should probably become part of a common errors package at some point.
 var errNotSignedByRequired = errors.New("image not signed by required entities")
 
-type VerifyCallback func(*sif.FileImage, integrity.VerifyResult) bool
+var errLegacyCertificates = errors.New("legacy signatures cannot be verified with X.509 certificates")
+
+type VerifyCallback func(*sif.FileImage, VerifyResult) bool
 
 type verifier struct {
 	opts      []client.Option
@@ -31,7 +37,12 @@ type verifier struct {
 	objectIDs []uint32
 	all       bool
 	legacy    bool
+	timestamp bool
+	tsaRoots  *x509.CertPool
+	roots     *x509.CertPool
+	crls      []*pkix.CertificateList
 	cb        VerifyCallback
+	err       error // First signing key or time-stamp error, set during verification.
 }
 
 // VerifyOpt are used to configure v.
@@ -82,6 +93,37 @@ func OptVerifyLegacy() VerifyOpt {
 	}
 }
 
+// OptVerifyTimestamp enables verification of the RFC 3161 time-stamp token of each signature,
+// which must be issued by a time stamping authority certified by roots, or by the system roots if
+// roots is nil. The status of signing keys is then checked at the time of the time stamp, instead
+// of the creation time of the signature.
+func OptVerifyTimestamp(roots *x509.CertPool) VerifyOpt {
+	return func(v *verifier) error {
+		v.timestamp = true
+		v.tsaRoots = roots
+		return nil
+	}
+}
+
+// OptVerifyCertificates specifies that X.509 signatures be verified instead of PGP signatures, with
+// the chains of signing certificates verified up to the root certificates in roots.
+func OptVerifyCertificates(roots *x509.CertPool) VerifyOpt {
+	return func(v *verifier) error {
+		v.roots = roots
+		return nil
+	}
+}
+
+// OptVerifyCRLs specifies that the certificates of the chains of signing certificates be checked
+// against the certificate revocation lists crls. This may be called multiple times to add more
+// lists.
+func OptVerifyCRLs(crls ...*pkix.CertificateList) VerifyOpt {
+	return func(v *verifier) error {
+		v.crls = append(v.crls, crls...)
+		return nil
+	}
+}
+
 // OptVerifyCallback registers f as the verification callback.
 func OptVerifyCallback(cb VerifyCallback) VerifyOpt {
 	return func(v *verifier) error {
@@ -102,7 +144,7 @@ func newVerifier(opts []VerifyOpt) (verifier, error) {
 }
 
 // getOpts returns integrity.VerifierOpt necessary to validate f.
-func (v verifier) getOpts(ctx context.Context, f *sif.FileImage) ([]integrity.VerifierOpt, error) {
+func (v *verifier) getOpts(ctx context.Context, f *sif.FileImage) ([]integrity.VerifierOpt, error) {
 	var iopts []integrity.VerifierOpt
 
 	// Add keyring.
@@ -129,7 +171,8 @@ func (v verifier) getOpts(ctx context.Context, f *sif.FileImage) ([]integrity.Ve
 	}
 	kr = sypgp.NewMultiKeyRing(gkr, kr)
 
-	iopts = append(iopts, integrity.OptVerifyWithKeyRing(kr))
+	// keys of revoked entities are kept, to report their status after verification
+	iopts = append(iopts, integrity.OptVerifyWithKeyRing(statusKeyRing{kr}))
 
 	// Add group IDs, if applicable.
 	for _, groupID := range v.groupIDs {
@@ -159,22 +202,84 @@ func (v verifier) getOpts(ctx context.Context, f *sif.FileImage) ([]integrity.Ve
 		}
 	}
 
-	// Add callback, if applicable.
-	if v.cb != nil {
-		fn := func(r integrity.VerifyResult) bool {
-			return v.cb(f, r)
+	// Add callback checking the signing key and time stamp of each signature.
+	fn := func(r integrity.VerifyResult) bool {
+		vr := v.checkResult(f, r)
+		if v.cb != nil && v.cb(f, vr) {
+			return true
+		}
+		if vr.err != nil && r.Error() == nil && v.err == nil {
+			v.err = vr.err
 		}
-		iopts = append(iopts, integrity.OptVerifyCallback(fn))
+		return false
 	}
+	iopts = append(iopts, integrity.OptVerifyCallback(fn))
 
 	return iopts, nil
 }
 
+// getX509Opts returns x509sig.VerifierOpt necessary to validate the X.509 signatures of f.
+func (v *verifier) getX509Opts(f *sif.FileImage) ([]x509sig.VerifierOpt, error) {
+	if v.legacy {
+		return nil, errLegacyCertificates
+	}
+
+	xopts := []x509sig.VerifierOpt{x509sig.OptVerifyWithRoots(v.roots)}
+
+	// Add certificate revocation lists, if applicable.
+	if len(v.crls) > 0 {
+		xopts = append(xopts, x509sig.OptVerifyWithCRLs(v.crls...))
+	}
+
+	// Add group IDs, if applicable.
+	for _, groupID := range v.groupIDs {
+		xopts = append(xopts, x509sig.OptVerifyGroup(groupID))
+	}
+
+	// Add objectIDs, if applicable.
+	for _, objectID := range v.objectIDs {
+		xopts = append(xopts, x509sig.OptVerifyObject(objectID))
+	}
+
+	// Check certificates at the time of the time stamp of each signature, if applicable.
+	timestamps := make(map[uint32]time.Time)
+	if v.timestamp {
+		fn := func(sig *sif.Descriptor) (time.Time, error) {
+			ts, err := checkTimestamp(f, sig, sig.GetData(f), v.tsaRoots)
+			if err != nil {
+				return time.Time{}, &TimestampError{ID: sig.ID, Err: err}
+			}
+			timestamps[sig.ID] = ts
+			return ts, nil
+		}
+		xopts = append(xopts, x509sig.OptVerifyTime(fn))
+	}
+
+	// Add callback reporting the status of the signing certificate of each signature.
+	fn := func(r x509sig.VerifyResult) bool {
+		vr := verifyResult{
+			VerifyResult: r,
+			status:       certificateStatus(r),
+			timestamp:    timestamps[r.Signature()],
+		}
+		return v.cb != nil && v.cb(f, vr)
+	}
+	xopts = append(xopts, x509sig.OptVerifyCallback(fn))
+
+	return xopts, nil
+}
+
 // Verify verifies digital signature(s) in the SIF image found at path, according to opts.
 //
 // By default, the singularity public keyring provides key material. To supplement this with a
 // keyserver, use OptVerifyUseKeyServer.
 //
+// Signatures made with expired or revoked keys are reported with a SigningKeyError. To check the
+// status of keys at the time of the RFC 3161 time stamps of signatures, use OptVerifyTimestamp.
+//
+// To verify X.509 signatures instead of PGP signatures, use OptVerifyCertificates, and optionally
+// OptVerifyCRLs.
+//
 // By default, non-legacy signatures for all object groups are verified. To override the default
 // behavior, consider using OptVerifyGroup, OptVerifyObject, OptVerifyAll, and/or OptVerifyLegacy.
 func Verify(ctx context.Context, path string, opts ...VerifyOpt) error {
@@ -190,18 +295,44 @@ func Verify(ctx context.Context, path string, opts ...VerifyOpt) error {
 	}
 	defer f.UnloadContainer()
 
+	if v.roots != nil {
+		return v.verifyCertificates(&f)
+	}
+
+	// X.509 signatures are not visible to the PGP verifier.
+	pf := x509sig.HideSignatures(&f)
+
 	// Get options to validate f.
-	vopts, err := v.getOpts(ctx, &f)
+	vopts, err := v.getOpts(ctx, pf)
 	if err != nil {
 		return err
 	}
 
 	// Verify signature(s).
-	iv, err := integrity.NewVerifier(&f, vopts...)
+	iv, err := integrity.NewVerifier(pf, vopts...)
 	if err != nil {
 		return err
 	}
-	return iv.Verify()
+	if err := iv.Verify(); err != nil {
+		return err
+	}
+	return v.err
+}
+
+// verifyCertificates verifies the X.509 signature(s) of f.
+func (v *verifier) verifyCertificates(f *sif.FileImage) error {
+	// Get options to validate f.
+	xopts, err := v.getX509Opts(f)
+	if err != nil {
+		return err
+	}
+
+	// Verify signature(s).
+	xv, err := x509sig.NewVerifier(f, xopts...)
+	if err != nil {
+		return err
+	}
+	return xv.Verify()
 }
 
 // VerifyFingerprints verifies an image and checks it was signed by *all* of the provided fingerprints
@@ -224,14 +355,17 @@ func VerifyFingerprints(ctx context.Context, path string, fingerprints []string,
 	}
 	defer f.UnloadContainer()
 
+	// X.509 signatures are not visible to the PGP verifier.
+	pf := x509sig.HideSignatures(&f)
+
 	// Get options to validate f.
-	vopts, err := v.getOpts(ctx, &f)
+	vopts, err := v.getOpts(ctx, pf)
 	if err != nil {
 		return err
 	}
 
 	// Verify signature(s).
-	iv, err := integrity.NewVerifier(&f, vopts...)
+	iv, err := integrity.NewVerifier(pf, vopts...)
 	if err != nil {
 		return err
 	}
@@ -239,6 +373,9 @@ func VerifyFingerprints(ctx context.Context, path string, fingerprints []string,
 	if err != nil {
 		return err
 	}
+	if v.err != nil {
+		return v.err
+	}
 
 	// get signing entities fingerprints that have signed all selected objects
 	keyfps, err := iv.AllSignedBy()
@@ -0,0 +1,334 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package singularity
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hpcng/sif/pkg/integrity"
+	"github.com/hpcng/sif/pkg/sif"
+	"github.com/hpcng/singularity/internal/pkg/util/timestamp"
+	"github.com/hpcng/singularity/internal/pkg/util/x509sig"
+	"github.com/hpcng/singularity/pkg/image"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// KeyStatus is the status of a signing key when a signature was made.
+type KeyStatus string
+
+const (
+	// KeyValid is the status of a key neither expired nor revoked.
+	KeyValid KeyStatus = "valid"
+	// KeyExpired is the status of a key past its expiration time.
+	KeyExpired KeyStatus = "expired"
+	// KeyRevoked is the status of a key with a revocation signature.
+	KeyRevoked KeyStatus = "revoked"
+)
+
+// Reasons for revocation, as defined in RFC 4880 section 5.2.3.23.
+const (
+	reasonKeySuperseded = 1
+	reasonKeyRetired    = 3
+)
+
+var errTimestampNotFound = errors.New("time-stamp token not found")
+
+// SigningKeyError records a signature made with an expired or revoked key.
+type SigningKeyError struct {
+	ID     uint32    // ID of the signature object.
+	Status KeyStatus // Status of the signing key.
+}
+
+func (e *SigningKeyError) Error() string {
+	return fmt.Sprintf("signature object %v made with %v key", e.ID, e.Status)
+}
+
+// TimestampError records an error verifying the time-stamp token of a signature.
+type TimestampError struct {
+	ID  uint32 // ID of the signature object.
+	Err error  // Underlying error.
+}
+
+func (e *TimestampError) Error() string {
+	return fmt.Sprintf("signature object %v: %v", e.ID, e.Err)
+}
+
+func (e *TimestampError) Unwrap() error {
+	return e.Err
+}
+
+// VerifyResult describes the verification of a signature. In addition to integrity.VerifyResult,
+// it reports the status of the signing key, the time stamp of the signature and, for X.509
+// signatures, the certificate chain of the signing certificate.
+type VerifyResult interface {
+	integrity.VerifyResult
+
+	// KeyStatus returns the status of the signing key when the signature was made, or an empty
+	// status if the signing entity could not be determined.
+	KeyStatus() KeyStatus
+
+	// Timestamp returns the time of the verified time-stamp token of the signature, or the zero
+	// time if time stamps are not verified.
+	Timestamp() time.Time
+
+	// Certificates returns the verified chain of the signing certificate of an X.509 signature,
+	// from the signing certificate to a root certificate, or nil for a PGP signature or if the
+	// chain could not be verified.
+	Certificates() []*x509.Certificate
+}
+
+type verifyResult struct {
+	integrity.VerifyResult
+	status    KeyStatus
+	timestamp time.Time
+	err       error // Signing key or time-stamp error.
+}
+
+// KeyStatus returns the status of the signing key when the signature was made.
+func (r verifyResult) KeyStatus() KeyStatus {
+	return r.status
+}
+
+// Timestamp returns the time of the verified time-stamp token of the signature.
+func (r verifyResult) Timestamp() time.Time {
+	return r.timestamp
+}
+
+// Certificates returns the verified chain of the signing certificate of an X.509 signature.
+func (r verifyResult) Certificates() []*x509.Certificate {
+	if xr, ok := r.VerifyResult.(x509sig.VerifyResult); ok {
+		return xr.Certificates()
+	}
+	return nil
+}
+
+// Error returns an error describing the reason verification failed, including a signature made
+// with an expired or revoked key, or nil if verification was successful.
+func (r verifyResult) Error() error {
+	if err := r.VerifyResult.Error(); err != nil {
+		return err
+	}
+	return r.err
+}
+
+// statusKeyRing wraps a keyring to return the keys of revoked entities as well, so signatures
+// made with them are verified and reported with a revoked key status.
+type statusKeyRing struct {
+	openpgp.KeyRing
+}
+
+// KeysByIdUsage returns the set of keys with the given id that also meet the key usage given by
+// requiredUsage, including revoked keys.
+//nolint:revive  // golang/x/crypto uses Id instead of ID so we have to too
+func (kr statusKeyRing) KeysByIdUsage(id uint64, requiredUsage byte) []openpgp.Key {
+	var keys []openpgp.Key
+
+	for _, k := range kr.KeysById(id) {
+		if sig := k.SelfSignature; sig != nil && sig.FlagsValid && requiredUsage != 0 {
+			var usage byte
+			if sig.FlagCertify {
+				usage |= packet.KeyFlagCertify
+			}
+			if sig.FlagSign {
+				usage |= packet.KeyFlagSign
+			}
+			if sig.FlagEncryptCommunications {
+				usage |= packet.KeyFlagEncryptCommunications
+			}
+			if sig.FlagEncryptStorage {
+				usage |= packet.KeyFlagEncryptStorage
+			}
+			if usage&requiredUsage != requiredUsage {
+				continue
+			}
+		}
+		keys = append(keys, k)
+	}
+
+	return keys
+}
+
+// readSignature returns the OpenPGP signature packet of the clear-signed message in data.
+func readSignature(data []byte) (*packet.Signature, error) {
+	b, _ := clearsign.Decode(data)
+	if b == nil {
+		return nil, fmt.Errorf("clearsigned message not found")
+	}
+
+	p, err := packet.Read(b.ArmoredSignature.Body)
+	if err != nil {
+		return nil, fmt.Errorf("while reading signature: %s", err)
+	}
+	sig, ok := p.(*packet.Signature)
+	if !ok || sig.IssuerKeyId == nil {
+		return nil, fmt.Errorf("unsupported signature packet")
+	}
+	return sig, nil
+}
+
+// revokedAt returns true if the revocation signature sig revokes a key at time t. A key
+// superseded or retired remains valid until the revocation, other revocations are effective
+// at any time.
+func revokedAt(sig *packet.Signature, t time.Time) bool {
+	if sig.RevocationReason != nil {
+		switch *sig.RevocationReason {
+		case reasonKeySuperseded, reasonKeyRetired:
+			return !sig.CreationTime.After(t)
+		}
+	}
+	return true
+}
+
+// expiredAt returns true if the key pub, with the self-signature sig, is expired at time t.
+func expiredAt(pub *packet.PublicKey, sig *packet.Signature, t time.Time) bool {
+	if sig == nil || sig.KeyLifetimeSecs == nil || *sig.KeyLifetimeSecs == 0 {
+		return false
+	}
+	expiry := pub.CreationTime.Add(time.Duration(*sig.KeyLifetimeSecs) * time.Second)
+	return t.After(expiry)
+}
+
+// primarySelfSignature returns the self-signature of the identity marked as primary, or the most
+// recent self-signature if none are so marked.
+func primarySelfSignature(e *openpgp.Entity) *packet.Signature {
+	var latest *packet.Signature
+	for _, id := range e.Identities {
+		sig := id.SelfSignature
+		if sig == nil {
+			continue
+		}
+		if sig.IsPrimaryId != nil && *sig.IsPrimaryId {
+			return sig
+		}
+		if latest == nil || sig.CreationTime.After(latest.CreationTime) {
+			latest = sig
+		}
+	}
+	return latest
+}
+
+// keyStatus returns the status at time t of the key of entity e with the given id.
+func keyStatus(e *openpgp.Entity, id uint64, t time.Time) KeyStatus {
+	for _, sig := range e.Revocations {
+		if revokedAt(sig, t) {
+			return KeyRevoked
+		}
+	}
+
+	// Subkeys expire with the primary key.
+	if expiredAt(e.PrimaryKey, primarySelfSignature(e), t) {
+		return KeyExpired
+	}
+
+	for _, sk := range e.Subkeys {
+		if sk.PublicKey.KeyId != id {
+			continue
+		}
+		if sk.Sig.SigType == packet.SigTypeSubkeyRevocation && revokedAt(sk.Sig, t) {
+			return KeyRevoked
+		}
+		if expiredAt(sk.PublicKey, sk.Sig, t) {
+			return KeyExpired
+		}
+	}
+
+	return KeyValid
+}
+
+// getTimestamp returns the time-stamp token linked to the signature object sig.
+func getTimestamp(f *sif.FileImage, sig *sif.Descriptor) ([]byte, error) {
+	ods, _, err := f.GetLinkedDescrsByType(sig.ID, sif.DataSignature)
+	if err != nil && !errors.Is(err, sif.ErrNotFound) {
+		return nil, err
+	}
+	for _, od := range ods {
+		if od.Groupid == sif.DescrUnusedGroup && od.GetName() == image.SIFDescTimestamp {
+			return od.GetData(f), nil
+		}
+	}
+	return nil, errTimestampNotFound
+}
+
+// checkTimestamp verifies the time-stamp token linked to the signature object sig, with data
+// data, against roots and returns its time.
+func checkTimestamp(f *sif.FileImage, sig *sif.Descriptor, data []byte, roots *x509.CertPool) (time.Time, error) {
+	tsr, err := getTimestamp(f, sig)
+	if err != nil {
+		return time.Time{}, err
+	}
+	digest := sha256.Sum256(data)
+	return timestamp.Verify(tsr, digest[:], crypto.SHA256, roots)
+}
+
+// certificateStatus returns the status of the signing certificate of the X.509 signature verified
+// with result r, or an empty status if it could not be determined.
+func certificateStatus(r x509sig.VerifyResult) KeyStatus {
+	if r.Certificates() != nil {
+		return KeyValid
+	}
+
+	var revokedErr *x509sig.CertificateRevokedError
+	if errors.As(r.Error(), &revokedErr) {
+		return KeyRevoked
+	}
+
+	var invalidErr x509.CertificateInvalidError
+	if errors.As(r.Error(), &invalidErr) && invalidErr.Reason == x509.Expired {
+		return KeyExpired
+	}
+
+	return ""
+}
+
+// checkResult checks the signing key status, and the time stamp if enabled, of the signature
+// verified with result r. The status of the key is checked at the time of the time stamp, or at
+// the creation time of the signature if time stamps are not verified.
+func (v *verifier) checkResult(f *sif.FileImage, r integrity.VerifyResult) verifyResult {
+	vr := verifyResult{VerifyResult: r}
+
+	e := r.Entity()
+	if e == nil {
+		return vr
+	}
+
+	od, _, err := f.GetFromDescrID(r.Signature())
+	if err != nil {
+		vr.err = err
+		return vr
+	}
+	data := od.GetData(f)
+
+	sig, err := readSignature(data)
+	if err != nil {
+		vr.err = err
+		return vr
+	}
+
+	t := sig.CreationTime
+	if v.timestamp {
+		ts, err := checkTimestamp(f, od, data, v.tsaRoots)
+		if err != nil {
+			vr.err = &TimestampError{ID: od.ID, Err: err}
+		} else {
+			t = ts
+			vr.timestamp = ts
+		}
+	}
+
+	// The signature may have been made with a subkey.
+	vr.status = keyStatus(e, *sig.IssuerKeyId, t)
+	if vr.status != KeyValid && vr.err == nil {
+		vr.err = &SigningKeyError{ID: od.ID, Status: vr.status}
+	}
+	return vr
+}
@@ -0,0 +1,342 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package singularity
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hpcng/sif/pkg/sif"
+	"github.com/hpcng/singularity/internal/pkg/util/timestamp/timestamptest"
+	"github.com/sylabs/scs-key-client/client"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// newTestEntity returns a new PGP entity, with a small key to keep tests fast.
+func newTestEntity(t *testing.T) *openpgp.Entity {
+	t.Helper()
+
+	e, err := openpgp.NewEntity("Unit Test", "", "unit@test.com", &packet.Config{RSABits: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestKeyStatus(t *testing.T) {
+	lifetime := uint32(time.Hour / time.Second)
+
+	revocation := func(reason uint8, created time.Time) *packet.Signature {
+		return &packet.Signature{
+			SigType:          packet.SigTypeKeyRevocation,
+			CreationTime:     created,
+			RevocationReason: &reason,
+		}
+	}
+
+	tests := []struct {
+		name       string
+		setup      func(e *openpgp.Entity, created time.Time)
+		subkey     bool
+		after      time.Duration
+		wantStatus KeyStatus
+	}{
+		{
+			name:       "Valid",
+			after:      time.Hour,
+			wantStatus: KeyValid,
+		},
+		{
+			name: "NotExpired",
+			setup: func(e *openpgp.Entity, created time.Time) {
+				primarySelfSignature(e).KeyLifetimeSecs = &lifetime
+			},
+			after:      30 * time.Minute,
+			wantStatus: KeyValid,
+		},
+		{
+			name: "Expired",
+			setup: func(e *openpgp.Entity, created time.Time) {
+				primarySelfSignature(e).KeyLifetimeSecs = &lifetime
+			},
+			after:      2 * time.Hour,
+			wantStatus: KeyExpired,
+		},
+		{
+			name: "ExpiredPrimary",
+			setup: func(e *openpgp.Entity, created time.Time) {
+				primarySelfSignature(e).KeyLifetimeSecs = &lifetime
+			},
+			subkey:     true,
+			after:      2 * time.Hour,
+			wantStatus: KeyExpired,
+		},
+		{
+			name: "ExpiredSubkey",
+			setup: func(e *openpgp.Entity, created time.Time) {
+				e.Subkeys[0].Sig.KeyLifetimeSecs = &lifetime
+			},
+			subkey:     true,
+			after:      2 * time.Hour,
+			wantStatus: KeyExpired,
+		},
+		{
+			name: "Compromised",
+			setup: func(e *openpgp.Entity, created time.Time) {
+				e.Revocations = append(e.Revocations, revocation(2, created.Add(time.Hour)))
+			},
+			after:      30 * time.Minute,
+			wantStatus: KeyRevoked,
+		},
+		{
+			name: "SupersededAfter",
+			setup: func(e *openpgp.Entity, created time.Time) {
+				e.Revocations = append(e.Revocations, revocation(reasonKeySuperseded, created.Add(time.Hour)))
+			},
+			after:      30 * time.Minute,
+			wantStatus: KeyValid,
+		},
+		{
+			name: "RetiredBefore",
+			setup: func(e *openpgp.Entity, created time.Time) {
+				e.Revocations = append(e.Revocations, revocation(reasonKeyRetired, created.Add(time.Hour)))
+			},
+			after:      2 * time.Hour,
+			wantStatus: KeyRevoked,
+		},
+		{
+			name: "RevokedSubkey",
+			setup: func(e *openpgp.Entity, created time.Time) {
+				e.Subkeys[0].Sig = revocation(2, created.Add(time.Hour))
+				e.Subkeys[0].Sig.SigType = packet.SigTypeSubkeyRevocation
+			},
+			subkey:     true,
+			after:      30 * time.Minute,
+			wantStatus: KeyRevoked,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEntity(t)
+			created := e.PrimaryKey.CreationTime
+
+			if tt.setup != nil {
+				tt.setup(e, created)
+			}
+
+			id := e.PrimaryKey.KeyId
+			if tt.subkey {
+				id = e.Subkeys[0].PublicKey.KeyId
+			}
+
+			if got, want := keyStatus(e, id, created.Add(tt.after)), tt.wantStatus; got != want {
+				t.Errorf("got status %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestStatusKeyRing(t *testing.T) {
+	e := newTestEntity(t)
+	reason := uint8(2)
+	e.Revocations = []*packet.Signature{{SigType: packet.SigTypeKeyRevocation, RevocationReason: &reason}}
+
+	el := openpgp.EntityList{e}
+	id := e.PrimaryKey.KeyId
+
+	if keys := el.KeysByIdUsage(id, packet.KeyFlagSign); len(keys) != 0 {
+		t.Fatalf("got %v keys from entity list, want 0", len(keys))
+	}
+
+	kr := statusKeyRing{el}
+	if got, want := len(kr.KeysByIdUsage(id, packet.KeyFlagSign)), 1; got != want {
+		t.Errorf("got %v signing keys, want %v", got, want)
+	}
+	if got, want := len(kr.KeysByIdUsage(e.Subkeys[0].PublicKey.KeyId, packet.KeyFlagSign)), 0; got != want {
+		t.Errorf("got %v signing subkeys, want %v", got, want)
+	}
+}
+
+func TestVerifyExpired(t *testing.T) {
+	// The test entity expired after the test images were signed.
+	e := getTestEntity(t)
+	s := httptest.NewServer(mockHKP{e: e})
+	defer s.Close()
+
+	keyServerOpt := OptVerifyUseKeyServer(client.OptBaseURL(s.URL))
+
+	// Signing modifies the file, so work with a temporary file.
+	path, err := tempFileFrom(filepath.Join("testdata", "images", "one-group.sif"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	if err := Sign(path, OptSignEntitySelector(mockEntitySelector(t))); err != nil {
+		t.Fatalf("failed to sign image: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus KeyStatus
+	}{
+		{
+			name:       "SignedBeforeExpiry",
+			path:       filepath.Join("testdata", "images", "one-group-signed.sif"),
+			wantStatus: KeyValid,
+		},
+		{
+			name:       "SignedAfterExpiry",
+			path:       path,
+			wantStatus: KeyExpired,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cb := func(f *sif.FileImage, r VerifyResult) bool {
+				if got, want := r.KeyStatus(), tt.wantStatus; got != want {
+					t.Errorf("got key status %v, want %v", got, want)
+				}
+				return false
+			}
+
+			err := Verify(context.Background(), tt.path, keyServerOpt, OptVerifyCallback(cb))
+
+			var keyErr *SigningKeyError
+			if tt.wantStatus == KeyValid {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			} else if !errors.As(err, &keyErr) || keyErr.Status != tt.wantStatus {
+				t.Errorf("got error %v, want %v key error", err, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestVerifyTimestamp(t *testing.T) {
+	// Start up a mock HKP server.
+	e := newTestEntity(t)
+	s := httptest.NewServer(mockHKP{e: e})
+	defer s.Close()
+
+	// Start up a local time stamping authority.
+	a, err := timestamptest.NewAuthority()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tsa := httptest.NewServer(a)
+	defer tsa.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(a.Certificate)
+
+	entityOpt := OptSignEntitySelector(func(openpgp.EntityList) (*openpgp.Entity, error) {
+		return e, nil
+	})
+
+	// Signing modifies the file, so work with temporary files.
+	stamped, err := tempFileFrom(filepath.Join("testdata", "images", "one-group.sif"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(stamped)
+
+	if err := Sign(stamped, entityOpt, OptSignTimestamp(tsa.URL)); err != nil {
+		t.Fatalf("failed to sign image: %v", err)
+	}
+
+	unstamped, err := tempFileFrom(filepath.Join("testdata", "images", "one-group.sif"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(unstamped)
+
+	if err := Sign(unstamped, entityOpt); err != nil {
+		t.Fatalf("failed to sign image: %v", err)
+	}
+
+	keyServerOpt := OptVerifyUseKeyServer(client.OptBaseURL(s.URL))
+
+	tests := []struct {
+		name          string
+		path          string
+		opts          []VerifyOpt
+		wantTimestamp bool
+		wantErr       bool
+		wantErrIs     error
+	}{
+		{
+			name: "NotVerified",
+			path: stamped,
+			opts: []VerifyOpt{keyServerOpt},
+		},
+		{
+			name:          "Verified",
+			path:          stamped,
+			opts:          []VerifyOpt{keyServerOpt, OptVerifyTimestamp(roots)},
+			wantTimestamp: true,
+		},
+		{
+			name:    "Untrusted",
+			path:    stamped,
+			opts:    []VerifyOpt{keyServerOpt, OptVerifyTimestamp(x509.NewCertPool())},
+			wantErr: true,
+		},
+		{
+			name:      "NotFound",
+			path:      unstamped,
+			opts:      []VerifyOpt{keyServerOpt, OptVerifyTimestamp(roots)},
+			wantErr:   true,
+			wantErrIs: errTimestampNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var results int
+
+			cb := func(f *sif.FileImage, r VerifyResult) bool {
+				results++
+
+				if got, want := r.KeyStatus(), KeyValid; got != want {
+					t.Errorf("got key status %v, want %v", got, want)
+				}
+				if got, want := !r.Timestamp().IsZero(), tt.wantTimestamp; got != want {
+					t.Errorf("got timestamp %v, want %v", got, want)
+				}
+				return false
+			}
+			tt.opts = append(tt.opts, OptVerifyCallback(cb))
+
+			err := Verify(context.Background(), tt.path, tt.opts...)
+
+			var tsErr *TimestampError
+			if got, want := errors.As(err, &tsErr), tt.wantErr; got != want {
+				t.Errorf("got error %v, want time-stamp error %v", err, want)
+			} else if tt.wantErrIs != nil && !errors.Is(err, tt.wantErrIs) {
+				t.Errorf("got error %v, want %v", err, tt.wantErrIs)
+			}
+
+			if got, want := results, 1; got != want {
+				t.Errorf("got %v results, want %v", got, want)
+			}
+		})
+	}
+}
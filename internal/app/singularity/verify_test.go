@@ -7,6 +7,8 @@ package singularity
 
 import (
 	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"errors"
 	"net/http"
 	"net/http/httptest"
@@ -69,6 +71,8 @@ func (m mockHKP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 func Test_newVerifier(t *testing.T) {
 	opts := []client.Option{client.OptBearerToken("token")}
+	roots := x509.NewCertPool()
+	crl := &pkix.CertificateList{}
 
 	tests := []struct {
 		name         string
@@ -105,6 +109,16 @@ func Test_newVerifier(t *testing.T) {
 			opts:         []VerifyOpt{OptVerifyLegacy()},
 			wantVerifier: verifier{legacy: true},
 		},
+		{
+			name:         "OptVerifyCertificates",
+			opts:         []VerifyOpt{OptVerifyCertificates(roots)},
+			wantVerifier: verifier{roots: roots},
+		},
+		{
+			name:         "OptVerifyCRLs",
+			opts:         []VerifyOpt{OptVerifyCRLs(crl), OptVerifyCRLs(crl)},
+			wantVerifier: verifier{crls: []*pkix.CertificateList{crl, crl}},
+		},
 	}
 
 	for _, tt := range tests {
@@ -136,7 +150,7 @@ func Test_verifier_getOpts(t *testing.T) {
 	}
 	defer oneGroupImage.UnloadContainer()
 
-	cb := func(*sif.FileImage, integrity.VerifyResult) bool { return false }
+	cb := func(*sif.FileImage, VerifyResult) bool { return false }
 
 	tests := []struct {
 		name     string
@@ -165,7 +179,7 @@ func Test_verifier_getOpts(t *testing.T) {
 		{
 			name:     "Defaults",
 			f:        &oneGroupImage,
-			wantOpts: 1,
+			wantOpts: 2,
 		},
 		{
 			name: "ClientConfig",
@@ -175,49 +189,49 @@ func Test_verifier_getOpts(t *testing.T) {
 				},
 			},
 			f:        &oneGroupImage,
-			wantOpts: 1,
+			wantOpts: 2,
 		},
 		{
 			name:     "Group1",
 			v:        verifier{groupIDs: []uint32{1}},
 			f:        &oneGroupImage,
-			wantOpts: 2,
+			wantOpts: 3,
 		},
 		{
 			name:     "Object1",
 			v:        verifier{objectIDs: []uint32{1}},
 			f:        &oneGroupImage,
-			wantOpts: 2,
+			wantOpts: 3,
 		},
 		{
 			name:     "All",
 			v:        verifier{all: true},
 			f:        &oneGroupImage,
-			wantOpts: 1,
+			wantOpts: 2,
 		},
 		{
 			name:     "Legacy",
 			v:        verifier{legacy: true},
 			f:        &oneGroupImage,
-			wantOpts: 3,
+			wantOpts: 4,
 		},
 		{
 			name:     "LegacyGroup1",
 			v:        verifier{legacy: true, groupIDs: []uint32{1}},
 			f:        &oneGroupImage,
-			wantOpts: 3,
+			wantOpts: 4,
 		},
 		{
 			name:     "LegacyObject1",
 			v:        verifier{legacy: true, objectIDs: []uint32{1}},
 			f:        &oneGroupImage,
-			wantOpts: 3,
+			wantOpts: 4,
 		},
 		{
 			name:     "LegacyAll",
 			v:        verifier{legacy: true, all: true},
 			f:        &oneGroupImage,
-			wantOpts: 2,
+			wantOpts: 3,
 		},
 		{
 			name:     "Callback",
@@ -344,7 +358,7 @@ func TestVerify(t *testing.T) {
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			cb := func(f *sif.FileImage, r integrity.VerifyResult) bool {
+			cb := func(f *sif.FileImage, r VerifyResult) bool {
 				if len(tt.wantVerified) == 0 {
 					t.Fatalf("wantVerified consumed")
 				}
@@ -506,7 +520,7 @@ func TestVerifyFingerPrint(t *testing.T) {
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			cb := func(f *sif.FileImage, r integrity.VerifyResult) bool {
+			cb := func(f *sif.FileImage, r VerifyResult) bool {
 				if len(tt.wantVerified) == 0 {
 					t.Fatalf("wantVerified consumed")
 				}
@@ -0,0 +1,279 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package singularity
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hpcng/sif/pkg/integrity"
+	"github.com/hpcng/sif/pkg/sif"
+	"github.com/hpcng/singularity/internal/pkg/util/timestamp/timestamptest"
+	"github.com/sylabs/scs-key-client/client"
+	"golang.org/x/crypto/openpgp"
+)
+
+// testCertificate holds a root certificate and a code signing certificate issued by it.
+type testCertificate struct {
+	root, cert       *x509.Certificate
+	rootKey, certKey crypto.Signer
+}
+
+// newTestCertificate returns a new code signing certificate, issued by a new root certificate.
+func newTestCertificate(t *testing.T) testCertificate {
+	t.Helper()
+
+	var tc testCertificate
+	for _, k := range []*crypto.Signer{&tc.rootKey, &tc.certKey} {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		*k = key
+	}
+
+	now := time.Now()
+	create := func(tmpl, parent *x509.Certificate, key crypto.Signer) *x509.Certificate {
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), tc.rootKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	root := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	tc.root = create(root, root, tc.rootKey)
+
+	tc.cert = create(&x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Test Signer"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}, tc.root, tc.certKey)
+
+	return tc
+}
+
+// roots returns a pool of the root certificate of tc.
+func (tc testCertificate) roots() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(tc.root)
+	return pool
+}
+
+// crl returns a certificate revocation list of the root of tc, revoking the signing certificate.
+func (tc testCertificate) crl(t *testing.T) *pkix.CertificateList {
+	t.Helper()
+
+	rcs := []pkix.RevokedCertificate{{SerialNumber: tc.cert.SerialNumber, RevocationTime: time.Now()}}
+	der, err := tc.root.CreateCRL(rand.Reader, tc.rootKey, rcs, time.Now(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl, err := x509.ParseCRL(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return crl
+}
+
+func TestSignCertificateAndEntity(t *testing.T) {
+	tc := newTestCertificate(t)
+
+	err := Sign(filepath.Join("testdata", "images", "one-group.sif"),
+		OptSignEntitySelector(mockEntitySelector(t)),
+		OptSignCertificate([]*x509.Certificate{tc.cert}, tc.certKey),
+	)
+	if !errors.Is(err, errEntityAndCertificate) {
+		t.Errorf("got error %v, want %v", err, errEntityAndCertificate)
+	}
+}
+
+func TestVerifyCertificates(t *testing.T) {
+	tc := newTestCertificate(t)
+	other := newTestCertificate(t)
+
+	// Start up a mock HKP server.
+	e := newTestEntity(t)
+	s := httptest.NewServer(mockHKP{e: e})
+	defer s.Close()
+
+	keyServerOpt := OptVerifyUseKeyServer(client.OptBaseURL(s.URL))
+
+	// Signing modifies the file, so work with a temporary file. Sign it with both PGP and X.509.
+	path, err := tempFileFrom(filepath.Join("testdata", "images", "one-group.sif"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	entityOpt := OptSignEntitySelector(func(openpgp.EntityList) (*openpgp.Entity, error) {
+		return e, nil
+	})
+	if err := Sign(path, entityOpt); err != nil {
+		t.Fatalf("failed to sign image: %v", err)
+	}
+	if err := Sign(path, OptSignCertificate([]*x509.Certificate{tc.cert}, tc.certKey)); err != nil {
+		t.Fatalf("failed to sign image: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		opts       []VerifyOpt
+		wantX509   bool
+		wantStatus KeyStatus
+		wantErr    error
+	}{
+		{
+			name:       "PGP",
+			path:       path,
+			opts:       []VerifyOpt{keyServerOpt},
+			wantStatus: KeyValid,
+		},
+		{
+			name:       "Certificate",
+			path:       path,
+			opts:       []VerifyOpt{OptVerifyCertificates(tc.roots())},
+			wantX509:   true,
+			wantStatus: KeyValid,
+		},
+		{
+			name:       "Group",
+			path:       path,
+			opts:       []VerifyOpt{OptVerifyCertificates(tc.roots()), OptVerifyGroup(1)},
+			wantX509:   true,
+			wantStatus: KeyValid,
+		},
+		{
+			name:       "Revoked",
+			path:       path,
+			opts:       []VerifyOpt{OptVerifyCertificates(tc.roots()), OptVerifyCRLs(tc.crl(t))},
+			wantX509:   true,
+			wantStatus: KeyRevoked,
+			wantErr:    &integrity.SignatureNotValidError{},
+		},
+		{
+			name:     "UnknownAuthority",
+			path:     path,
+			opts:     []VerifyOpt{OptVerifyCertificates(other.roots())},
+			wantX509: true,
+			wantErr:  &integrity.SignatureNotValidError{},
+		},
+		{
+			name:    "Unsigned",
+			path:    filepath.Join("testdata", "images", "one-group-signed.sif"),
+			opts:    []VerifyOpt{OptVerifyCertificates(tc.roots())},
+			wantErr: &integrity.SignatureNotFoundError{},
+		},
+		{
+			name:    "Legacy",
+			path:    path,
+			opts:    []VerifyOpt{OptVerifyCertificates(tc.roots()), OptVerifyLegacy()},
+			wantErr: errLegacyCertificates,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cb := func(f *sif.FileImage, r VerifyResult) bool {
+				if got, want := r.Entity() == nil, tt.wantX509; got != want {
+					t.Errorf("got X.509 signature %v, want %v", got, want)
+				}
+				if got, want := r.Certificates() != nil, tt.wantX509 && tt.wantErr == nil; got != want {
+					t.Errorf("got certificates %v, want %v", got, want)
+				}
+				if got, want := r.KeyStatus(), tt.wantStatus; got != want {
+					t.Errorf("got key status %v, want %v", got, want)
+				}
+				return false
+			}
+
+			err := Verify(context.Background(), tt.path, append(tt.opts, OptVerifyCallback(cb))...)
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			} else if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyCertificatesTimestamp(t *testing.T) {
+	tc := newTestCertificate(t)
+
+	// Start up a local time stamping authority.
+	a, err := timestamptest.NewAuthority()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tsa := httptest.NewServer(a)
+	defer tsa.Close()
+
+	tsaRoots := x509.NewCertPool()
+	tsaRoots.AddCert(a.Certificate)
+
+	// Signing modifies the file, so work with a temporary file.
+	path, err := tempFileFrom(filepath.Join("testdata", "images", "one-group.sif"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	certOpt := OptSignCertificate([]*x509.Certificate{tc.cert}, tc.certKey)
+	if err := Sign(path, certOpt, OptSignTimestamp(tsa.URL)); err != nil {
+		t.Fatalf("failed to sign image: %v", err)
+	}
+
+	var results int
+	cb := func(f *sif.FileImage, r VerifyResult) bool {
+		results++
+
+		if r.Timestamp().IsZero() {
+			t.Errorf("time stamp not verified")
+		}
+		return false
+	}
+
+	err = Verify(context.Background(), path,
+		OptVerifyCertificates(tc.roots()),
+		OptVerifyTimestamp(tsaRoots),
+		OptVerifyCallback(cb),
+	)
+	if err != nil {
+		t.Errorf("failed to verify: %v", err)
+	}
+	if got, want := results, 1; got != want {
+		t.Errorf("got %v results, want %v", got, want)
+	}
+}
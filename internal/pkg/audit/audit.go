@@ -0,0 +1,69 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package audit records container launches, for site administrators to keep
+// track of who ran which image and how. Records are sent to the sink selected
+// in singularity.conf, see NewWriter.
+package audit
+
+import (
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// EventStart is the event of a record emitted once the container is created.
+	EventStart = "start"
+	// EventExit is the event of a record emitted once the container is torn down.
+	EventExit = "exit"
+)
+
+// Record describes a container launch.
+type Record struct {
+	Time        time.Time `json:"time"`
+	Event       string    `json:"event"`
+	ContainerID string    `json:"containerID"`
+	Instance    bool      `json:"instance,omitempty"`
+	UID         int       `json:"uid"`
+	GID         int       `json:"gid"`
+	User        string    `json:"user,omitempty"`
+	Image       string    `json:"image"`
+	Digest      string    `json:"digest,omitempty"`
+	Signers     []string  `json:"signers,omitempty"`
+	Binds       []string  `json:"binds,omitempty"`
+	Namespaces  []string  `json:"namespaces,omitempty"`
+	Fakeroot    bool      `json:"fakeroot"`
+	Setuid      bool      `json:"setuid"`
+	Args        []string  `json:"args,omitempty"`
+	ExitCode    *int      `json:"exitCode,omitempty"`
+	Signal      string    `json:"signal,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// Start returns a copy of r for the start event.
+func (r Record) Start() *Record {
+	r.Time = time.Now().UTC()
+	r.Event = EventStart
+	return &r
+}
+
+// Exit returns a copy of r for the exit event of a container with the given
+// wait status, or for a container which failed with the fatal error.
+func (r Record) Exit(fatal error, status syscall.WaitStatus) *Record {
+	r.Time = time.Now().UTC()
+	r.Event = EventExit
+
+	if fatal != nil {
+		r.Error = fatal.Error()
+	} else if status.Signaled() {
+		r.Signal = unix.SignalName(status.Signal())
+	} else {
+		code := status.ExitStatus()
+		r.ExitCode = &code
+	}
+	return &r
+}
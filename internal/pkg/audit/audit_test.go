@@ -0,0 +1,233 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+var testRecord = Record{
+	ContainerID: "test",
+	UID:         1000,
+	GID:         1000,
+	User:        "user",
+	Image:       "/tmp/test.sif",
+	Digest:      "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+	Signers:     []string{"8883491F4268F173C6E5DC49EDECE4F3F38D871E"},
+	Binds:       []string{"/tmp:/tmp"},
+	Namespaces:  []string{"mnt", "pid"},
+	Setuid:      true,
+	Args:        []string{"/bin/true"},
+}
+
+// readRecords returns the records read as JSON lines from r.
+func readRecords(r io.Reader) ([]Record, error) {
+	var records []Record
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		var rec Record
+		if err := json.Unmarshal(s.Bytes(), &rec); err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	return records, s.Err()
+}
+
+func TestExit(t *testing.T) {
+	zero, one := 0, 1
+
+	tests := []struct {
+		name       string
+		fatal      error
+		status     syscall.WaitStatus
+		wantCode   *int
+		wantSignal string
+		wantError  string
+	}{
+		{
+			name:     "Success",
+			status:   0,
+			wantCode: &zero,
+		},
+		{
+			name:     "Failure",
+			status:   1 << 8,
+			wantCode: &one,
+		},
+		{
+			name:       "Signaled",
+			status:     syscall.WaitStatus(syscall.SIGKILL),
+			wantSignal: "SIGKILL",
+		},
+		{
+			name:      "Fatal",
+			fatal:     errors.New("container failed"),
+			wantError: "container failed",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			r := testRecord.Exit(tt.fatal, tt.status)
+
+			if got, want := r.Event, EventExit; got != want {
+				t.Errorf("got event %v, want %v", got, want)
+			}
+			if got, want := r.ExitCode, tt.wantCode; !reflect.DeepEqual(got, want) {
+				t.Errorf("got exit code %v, want %v", got, want)
+			}
+			if got, want := r.Signal, tt.wantSignal; got != want {
+				t.Errorf("got signal %v, want %v", got, want)
+			}
+			if got, want := r.Error, tt.wantError; got != want {
+				t.Errorf("got error %v, want %v", got, want)
+			}
+		})
+	}
+
+	if testRecord.Event != "" || testRecord.ExitCode != nil {
+		t.Errorf("record modified by Exit")
+	}
+}
+
+func TestNewWriter(t *testing.T) {
+	tests := []struct {
+		name string
+		sink string
+		path string
+	}{
+		{name: "None", sink: SinkNone},
+		{name: "Unknown", sink: "journal"},
+		{name: "FileNoPath", sink: SinkFile},
+		{name: "SocketNoPath", sink: SinkSocket},
+		{name: "FileNotExist", sink: SinkFile, path: filepath.Join(t.TempDir(), "missing", "audit.log")},
+		{name: "SocketNotExist", sink: SinkSocket, path: filepath.Join(t.TempDir(), "audit.sock")},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewWriter(tt.sink, tt.path); err == nil {
+				t.Errorf("unexpected success")
+			}
+		})
+	}
+}
+
+func TestFileWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	want := []Record{*testRecord.Start(), *testRecord.Exit(nil, 0)}
+
+	// Each record is written by a different writer, as from different processes.
+	for i := range want {
+		w, err := NewWriter(SinkFile, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Write(&want[i]); err != nil {
+			t.Errorf("failed to write record: %v", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fi.Mode().Perm(), os.FileMode(0o600); got != want {
+		t.Errorf("got mode %v, want %v", got, want)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	got, err := readRecords(f)
+	if err != nil {
+		t.Fatalf("failed to read records: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v records, want %v", len(got), len(want))
+	}
+	for i := range got {
+		if !got[i].Time.Equal(want[i].Time) {
+			t.Errorf("got time %v, want %v", got[i].Time, want[i].Time)
+		}
+		got[i].Time = want[i].Time
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("got record %+v, want %+v", got[i], want[i])
+		}
+	}
+}
+
+func TestSocketWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.sock")
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	type result struct {
+		records []Record
+		err     error
+	}
+	results := make(chan result, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			results <- result{err: err}
+			return
+		}
+		defer c.Close()
+		records, err := readRecords(c)
+		results <- result{records, err}
+	}()
+
+	w, err := NewWriter(SinkSocket, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(testRecord.Start()); err != nil {
+		t.Errorf("failed to write record: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	res := <-results
+	if res.err != nil {
+		t.Fatalf("failed to read records: %v", res.err)
+	}
+	got := res.records
+	if len(got) != 1 {
+		t.Fatalf("got %v records, want 1", len(got))
+	}
+	if got, want := got[0].Event, EventStart; got != want {
+		t.Errorf("got event %v, want %v", got, want)
+	}
+	if got, want := got[0].Digest, testRecord.Digest; got != want {
+		t.Errorf("got digest %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+	"net"
+	"os"
+	"time"
+)
+
+const (
+	// SinkNone disables audit logging.
+	SinkNone = "none"
+	// SinkSyslog sends records to the local syslog daemon.
+	SinkSyslog = "syslog"
+	// SinkFile appends records to a JSON lines file.
+	SinkFile = "file"
+	// SinkSocket sends records to a listener on a Unix socket.
+	SinkSocket = "socket"
+)
+
+// socketTimeout bounds the time spent connecting and writing to an audit
+// socket, so that a stuck listener can't hang container launches.
+const socketTimeout = 5 * time.Second
+
+// Writer writes audit records to a sink.
+type Writer interface {
+	Write(r *Record) error
+	Close() error
+}
+
+// NewWriter returns a Writer for the sink: SinkSyslog, SinkFile or
+// SinkSocket. The path is the JSON lines file for SinkFile and the
+// socket for SinkSocket, it is ignored for SinkSyslog.
+func NewWriter(sink, path string) (Writer, error) {
+	if (sink == SinkFile || sink == SinkSocket) && path == "" {
+		return nil, fmt.Errorf("no path specified for audit log %s", sink)
+	}
+
+	switch sink {
+	case SinkSyslog:
+		w, err := syslog.New(syslog.LOG_AUTHPRIV|syslog.LOG_INFO, "singularity")
+		if err != nil {
+			return nil, fmt.Errorf("while connecting to syslog: %s", err)
+		}
+		return &syslogWriter{w: w}, nil
+	case SinkFile:
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("while opening audit log %s: %s", path, err)
+		}
+		return &fileWriter{f: f}, nil
+	case SinkSocket:
+		c, err := net.DialTimeout("unix", path, socketTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("while connecting to audit socket %s: %s", path, err)
+		}
+		return &socketWriter{c: c}, nil
+	}
+	return nil, fmt.Errorf("unknown audit log sink %q", sink)
+}
+
+// marshalLine returns r encoded as a JSON line.
+func marshalLine(r *Record) ([]byte, error) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return nil, fmt.Errorf("while encoding audit record: %s", err)
+	}
+	return append(b, '\n'), nil
+}
+
+type syslogWriter struct {
+	w *syslog.Writer
+}
+
+func (s *syslogWriter) Write(r *Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("while encoding audit record: %s", err)
+	}
+	return s.w.Info(string(b))
+}
+
+func (s *syslogWriter) Close() error {
+	return s.w.Close()
+}
+
+type fileWriter struct {
+	f *os.File
+}
+
+// Write appends r as a single write, so that concurrent containers don't
+// interleave their records.
+func (f *fileWriter) Write(r *Record) error {
+	b, err := marshalLine(r)
+	if err != nil {
+		return err
+	}
+	if _, err := f.f.Write(b); err != nil {
+		return fmt.Errorf("while writing audit record: %s", err)
+	}
+	return nil
+}
+
+func (f *fileWriter) Close() error {
+	return f.f.Close()
+}
+
+type socketWriter struct {
+	c net.Conn
+}
+
+func (s *socketWriter) Write(r *Record) error {
+	b, err := marshalLine(r)
+	if err != nil {
+		return err
+	}
+	if err := s.c.SetWriteDeadline(time.Now().Add(socketTimeout)); err != nil {
+		return err
+	}
+	if _, err := s.c.Write(b); err != nil {
+		return fmt.Errorf("while writing audit record: %s", err)
+	}
+	return nil
+}
+
+func (s *socketWriter) Close() error {
+	return s.c.Close()
+}
@@ -6,8 +6,12 @@
 package assemblers
 
 import (
+	"crypto/sha256"
 	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"regexp"
@@ -21,6 +25,8 @@ import (
 	"github.com/hpcng/singularity/internal/pkg/util/crypt"
 	"github.com/hpcng/singularity/internal/pkg/util/machine"
 	"github.com/hpcng/singularity/pkg/build/types"
+	"github.com/hpcng/singularity/pkg/image"
+	"github.com/hpcng/singularity/pkg/inspect"
 	"github.com/hpcng/singularity/pkg/sylog"
 	"github.com/hpcng/singularity/pkg/util/cryptkey"
 	uuid "github.com/satori/go.uuid"
@@ -28,10 +34,15 @@ import (
 
 // SIFAssembler doesn't store anything.
 type SIFAssembler struct {
-	GzipFlag        bool
-	MksquashfsProcs uint
-	MksquashfsMem   string
-	MksquashfsPath  string
+	// Compression is the compression of the squashfs filesystem
+	// recorded in the image metadata.
+	Compression string
+	// CompressionFlags are the mksquashfs options selecting the
+	// compression.
+	CompressionFlags []string
+	MksquashfsProcs  uint
+	MksquashfsMem    string
+	MksquashfsPath   string
 }
 
 type encryptionOptions struct {
@@ -42,7 +53,12 @@ type encryptionOptions struct {
 func createSIF(path string, b *types.Bundle, squashfile string, encOpts *encryptionOptions, arch string) (err error) {
 	definition := b.Recipe.Raw
 
-	id, err := uuid.NewV4()
+	var id uuid.UUID
+	if b.Opts.Reproducible {
+		id, err = reproducibleID(definition, squashfile)
+	} else {
+		id, err = uuid.NewV4()
+	}
 	if err != nil {
 		return fmt.Errorf("sif id generation failed: %v", err)
 	}
@@ -163,6 +179,13 @@ func createSIF(path string, b *types.Bundle, squashfile string, encOpts *encrypt
 		return fmt.Errorf("while creating container: %s", err)
 	}
 
+	if b.Opts.Reproducible {
+		if err := setReproducibleHeader(f, b.Opts.SourceDateEpoch); err != nil {
+			f.UnloadContainer()
+			return fmt.Errorf("while setting reproducible SIF header: %s", err)
+		}
+	}
+
 	if err := f.UnloadContainer(); err != nil {
 		return fmt.Errorf("while unloading container: %w", err)
 	}
@@ -177,6 +200,53 @@ func createSIF(path string, b *types.Bundle, squashfile string, encOpts *encrypt
 	return nil
 }
 
+// reproducibleID returns a SIF ID derived from the content of the
+// definition and of the squashfs file.
+func reproducibleID(definition []byte, squashfile string) (uuid.UUID, error) {
+	f, err := os.Open(squashfile)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	h.Write(definition)
+	if _, err := io.Copy(h, f); err != nil {
+		return uuid.Nil, err
+	}
+
+	return uuid.NewV5(uuid.NamespaceOID, hex.EncodeToString(h.Sum(nil))), nil
+}
+
+// setReproducibleHeader sets the creation and modification times of the
+// header and descriptors of the SIF file f to epoch, and the descriptor
+// owners to root, and writes them back to the file.
+func setReproducibleHeader(f *sif.FileImage, epoch int64) error {
+	f.Header.Ctime = epoch
+	f.Header.Mtime = epoch
+
+	for i := range f.DescrArr {
+		if !f.DescrArr[i].Used {
+			continue
+		}
+		f.DescrArr[i].Ctime = epoch
+		f.DescrArr[i].Mtime = epoch
+		f.DescrArr[i].UID = 0
+		f.DescrArr[i].Gid = 0
+	}
+
+	if _, err := f.Fp.Seek(sif.DescrStartOffset, io.SeekStart); err != nil {
+		return err
+	}
+	if err := binary.Write(f.Fp, binary.LittleEndian, f.DescrArr); err != nil {
+		return err
+	}
+	if _, err := f.Fp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return binary.Write(f.Fp, binary.LittleEndian, f.Header)
+}
+
 // Assemble creates a SIF image from a Bundle.
 func (a *SIFAssembler) Assemble(b *types.Bundle, path string) error {
 	sylog.Infof("Creating SIF file...")
@@ -199,15 +269,18 @@ func (a *SIFAssembler) Assemble(b *types.Bundle, path string) error {
 		flags = append(flags, "-all-root")
 	}
 	// specify compression if needed
-	if a.GzipFlag {
-		flags = append(flags, "-comp", "gzip")
-	}
+	flags = append(flags, a.CompressionFlags...)
 	if a.MksquashfsMem != "" {
 		flags = append(flags, "-mem", a.MksquashfsMem)
 	}
 	if a.MksquashfsProcs != 0 {
 		flags = append(flags, "-processors", fmt.Sprint(a.MksquashfsProcs))
 	}
+	if b.Opts.Reproducible {
+		// requires squashfs-tools >= 4.4
+		epoch := strconv.FormatInt(b.Opts.SourceDateEpoch, 10)
+		flags = append(flags, "-reproducible", "-mkfs-time", epoch, "-all-time", epoch)
+	}
 	arch := machine.ArchFromContainer(b.RootfsPath)
 	if arch == "" {
 		sylog.Infof("Architecture not recognized, use native")
@@ -219,6 +292,10 @@ func (a *SIFAssembler) Assemble(b *types.Bundle, path string) error {
 		return fmt.Errorf("while creating squashfs: %v", err)
 	}
 
+	if err := a.insertCompression(b); err != nil {
+		return err
+	}
+
 	var encOpts *encryptionOptions
 
 	if b.Opts.EncryptionKeyInfo != nil {
@@ -257,6 +334,29 @@ func (a *SIFAssembler) Assemble(b *types.Bundle, path string) error {
 	return nil
 }
 
+// insertCompression records the compression of the squashfs filesystem
+// in the inspect metadata of the image.
+func (a *SIFAssembler) insertCompression(b *types.Bundle) error {
+	data, ok := b.JSONObjects[image.SIFDescInspectMetadataJSON]
+	if !ok || a.Compression == "" {
+		return nil
+	}
+
+	metadata := new(inspect.Metadata)
+	if err := json.Unmarshal(data, metadata); err != nil {
+		return fmt.Errorf("while decoding inspect metadata: %s", err)
+	}
+	metadata.Attributes.Compression = a.Compression
+
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("while encoding inspect metadata: %s", err)
+	}
+	b.JSONObjects[image.SIFDescInspectMetadataJSON] = data
+
+	return nil
+}
+
 // changeOwner check the command being called with sudo with the environment
 // variable SUDO_COMMAND. Pattern match that for the singularity bin.
 func changeOwner() (int, int, bool) {
@@ -1,4 +1,4 @@
-// Copyright (c) 2019-2020, Sylabs Inc. All rights reserved.
+// Copyright (c) 2019-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -15,6 +15,7 @@ import (
 	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/hpcng/singularity/internal/pkg/util/fs"
 	"github.com/hpcng/singularity/pkg/util/fs/proc"
@@ -27,6 +28,7 @@ import (
 	"github.com/hpcng/singularity/internal/pkg/image/packer"
 	"github.com/hpcng/singularity/internal/pkg/util/fs/squashfs"
 	"github.com/hpcng/singularity/internal/pkg/util/uri"
+	"github.com/hpcng/singularity/pkg/build/events"
 	"github.com/hpcng/singularity/pkg/build/types"
 	"github.com/hpcng/singularity/pkg/build/types/parser"
 	"github.com/hpcng/singularity/pkg/image"
@@ -55,6 +57,17 @@ type Config struct {
 	// NoCleanUp allows a user to prevent a bundle from being cleaned
 	// up after a failed build, useful for debugging.
 	NoCleanUp bool
+	// Compression is the compression of the SIF root filesystem in the
+	// algorithm[:level] format, the configuration file default is used
+	// if empty.
+	Compression string
+	// Events receives the progress events of the build, if set.
+	Events events.Handler
+	// Jobs is the maximum number of stages built concurrently.
+	Jobs int
+	// Target is the name of the stage to build, the last stage is
+	// built if empty.
+	Target string
 	// Opts for bundles.
 	Opts types.Options
 }
@@ -101,6 +114,12 @@ func newBuild(defs []types.Definition, conf Config) (*Build, error) {
 		return nil, fmt.Errorf("failed to retrieve mount information: %v", err)
 	}
 
+	// only build the stages needed by the target stage
+	defs, deps, err := selectStages(defs, conf.Target)
+	if err != nil {
+		return nil, err
+	}
+
 	lastStageIndex := len(defs) - 1
 
 	// create stages
@@ -129,6 +148,7 @@ func newBuild(defs []types.Definition, conf Config) (*Build, error) {
 			return nil, err
 		}
 		s.name = d.Header["stage"]
+		s.deps = deps[i]
 		s.b.Recipe = d
 
 		if conf.Format == "sandbox" && lastStageIndex == i {
@@ -193,7 +213,16 @@ func newBuild(defs []types.Definition, conf Config) (*Build, error) {
 			return nil, fmt.Errorf("while searching for mksquashfs: %v", err)
 		}
 
-		flag, err := ensureGzipComp(b.stages[lastStageIndex].b.TmpDir, mksquashfsPath)
+		var comp squashfs.Compression
+		if conf.Compression != "" {
+			comp, err = squashfs.ParseCompression(conf.Compression)
+		} else {
+			comp, err = squashfs.GetCompression()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("while getting compression algorithm: %v", err)
+		}
+		compFlags, err := ensureComp(b.stages[lastStageIndex].b.TmpDir, mksquashfsPath, comp)
 		if err != nil {
 			return nil, fmt.Errorf("while ensuring correct compression algorithm: %v", err)
 		}
@@ -206,10 +235,11 @@ func newBuild(defs []types.Definition, conf Config) (*Build, error) {
 			return nil, fmt.Errorf("while searching for mksquashfs mem limits: %v", err)
 		}
 		b.stages[lastStageIndex].a = &assemblers.SIFAssembler{
-			GzipFlag:        flag,
-			MksquashfsProcs: mksquashfsProcs,
-			MksquashfsMem:   mksquashfsMem,
-			MksquashfsPath:  mksquashfsPath,
+			Compression:      comp.String(),
+			CompressionFlags: compFlags,
+			MksquashfsProcs:  mksquashfsProcs,
+			MksquashfsMem:    mksquashfsMem,
+			MksquashfsPath:   mksquashfsPath,
 		}
 	default:
 		return nil, fmt.Errorf("unrecognized output format %s", conf.Format)
@@ -218,40 +248,43 @@ func newBuild(defs []types.Definition, conf Config) (*Build, error) {
 	return b, nil
 }
 
-// ensureGzipComp builds dummy squashfs images and checks the type of compression used
-// to deduce if we can successfully build with gzip compression. It returns an error
-// if we cannot and a boolean to indicate if the `-comp` flag is needed to specify
-// gzip compression when the final squashfs is built
-func ensureGzipComp(tmpdir, mksquashfsPath string) (bool, error) {
-	sylog.Debugf("Ensuring gzip compression for mksquashfs")
+// ensureComp builds dummy squashfs images to check that mksquashfs supports
+// the compression comp. It returns an error if it doesn't and the mksquashfs
+// options selecting the compression. For gzip without compression level, no
+// option is returned if gzip is already the default mksquashfs compression,
+// as the `-comp` flag is not supported by old mksquashfs versions.
+func ensureComp(tmpdir, mksquashfsPath string, comp squashfs.Compression) ([]string, error) {
+	sylog.Debugf("Ensuring %s compression for mksquashfs", comp)
 
 	var err error
 	s := packer.NewSquashfs()
 	s.MksquashfsPath = mksquashfsPath
 
-	srcf, err := ioutil.TempFile(tmpdir, "squashfs-gzip-comp-test-src")
+	srcf, err := ioutil.TempFile(tmpdir, "squashfs-comp-test-src")
 	if err != nil {
-		return false, fmt.Errorf("while creating temporary file for squashfs source: %v", err)
+		return nil, fmt.Errorf("while creating temporary file for squashfs source: %v", err)
 	}
+	defer os.Remove(srcf.Name())
 
 	srcf.Write([]byte("Test File Content"))
 	srcf.Close()
 
-	f, err := ioutil.TempFile(tmpdir, "squashfs-gzip-comp-test-")
+	f, err := ioutil.TempFile(tmpdir, "squashfs-comp-test-")
 	if err != nil {
-		return false, fmt.Errorf("while creating temporary file for squashfs: %v", err)
+		return nil, fmt.Errorf("while creating temporary file for squashfs: %v", err)
 	}
+	defer os.Remove(f.Name())
 	f.Close()
 
 	flags := []string{"-noappend"}
 
 	mksquashfsProcs, err := squashfs.GetProcs()
 	if err != nil {
-		return false, fmt.Errorf("while searching for mksquashfs processor limits: %v", err)
+		return nil, fmt.Errorf("while searching for mksquashfs processor limits: %v", err)
 	}
 	mksquashfsMem, err := squashfs.GetMem()
 	if err != nil {
-		return false, fmt.Errorf("while searching for mksquashfs mem limits: %v", err)
+		return nil, fmt.Errorf("while searching for mksquashfs mem limits: %v", err)
 	}
 	if mksquashfsMem != "" {
 		flags = append(flags, "-mem", mksquashfsMem)
@@ -260,48 +293,47 @@ func ensureGzipComp(tmpdir, mksquashfsPath string) (bool, error) {
 		flags = append(flags, "-processors", fmt.Sprint(mksquashfsProcs))
 	}
 
-	if err := s.Create([]string{srcf.Name()}, f.Name(), flags); err != nil {
-		return false, fmt.Errorf("while creating squashfs: %v", err)
-	}
-
-	content, err := ioutil.ReadFile(f.Name())
-	if err != nil {
-		return false, fmt.Errorf("while reading test squashfs: %v", err)
-	}
-
-	comp, err := image.GetSquashfsComp(content)
-	if err != nil {
-		return false, fmt.Errorf("could not verify squashfs compression type: %v", err)
-	}
-
-	if comp == "gzip" {
-		sylog.Debugf("Gzip compression by default ensured")
-		return false, nil
-	}
+	// getComp builds the test squashfs with compFlags and returns the
+	// compression used
+	getComp := func(compFlags []string) (string, error) {
+		if err := s.Create([]string{srcf.Name()}, f.Name(), append(flags, compFlags...)); err != nil {
+			return "", err
+		}
 
-	// Now force add `-comp gzip` in addition to -noappend -mem -processors
-	flags = append(flags, "-comp", "gzip")
+		content, err := ioutil.ReadFile(f.Name())
+		if err != nil {
+			return "", fmt.Errorf("while reading test squashfs: %v", err)
+		}
 
-	if err := s.Create([]string{srcf.Name()}, f.Name(), flags); err != nil {
-		return false, fmt.Errorf("could not build squashfs with required gzip compression")
+		compType, err := image.GetSquashfsComp(content)
+		if err != nil {
+			return "", fmt.Errorf("could not verify squashfs compression type: %v", err)
+		}
+		return compType, nil
 	}
 
-	content, err = ioutil.ReadFile(f.Name())
-	if err != nil {
-		return false, fmt.Errorf("while reading test squashfs: %v", err)
+	if comp.Algorithm == "gzip" && comp.Level == 0 {
+		compType, err := getComp(nil)
+		if err != nil {
+			return nil, fmt.Errorf("while creating squashfs: %v", err)
+		}
+		if compType == "gzip" {
+			sylog.Debugf("Gzip compression by default ensured")
+			return nil, nil
+		}
 	}
 
-	comp, err = image.GetSquashfsComp(content)
+	// Now force add `-comp` in addition to -noappend -mem -processors
+	compType, err := getComp(comp.Flags())
 	if err != nil {
-		return false, fmt.Errorf("could not verify squashfs compression type: %v", err)
+		return nil, fmt.Errorf("could not build squashfs with %s compression, it may not be supported by mksquashfs: %v", comp, err)
 	}
-
-	if comp == "gzip" {
-		sylog.Debugf("Gzip compression with -comp flag ensured")
-		return true, nil
+	if compType != comp.Algorithm {
+		return nil, fmt.Errorf("could not build squashfs with required %s compression", comp)
 	}
 
-	return false, fmt.Errorf("could not build squashfs with required gzip compression")
+	sylog.Debugf("%s compression with -comp flag ensured", comp)
+	return comp.Flags(), nil
 }
 
 // cleanUp removes remnants of build from file system unless NoCleanUp is specified.
@@ -324,8 +356,58 @@ func (b Build) cleanUp() {
 	}
 }
 
+// emit reports the build event e to the configured event handler.
+func (b *Build) emit(e events.Event) {
+	if b.Conf.Events == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b.Conf.Events.Handle(e)
+}
+
+// runStep runs fn as the build step of stage s, and reports its start,
+// its end or its failure with its duration.
+func (b *Build) runStep(s *stage, step events.Step, fn func() error) error {
+	start := time.Now()
+	b.emit(events.Event{Type: events.StepStart, Time: start, Stage: s.name, Step: step})
+
+	if err := fn(); err != nil {
+		e := events.Failure(events.StepFailed, err)
+		e.Stage = s.name
+		e.Step = step
+		e.Duration = time.Since(start)
+		b.emit(e)
+		return err
+	}
+
+	b.emit(events.Event{Type: events.StepEnd, Stage: s.name, Step: step, Duration: time.Since(start)})
+	return nil
+}
+
+// skipStep reports the build step of stage s as restored from the step cache.
+func (b *Build) skipStep(s *stage, step events.Step) {
+	b.emit(events.Event{Type: events.StepCached, Stage: s.name, Step: step})
+}
+
 // Full runs a standard build from start to finish.
 func (b *Build) Full(ctx context.Context) error {
+	start := time.Now()
+	b.emit(events.Event{Type: events.BuildStart, Time: start})
+
+	if err := b.full(ctx); err != nil {
+		e := events.Failure(events.BuildFailed, err)
+		e.Duration = time.Since(start)
+		b.emit(e)
+		return err
+	}
+
+	b.emit(events.Event{Type: events.BuildEnd, Duration: time.Since(start)})
+	return nil
+}
+
+func (b *Build) full(ctx context.Context) error {
 	sylog.Infof("Starting build...")
 
 	// monitor build for termination signal and clean up
@@ -371,117 +453,203 @@ func (b *Build) Full(ctx context.Context) error {
 	}
 	configData := buffer.Bytes()
 
-	// build each stage one after the other
-	for i, stage := range b.stages {
-		if err := stage.runSectionScript("pre", stage.b.Recipe.BuildData.Pre); err != nil {
+	// build the stages once the stages they copy files from are built
+	err = b.runStages(ctx, b.Conf.Jobs, func(ctx context.Context, i int) error {
+		return b.buildStage(ctx, i, configData)
+	})
+	if err != nil {
+		return err
+	}
+
+	syscall.Umask(oldumask)
+
+	last := &b.stages[len(b.stages)-1]
+	if b.Conf.Opts.Reproducible {
+		if err := clampTimes(last.b.RootfsPath, b.Conf.Opts.BuildTime()); err != nil {
 			return err
 		}
+	}
 
-		// only update last stage if specified
-		update := stage.b.Opts.Update && !stage.b.Opts.Force && i == len(b.stages)-1
-		if update {
-			// updating, extract dest container to bundle
-			sylog.Infof("Building into existing container: %s", b.Conf.Dest)
-			p, err := sources.GetLocalPacker(ctx, b.Conf.Dest, stage.b)
-			if err != nil {
-				return err
-			}
+	sylog.Debugf("Calling assembler")
+	if err := b.runStep(last, events.Assemble, func() error { return last.Assemble(b.Conf.Dest) }); err != nil {
+		return err
+	}
+
+	sylog.Verbosef("Build complete: %s", b.Conf.Dest)
+	return nil
+}
+
+// buildStage builds the root filesystem of the stage i, configData is
+// the configuration file used to run the %post and %test sections.
+func (b *Build) buildStage(ctx context.Context, i int, configData []byte) error {
+	stage := &b.stages[i]
+	stageStart := time.Now()
+	b.emit(events.Event{Type: events.StageStart, Time: stageStart, Stage: stage.name})
+
+	if stage.hasSectionScript("pre", stage.b.Recipe.BuildData.Pre) {
+		err := b.runStep(stage, events.Pre, func() error {
+			return stage.runSectionScript("pre", stage.b.Recipe.BuildData.Pre)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// only update last stage if specified
+	update := stage.b.Opts.Update && !stage.b.Opts.Force && i == len(b.stages)-1
 
-			_, err = p.Pack(ctx)
+	var sc *stepCache
+	var err error
+
+	if update {
+		// updating, extract dest container to bundle
+		sylog.Infof("Building into existing container: %s", b.Conf.Dest)
+		p, err := sources.GetLocalPacker(ctx, b.Conf.Dest, stage.b)
+		if err != nil {
+			return err
+		}
+
+		_, err = p.Pack(ctx)
+		if err != nil {
+			return err
+		}
+	} else {
+		// regular build or force, start build from scratch
+		if b.Conf.Opts.ImgCache == nil {
+			return fmt.Errorf("undefined image cache")
+		}
+
+		// restore the root filesystem of cached build steps
+		sc, err = b.newStepCache(ctx, i)
+		if err != nil {
+			return err
+		}
+		defer sc.close()
+
+		if !sc.skip(stepFiles) {
+			err := b.runStep(stage, events.Get, func() error {
+				return stage.c.Get(ctx, stage.b)
+			})
 			if err != nil {
-				return err
-			}
-		} else {
-			// regular build or force, start build from scratch
-			if b.Conf.Opts.ImgCache == nil {
-				return fmt.Errorf("undefined image cache")
-			}
-			if err := stage.c.Get(ctx, stage.b); err != nil {
 				return fmt.Errorf("conveyor failed to get: %v", err)
 			}
 
-			_, err := stage.c.Pack(ctx)
+			err = b.runStep(stage, events.Pack, func() error {
+				_, err := stage.c.Pack(ctx)
+				return err
+			})
 			if err != nil {
 				return fmt.Errorf("packer failed to pack: %v", err)
 			}
+		} else {
+			b.skipStep(stage, events.Get)
+			b.skipStep(stage, events.Pack)
 		}
+	}
 
-		// create apps in bundle
-		a := apps.New()
-		for k, v := range stage.b.Recipe.CustomData {
-			a.HandleSection(k, v)
-		}
+	// create apps in bundle
+	a := apps.New()
+	for k, v := range stage.b.Recipe.CustomData {
+		a.HandleSection(k, v)
+	}
 
+	if !sc.skip(stepFiles) {
 		a.HandleBundle(stage.b)
-		appPost, err := a.HandlePost(stage.b)
-		if err != nil {
-			return fmt.Errorf("unable to get app post information: %v", err)
-		}
-		stage.b.Recipe.BuildData.Post.Script += appPost
+	}
+	appPost, err := a.HandlePost(stage.b)
+	if err != nil {
+		return fmt.Errorf("unable to get app post information: %v", err)
+	}
+	stage.b.Recipe.BuildData.Post.Script += appPost
 
+	if !sc.skip(stepFiles) {
 		// copy potential files from previous stage
-		if stage.b.RunSection("files") {
-			if err := stage.copyFilesFrom(b); err != nil {
+		if stage.b.RunSection("files") && len(stage.deps) > 0 {
+			if err := b.runStep(stage, events.FilesFrom, func() error { return stage.copyFilesFrom(b) }); err != nil {
 				return fmt.Errorf("unable to copy files from stage to container fs: %v", err)
 			}
 		}
 
-		if err := stage.runSectionScript("setup", stage.b.Recipe.BuildData.Setup); err != nil {
-			return err
+		if stage.hasSectionScript("setup", stage.b.Recipe.BuildData.Setup) {
+			err := b.runStep(stage, events.Setup, func() error {
+				return stage.runSectionScript("setup", stage.b.Recipe.BuildData.Setup)
+			})
+			if err != nil {
+				return err
+			}
 		}
 
 		// copy files from host
 		if stage.b.RunSection("files") {
-			if err := stage.copyFiles(); err != nil {
+			if err := b.runStep(stage, events.Files, stage.copyFiles); err != nil {
 				return fmt.Errorf("unable to copy files from host to container fs: %v", err)
 			}
 		}
 
-		// create stage file for /etc/resolv.conf and /etc/hosts
-		sessionResolv, err := createStageFile("/etc/resolv.conf", stage.b, "Name resolution could fail")
-		if err != nil {
-			return err
-		} else if sessionResolv != "" {
-			defer os.Remove(sessionResolv)
-		}
-		sessionHosts, err := createStageFile("/etc/hosts", stage.b, "Host resolution could fail")
-		if err != nil {
-			return err
-		} else if sessionHosts != "" {
-			defer os.Remove(sessionHosts)
+		if err := sc.save(stepFiles); err != nil {
+			return fmt.Errorf("while caching build step: %v", err)
 		}
+	} else {
+		b.skipStep(stage, events.Files)
+	}
 
-		// write the build configuration used for %post and %test sections
-		configFile := filepath.Join(stage.b.TmpDir, "singularity.conf")
-		if err := ioutil.WriteFile(configFile, configData, 0o644); err != nil {
-			return fmt.Errorf("while creating %s: %s", configFile, err)
-		}
-		defer os.Remove(configFile)
+	// create stage file for /etc/resolv.conf and /etc/hosts
+	sessionResolv, err := createStageFile("/etc/resolv.conf", stage.b, "Name resolution could fail")
+	if err != nil {
+		return err
+	} else if sessionResolv != "" {
+		defer os.Remove(sessionResolv)
+	}
+	sessionHosts, err := createStageFile("/etc/hosts", stage.b, "Host resolution could fail")
+	if err != nil {
+		return err
+	} else if sessionHosts != "" {
+		defer os.Remove(sessionHosts)
+	}
 
-		if stage.b.Recipe.BuildData.Post.Script != "" {
-			if err := stage.runPostScript(configFile, sessionResolv, sessionHosts); err != nil {
-				return fmt.Errorf("while running engine: %v", err)
-			}
-		}
+	// write the build configuration used for %post and %test sections
+	configFile := filepath.Join(stage.b.TmpDir, "singularity.conf")
+	if err := ioutil.WriteFile(configFile, configData, 0o644); err != nil {
+		return fmt.Errorf("while creating %s: %s", configFile, err)
+	}
+	defer os.Remove(configFile)
 
-		sylog.Debugf("Inserting Metadata")
-		if err := stage.insertMetadata(); err != nil {
-			return fmt.Errorf("while inserting metadata to bundle: %v", err)
+	if stage.b.Recipe.BuildData.Post.Script != "" && !sc.skip(stepPost) {
+		err := b.runStep(stage, events.Post, func() error {
+			return stage.runPostScript(configFile, sessionResolv, sessionHosts)
+		})
+		if err != nil {
+			return fmt.Errorf("while running engine: %w", err)
+		}
+		if err := sc.save(stepPost); err != nil {
+			return fmt.Errorf("while caching build step: %v", err)
 		}
+	} else if stage.b.Recipe.BuildData.Post.Script != "" {
+		b.skipStep(stage, events.Post)
+	}
 
-		if err := stage.runTestScript(configFile, sessionResolv, sessionHosts); err != nil {
-			return fmt.Errorf("failed to execute %%test script: %v", err)
+	// only the image built from the last stage needs a bill of materials
+	if i == len(b.stages)-1 && !stage.b.Opts.NoSBOM {
+		if err := b.runStep(stage, events.SBOM, func() error { return b.insertSBOM(stage) }); err != nil {
+			return fmt.Errorf("while generating SBOM: %v", err)
 		}
 	}
 
-	syscall.Umask(oldumask)
+	sylog.Debugf("Inserting Metadata")
+	if err := stage.insertMetadata(); err != nil {
+		return fmt.Errorf("while inserting metadata to bundle: %v", err)
+	}
 
-	sylog.Debugf("Calling assembler")
-	if err := b.stages[len(b.stages)-1].Assemble(b.Conf.Dest); err != nil {
-		return err
+	if !stage.b.Opts.NoTest && stage.b.Recipe.BuildData.Test.Script != "" {
+		err := b.runStep(stage, events.Test, func() error {
+			return stage.runTestScript(configFile, sessionResolv, sessionHosts)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to execute %%test script: %w", err)
+		}
 	}
 
-	sylog.Verbosef("Build complete: %s", b.Conf.Dest)
+	b.emit(events.Event{Type: events.StageEnd, Stage: stage.name, Duration: time.Since(stageStart)})
 	return nil
 }
 
@@ -512,10 +680,12 @@ func makeDef(spec string) (types.Definition, error) {
 	return d, nil
 }
 
-// MakeAllDefs gets a definition object from a spec
-func MakeAllDefs(spec string) ([]types.Definition, error) {
+// MakeAllDefs gets a definition object from a spec, buildArgs values are
+// substituted to the build arguments of a definition file.
+func MakeAllDefs(spec string, buildArgs map[string]string) ([]types.Definition, error) {
 	if ok, err := uri.IsValid(spec); ok && err == nil {
 		// URI passed as spec
+		ignoreBuildArgs(buildArgs)
 		d, err := types.NewDefinitionFromURI(spec)
 		return []types.Definition{d}, err
 	}
@@ -523,18 +693,26 @@ func MakeAllDefs(spec string) ([]types.Definition, error) {
 	// check if spec is an image/sandbox
 	if i, err := image.Init(spec, false); err == nil {
 		_ = i.File.Close()
+		ignoreBuildArgs(buildArgs)
 		d, err := types.NewDefinitionFromURI("localimage://" + spec)
 		return []types.Definition{d}, err
 	}
 
 	// default to reading file as definition
-	defFile, err := os.Open(spec)
+	raw, err := ioutil.ReadFile(spec)
 	if err != nil {
 		return nil, fmt.Errorf("unable to open file %s: %v", spec, err)
 	}
-	defer defFile.Close()
 
-	d, err := parser.All(defFile)
+	raw, unused, err := parser.SubstituteBuildArgs(raw, buildArgs)
+	if err != nil {
+		return nil, fmt.Errorf("while substituting build arguments: %s: %v", spec, err)
+	}
+	for _, arg := range unused {
+		sylog.Warningf("Build argument %s is not used by definition %s", arg, spec)
+	}
+
+	d, err := parser.All(bytes.NewReader(raw))
 	if err != nil {
 		return nil, fmt.Errorf("while parsing definition: %s: %v", spec, err)
 	}
@@ -542,6 +720,14 @@ func MakeAllDefs(spec string) ([]types.Definition, error) {
 	return d, nil
 }
 
+// ignoreBuildArgs warns about build arguments passed for a spec which
+// isn't a definition file.
+func ignoreBuildArgs(buildArgs map[string]string) {
+	if len(buildArgs) > 0 {
+		sylog.Warningf("Build arguments are ignored when not building from a definition file")
+	}
+}
+
 func (b *Build) findStageIndex(name string) (int, error) {
 	for i, s := range b.stages {
 		if name == s.name {
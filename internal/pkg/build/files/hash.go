@@ -0,0 +1,69 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package files
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// HashFromHost writes the paths, modes and contents of the host files which
+// would be copied from src by CopyFromHost to w, so the content of w changes
+// whenever the copied files change. Symbolic links found while walking a
+// directory are written as their target path.
+func HashFromHost(w io.Writer, src string) error {
+	// resolve any bash globbing in filepath
+	paths, err := expandPath(src)
+	if err != nil {
+		return fmt.Errorf("while expanding source path with bash: %s: %s", src, err)
+	}
+
+	for _, path := range paths {
+		// cp -L follows a source symbolic link
+		root, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return fmt.Errorf("while resolving %s: %s", path, err)
+		}
+
+		err = filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "%s\x00%s\x00%o\x00", path, rel, fi.Mode())
+
+			switch {
+			case fi.Mode()&os.ModeSymlink != 0:
+				target, err := os.Readlink(p)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(w, "%s\x00", target)
+			case fi.Mode().IsRegular():
+				f, err := os.Open(p)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				fmt.Fprintf(w, "%d\x00", fi.Size())
+				if _, err := io.Copy(w, f); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("while hashing %s: %s", path, err)
+		}
+	}
+
+	return nil
+}
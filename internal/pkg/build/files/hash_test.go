@@ -0,0 +1,81 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package files
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func hashFromHost(t *testing.T, src string) string {
+	h := sha256.New()
+	if err := HashFromHost(h, src); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+func TestHashFromHost(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hash-test-src-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srcDir := filepath.Join(dir, "srcDir")
+	if err := os.Mkdir(srcDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	srcFile := filepath.Join(srcDir, "srcFile")
+	if err := ioutil.WriteFile(srcFile, []byte(sourceFileContent), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	srcFileLink := filepath.Join(dir, "srcFileLink")
+	if err := os.Symlink(srcFile, srcFileLink); err != nil {
+		t.Fatal(err)
+	}
+
+	dirHash := hashFromHost(t, srcDir)
+	if h := hashFromHost(t, srcDir); h != dirHash {
+		t.Errorf("hash of unchanged directory changed")
+	}
+	if h := hashFromHost(t, filepath.Join(dir, "srcD?r")); h != dirHash {
+		t.Errorf("hash of globbed directory differs from hash of directory")
+	}
+
+	fileHash := hashFromHost(t, srcFile)
+	linkHash := hashFromHost(t, srcFileLink)
+
+	if err := ioutil.WriteFile(srcFile, []byte("changed"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if h := hashFromHost(t, srcDir); h == dirHash {
+		t.Errorf("hash of directory didn't change with file content")
+	}
+	if h := hashFromHost(t, srcFile); h == fileHash {
+		t.Errorf("hash of file didn't change with file content")
+	}
+	// a link is followed like cp -L does
+	if h := hashFromHost(t, srcFileLink); h == linkHash {
+		t.Errorf("hash of link didn't change with target file content")
+	}
+	fileHash = hashFromHost(t, srcFile)
+
+	if err := os.Chmod(srcFile, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if h := hashFromHost(t, srcFile); h == fileHash {
+		t.Errorf("hash of file didn't change with file mode")
+	}
+
+	if err := HashFromHost(ioutil.Discard, filepath.Join(dir, "nonexistent")); err == nil {
+		t.Errorf("unexpected success with nonexistent path")
+	}
+}
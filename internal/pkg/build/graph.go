@@ -0,0 +1,189 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hpcng/singularity/pkg/build/types"
+	"github.com/hpcng/singularity/pkg/sylog"
+)
+
+// filesFromStage returns the stage name of a '%files from <stage>'
+// section, or an empty string for files copied from the host.
+func filesFromStage(f types.Files) string {
+	// Trim comments from args
+	args := strings.Fields(strings.Split(f.Args, "#")[0])
+	if len(args) != 2 {
+		return ""
+	}
+	return args[1]
+}
+
+// stageDeps returns the indexes of the stages each definition of defs
+// copies files from. A stage can only copy files from a stage defined
+// before it, so the dependency graph has no cycles.
+func stageDeps(defs []types.Definition) ([][]int, error) {
+	deps := make([][]int, len(defs))
+
+	for i, d := range defs {
+		for _, f := range d.BuildData.Files {
+			name := filesFromStage(f)
+			if name == "" {
+				continue
+			}
+
+			j := -1
+			for k := 0; k < i; k++ {
+				if defs[k].Header["stage"] == name {
+					j = k
+					break
+				}
+			}
+			if j < 0 {
+				return nil, fmt.Errorf("stage %s was not found before stage %s", name, d.Header["stage"])
+			}
+			deps[i] = append(deps[i], j)
+		}
+	}
+
+	return deps, nil
+}
+
+// selectStages returns the definitions of the stages needed to build the
+// target stage, which is the last stage if target is empty, along with
+// their dependencies as indexes in the returned definitions.
+func selectStages(defs []types.Definition, target string) ([]types.Definition, [][]int, error) {
+	deps, err := stageDeps(defs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	last := len(defs) - 1
+	if target != "" {
+		last = -1
+		for i, d := range defs {
+			if d.Header["stage"] == target {
+				last = i
+				break
+			}
+		}
+		if last < 0 {
+			return nil, nil, fmt.Errorf("target stage %s was not found", target)
+		}
+	}
+
+	// mark the target stage and the stages it depends on, dependencies
+	// are defined before, so a reverse walk marks them all
+	needed := make([]bool, len(defs))
+	needed[last] = true
+	for i := last; i >= 0; i-- {
+		if !needed[i] {
+			continue
+		}
+		for _, j := range deps[i] {
+			needed[j] = true
+		}
+	}
+
+	var selected []types.Definition
+	var selectedDeps [][]int
+
+	index := make([]int, len(defs))
+	for i, d := range defs[:last+1] {
+		if !needed[i] {
+			sylog.Infof("Skipping stage %s, not needed to build the final image", d.Header["stage"])
+			continue
+		}
+		index[i] = len(selected)
+		selected = append(selected, d)
+
+		var sd []int
+		for _, j := range deps[i] {
+			sd = append(sd, index[j])
+		}
+		selectedDeps = append(selectedDeps, sd)
+	}
+
+	return selected, selectedDeps, nil
+}
+
+// stageResult is the result of the build of the stage index.
+type stageResult struct {
+	index int
+	err   error
+}
+
+// runStages builds the stages, running up to jobs stages which don't
+// depend on each other concurrently. Ready stages are started in their
+// definition order, so stages are built one after the other with a single
+// job. The first stage error stops the start of new stages.
+func (b *Build) runStages(ctx context.Context, jobs int, build func(context.Context, int) error) error {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	started := make([]bool, len(b.stages))
+	done := make([]bool, len(b.stages))
+	results := make(chan stageResult)
+	running := 0
+
+	var firstErr error
+
+	for {
+		for i := range b.stages {
+			if firstErr != nil || running >= jobs {
+				break
+			}
+			if started[i] || !b.stages[i].ready(done) {
+				continue
+			}
+			started[i] = true
+			running++
+
+			go func(i int) {
+				results <- stageResult{index: i, err: build(ctx, i)}
+			}(i)
+		}
+
+		if running == 0 {
+			break
+		}
+
+		r := <-results
+		running--
+		done[r.index] = true
+
+		if r.err != nil && firstErr == nil {
+			firstErr = r.err
+			cancel()
+		}
+	}
+
+	if firstErr == nil {
+		for i := range b.stages {
+			if !done[i] {
+				return fmt.Errorf("stage %s dependencies could not be resolved", b.stages[i].name)
+			}
+		}
+	}
+	return firstErr
+}
+
+// ready returns whether the stages s depends on are built.
+func (s *stage) ready(done []bool) bool {
+	for _, i := range s.deps {
+		if !done[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/hpcng/singularity/pkg/build/types"
+)
+
+func stageDef(name string, from ...string) types.Definition {
+	d := types.Definition{
+		Header: map[string]string{"bootstrap": "docker", "from": "alpine", "stage": name},
+	}
+	for _, f := range from {
+		d.BuildData.Files = append(d.BuildData.Files, types.Files{
+			Args:  "from " + f + " # comment",
+			Files: []types.FileTransport{{Src: "/src", Dst: "/dst"}},
+		})
+	}
+	return d
+}
+
+func stageNames(defs []types.Definition) []string {
+	var names []string
+	for _, d := range defs {
+		names = append(names, d.Header["stage"])
+	}
+	return names
+}
+
+func TestSelectStages(t *testing.T) {
+	defs := []types.Definition{
+		stageDef("base"),
+		stageDef("docs"),
+		stageDef("devel", "base"),
+		stageDef("test", "devel"),
+		stageDef("final", "devel", "base"),
+	}
+
+	tests := []struct {
+		name      string
+		defs      []types.Definition
+		target    string
+		wantNames []string
+		wantDeps  [][]int
+		wantErr   bool
+	}{
+		{
+			name:      "LastStage",
+			defs:      defs,
+			wantNames: []string{"base", "devel", "final"},
+			wantDeps:  [][]int{nil, {0}, {1, 0}},
+		},
+		{
+			name:      "Target",
+			defs:      defs,
+			target:    "test",
+			wantNames: []string{"base", "devel", "test"},
+			wantDeps:  [][]int{nil, {0}, {1}},
+		},
+		{
+			name:      "TargetFirst",
+			defs:      defs,
+			target:    "base",
+			wantNames: []string{"base"},
+			wantDeps:  [][]int{nil},
+		},
+		{
+			name:    "UnknownTarget",
+			defs:    defs,
+			target:  "release",
+			wantErr: true,
+		},
+		{
+			name:    "ForwardReference",
+			defs:    []types.Definition{stageDef("devel", "base"), stageDef("base")},
+			wantErr: true,
+		},
+		{
+			name:    "UnknownStage",
+			defs:    []types.Definition{stageDef("base"), stageDef("final", "devel")},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, deps, err := selectStages(tt.defs, tt.target)
+			if err != nil && !tt.wantErr {
+				t.Fatalf("unexpected error: %s", err)
+			} else if err == nil && tt.wantErr {
+				t.Fatalf("unexpected success")
+			} else if err != nil {
+				return
+			}
+
+			if got := stageNames(selected); !reflect.DeepEqual(got, tt.wantNames) {
+				t.Errorf("unexpected stages: got %v, want %v", got, tt.wantNames)
+			}
+			if !reflect.DeepEqual(deps, tt.wantDeps) {
+				t.Errorf("unexpected dependencies: got %v, want %v", deps, tt.wantDeps)
+			}
+		})
+	}
+}
+
+func TestRunStages(t *testing.T) {
+	// base <- devel <- final, docs is independent
+	b := &Build{
+		stages: []stage{
+			{name: "base"},
+			{name: "docs"},
+			{name: "devel", deps: []int{0}},
+			{name: "final", deps: []int{2, 1}},
+		},
+	}
+
+	for _, jobs := range []int{0, 1, 2, 4} {
+		t.Run(fmt.Sprintf("Jobs%d", jobs), func(t *testing.T) {
+			var mu sync.Mutex
+			var order []string
+
+			err := b.runStages(context.Background(), jobs, func(_ context.Context, i int) error {
+				mu.Lock()
+				defer mu.Unlock()
+
+				for _, d := range b.stages[i].deps {
+					if !contains(order, b.stages[d].name) {
+						t.Errorf("stage %s started before stage %s", b.stages[i].name, b.stages[d].name)
+					}
+				}
+				order = append(order, b.stages[i].name)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if len(order) != len(b.stages) {
+				t.Errorf("unexpected built stages: %v", order)
+			}
+			if jobs <= 1 && !reflect.DeepEqual(order, []string{"base", "docs", "devel", "final"}) {
+				t.Errorf("stages not built in definition order: %v", order)
+			}
+		})
+	}
+
+	t.Run("Failure", func(t *testing.T) {
+		var built []string
+
+		err := b.runStages(context.Background(), 1, func(_ context.Context, i int) error {
+			built = append(built, b.stages[i].name)
+			if b.stages[i].name == "devel" {
+				return fmt.Errorf("failed")
+			}
+			return nil
+		})
+		if err == nil {
+			t.Fatalf("unexpected success")
+		}
+		if contains(built, "final") {
+			t.Errorf("stage final built after stage devel failure")
+		}
+	})
+}
+
+func contains(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
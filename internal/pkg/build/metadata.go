@@ -1,4 +1,4 @@
-// Copyright (c) 2018-2020, Sylabs Inc. All rights reserved.
+// Copyright (c) 2018-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -15,7 +15,6 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/hpcng/singularity/internal/pkg/buildcfg"
 	"github.com/hpcng/singularity/pkg/build/types"
@@ -51,6 +50,11 @@ func (s *stage) insertMetadata() error {
 		return fmt.Errorf("while inserting startscript: %v", err)
 	}
 
+	// insert healthcheck
+	if err := insertHealthcheck(s.b); err != nil {
+		return fmt.Errorf("while inserting healthcheck: %v", err)
+	}
+
 	// insert runscript
 	if err := insertRunScript(s.b); err != nil {
 		return fmt.Errorf("while inserting runscript: %v", err)
@@ -96,7 +100,7 @@ func insertEnvScript(b *types.Bundle) error {
 	return nil
 }
 
-// runscript and starscript should use this function to properly handle args and shebangs
+// runscript, starscript and healthcheck should use this function to properly handle args and shebangs
 func handleShebangScript(s types.Script) (string, string) {
 	shebang := "#!/bin/sh"
 	script := ""
@@ -142,6 +146,18 @@ func insertStartScript(b *types.Bundle) error {
 	return nil
 }
 
+func insertHealthcheck(b *types.Bundle) error {
+	if b.RunSection("healthcheck") && b.Recipe.ImageData.Healthcheck.Script != "" {
+		sylog.Infof("Adding healthcheck")
+		shebang, script := handleShebangScript(b.Recipe.ImageData.Healthcheck)
+		err := ioutil.WriteFile(filepath.Join(b.RootfsPath, "/.singularity.d/healthcheck"), []byte(shebang+"\n\n"+script+"\n"), 0o755)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func insertTestScript(b *types.Bundle) error {
 	if b.RunSection("test") && b.Recipe.ImageData.Test.Script != "" {
 		sylog.Infof("Adding testscript")
@@ -314,7 +330,7 @@ func addBuildLabels(labels map[string]string, b *types.Bundle) error {
 	labels["org.label-schema.schema-version"] = "1.0"
 
 	// build date and time, lots of time formatting
-	currentTime := time.Now()
+	currentTime := b.Opts.BuildTime()
 	year, month, day := currentTime.Date()
 	date := strconv.Itoa(day) + `_` + month.String() + `_` + strconv.Itoa(year)
 	hour, min, sec := currentTime.Clock()
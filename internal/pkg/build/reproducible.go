@@ -0,0 +1,63 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hpcng/singularity/pkg/sylog"
+	"golang.org/x/sys/unix"
+)
+
+// clampTimes sets the access and modification times of the files under
+// rootfs which are more recent than t to t, without following symlinks.
+func clampTimes(rootfs string, t time.Time) error {
+	sylog.Debugf("Clamping file times of %s to %s", rootfs, t)
+
+	ts := []unix.Timespec{
+		unix.NsecToTimespec(t.UnixNano()),
+		unix.NsecToTimespec(t.UnixNano()),
+	}
+
+	// directories are walked before their content, which changes the
+	// modification time of directories, so they are clamped after
+	var dirs []string
+
+	err := filepath.Walk(rootfs, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			dirs = append(dirs, path)
+			return nil
+		}
+		if !fi.ModTime().After(t) {
+			return nil
+		}
+		return unix.UtimesNanoAt(unix.AT_FDCWD, path, ts, unix.AT_SYMLINK_NOFOLLOW)
+	})
+	if err != nil {
+		return fmt.Errorf("while clamping file times: %s", err)
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		fi, err := os.Lstat(dirs[i])
+		if err != nil {
+			return fmt.Errorf("while clamping file times: %s", err)
+		}
+		if !fi.ModTime().After(t) {
+			continue
+		}
+		if err := unix.UtimesNanoAt(unix.AT_FDCWD, dirs[i], ts, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+			return fmt.Errorf("while clamping file times of %s: %s", dirs[i], err)
+		}
+	}
+
+	return nil
+}
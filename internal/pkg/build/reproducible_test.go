@@ -0,0 +1,69 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestClampTimes(t *testing.T) {
+	rootfs, err := ioutil.TempDir("", "clamp-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(rootfs)
+
+	epoch := time.Unix(1600000000, 0)
+	older := epoch.Add(-time.Hour)
+
+	dir := filepath.Join(rootfs, "dir")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatalf("failed to create directory: %s", err)
+	}
+	file := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(file, []byte("data"), 0o644); err != nil {
+		t.Fatalf("failed to create file: %s", err)
+	}
+	oldFile := filepath.Join(rootfs, "old")
+	if err := ioutil.WriteFile(oldFile, []byte("data"), 0o644); err != nil {
+		t.Fatalf("failed to create file: %s", err)
+	}
+	if err := os.Chtimes(oldFile, older, older); err != nil {
+		t.Fatalf("failed to set file times: %s", err)
+	}
+	link := filepath.Join(rootfs, "link")
+	if err := os.Symlink("/nonexistent", link); err != nil {
+		t.Fatalf("failed to create symlink: %s", err)
+	}
+
+	if err := clampTimes(rootfs, epoch); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	tests := []struct {
+		path string
+		want time.Time
+	}{
+		{rootfs, epoch},
+		{dir, epoch},
+		{file, epoch},
+		{oldFile, older},
+		{link, epoch},
+	}
+	for _, tt := range tests {
+		fi, err := os.Lstat(tt.path)
+		if err != nil {
+			t.Fatalf("failed to stat %s: %s", tt.path, err)
+		}
+		if !fi.ModTime().Equal(tt.want) {
+			t.Errorf("unexpected modification time of %s: got %s, want %s", tt.path, fi.ModTime(), tt.want)
+		}
+	}
+}
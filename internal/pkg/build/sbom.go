@@ -0,0 +1,58 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/hpcng/singularity/internal/pkg/buildcfg"
+	"github.com/hpcng/singularity/internal/pkg/sbom"
+	"github.com/hpcng/singularity/pkg/image"
+	"github.com/hpcng/singularity/pkg/sylog"
+)
+
+// sbomPath is the path of the SPDX software bill of materials in the
+// container.
+const sbomPath = "/.singularity.d/" + image.SIFDescSBOMJSON
+
+// insertSBOM collects the packages installed in the root filesystem of
+// the stage s, and stores their SPDX software bill of materials in the
+// container and as a SIF data object.
+func (b *Build) insertSBOM(s *stage) error {
+	sylog.Infof("Generating SBOM")
+
+	pkgs, err := sbom.Collect(s.b.RootfsPath)
+	if err != nil {
+		return err
+	}
+	sylog.Verbosef("Found %d installed packages", len(pkgs))
+
+	doc, err := sbom.NewSPDX(
+		filepath.Base(b.Conf.Dest),
+		sbom.Distro(s.b.RootfsPath),
+		"Tool: singularity-"+buildcfg.PACKAGE_VERSION,
+		s.b.Opts.BuildTime(),
+		pkgs,
+	)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(doc, "", "\t")
+	if err != nil {
+		return fmt.Errorf("while encoding SBOM: %s", err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(s.b.RootfsPath, sbomPath), data, 0o644); err != nil {
+		return fmt.Errorf("while writing SBOM: %s", err)
+	}
+	s.b.JSONObjects[image.SIFDescSBOMJSON] = data
+
+	return nil
+}
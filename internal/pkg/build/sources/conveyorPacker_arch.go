@@ -142,7 +142,7 @@ func (cp *ArchConveyorPacker) Get(ctx context.Context, b *types.Bundle) (err err
 	args = append(args, instList...)
 
 	pacCmd := exec.Command(pacstrapPath, args...)
-	pacCmd.Stdout = os.Stdout
+	pacCmd.Stdout = cp.b.Opts.GetStdout()
 	pacCmd.Stderr = os.Stderr
 	sylog.Debugf("\n\tPacstrap Path: %s\n\tPac Conf: %s\n\tRootfs: %s\n\tInstall List: %s\n", pacstrapPath, pacConf, cp.b.RootfsPath, instList)
 
@@ -152,7 +152,7 @@ func (cp *ArchConveyorPacker) Get(ctx context.Context, b *types.Bundle) (err err
 
 	// Pacman package signing setup
 	cmd := exec.Command("arch-chroot", cp.b.RootfsPath, "/bin/sh", "-c", "haveged -w 1024; pacman-key --init; pacman-key --populate archlinux")
-	cmd.Stdout = os.Stdout
+	cmd.Stdout = cp.b.Opts.GetStdout()
 	cmd.Stderr = os.Stderr
 	if err = cmd.Run(); err != nil {
 		return fmt.Errorf("while setting up package signing: %v", err)
@@ -160,7 +160,7 @@ func (cp *ArchConveyorPacker) Get(ctx context.Context, b *types.Bundle) (err err
 
 	// Clean up haveged
 	cmd = exec.Command("arch-chroot", cp.b.RootfsPath, "pacman", "-Rs", "--noconfirm", "haveged")
-	cmd.Stdout = os.Stdout
+	cmd.Stdout = cp.b.Opts.GetStdout()
 	cmd.Stderr = os.Stderr
 	if err = cmd.Run(); err != nil {
 		return fmt.Errorf("while cleaning up packages: %v", err)
@@ -187,7 +187,7 @@ func (cp *DebootstrapConveyorPacker) Get(ctx context.Context, b *types.Bundle) (
 	// run debootstrap
 	out, err := cmd.CombinedOutput()
 
-	io.Copy(os.Stdout, bytes.NewReader(out))
+	io.Copy(cp.b.Opts.GetStdout(), bytes.NewReader(out))
 
 	if err != nil {
 		dumpLog := func(fn string) {
@@ -36,13 +36,36 @@ func (cp *LibraryConveyorPacker) Get(ctx context.Context, b *types.Bundle) (err
 
 	cp.b = b
 
-	libraryURL := b.Opts.LibraryURL
-	authToken := b.Opts.LibraryAuthToken
+	if err = makeBaseEnv(cp.b.RootfsPath); err != nil {
+		return fmt.Errorf("while inserting base environment: %v", err)
+	}
+
+	imageRef, libraryConfig, err := libraryReference(b)
+	if err != nil {
+		return err
+	}
+
+	imagePath, err := library.Pull(ctx, b.Opts.ImgCache, imageRef, runtime.GOARCH, cp.b.TmpDir, libraryConfig)
+	if err != nil {
+		return fmt.Errorf("while fetching library image: %v", err)
+	}
 
+	// insert base metadata before unpacking fs
 	if err = makeBaseEnv(cp.b.RootfsPath); err != nil {
 		return fmt.Errorf("while inserting base environment: %v", err)
 	}
 
+	cp.LocalPacker, err = GetLocalPacker(ctx, imagePath, cp.b)
+
+	return err
+}
+
+// libraryReference returns the reference of the source image of the bundle
+// and the configuration of the library client to fetch it.
+func libraryReference(b *types.Bundle) (*client.Ref, *client.Config, error) {
+	libraryURL := b.Opts.LibraryURL
+	authToken := b.Opts.LibraryAuthToken
+
 	// check for custom library from definition
 	customLib, ok := b.Recipe.Header["library"]
 	if ok {
@@ -52,7 +75,7 @@ func (cp *LibraryConveyorPacker) Get(ctx context.Context, b *types.Bundle) (err
 
 	imageRef, err := library.NormalizeLibraryRef(b.Recipe.Header["from"])
 	if err != nil {
-		return fmt.Errorf("error parsing libraryRef: %v", err)
+		return nil, nil, fmt.Errorf("error parsing libraryRef: %v", err)
 	}
 
 	if imageRef.Host != "" {
@@ -71,20 +94,7 @@ func (cp *LibraryConveyorPacker) Get(ctx context.Context, b *types.Bundle) (err
 		AuthToken: authToken,
 		Logger:    (golog.Logger)(sylog.DebugLogger{}),
 	}
-
-	imagePath, err := library.Pull(ctx, b.Opts.ImgCache, imageRef, runtime.GOARCH, cp.b.TmpDir, libraryConfig)
-	if err != nil {
-		return fmt.Errorf("while fetching library image: %v", err)
-	}
-
-	// insert base metadata before unpacking fs
-	if err = makeBaseEnv(cp.b.RootfsPath); err != nil {
-		return fmt.Errorf("while inserting base environment: %v", err)
-	}
-
-	cp.LocalPacker, err = GetLocalPacker(ctx, imagePath, cp.b)
-
-	return err
+	return imageRef, libraryConfig, nil
 }
 
 // CleanUp removes any files owned by the conveyorPacker on the filesystem.
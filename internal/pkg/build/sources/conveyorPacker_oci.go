@@ -58,31 +58,9 @@ func (cp *OCIConveyorPacker) Get(ctx context.Context, b *sytypes.Bundle) (err er
 		return err
 	}
 
-	// DockerInsecureSkipTLSVerify is set only if --no-https is specified to honor
-	// configuration from /etc/containers/registries.conf because DockerInsecureSkipTLSVerify
-	// can have three possible values true/false and undefined, so we left it as undefined instead
-	// of forcing it to false in order to delegate decision to /etc/containers/registries.conf:
-	// https://github.com/hpcng/singularity/issues/5172
-	cp.sysCtx = &types.SystemContext{
-		OCIInsecureSkipTLSVerify: cp.b.Opts.NoHTTPS,
-		DockerAuthConfig:         cp.b.Opts.DockerAuthConfig,
-		OSChoice:                 "linux",
-		AuthFilePath:             syfs.DockerConf(),
-		DockerRegistryUserAgent:  useragent.Value(),
-		BigFilesTemporaryDir:     b.TmpDir,
-	}
-	if cp.b.Opts.NoHTTPS {
-		cp.sysCtx.DockerInsecureSkipTLSVerify = types.NewOptionalBool(true)
-	}
+	cp.sysCtx = ociSystemContext(b)
 
-	// add registry and namespace to reference if specified
-	ref := b.Recipe.Header["from"]
-	if b.Recipe.Header["namespace"] != "" {
-		ref = b.Recipe.Header["namespace"] + "/" + ref
-	}
-	if b.Recipe.Header["registry"] != "" {
-		ref = b.Recipe.Header["registry"] + "/" + ref
-	}
+	ref := ociReference(b)
 	sylog.Debugf("Reference: %v", ref)
 
 	switch b.Recipe.Header["bootstrap"] {
@@ -157,6 +135,41 @@ func (cp *OCIConveyorPacker) Get(ctx context.Context, b *sytypes.Bundle) (err er
 	return nil
 }
 
+// ociSystemContext returns the containers/image system context used to
+// fetch the source image of the bundle.
+func ociSystemContext(b *sytypes.Bundle) *types.SystemContext {
+	// DockerInsecureSkipTLSVerify is set only if --no-https is specified to honor
+	// configuration from /etc/containers/registries.conf because DockerInsecureSkipTLSVerify
+	// can have three possible values true/false and undefined, so we left it as undefined instead
+	// of forcing it to false in order to delegate decision to /etc/containers/registries.conf:
+	// https://github.com/hpcng/singularity/issues/5172
+	sysCtx := &types.SystemContext{
+		OCIInsecureSkipTLSVerify: b.Opts.NoHTTPS,
+		DockerAuthConfig:         b.Opts.DockerAuthConfig,
+		OSChoice:                 "linux",
+		AuthFilePath:             syfs.DockerConf(),
+		DockerRegistryUserAgent:  useragent.Value(),
+		BigFilesTemporaryDir:     b.TmpDir,
+	}
+	if b.Opts.NoHTTPS {
+		sysCtx.DockerInsecureSkipTLSVerify = types.NewOptionalBool(true)
+	}
+	return sysCtx
+}
+
+// ociReference returns the reference of the source image of the bundle,
+// with the registry and namespace of the definition if specified.
+func ociReference(b *sytypes.Bundle) string {
+	ref := b.Recipe.Header["from"]
+	if b.Recipe.Header["namespace"] != "" {
+		ref = b.Recipe.Header["namespace"] + "/" + ref
+	}
+	if b.Recipe.Header["registry"] != "" {
+		ref = b.Recipe.Header["registry"] + "/" + ref
+	}
+	return ref
+}
+
 // Pack puts relevant objects in a Bundle.
 func (cp *OCIConveyorPacker) Pack(ctx context.Context) (*sytypes.Bundle, error) {
 	err := cp.unpackTmpfs(ctx)
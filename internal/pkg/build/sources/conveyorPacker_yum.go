@@ -284,14 +284,14 @@ func (c *YumConveyor) importGPGKey() (err error) {
 	}
 
 	cmd := exec.Command(c.rpmPath, "--root", c.b.RootfsPath, "--initdb")
-	cmd.Stdout = os.Stdout
+	cmd.Stdout = c.b.Opts.GetStdout()
 	cmd.Stderr = os.Stderr
 	if err = cmd.Run(); err != nil {
 		return fmt.Errorf("while initializing new rpm db: %v", err)
 	}
 
 	cmd = exec.Command(c.rpmPath, "--root", c.b.RootfsPath, "--import", c.gpg)
-	cmd.Stdout = os.Stdout
+	cmd.Stdout = c.b.Opts.GetStdout()
 	cmd.Stderr = os.Stderr
 	if err = cmd.Run(); err != nil {
 		return fmt.Errorf("while importing gpg key with rpm: %v", err)
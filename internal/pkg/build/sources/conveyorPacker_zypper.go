@@ -213,21 +213,21 @@ func (cp *ZypperConveyorPacker) Get(ctx context.Context, b *types.Bundle) (err e
 	// Add mirrorURL/installURL as repo
 	if mirrorurl != "" {
 		cmd := exec.Command(zypperPath, `--root`, cp.b.RootfsPath, `ar`, mirrorurl, `repo`)
-		cmd.Stdout = os.Stdout
+		cmd.Stdout = cp.b.Opts.GetStdout()
 		cmd.Stderr = os.Stderr
 		if err = cmd.Run(); err != nil {
 			return fmt.Errorf("while adding zypper mirror: %v", err)
 		}
 		// Refreshing gpg keys
 		cmd = exec.Command(zypperPath, `--root`, cp.b.RootfsPath, `--gpg-auto-import-keys`, `refresh`)
-		cmd.Stdout = os.Stdout
+		cmd.Stdout = cp.b.Opts.GetStdout()
 		cmd.Stderr = os.Stderr
 		if err = cmd.Run(); err != nil {
 			return fmt.Errorf("while refreshing gpg keys: %v", err)
 		}
 		if updateurl != "" {
 			cmd := exec.Command(zypperPath, `--root`, cp.b.RootfsPath, `ar`, `-f`, updateurl, `update`)
-			cmd.Stdout = os.Stdout
+			cmd.Stdout = cp.b.Opts.GetStdout()
 			cmd.Stderr = os.Stderr
 			if err = cmd.Run(); err != nil {
 				return fmt.Errorf("while adding zypper update: %v", err)
@@ -260,7 +260,7 @@ func (cp *ZypperConveyorPacker) Get(ctx context.Context, b *types.Bundle) (err e
 			return fmt.Errorf("cannot create rpm symlink")
 		}
 		cmd := exec.Command("rpmkeys", `--root`, cp.b.RootfsPath, `--import`, pgpfile)
-		cmd.Stdout = os.Stdout
+		cmd.Stdout = cp.b.Opts.GetStdout()
 		cmd.Stderr = os.Stderr
 		if err = cmd.Run(); err != nil {
 			return fmt.Errorf("while importing pgp keys: %v", err)
@@ -281,7 +281,7 @@ func (cp *ZypperConveyorPacker) Get(ctx context.Context, b *types.Bundle) (err e
 			args = append(args, `--url`, sleurl)
 		}
 		cmd := exec.Command(suseconnectPath, args...)
-		cmd.Stdout = os.Stdout
+		cmd.Stdout = cp.b.Opts.GetStdout()
 		cmd.Stderr = os.Stderr
 		if err = cmd.Run(); err != nil {
 			return fmt.Errorf("while registering: %v", err)
@@ -292,7 +292,7 @@ func (cp *ZypperConveyorPacker) Get(ctx context.Context, b *types.Bundle) (err e
 				array[i] = strings.TrimSpace(array[i])
 				cmd := exec.Command(suseconnectPath, `--root`, cp.b.RootfsPath,
 					`--product`, array[i]+`/`+suseconnectModver)
-				cmd.Stdout = os.Stdout
+				cmd.Stdout = cp.b.Opts.GetStdout()
 				cmd.Stderr = os.Stderr
 				if err = cmd.Run(); err != nil {
 					return fmt.Errorf("while registering: %v", err)
@@ -303,7 +303,7 @@ func (cp *ZypperConveyorPacker) Get(ctx context.Context, b *types.Bundle) (err e
 	for i := 0; otherurl[i] != ""; i++ {
 		sID := strconv.Itoa(i)
 		cmd := exec.Command(zypperPath, `--root`, cp.b.RootfsPath, `ar`, `-f`, otherurl[i], `repo-`+sID)
-		cmd.Stdout = os.Stdout
+		cmd.Stdout = cp.b.Opts.GetStdout()
 		cmd.Stderr = os.Stderr
 		if err = cmd.Run(); err != nil {
 			return fmt.Errorf("while adding zypper url: %s %v", otherurl[i], err)
@@ -319,7 +319,7 @@ func (cp *ZypperConveyorPacker) Get(ctx context.Context, b *types.Bundle) (err e
 
 	// Zypper install command
 	cmd := exec.Command(zypperPath, args...)
-	cmd.Stdout = os.Stdout
+	cmd.Stdout = cp.b.Opts.GetStdout()
 	cmd.Stderr = os.Stderr
 
 	sylog.Debugf("\n\tZypper Path: %s\n\tDetected Arch: %s\n\tOSVersion: %s\n\tMirrorURL: %s\n\tIncludes: %s\n", zypperPath, runtime.GOARCH, osversion, mirrorurl, include)
@@ -0,0 +1,82 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sources
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+
+	"github.com/hpcng/singularity/internal/pkg/build/files"
+	"github.com/hpcng/singularity/internal/pkg/build/oci"
+	"github.com/hpcng/singularity/internal/pkg/client/oras"
+	"github.com/hpcng/singularity/pkg/build/types"
+	"github.com/sylabs/scs-library-client/client"
+)
+
+// HashSource writes the digest of the bootstrap source of the bundle
+// definition to w, so the content of w changes whenever the image the build
+// starts from changes: remote images are resolved to the digest of their
+// manifest and the content of local images is hashed. It returns false if
+// the source can't be pinned to a digest, such as the packages installed
+// from a mirror by package manager bootstraps.
+func HashSource(ctx context.Context, w io.Writer, b *types.Bundle) (bool, error) {
+	bootstrap := b.Recipe.Header["bootstrap"]
+	from := b.Recipe.Header["from"]
+
+	var digest string
+	var err error
+
+	switch bootstrap {
+	case "scratch":
+		return true, nil
+	case "localimage":
+		return true, files.HashFromHost(w, from)
+	case "oci", "oci-archive", "docker-archive":
+		// the reference is path[:tag]
+		fmt.Fprintf(w, "%s\x00", from)
+		return true, files.HashFromHost(w, strings.SplitN(from, ":", 2)[0])
+	case "docker":
+		digest, err = oci.ImageSHA(ctx, "docker://"+ociReference(b), ociSystemContext(b))
+	case "docker-daemon":
+		digest, err = oci.ImageSHA(ctx, "docker-daemon:"+ociReference(b), ociSystemContext(b))
+	case "library":
+		digest, err = libraryImageHash(ctx, b)
+	case "oras":
+		digest, err = oras.ImageSHA(ctx, "//"+from, b.Opts.DockerAuthConfig)
+	default:
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("while resolving %s source %s: %v", bootstrap, from, err)
+	}
+
+	fmt.Fprintf(w, "%s\x00", digest)
+	return true, nil
+}
+
+// libraryImageHash returns the hash of the library image of the bundle
+// definition for the host architecture.
+func libraryImageHash(ctx context.Context, b *types.Bundle) (string, error) {
+	imageRef, libraryConfig, err := libraryReference(b)
+	if err != nil {
+		return "", err
+	}
+
+	c, err := client.NewClient(libraryConfig)
+	if err != nil {
+		return "", fmt.Errorf("unable to initialize client library: %v", err)
+	}
+
+	ref := fmt.Sprintf("%s:%s", imageRef.Path, imageRef.Tags[0])
+	libraryImage, err := c.GetImage(ctx, runtime.GOARCH, ref)
+	if err != nil {
+		return "", err
+	}
+	return libraryImage.Hash, nil
+}
@@ -1,4 +1,4 @@
-// Copyright (c) 2018-2020, Sylabs Inc. All rights reserved.
+// Copyright (c) 2018-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -29,6 +29,10 @@ type stage struct {
 	a Assembler
 	// b is an intermediate structure that encapsulates all information for the container, e.g., metadata, filesystems.
 	b *types.Bundle
+	// stepKey is the build cache key of the last build step of the stage, it is empty if steps are not cached.
+	stepKey string
+	// deps are the indexes of the stages the stage copies files from.
+	deps []int
 }
 
 const (
@@ -42,9 +46,14 @@ func (s *stage) Assemble(path string) error {
 	return s.a.Assemble(s.b, path)
 }
 
+// hasSectionScript returns whether the section script name is run by the stage.
+func (s *stage) hasSectionScript(name string, script types.Script) bool {
+	return s.b.RunSection(name) && script.Script != ""
+}
+
 // runSetupScript executes the stage's pre script on host.
 func (s *stage) runSectionScript(name string, script types.Script) error {
-	if s.b.RunSection(name) && script.Script != "" {
+	if s.hasSectionScript(name, script) {
 		if syscall.Getuid() != 0 {
 			return fmt.Errorf("attempted to build with scripts as non-root user or without --fakeroot")
 		}
@@ -64,14 +73,14 @@ func (s *stage) runSectionScript(name string, script types.Script) error {
 
 		// Run script section here
 		cmd := exec.Command(args[0], args[1:]...)
-		cmd.Stdout = os.Stdout
+		cmd.Stdout = s.b.Opts.GetStdout()
 		cmd.Stderr = os.Stderr
 		cmd.Env = os.Environ()
 		cmd.Env = append(cmd.Env, sEnvironment, sRootfs)
 
 		sylog.Infof("Running %s scriptlet", name)
 		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to run %%%s script: %v", name, err)
+			return fmt.Errorf("failed to run %%%s script: %w", name, err)
 		}
 	}
 	return nil
@@ -106,7 +115,7 @@ func (s *stage) runPostScript(configFile, sessionResolv, sessionHosts string) er
 		cmdArgs = append(cmdArgs, s.b.RootfsPath)
 		cmdArgs = append(cmdArgs, args...)
 		cmd := exec.Command(exe, cmdArgs...)
-		cmd.Stdout = os.Stdout
+		cmd.Stdout = s.b.Opts.GetStdout()
 		cmd.Stderr = os.Stderr
 		cmd.Dir = "/"
 		cmd.Env = currentEnvNoSingularity([]string{"NV", "NVCCLI", "ROCM", "BINDPATH"})
@@ -132,7 +141,7 @@ func (s *stage) runTestScript(configFile, sessionResolv, sessionHosts string) er
 
 		cmdArgs = append(cmdArgs, s.b.RootfsPath)
 		cmd := exec.Command(exe, cmdArgs...)
-		cmd.Stdout = os.Stdout
+		cmd.Stdout = s.b.Opts.GetStdout()
 		cmd.Stderr = os.Stderr
 		cmd.Dir = "/"
 		cmd.Env = currentEnvNoSingularity([]string{"NV", "NVCCLI", "ROCM", "BINDPATH", "WRITABLE_TMPFS"})
@@ -146,18 +155,12 @@ func (s *stage) runTestScript(configFile, sessionResolv, sessionHosts string) er
 func (s *stage) copyFilesFrom(b *Build) error {
 	def := s.b.Recipe
 	for _, f := range def.BuildData.Files {
-		// Trim comments from args
-		cleanArgs := strings.Split(f.Args, "#")[0]
-		if cleanArgs == "" {
-			continue
-		}
-
-		args := strings.Fields(cleanArgs)
-		if len(args) != 2 {
+		name := filesFromStage(f)
+		if name == "" {
 			continue
 		}
 
-		stageIndex, err := b.findStageIndex(args[1])
+		stageIndex, err := b.findStageIndex(name)
 		if err != nil {
 			return err
 		}
@@ -165,7 +168,7 @@ func (s *stage) copyFilesFrom(b *Build) error {
 		srcRootfsPath := b.stages[stageIndex].b.RootfsPath
 		dstRootfsPath := s.b.RootfsPath
 
-		sylog.Debugf("Copying files from stage: %s", args[1])
+		sylog.Debugf("Copying files from stage: %s", name)
 
 		// iterate through filetransfers
 		for _, transfer := range f.Files {
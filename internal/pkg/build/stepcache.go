@@ -0,0 +1,318 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hpcng/singularity/internal/pkg/build/files"
+	"github.com/hpcng/singularity/internal/pkg/build/sources"
+	"github.com/hpcng/singularity/internal/pkg/cache"
+	"github.com/hpcng/singularity/internal/pkg/image/packer"
+	"github.com/hpcng/singularity/internal/pkg/image/unpacker"
+	"github.com/hpcng/singularity/internal/pkg/util/fs/squashfs"
+	"github.com/hpcng/singularity/pkg/build/types"
+	"github.com/hpcng/singularity/pkg/sylog"
+)
+
+// stepCacheVersion is part of every step key, it must be changed when
+// the content of snapshots or the way keys are computed changes.
+const stepCacheVersion = "2"
+
+// stepCacheObjects is the file of the root filesystem snapshots holding the
+// JSON objects of the bundle, such as the OCI configuration set when the
+// bootstrap source is packed, which are not set when the bootstrap is
+// restored from the cache.
+const stepCacheObjects = ".singularity-build-objects.json"
+
+// build steps after which the root filesystem of a stage is cached.
+const (
+	stepNone = iota
+	// stepFiles is the root filesystem after the bootstrap, %setup
+	// and %files sections.
+	stepFiles
+	// stepPost is the root filesystem after the %post section.
+	stepPost
+)
+
+var stepNames = map[int]string{
+	stepFiles: "files",
+	stepPost:  "post",
+}
+
+// stepCache holds the build cache entries of the root filesystem snapshots
+// of a stage. Keys of a step are computed from the bootstrap source and
+// the content of the sections up to this step, so the longest unchanged
+// sequence of steps is restored from the cache. A nil stepCache caches
+// nothing.
+type stepCache struct {
+	b       *types.Bundle
+	entries map[int]*cache.Entry
+	// restored is the last step restored from the cache
+	restored int
+}
+
+// newStepCache returns the step cache of the stage i, and restores its root
+// filesystem from the last cached step if any. It returns nil if steps are
+// not cached for this build.
+func (b *Build) newStepCache(ctx context.Context, i int) (sc *stepCache, err error) {
+	opts := b.Conf.Opts
+	if !opts.StepCache || opts.NoCache || opts.ImgCache == nil || opts.ImgCache.IsDisabled() {
+		return nil, nil
+	}
+	// snapshots are not encrypted
+	if opts.EncryptionKeyInfo != nil {
+		sylog.Infof("Build steps are not cached for encrypted images")
+		return nil, nil
+	}
+
+	s := &b.stages[i]
+
+	keys, err := s.stepKeys(ctx, b)
+	if err != nil {
+		return nil, fmt.Errorf("while computing build step keys: %v", err)
+	} else if keys == nil {
+		return nil, nil
+	}
+	s.stepKey = keys[stepPost]
+
+	sc = &stepCache{
+		b:       s.b,
+		entries: make(map[int]*cache.Entry),
+	}
+	defer func() {
+		if err != nil {
+			sc.close()
+		}
+	}()
+
+	// look for the longest sequence of cached steps, entries of missing
+	// steps stay locked until the step is cached or the build ends, so
+	// concurrent builds of the same definition wait for them
+	for step := stepPost; step > stepNone; step-- {
+		entry, err := opts.ImgCache.GetEntry(cache.BuildCacheType, keys[step])
+		if err != nil {
+			return nil, fmt.Errorf("while getting build cache entry: %v", err)
+		}
+		if !entry.Exists {
+			sc.entries[step] = entry
+			continue
+		}
+
+		sylog.Infof("Using cached root filesystem after %%%s section", stepNames[step])
+		err = sc.restore(entry)
+		entry.CleanTmp()
+		if err != nil {
+			return nil, err
+		}
+		sc.restored = step
+		break
+	}
+
+	return sc, nil
+}
+
+// skip returns whether step was restored from the cache.
+func (sc *stepCache) skip(step int) bool {
+	return sc != nil && sc.restored >= step
+}
+
+// restore extracts the root filesystem snapshot of entry, and restores the
+// JSON objects of the bundle saved with it.
+func (sc *stepCache) restore(entry *cache.Entry) error {
+	f, err := os.Open(entry.Path)
+	if err != nil {
+		return fmt.Errorf("while opening cached root filesystem: %v", err)
+	}
+	defer f.Close()
+
+	if err := unpacker.NewSquashfs().ExtractAll(f, sc.b.RootfsPath); err != nil {
+		return fmt.Errorf("while extracting cached root filesystem: %v", err)
+	}
+
+	path := filepath.Join(sc.b.RootfsPath, stepCacheObjects)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("while reading cached bundle objects: %v", err)
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("while removing cached bundle objects: %v", err)
+	}
+
+	objects := make(map[string][]byte)
+	if err := json.Unmarshal(data, &objects); err != nil {
+		return fmt.Errorf("while decoding cached bundle objects: %v", err)
+	}
+	for name, data := range objects {
+		sc.b.JSONObjects[name] = data
+	}
+	return nil
+}
+
+// save caches the root filesystem after step if it isn't cached yet.
+func (sc *stepCache) save(step int) error {
+	if sc == nil {
+		return nil
+	}
+	entry, ok := sc.entries[step]
+	if !ok || entry.Exists {
+		return nil
+	}
+
+	sylog.Infof("Caching root filesystem after %%%s section", stepNames[step])
+
+	flags := []string{"-noappend"}
+	mksquashfsProcs, err := squashfs.GetProcs()
+	if err != nil {
+		return fmt.Errorf("while searching for mksquashfs processor limits: %v", err)
+	}
+	mksquashfsMem, err := squashfs.GetMem()
+	if err != nil {
+		return fmt.Errorf("while searching for mksquashfs mem limits: %v", err)
+	}
+	if mksquashfsMem != "" {
+		flags = append(flags, "-mem", mksquashfsMem)
+	}
+	if mksquashfsProcs != 0 {
+		flags = append(flags, "-processors", fmt.Sprint(mksquashfsProcs))
+	}
+
+	// the JSON objects of the bundle are saved in the snapshot, so the
+	// root filesystem and its objects are cached atomically
+	data, err := json.Marshal(sc.b.JSONObjects)
+	if err != nil {
+		return fmt.Errorf("while encoding bundle objects: %v", err)
+	}
+	path := filepath.Join(sc.b.RootfsPath, stepCacheObjects)
+	if err := ioutil.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("while writing bundle objects: %v", err)
+	}
+	defer os.Remove(path)
+
+	if err := packer.NewSquashfs().Create([]string{sc.b.RootfsPath}, entry.TmpPath, flags); err != nil {
+		return fmt.Errorf("while creating root filesystem snapshot: %v", err)
+	}
+	if err := entry.Finalize(); err != nil {
+		return err
+	}
+	entry.Exists = true
+	entry.CleanTmp()
+	return nil
+}
+
+// close releases the cache entries of the steps which were not cached.
+func (sc *stepCache) close() {
+	if sc == nil {
+		return
+	}
+	for _, entry := range sc.entries {
+		entry.CleanTmp()
+	}
+}
+
+// stepKeys returns the cache keys of the build steps of the stage, or nil
+// if the stage can't be cached.
+func (s *stage) stepKeys(ctx context.Context, b *Build) (map[int]string, error) {
+	def := s.b.Recipe
+	h := sha256.New()
+
+	fmt.Fprintf(h, "version\x00%s\x00", stepCacheVersion)
+	writeSorted(h, "header", def.Header)
+
+	// the header doesn't change when the image it references changes
+	fmt.Fprintf(h, "source\x00")
+	if ok, err := sources.HashSource(ctx, h, s.b); err != nil {
+		return nil, err
+	} else if !ok {
+		sylog.Infof("Build steps are not cached for %s bootstrap", def.Header["bootstrap"])
+		return nil, nil
+	}
+	fmt.Fprintf(h, "sections\x00%s\x00", strings.Join(s.b.Opts.Sections, ","))
+	fmt.Fprintf(h, "fixperms\x00%v\x00", s.b.Opts.FixPerms)
+
+	// apps sections and their files
+	writeSorted(h, "apps", def.CustomData)
+	for _, k := range sortedKeys(def.CustomData) {
+		if !strings.HasPrefix(k, "appfiles ") {
+			continue
+		}
+		for _, line := range strings.Split(def.CustomData[k], "\n") {
+			line = strings.TrimSpace(strings.Split(line, "#")[0])
+			if line == "" {
+				continue
+			}
+			if err := files.HashFromHost(h, strings.Fields(line)[0]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	writeScript(h, "setup", def.BuildData.Setup)
+
+	for _, f := range def.BuildData.Files {
+		// Trim comments from args
+		cleanArgs := strings.Split(f.Args, "#")[0]
+		fmt.Fprintf(h, "files\x00%s\x00", cleanArgs)
+
+		if args := strings.Fields(cleanArgs); len(args) == 2 {
+			// files copied from a stage depend on its last step
+			i, err := b.findStageIndex(args[1])
+			if err != nil {
+				return nil, err
+			}
+			if b.stages[i].stepKey == "" {
+				return nil, nil
+			}
+			fmt.Fprintf(h, "%s\x00", b.stages[i].stepKey)
+		}
+
+		for _, transfer := range f.Files {
+			fmt.Fprintf(h, "%s\x00%s\x00", transfer.Src, transfer.Dst)
+			if cleanArgs == "" && transfer.Src != "" {
+				if err := files.HashFromHost(h, transfer.Src); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	keys := make(map[int]string)
+	keys[stepFiles] = fmt.Sprintf("%x", h.Sum(nil))
+
+	writeScript(h, "post", def.BuildData.Post)
+	keys[stepPost] = fmt.Sprintf("%x", h.Sum(nil))
+
+	return keys, nil
+}
+
+func writeScript(w io.Writer, name string, script types.Script) {
+	fmt.Fprintf(w, "%s\x00%s\x00%s\x00", name, script.Args, script.Script)
+}
+
+func writeSorted(w io.Writer, name string, m map[string]string) {
+	fmt.Fprintf(w, "%s\x00", name)
+	for _, k := range sortedKeys(m) {
+		fmt.Fprintf(w, "%s\x00%s\x00", k, m[k])
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
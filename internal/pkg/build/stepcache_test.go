@@ -0,0 +1,154 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/hpcng/sif/pkg/sif"
+	"github.com/hpcng/singularity/internal/pkg/build/assemblers"
+	"github.com/hpcng/singularity/internal/pkg/cache"
+	"github.com/hpcng/singularity/internal/pkg/test/tool/require"
+	"github.com/hpcng/singularity/pkg/build/types"
+	"github.com/hpcng/singularity/pkg/image"
+)
+
+// newStepCacheBuild returns a single stage build of a scratch definition
+// caching its steps in imgCache.
+func newStepCacheBuild(t *testing.T, dir string, imgCache *cache.Handle) *Build {
+	bundle, err := types.NewBundle(dir, os.TempDir())
+	if err != nil {
+		t.Fatalf("unable to make bundle: %v", err)
+	}
+	t.Cleanup(func() { bundle.Remove() })
+
+	bundle.Recipe = types.Definition{
+		Header: map[string]string{"bootstrap": "scratch"},
+		Raw:    []byte("bootstrap: scratch\n"),
+	}
+	bundle.Opts.Sections = []string{"all"}
+	bundle.Opts.StepCache = true
+	bundle.Opts.ImgCache = imgCache
+
+	return &Build{
+		stages: []stage{{name: "test", b: bundle}},
+		Conf:   Config{Opts: bundle.Opts},
+	}
+}
+
+// sifObjects returns the data of the JSON descriptors of the SIF image
+// path, indexed by name.
+func sifObjects(t *testing.T, path string) map[string][]byte {
+	f, err := sif.LoadContainer(path, true)
+	if err != nil {
+		t.Fatalf("failed to load SIF image: %v", err)
+	}
+	defer f.UnloadContainer()
+
+	objects := make(map[string][]byte)
+	for i := range f.DescrArr {
+		d := &f.DescrArr[i]
+		if d.Used && d.Datatype == sif.DataGenericJSON {
+			objects[d.GetName()] = d.GetData(&f)
+		}
+	}
+	return objects
+}
+
+func TestStepCacheRebuild(t *testing.T) {
+	require.Command(t, "mksquashfs")
+	require.Command(t, "unsquashfs")
+
+	mksquashfsPath, err := exec.LookPath("mksquashfs")
+	if err != nil {
+		t.Fatalf("could not find mksquashfs: %v", err)
+	}
+
+	dir := t.TempDir()
+	imgCache, err := cache.New(cache.Config{ParentDir: filepath.Join(dir, "cache")})
+	if err != nil {
+		t.Fatalf("failed to create an image cache handle: %s", err)
+	}
+
+	ctx := context.Background()
+	a := &assemblers.SIFAssembler{MksquashfsPath: mksquashfsPath}
+	ociConfig := []byte(`{"Cmd":["/bin/sh"]}`)
+
+	// first build, the bootstrap source is packed
+	first := newStepCacheBuild(t, filepath.Join(dir, "first"), imgCache)
+	b := first.stages[0].b
+
+	sc, err := first.newStepCache(ctx, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sc.skip(stepFiles) {
+		t.Fatalf("unexpected cached step in empty cache")
+	}
+	if err := ioutil.WriteFile(filepath.Join(b.RootfsPath, "file"), []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	b.JSONObjects[image.SIFDescOCIConfigJSON] = ociConfig
+	if err := sc.save(stepFiles); err != nil {
+		t.Fatalf("failed to cache files step: %v", err)
+	}
+	if err := sc.save(stepPost); err != nil {
+		t.Fatalf("failed to cache post step: %v", err)
+	}
+	sc.close()
+
+	if _, err := os.Stat(filepath.Join(b.RootfsPath, stepCacheObjects)); !os.IsNotExist(err) {
+		t.Errorf("bundle objects left in root filesystem: %v", err)
+	}
+	firstSIF := filepath.Join(dir, "first.sif")
+	if err := a.Assemble(b, firstSIF); err != nil {
+		t.Fatalf("failed to assemble first image: %v", err)
+	}
+
+	// rebuild, all steps are restored from the cache
+	rebuild := newStepCacheBuild(t, filepath.Join(dir, "rebuild"), imgCache)
+	b = rebuild.stages[0].b
+
+	sc, err = rebuild.newStepCache(ctx, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sc.close()
+	if !sc.skip(stepPost) {
+		t.Fatalf("post step not restored from cache")
+	}
+
+	if data, err := ioutil.ReadFile(filepath.Join(b.RootfsPath, "file")); err != nil || string(data) != "data" {
+		t.Errorf("unexpected restored file content %q: %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(b.RootfsPath, stepCacheObjects)); !os.IsNotExist(err) {
+		t.Errorf("bundle objects left in restored root filesystem: %v", err)
+	}
+	rebuildSIF := filepath.Join(dir, "rebuild.sif")
+	if err := a.Assemble(b, rebuildSIF); err != nil {
+		t.Fatalf("failed to assemble rebuilt image: %v", err)
+	}
+
+	want := sifObjects(t, firstSIF)
+	got := sifObjects(t, rebuildSIF)
+	if !bytes.Equal(want[image.SIFDescOCIConfigJSON], ociConfig) {
+		t.Fatalf("unexpected OCI configuration in first image: %s", want[image.SIFDescOCIConfigJSON])
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d JSON descriptors, want %d", len(got), len(want))
+	}
+	for name, data := range want {
+		if !bytes.Equal(got[name], data) {
+			t.Errorf("got descriptor %s %q, want %q", name, got[name], data)
+		}
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/hpcng/singularity/internal/pkg/util/fs"
 	"github.com/hpcng/singularity/pkg/syfs"
 	"github.com/hpcng/singularity/pkg/sylog"
+	"github.com/hpcng/singularity/pkg/util/fs/lock"
 )
 
 var errInvalidCacheType = errors.New("invalid cache type")
@@ -29,6 +30,11 @@ const (
 	DirEnv = "SINGULARITY_CACHEDIR"
 	// DisableEnv specifies whether the image should be used
 	DisableEnv = "SINGULARITY_DISABLE_CACHE"
+	// MaxSizeEnv specifies the maximum size of the cache, e.g. "20G"
+	MaxSizeEnv = "SINGULARITY_CACHE_MAXSIZE"
+	// QuotaEnv specifies the maximum size of individual cache types as a
+	// comma separated list of type=size, e.g. "library=10G,oci-tmp=5G"
+	QuotaEnv = "SINGULARITY_CACHE_QUOTA"
 	// SubDirName specifies the name of the directory relative to the
 	// ParentDir specified when the cache is created.
 	// By default the cache will be placed at "~/.singularity/cache" which
@@ -47,6 +53,8 @@ const (
 	OrasCacheType = "oras"
 	// NetCacheType specifies the cache holds images pulled from http(s) internet sources
 	NetCacheType = "net"
+	// BuildCacheType specifies the cache holds root filesystem snapshots of build steps
+	BuildCacheType = "build"
 )
 
 var (
@@ -57,6 +65,7 @@ var (
 		ShubCacheType,
 		OrasCacheType,
 		NetCacheType,
+		BuildCacheType,
 	}
 	// OciCacheTypes specifies the OCI cache types.
 	OciCacheTypes = []string{
@@ -71,6 +80,10 @@ type Config struct {
 	ParentDir string
 	// Disable specifies whether the user request the cache to be disabled by default.
 	Disable bool
+	// MaxSize specifies the maximum size in bytes of the cache, 0 means unlimited.
+	MaxSize int64
+	// Quotas specifies the maximum size in bytes of individual file cache types.
+	Quotas map[string]int64
 }
 
 // Handle is an structure representing the image cache, it's location and subdirectories
@@ -85,6 +98,10 @@ type Handle struct {
 	rootDir string
 	// If the cache is disabled
 	disabled bool
+	// maxSize is the maximum size of the cache, 0 means unlimited
+	maxSize int64
+	// quotas holds the maximum size of file cache types
+	quotas map[string]int64
 }
 
 func (h *Handle) GetFileCacheDir(cacheType string) (cacheDir string, err error) {
@@ -101,13 +118,20 @@ func (h *Handle) GetOciCacheDir(cacheType string) (cacheDir string, err error) {
 	return h.getCacheTypeDir(cacheType), nil
 }
 
-// GetEntry returns a cache Entry for a specified file cache type and hash
+// GetEntry returns a cache Entry for a specified file cache type and hash.
+// The entry is locked until CleanTmp is called, so a concurrent process
+// requesting the same entry waits for the entry to be created or used, and
+// then reuses it.
 func (h *Handle) GetEntry(cacheType string, hash string) (e *Entry, err error) {
 	if h.disabled {
 		return nil, nil
 	}
 
-	e = &Entry{}
+	e = &Entry{
+		CacheType: cacheType,
+		handle:    h,
+		lockFd:    -1,
+	}
 
 	cacheDir, err := h.GetFileCacheDir(cacheType)
 	if err != nil {
@@ -116,6 +140,16 @@ func (h *Handle) GetEntry(cacheType string, hash string) (e *Entry, err error) {
 
 	e.Path = filepath.Join(cacheDir, hash)
 
+	e.lockFd, err = h.lockEntry(cacheType, hash)
+	if err != nil {
+		return nil, fmt.Errorf("could not lock cache entry '%s': %v", e.Path, err)
+	}
+	defer func() {
+		if err != nil {
+			e.release()
+		}
+	}()
+
 	// If there is a directory it's from an older version of Singularity
 	// We need to remove it as we work with single files per hash only now
 	if fs.IsDir(e.Path) {
@@ -136,7 +170,7 @@ func (h *Handle) GetEntry(cacheType string, hash string) (e *Entry, err error) {
 
 	if !pathExists {
 		e.Exists = false
-		f, err := fs.MakeTmpFile(cacheDir, "tmp_", 0o700)
+		f, err := fs.MakeTmpFile(cacheDir, tmpPrefix+hash+"-", 0o700)
 		if err != nil {
 			return nil, err
 		}
@@ -145,6 +179,7 @@ func (h *Handle) GetEntry(cacheType string, hash string) (e *Entry, err error) {
 			return nil, err
 		}
 		e.TmpPath = f.Name()
+		h.recordAccess(cacheType, false)
 		return e, nil
 	}
 
@@ -155,6 +190,10 @@ func (h *Handle) GetEntry(cacheType string, hash string) (e *Entry, err error) {
 
 	// It exists in the cache and it's a file. Caller can use the Path directly
 	e.Exists = true
+	if err := e.touch(); err != nil {
+		sylog.Debugf("Could not update access time of cache entry '%s': %v", e.Path, err)
+	}
+	h.recordAccess(cacheType, true)
 	return e, nil
 }
 
@@ -167,6 +206,9 @@ func (h *Handle) CleanCache(cacheType string, dryRun bool, days int) (err error)
 		return nil
 	}
 
+	// Entries of file cache types are locked while they are created or used
+	lockEntries := stringInSlice(cacheType, FileCacheTypes)
+
 	errCount := 0
 	for _, f := range files {
 
@@ -177,6 +219,19 @@ func (h *Handle) CleanCache(cacheType string, dryRun bool, days int) (err error)
 			}
 		}
 
+		fd := -1
+		if lockEntries {
+			fd, err = h.tryLockEntry(cacheType, entryHash(f.Name()))
+			if err == lock.ErrLocked {
+				sylog.Infof("Skipping %s cache entry %s: in use by another process", cacheType, f.Name())
+				continue
+			} else if err != nil {
+				sylog.Errorf("Could not lock cache entry '%s': %v", f.Name(), err)
+				errCount = errCount + 1
+				continue
+			}
+		}
+
 		sylog.Infof("Removing %s cache entry: %s", cacheType, f.Name())
 		if !dryRun {
 			// We RemoveAll in case the entry is a directory from Singularity <3.6
@@ -186,13 +241,17 @@ func (h *Handle) CleanCache(cacheType string, dryRun bool, days int) (err error)
 				errCount = errCount + 1
 			}
 		}
+
+		if fd >= 0 {
+			lock.Release(fd)
+		}
 	}
 
 	if errCount > 0 {
 		return fmt.Errorf("failed to remove %d cache entries", errCount)
 	}
 
-	return err
+	return nil
 }
 
 // cleanAllCaches is an utility function that wipes all files in the
@@ -247,6 +306,19 @@ func New(cfg Config) (h *Handle, err error) {
 		return h, nil
 	}
 
+	h.maxSize = cfg.MaxSize
+	if h.maxSize == 0 {
+		if h.maxSize, err = fs.ParseSize(os.Getenv(MaxSizeEnv)); err != nil {
+			return nil, fmt.Errorf("failed to parse environment variable %s: %s", MaxSizeEnv, err)
+		}
+	}
+	h.quotas = cfg.Quotas
+	if h.quotas == nil {
+		if h.quotas, err = parseQuotas(os.Getenv(QuotaEnv)); err != nil {
+			return nil, fmt.Errorf("failed to parse environment variable %s: %s", QuotaEnv, err)
+		}
+	}
+
 	// cfg is what is requested so we should not change any value that it contains
 	parentDir := cfg.ParentDir
 	if parentDir == "" {
@@ -1,4 +1,4 @@
-// Copyright (c) 2018-2020, Sylabs Inc. All rights reserved.
+// Copyright (c) 2018-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -9,9 +9,12 @@ package cache
 import (
 	"fmt"
 	"os"
+	"syscall"
+	"time"
 
 	"github.com/hpcng/singularity/internal/pkg/util/fs"
 	"github.com/hpcng/singularity/pkg/sylog"
+	"github.com/hpcng/singularity/pkg/util/fs/lock"
 )
 
 // Entry is a structure representing an entry in the cache. An entry is a file under the
@@ -27,10 +30,30 @@ type Entry struct {
 	// tmpPath is the temporary location that should be used for a new cache entry as it
 	// is created
 	TmpPath string
+	// AccessTime is the last time the entry was retrieved from the cache, it is
+	// used to evict the least recently used entries when the cache is full
+	AccessTime time.Time
+
+	handle *Handle
+	// lockFd is the file descriptor of the entry lock, or -1 if the entry
+	// is not locked
+	lockFd int
 }
 
-// Finalize an entry by renaming it to its permanent path atomically
+// Finalize an entry by renaming it to its permanent path atomically. If the cache
+// has a maximum size or a quota for the entry type, least recently used entries are
+// evicted to make room for the new entry.
 func (e *Entry) Finalize() error {
+	if e.handle != nil {
+		fi, err := os.Stat(e.TmpPath)
+		if err != nil {
+			return fmt.Errorf("could not finalize cached file: %v", err)
+		}
+		if err := e.handle.evict(e.CacheType, e.Path, fi.Size()); err != nil {
+			sylog.Warningf("Could not evict cache entries: %v", err)
+		}
+	}
+
 	// Try to rename the temporary file to its permanent path
 	// This is a file, so we won't have an IsExist error since...
 	//   If newpath already exists and is not a directory, Rename replaces it.
@@ -39,11 +62,17 @@ func (e *Entry) Finalize() error {
 	if err != nil {
 		return fmt.Errorf("could not finalize cached file: %v", err)
 	}
+	if err := e.touch(); err != nil {
+		sylog.Debugf("Could not update access time of cache entry '%s': %v", e.Path, err)
+	}
 	return nil
 }
 
-// CleanTmp should be defer'd when an Entry is created and will remove any temporary file
+// CleanTmp should be defer'd when an Entry is created and will remove any temporary file,
+// it also releases the entry lock so other processes can use the entry
 func (e *Entry) CleanTmp() {
+	defer e.release()
+
 	// If there is no TmpPath / file there then there is nothing to clean up
 	if e.TmpPath == "" || !fs.IsFile(e.TmpPath) {
 		return
@@ -53,3 +82,34 @@ func (e *Entry) CleanTmp() {
 		sylog.Errorf("Could not remove cache temporary file '%s': %v", e.TmpPath, err)
 	}
 }
+
+// release releases the entry lock if held
+func (e *Entry) release() {
+	if e.lockFd < 0 {
+		return
+	}
+	if err := lock.Release(e.lockFd); err != nil {
+		sylog.Debugf("Could not release lock of cache entry '%s': %v", e.Path, err)
+	}
+	e.lockFd = -1
+}
+
+// touch sets the access time of the entry to the current time, the
+// modification time is preserved as it is used as the creation date
+// of the entry.
+func (e *Entry) touch() error {
+	fi, err := os.Stat(e.Path)
+	if err != nil {
+		return err
+	}
+	e.AccessTime = time.Now()
+	return os.Chtimes(e.Path, e.AccessTime, fi.ModTime())
+}
+
+// accessTime returns the last access time of a file.
+func accessTime(fi os.FileInfo) time.Time {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return time.Unix(st.Atim.Unix())
+	}
+	return fi.ModTime()
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hpcng/singularity/internal/pkg/util/fs"
+	"github.com/hpcng/singularity/pkg/sylog"
+	"github.com/hpcng/singularity/pkg/util/fs/lock"
+)
+
+// lockDirName is the name of the directory, relative to the cache root
+// directory, holding the lock files of file cache entries. Lock files are
+// kept outside of the cache type directories so they are never listed,
+// evicted or cleaned as cache entries.
+const lockDirName = "locks"
+
+// tmpPrefix is the prefix of temporary files created for new entries,
+// it is followed by the entry hash and a random suffix.
+const tmpPrefix = "tmp_"
+
+// lockPath returns the path of the lock file of the cache entry hash.
+func (h *Handle) lockPath(cacheType, hash string) string {
+	return filepath.Join(h.rootDir, lockDirName, cacheType, hash)
+}
+
+// openLock makes sure the lock file of the cache entry hash exists and
+// returns its path.
+func (h *Handle) openLock(cacheType, hash string) (string, error) {
+	path := h.lockPath(cacheType, hash)
+
+	if err := fs.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0o600)
+	if err != nil {
+		return "", err
+	}
+
+	return path, f.Close()
+}
+
+// lockEntry acquires the lock of the cache entry hash, waiting for any
+// other process creating or using the same entry to release it.
+func (h *Handle) lockEntry(cacheType, hash string) (int, error) {
+	path, err := h.openLock(cacheType, hash)
+	if err != nil {
+		return -1, err
+	}
+
+	fd, err := lock.TryExclusive(path)
+	if err == lock.ErrLocked {
+		sylog.Infof("Waiting for another process using %s cache entry %s", cacheType, hash)
+		fd, err = lock.Exclusive(path)
+	}
+
+	return fd, err
+}
+
+// tryLockEntry acquires the lock of the cache entry hash without waiting,
+// it returns lock.ErrLocked if the entry is in use by another process.
+func (h *Handle) tryLockEntry(cacheType, hash string) (int, error) {
+	path, err := h.openLock(cacheType, hash)
+	if err != nil {
+		return -1, err
+	}
+	return lock.TryExclusive(path)
+}
+
+// entryHash returns the hash of the cache entry corresponding to
+// the file name found in a cache type directory.
+func entryHash(name string) string {
+	if !strings.HasPrefix(name, tmpPrefix) {
+		return name
+	}
+	name = strings.TrimPrefix(name, tmpPrefix)
+	if i := strings.LastIndex(name, "-"); i > 0 {
+		return name[:i]
+	}
+	return name
+}
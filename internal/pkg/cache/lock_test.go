@@ -0,0 +1,117 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func newTestHandle(t *testing.T) (*Handle, func()) {
+	dir, err := ioutil.TempDir("", "cache-")
+	if err != nil {
+		t.Fatalf("while creating temporary directory: %s", err)
+	}
+
+	h, err := New(Config{ParentDir: dir})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("while creating cache handle: %s", err)
+	}
+
+	return h, func() { os.RemoveAll(dir) }
+}
+
+func TestConcurrentEntry(t *testing.T) {
+	h, cleanup := newTestHandle(t)
+	defer cleanup()
+
+	first, err := h.GetEntry(LibraryCacheType, "sha256.1234")
+	if err != nil {
+		t.Fatalf("while getting cache entry: %s", err)
+	}
+	if first.Exists {
+		t.Fatalf("unexpected existing cache entry")
+	}
+
+	type result struct {
+		e   *Entry
+		err error
+	}
+	ch := make(chan result, 1)
+
+	go func() {
+		e, err := h.GetEntry(LibraryCacheType, "sha256.1234")
+		ch <- result{e, err}
+	}()
+
+	select {
+	case <-ch:
+		t.Fatalf("second entry returned while the first one is being created")
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	if err := ioutil.WriteFile(first.TmpPath, []byte("image"), 0o600); err != nil {
+		t.Fatalf("while writing cache entry: %s", err)
+	}
+	if err := first.Finalize(); err != nil {
+		t.Fatalf("while finalizing cache entry: %s", err)
+	}
+	first.CleanTmp()
+
+	select {
+	case r := <-ch:
+		if r.err != nil {
+			t.Fatalf("while getting second cache entry: %s", r.err)
+		}
+		defer r.e.CleanTmp()
+		if !r.e.Exists {
+			t.Errorf("second process didn't reuse the cache entry")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("second entry not returned after the first one was released")
+	}
+}
+
+func TestCleanLockedEntry(t *testing.T) {
+	h, cleanup := newTestHandle(t)
+	defer cleanup()
+
+	path := addEntry(t, h, OrasCacheType, "sha256.1234", 10, time.Time{})
+
+	e, err := h.GetEntry(OrasCacheType, "sha256.1234")
+	if err != nil {
+		t.Fatalf("while getting cache entry: %s", err)
+	}
+
+	// an entry being created must be skipped as well
+	tmp, err := h.GetEntry(OrasCacheType, "sha256.5678")
+	if err != nil {
+		t.Fatalf("while getting cache entry: %s", err)
+	}
+
+	if err := h.CleanCache(OrasCacheType, false, -1); err != nil {
+		t.Fatalf("unexpected error while cleaning cache: %s", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("cache entry in use was removed: %s", err)
+	}
+	if _, err := os.Stat(tmp.TmpPath); err != nil {
+		t.Errorf("cache entry being created was removed: %s", err)
+	}
+
+	e.CleanTmp()
+	tmp.CleanTmp()
+
+	if err := h.CleanCache(OrasCacheType, false, -1); err != nil {
+		t.Fatalf("unexpected error while cleaning cache: %s", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("released cache entry was not removed")
+	}
+}
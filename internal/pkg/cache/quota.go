@@ -0,0 +1,205 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hpcng/singularity/internal/pkg/util/fs"
+	"github.com/hpcng/singularity/pkg/sylog"
+	"github.com/hpcng/singularity/pkg/util/fs/lock"
+)
+
+// parseQuotas parses a comma separated list of type=size quotas.
+func parseQuotas(s string) (map[string]int64, error) {
+	quotas := make(map[string]int64)
+
+	for _, q := range strings.Split(s, ",") {
+		q = strings.TrimSpace(q)
+		if q == "" {
+			continue
+		}
+
+		kv := strings.SplitN(q, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid quota %q: must be of the form type=size", q)
+		}
+
+		cacheType := strings.TrimSpace(kv[0])
+		if !stringInSlice(cacheType, FileCacheTypes) {
+			return nil, fmt.Errorf("invalid quota %q: %s", q, errInvalidCacheType)
+		}
+
+		size, err := fs.ParseSize(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid quota %q: %s", q, err)
+		}
+		quotas[cacheType] = size
+	}
+
+	return quotas, nil
+}
+
+// MaxSize returns the maximum size of the cache in bytes, 0 means unlimited.
+func (h *Handle) MaxSize() int64 {
+	return h.maxSize
+}
+
+// Quota returns the maximum size in bytes of the cache type, 0 means unlimited.
+func (h *Handle) Quota(cacheType string) int64 {
+	return h.quotas[cacheType]
+}
+
+// fileEntry describes a finalized entry of a file cache type.
+type fileEntry struct {
+	cacheType  string
+	path       string
+	size       int64
+	accessTime time.Time
+}
+
+// fileEntries returns the finalized entries of all file cache types,
+// sorted from the least to the most recently used.
+func (h *Handle) fileEntries() ([]fileEntry, error) {
+	var entries []fileEntry
+
+	for _, ct := range FileCacheTypes {
+		dir := h.getCacheTypeDir(ct)
+
+		files, err := ioutil.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		for _, f := range files {
+			// skip entries being created and any directory left over by
+			// older versions
+			if !f.Mode().IsRegular() || strings.HasPrefix(f.Name(), tmpPrefix) {
+				continue
+			}
+			entries = append(entries, fileEntry{
+				cacheType:  ct,
+				path:       filepath.Join(dir, f.Name()),
+				size:       f.Size(),
+				accessTime: accessTime(f),
+			})
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].accessTime.Before(entries[j].accessTime)
+	})
+
+	return entries, nil
+}
+
+// blobsSize returns the space used by the OCI blob cache.
+func (h *Handle) blobsSize() (int64, error) {
+	var size int64
+
+	dir := h.getCacheTypeDir(OciBlobCacheType)
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if fi.Mode().IsRegular() {
+			size += fi.Size()
+		}
+		return nil
+	})
+
+	return size, err
+}
+
+// evict removes the least recently used entries until an entry of size bytes
+// for cacheType, replacing the entry at path if any, fits within the cache
+// maximum size and the quota of cacheType. OCI blobs are accounted in the
+// cache size but are never evicted, they are shared between images and can
+// be removed with 'singularity cache clean'.
+func (h *Handle) evict(cacheType, path string, size int64) error {
+	quota := h.quotas[cacheType]
+	if h.disabled || (h.maxSize == 0 && quota == 0) {
+		return nil
+	}
+
+	entries, err := h.fileEntries()
+	if err != nil {
+		return fmt.Errorf("while listing cache entries: %s", err)
+	}
+
+	var totalSize, typeSize int64
+
+	if h.maxSize > 0 {
+		if totalSize, err = h.blobsSize(); err != nil {
+			return fmt.Errorf("while computing blob cache size: %s", err)
+		}
+	}
+
+	candidates := entries[:0]
+	for _, e := range entries {
+		// the entry will be replaced, don't account it
+		if e.path == path {
+			continue
+		}
+		totalSize += e.size
+		if e.cacheType == cacheType {
+			typeSize += e.size
+		}
+		candidates = append(candidates, e)
+	}
+
+	for _, e := range candidates {
+		overQuota := quota > 0 && typeSize+size > quota
+		overMax := h.maxSize > 0 && totalSize+size > h.maxSize
+		if !overQuota && !overMax {
+			return nil
+		}
+		// only entries of the same type free space for the quota
+		if !overMax && e.cacheType != cacheType {
+			continue
+		}
+
+		// entries in use by another process are not evicted
+		fd, err := h.tryLockEntry(e.cacheType, filepath.Base(e.path))
+		if err == lock.ErrLocked {
+			sylog.Debugf("Not evicting %s cache entry %s: in use", e.cacheType, filepath.Base(e.path))
+			continue
+		} else if err != nil {
+			return fmt.Errorf("could not lock cache entry '%s': %v", e.path, err)
+		}
+
+		sylog.Infof("Evicting %s cache entry %s (%s)", e.cacheType, filepath.Base(e.path), fs.FindSize(e.size))
+		err = os.Remove(e.path)
+		lock.Release(fd)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("could not remove cache entry '%s': %v", e.path, err)
+		}
+
+		totalSize -= e.size
+		if e.cacheType == cacheType {
+			typeSize -= e.size
+		}
+	}
+
+	if quota > 0 && typeSize+size > quota {
+		sylog.Warningf("New %s cache entry exceeds the %s cache quota (%s)", cacheType, cacheType, fs.FindSize(quota))
+	} else if h.maxSize > 0 && totalSize+size > h.maxSize {
+		sylog.Warningf("New %s cache entry exceeds the cache maximum size (%s)", cacheType, fs.FindSize(h.maxSize))
+	}
+
+	return nil
+}
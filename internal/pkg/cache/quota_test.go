@@ -0,0 +1,205 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseQuotas(t *testing.T) {
+	tests := []struct {
+		name        string
+		quotas      string
+		expected    map[string]int64
+		expectError bool
+	}{
+		{
+			name:     "Empty",
+			quotas:   "",
+			expected: map[string]int64{},
+		},
+		{
+			name:   "Valid",
+			quotas: "library=1G, oci-tmp=512M",
+			expected: map[string]int64{
+				LibraryCacheType: 1 << 30,
+				OciTempCacheType: 512 << 20,
+			},
+		},
+		{
+			name:        "BlobType",
+			quotas:      "blob=1G",
+			expectError: true,
+		},
+		{
+			name:        "MissingSize",
+			quotas:      "library",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quotas, err := parseQuotas(tt.quotas)
+			if tt.expectError {
+				if err == nil {
+					t.Fatalf("unexpected success")
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(quotas, tt.expected) {
+				t.Errorf("unexpected quotas: got %v, expected %v", quotas, tt.expected)
+			}
+		})
+	}
+}
+
+// addEntry creates a finalized cache entry of size bytes last accessed
+// at the given time.
+func addEntry(t *testing.T, h *Handle, cacheType, hash string, size int, atime time.Time) string {
+	e, err := h.GetEntry(cacheType, hash)
+	if err != nil {
+		t.Fatalf("while getting cache entry: %s", err)
+	}
+	defer e.CleanTmp()
+
+	if err := ioutil.WriteFile(e.TmpPath, make([]byte, size), 0o600); err != nil {
+		t.Fatalf("while writing cache entry: %s", err)
+	}
+	if err := e.Finalize(); err != nil {
+		t.Fatalf("while finalizing cache entry: %s", err)
+	}
+	if !atime.IsZero() {
+		if err := os.Chtimes(e.Path, atime, atime); err != nil {
+			t.Fatalf("while setting access time: %s", err)
+		}
+	}
+
+	return e.Path
+}
+
+func TestEviction(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		maxSize  int64
+		quotas   map[string]int64
+		expected []string
+	}{
+		{
+			name:     "Unlimited",
+			expected: []string{"lib-old", "lib-new", "oras-old", "new"},
+		},
+		{
+			name:     "MaxSize",
+			maxSize:  300,
+			expected: []string{"lib-new", "new"},
+		},
+		{
+			name:     "Quota",
+			quotas:   map[string]int64{LibraryCacheType: 250},
+			expected: []string{"lib-new", "oras-old", "new"},
+		},
+		{
+			name:     "QuotaOtherType",
+			quotas:   map[string]int64{OrasCacheType: 100},
+			expected: []string{"lib-old", "lib-new", "oras-old", "new"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "cache-")
+			if err != nil {
+				t.Fatalf("while creating temporary directory: %s", err)
+			}
+			defer os.RemoveAll(dir)
+
+			h, err := New(Config{ParentDir: dir, MaxSize: tt.maxSize, Quotas: tt.quotas})
+			if err != nil {
+				t.Fatalf("while creating cache handle: %s", err)
+			}
+
+			entries := map[string]string{
+				"oras-old": addEntry(t, h, OrasCacheType, "oras-old", 100, now.Add(-3*time.Hour)),
+				"lib-old":  addEntry(t, h, LibraryCacheType, "lib-old", 100, now.Add(-2*time.Hour)),
+				"lib-new":  addEntry(t, h, LibraryCacheType, "lib-new", 100, now.Add(-1*time.Hour)),
+				"new":      addEntry(t, h, LibraryCacheType, "new", 150, time.Time{}),
+			}
+
+			var remaining []string
+			for _, name := range []string{"lib-old", "lib-new", "oras-old", "new"} {
+				if _, err := os.Stat(entries[name]); err == nil {
+					remaining = append(remaining, name)
+				}
+			}
+
+			if !reflect.DeepEqual(remaining, tt.expected) {
+				t.Errorf("unexpected remaining entries: got %v, expected %v", remaining, tt.expected)
+			}
+		})
+	}
+}
+
+func TestStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache-")
+	if err != nil {
+		t.Fatalf("while creating temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	h, err := New(Config{ParentDir: dir})
+	if err != nil {
+		t.Fatalf("while creating cache handle: %s", err)
+	}
+
+	path := addEntry(t, h, NetCacheType, "hash", 10, time.Time{})
+
+	before := time.Now().Add(-time.Minute)
+	if err := os.Chtimes(path, before, before); err != nil {
+		t.Fatalf("while setting access time: %s", err)
+	}
+
+	e, err := h.GetEntry(NetCacheType, "hash")
+	if err != nil {
+		t.Fatalf("while getting cache entry: %s", err)
+	}
+	defer e.CleanTmp()
+	if !e.Exists {
+		t.Fatalf("cache entry %s not found", path)
+	}
+	if !e.AccessTime.After(before) {
+		t.Errorf("access time of cache entry not updated")
+	}
+
+	fi, err := os.Stat(filepath.Join(dir, SubDirName, NetCacheType, "hash"))
+	if err != nil {
+		t.Fatalf("while getting cache entry information: %s", err)
+	}
+	if !fi.ModTime().Equal(before) {
+		t.Errorf("modification time of cache entry changed")
+	}
+
+	stats, err := h.Stats()
+	if err != nil {
+		t.Fatalf("while getting cache statistics: %s", err)
+	}
+
+	expected := map[string]Stats{
+		NetCacheType: {Hits: 1, Misses: 1},
+	}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("unexpected statistics: got %v, expected %v", stats, expected)
+	}
+}
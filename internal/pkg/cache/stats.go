@@ -0,0 +1,99 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/hpcng/singularity/pkg/sylog"
+	"github.com/hpcng/singularity/pkg/util/fs/lock"
+)
+
+// statsFile is the name of the file, relative to the cache root directory,
+// holding the hit and miss statistics of file cache types.
+const statsFile = "stats.json"
+
+// Stats holds the number of times entries of a cache type were found
+// in the cache (hits) or had to be created (misses).
+type Stats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+}
+
+// Stats returns the hit and miss statistics of the file cache types.
+func (h *Handle) Stats() (map[string]Stats, error) {
+	stats := make(map[string]Stats)
+	if h.disabled {
+		return stats, nil
+	}
+
+	b, err := ioutil.ReadFile(h.statsPath())
+	if os.IsNotExist(err) || len(b) == 0 {
+		return stats, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("while reading cache statistics: %s", err)
+	}
+
+	if err := json.Unmarshal(b, &stats); err != nil {
+		return nil, fmt.Errorf("while decoding cache statistics: %s", err)
+	}
+
+	return stats, nil
+}
+
+func (h *Handle) statsPath() string {
+	return filepath.Join(h.rootDir, statsFile)
+}
+
+// recordAccess increments the hit or miss counter of cacheType, errors
+// are not fatal as statistics are informative only.
+func (h *Handle) recordAccess(cacheType string, hit bool) {
+	if err := h.updateStats(cacheType, hit); err != nil {
+		sylog.Debugf("Could not update cache statistics: %v", err)
+	}
+}
+
+func (h *Handle) updateStats(cacheType string, hit bool) error {
+	path := h.statsPath()
+
+	// the statistics file must exist to be locked
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	f.Close()
+
+	fd, err := lock.Exclusive(path)
+	if err != nil {
+		return err
+	}
+	defer lock.Release(fd)
+
+	stats, err := h.Stats()
+	if err != nil {
+		return err
+	}
+
+	s := stats[cacheType]
+	if hit {
+		s.Hits++
+	} else {
+		s.Misses++
+	}
+	stats[cacheType] = s
+
+	b, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+
+	// the file is rewritten in place to preserve the lock held on it
+	return ioutil.WriteFile(path, b, 0o600)
+}
@@ -0,0 +1,381 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package cdi implements the Container Device Interface (CDI). CDI spec files
+// describe the device nodes, mounts, environment variables and hooks which
+// must be added to a container to use a vendor device, devices are requested
+// by their fully-qualified name vendor.com/class=name.
+package cdi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultSpecDirs are the directories searched for CDI spec files. A device
+// defined in a later directory overrides a device of the same name defined
+// in an earlier one.
+var DefaultSpecDirs = []string{"/etc/cdi", "/var/run/cdi"}
+
+// Hook names, they map to the OCI runtime specification hooks.
+const (
+	PrestartHook        = "prestart"
+	CreateRuntimeHook   = "createRuntime"
+	CreateContainerHook = "createContainer"
+	StartContainerHook  = "startContainer"
+	PoststartHook       = "poststart"
+	PoststopHook        = "poststop"
+)
+
+var hookNames = map[string]bool{
+	PrestartHook:        true,
+	CreateRuntimeHook:   true,
+	CreateContainerHook: true,
+	StartContainerHook:  true,
+	PoststartHook:       true,
+	PoststopHook:        true,
+}
+
+var (
+	// Match vendor.com/class kinds
+	kindRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*\.[A-Za-z0-9_.-]+/[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+	// Match device names
+	nameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.:-]*$`)
+)
+
+// Spec is the content of a CDI spec file, it defines the devices of a kind.
+type Spec struct {
+	Version        string         `json:"cdiVersion" yaml:"cdiVersion"`
+	Kind           string         `json:"kind" yaml:"kind"`
+	Devices        []Device       `json:"devices" yaml:"devices"`
+	ContainerEdits ContainerEdits `json:"containerEdits,omitempty" yaml:"containerEdits,omitempty"`
+}
+
+// Device is a device of a CDI spec, its container edits are applied
+// along with the container edits of the spec.
+type Device struct {
+	Name           string         `json:"name" yaml:"name"`
+	ContainerEdits ContainerEdits `json:"containerEdits" yaml:"containerEdits"`
+}
+
+// ContainerEdits are the modifications applied to a container to use
+// a device.
+type ContainerEdits struct {
+	Env         []string      `json:"env,omitempty" yaml:"env,omitempty"`
+	DeviceNodes []*DeviceNode `json:"deviceNodes,omitempty" yaml:"deviceNodes,omitempty"`
+	Hooks       []*Hook       `json:"hooks,omitempty" yaml:"hooks,omitempty"`
+	Mounts      []*Mount      `json:"mounts,omitempty" yaml:"mounts,omitempty"`
+}
+
+// DeviceNode is a device node created in the container. The type, major
+// and minor numbers and file mode default to the ones of the host device
+// node.
+type DeviceNode struct {
+	Path        string       `json:"path" yaml:"path"`
+	HostPath    string       `json:"hostPath,omitempty" yaml:"hostPath,omitempty"`
+	Type        string       `json:"type,omitempty" yaml:"type,omitempty"`
+	Major       int64        `json:"major,omitempty" yaml:"major,omitempty"`
+	Minor       int64        `json:"minor,omitempty" yaml:"minor,omitempty"`
+	FileMode    *os.FileMode `json:"fileMode,omitempty" yaml:"fileMode,omitempty"`
+	Permissions string       `json:"permissions,omitempty" yaml:"permissions,omitempty"`
+	UID         *uint32      `json:"uid,omitempty" yaml:"uid,omitempty"`
+	GID         *uint32      `json:"gid,omitempty" yaml:"gid,omitempty"`
+}
+
+// HostNodePath returns the path of the device node on the host.
+func (d *DeviceNode) HostNodePath() string {
+	if d.HostPath != "" {
+		return d.HostPath
+	}
+	return d.Path
+}
+
+// Mount is a host path bind mounted in the container.
+type Mount struct {
+	HostPath      string   `json:"hostPath" yaml:"hostPath"`
+	ContainerPath string   `json:"containerPath" yaml:"containerPath"`
+	Type          string   `json:"type,omitempty" yaml:"type,omitempty"`
+	Options       []string `json:"options,omitempty" yaml:"options,omitempty"`
+}
+
+// Readonly returns whether the mount is read-only.
+func (m *Mount) Readonly() bool {
+	for _, o := range m.Options {
+		if o == "ro" {
+			return true
+		}
+	}
+	return false
+}
+
+// Hook is a program executed at the container lifecycle step HookName.
+type Hook struct {
+	HookName string   `json:"hookName" yaml:"hookName"`
+	Path     string   `json:"path" yaml:"path"`
+	Args     []string `json:"args,omitempty" yaml:"args,omitempty"`
+	Env      []string `json:"env,omitempty" yaml:"env,omitempty"`
+	Timeout  *int     `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+// ParseQualifiedName splits a fully-qualified vendor.com/class=name device
+// name into its kind and name.
+func ParseQualifiedName(device string) (kind, name string, err error) {
+	split := strings.SplitN(device, "=", 2)
+	if len(split) != 2 || !kindRegexp.MatchString(split[0]) || !nameRegexp.MatchString(split[1]) {
+		return "", "", fmt.Errorf("invalid device name %q, the format is vendor.com/class=name", device)
+	}
+	return split[0], split[1], nil
+}
+
+func (e *ContainerEdits) validate() error {
+	for _, env := range e.Env {
+		if !strings.Contains(env, "=") {
+			return fmt.Errorf("invalid environment variable %q: '=' is missing", env)
+		}
+	}
+	for _, d := range e.DeviceNodes {
+		if !filepath.IsAbs(d.Path) {
+			return fmt.Errorf("device node path %q is not absolute", d.Path)
+		}
+		if d.HostPath != "" && !filepath.IsAbs(d.HostPath) {
+			return fmt.Errorf("device node host path %q is not absolute", d.HostPath)
+		}
+		switch d.Type {
+		case "", "b", "c", "u", "p":
+		default:
+			return fmt.Errorf("invalid device node type %q for %s", d.Type, d.Path)
+		}
+		if strings.Trim(d.Permissions, "rwm") != "" {
+			return fmt.Errorf("invalid device node permissions %q for %s", d.Permissions, d.Path)
+		}
+	}
+	for _, m := range e.Mounts {
+		if !filepath.IsAbs(m.HostPath) || !filepath.IsAbs(m.ContainerPath) {
+			return fmt.Errorf("mount %s:%s paths must be absolute", m.HostPath, m.ContainerPath)
+		}
+	}
+	for _, h := range e.Hooks {
+		if !hookNames[h.HookName] {
+			return fmt.Errorf("invalid hook name %q", h.HookName)
+		}
+		if !filepath.IsAbs(h.Path) {
+			return fmt.Errorf("hook path %q is not absolute", h.Path)
+		}
+	}
+	return nil
+}
+
+func (s *Spec) validate() error {
+	if s.Version == "" {
+		return fmt.Errorf("cdiVersion is missing")
+	}
+	if !kindRegexp.MatchString(s.Kind) {
+		return fmt.Errorf("invalid kind %q, the format is vendor.com/class", s.Kind)
+	}
+	if len(s.Devices) == 0 {
+		return fmt.Errorf("no device defined")
+	}
+	if err := s.ContainerEdits.validate(); err != nil {
+		return err
+	}
+	for _, d := range s.Devices {
+		if !nameRegexp.MatchString(d.Name) {
+			return fmt.Errorf("invalid device name %q", d.Name)
+		}
+		if err := d.ContainerEdits.validate(); err != nil {
+			return fmt.Errorf("device %s: %s", d.Name, err)
+		}
+	}
+	return nil
+}
+
+// ReadSpec reads and validates the CDI spec file path. Files with a .json
+// extension are decoded as JSON, other files as YAML.
+func ReadSpec(path string) (*Spec, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	spec := new(Spec)
+	if filepath.Ext(path) == ".json" {
+		err = json.Unmarshal(data, spec)
+	} else {
+		err = yaml.UnmarshalStrict(data, spec)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("while decoding CDI spec %s: %s", path, err)
+	}
+	if err := spec.validate(); err != nil {
+		return nil, fmt.Errorf("invalid CDI spec %s: %s", path, err)
+	}
+	return spec, nil
+}
+
+// Registry holds the devices defined by the CDI spec files of a list of
+// directories.
+type Registry struct {
+	devices map[string]*registryDevice
+}
+
+type registryDevice struct {
+	spec   *Spec
+	device *Device
+	path   string
+}
+
+// Load reads the CDI spec files (*.json, *.yaml and *.yml) found in dirs,
+// nonexistent directories are ignored.
+func Load(dirs ...string) (*Registry, error) {
+	r := &Registry{
+		devices: make(map[string]*registryDevice),
+	}
+
+	for _, dir := range dirs {
+		var paths []string
+		for _, ext := range []string{".json", ".yaml", ".yml"} {
+			matches, err := filepath.Glob(filepath.Join(dir, "*"+ext))
+			if err != nil {
+				return nil, err
+			}
+			paths = append(paths, matches...)
+		}
+		sort.Strings(paths)
+
+		// devices of a directory can't be defined twice
+		defined := make(map[string]string)
+
+		for _, path := range paths {
+			spec, err := ReadSpec(path)
+			if err != nil {
+				return nil, err
+			}
+			for i := range spec.Devices {
+				name := spec.Kind + "=" + spec.Devices[i].Name
+				if other, ok := defined[name]; ok {
+					return nil, fmt.Errorf("device %s defined in both %s and %s", name, other, path)
+				}
+				defined[name] = path
+				r.devices[name] = &registryDevice{
+					spec:   spec,
+					device: &spec.Devices[i],
+					path:   path,
+				}
+			}
+		}
+	}
+
+	return r, nil
+}
+
+// Devices returns the sorted fully-qualified names of the devices of the
+// registry.
+func (r *Registry) Devices() []string {
+	names := make([]string, 0, len(r.devices))
+	for name := range r.devices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolve returns the container edits of the devices, the edits of the spec
+// of a device are applied before the edits of the device.
+func (r *Registry) Resolve(devices []string) (*ContainerEdits, error) {
+	edits := new(ContainerEdits)
+	specs := make(map[*Spec]bool)
+	resolved := make(map[string]bool)
+
+	for _, device := range devices {
+		if _, _, err := ParseQualifiedName(device); err != nil {
+			return nil, err
+		}
+		d, ok := r.devices[device]
+		if !ok {
+			return nil, fmt.Errorf("unknown CDI device %s", device)
+		}
+		if resolved[device] {
+			continue
+		}
+		resolved[device] = true
+
+		if !specs[d.spec] {
+			specs[d.spec] = true
+			edits.append(&d.spec.ContainerEdits)
+		}
+		edits.append(&d.device.ContainerEdits)
+	}
+
+	return edits, nil
+}
+
+// CheckHooksOwner returns an error if one of the devices defines hooks in a
+// spec file which is not owned by uid, or which can be modified by other
+// users. Hooks are run by the runtime with its privileges, so only hooks
+// installed by an administrator can be trusted for unprivileged users.
+func (r *Registry) CheckHooksOwner(devices []string, uid uint32) error {
+	for _, device := range devices {
+		d, ok := r.devices[device]
+		if !ok {
+			return fmt.Errorf("unknown CDI device %s", device)
+		}
+		if len(d.spec.ContainerEdits.Hooks) == 0 && len(d.device.ContainerEdits.Hooks) == 0 {
+			continue
+		}
+		for _, path := range []string{d.path, filepath.Dir(d.path)} {
+			fi, err := os.Stat(path)
+			if err != nil {
+				return fmt.Errorf("while checking CDI device %s hooks: %s", device, err)
+			}
+			st, ok := fi.Sys().(*syscall.Stat_t)
+			if !ok || st.Uid != uid || fi.Mode().Perm()&0o022 != 0 {
+				return fmt.Errorf("CDI device %s defines hooks in %s, which is not owned by uid %d or is writable by other users", device, path, uid)
+			}
+		}
+	}
+	return nil
+}
+
+func (e *ContainerEdits) append(o *ContainerEdits) {
+	e.Env = append(e.Env, o.Env...)
+	e.DeviceNodes = append(e.DeviceNodes, o.DeviceNodes...)
+	e.Hooks = append(e.Hooks, o.Hooks...)
+	e.Mounts = append(e.Mounts, o.Mounts...)
+}
+
+// HooksByName returns the hooks run at the lifecycle step name.
+func (e *ContainerEdits) HooksByName(name string) []*Hook {
+	var hooks []*Hook
+	for _, h := range e.Hooks {
+		if h.HookName == name {
+			hooks = append(hooks, h)
+		}
+	}
+	return hooks
+}
+
+// CheckHooks returns an error if the edits define hooks for a lifecycle step
+// which is not in names.
+func (e *ContainerEdits) CheckHooks(names ...string) error {
+	for _, h := range e.Hooks {
+		supported := false
+		for _, name := range names {
+			supported = supported || h.HookName == name
+		}
+		if !supported {
+			return fmt.Errorf("CDI %s hook %s is not supported by this runtime", h.HookName, h.Path)
+		}
+	}
+	return nil
+}
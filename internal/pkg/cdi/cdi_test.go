@@ -0,0 +1,292 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cdi
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+const jsonSpec = `{
+	"cdiVersion": "0.3.0",
+	"kind": "vendor.com/fpga",
+	"containerEdits": {
+		"env": ["FPGA_RUNTIME=1"]
+	},
+	"devices": [
+		{
+			"name": "card0",
+			"containerEdits": {
+				"env": ["FPGA_CARD=0"],
+				"deviceNodes": [
+					{"path": "/dev/fpga0", "hostPath": "/dev/null"}
+				],
+				"mounts": [
+					{"hostPath": "/usr/lib/fpga", "containerPath": "/usr/lib/fpga", "options": ["ro"]}
+				],
+				"hooks": [
+					{"hookName": "createContainer", "path": "/usr/bin/fpga-hook", "args": ["fpga-hook", "card0"]}
+				]
+			}
+		},
+		{
+			"name": "card1",
+			"containerEdits": {
+				"env": ["FPGA_CARD=1"],
+				"deviceNodes": [
+					{"path": "/dev/fpga1", "type": "c", "major": 240, "minor": 1}
+				]
+			}
+		}
+	]
+}
+`
+
+const yamlSpec = `cdiVersion: 0.3.0
+kind: example.org/net
+devices:
+- name: ib0
+  containerEdits:
+    env:
+    - IB_DEVICE=ib0
+    deviceNodes:
+    - path: /dev/zero
+`
+
+// writeSpecs writes the spec files of files, indexed by name, in a new
+// directory of dir.
+func writeSpecs(t *testing.T, dir string, files map[string]string) string {
+	specDir, err := ioutil.TempDir(dir, "cdi-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(specDir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return specDir
+}
+
+func TestParseQualifiedName(t *testing.T) {
+	tests := []struct {
+		device      string
+		expectKind  string
+		expectName  string
+		expectError bool
+	}{
+		{device: "vendor.com/fpga=card0", expectKind: "vendor.com/fpga", expectName: "card0"},
+		{device: "vendor.com/gpu=all", expectKind: "vendor.com/gpu", expectName: "all"},
+		{device: "vendor/fpga=card0", expectError: true},
+		{device: "vendor.com/fpga", expectError: true},
+		{device: "vendor.com/fpga=", expectError: true},
+		{device: "card0", expectError: true},
+	}
+
+	for _, tt := range tests {
+		kind, name, err := ParseQualifiedName(tt.device)
+		if tt.expectError {
+			if err == nil {
+				t.Errorf("%s: unexpected success", tt.device)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.device, err)
+			continue
+		}
+		if kind != tt.expectKind || name != tt.expectName {
+			t.Errorf("%s: got %s %s, expected %s %s", tt.device, kind, name, tt.expectKind, tt.expectName)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cdi-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	etcDir := writeSpecs(t, dir, map[string]string{
+		"fpga.json": jsonSpec,
+		"net.yaml":  yamlSpec,
+		"README":    "not a spec",
+	})
+
+	r, err := Load(etcDir, filepath.Join(dir, "nonexistent"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expectDevices := []string{"example.org/net=ib0", "vendor.com/fpga=card0", "vendor.com/fpga=card1"}
+	if devices := r.Devices(); !reflect.DeepEqual(devices, expectDevices) {
+		t.Errorf("unexpected devices %v, expected %v", devices, expectDevices)
+	}
+
+	// devices of a later directory override devices of an earlier one
+	runDir := writeSpecs(t, dir, map[string]string{
+		"net.yml": yamlSpec + "    - path: /dev/null\n",
+	})
+	r, err = Load(etcDir, runDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	edits, err := r.Resolve([]string{"example.org/net=ib0"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(edits.DeviceNodes) != 2 {
+		t.Errorf("device of the later directory not used: %d device nodes", len(edits.DeviceNodes))
+	}
+
+	errorTests := []struct {
+		name  string
+		files map[string]string
+	}{
+		{
+			name:  "Duplicate",
+			files: map[string]string{"a.yaml": yamlSpec, "b.yaml": yamlSpec},
+		},
+		{
+			name:  "InvalidKind",
+			files: map[string]string{"a.yaml": "cdiVersion: 0.3.0\nkind: net\ndevices:\n- name: ib0\n"},
+		},
+		{
+			name:  "RelativeNode",
+			files: map[string]string{"a.yaml": "cdiVersion: 0.3.0\nkind: a.org/net\ndevices:\n- name: ib0\n  containerEdits:\n    deviceNodes:\n    - path: dev/ib0\n"},
+		},
+		{
+			name:  "InvalidHook",
+			files: map[string]string{"a.yaml": "cdiVersion: 0.3.0\nkind: a.org/net\ndevices:\n- name: ib0\n  containerEdits:\n    hooks:\n    - hookName: start\n      path: /bin/true\n"},
+		},
+		{
+			name:  "UnknownField",
+			files: map[string]string{"a.yaml": yamlSpec + "unknown: 1\n"},
+		},
+	}
+	for _, tt := range errorTests {
+		if _, err := Load(writeSpecs(t, dir, tt.files)); err == nil {
+			t.Errorf("%s: unexpected success", tt.name)
+		}
+	}
+}
+
+func TestResolveApply(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cdi-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := Load(writeSpecs(t, dir, map[string]string{"fpga.json": jsonSpec}))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := r.Resolve([]string{"vendor.com/fpga=card2"}); err == nil {
+		t.Errorf("unexpected success with an unknown device")
+	}
+	if _, err := r.Resolve([]string{"card0"}); err == nil {
+		t.Errorf("unexpected success with an invalid device name")
+	}
+
+	edits, err := r.Resolve([]string{"vendor.com/fpga=card0", "vendor.com/fpga=card1", "vendor.com/fpga=card0"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// spec edits are applied once before the device edits
+	expectEnv := []string{"FPGA_RUNTIME=1", "FPGA_CARD=0", "FPGA_CARD=1"}
+	if !reflect.DeepEqual(edits.Env, expectEnv) {
+		t.Errorf("unexpected environment %v, expected %v", edits.Env, expectEnv)
+	}
+	if hooks := edits.HooksByName(CreateContainerHook); len(hooks) != 1 {
+		t.Errorf("unexpected %d createContainer hooks", len(hooks))
+	}
+
+	spec := &specs.Spec{
+		Process: &specs.Process{Env: []string{"PATH=/bin", "FPGA_CARD=none"}},
+	}
+	if err := edits.Apply(spec); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expectEnv = []string{"PATH=/bin", "FPGA_CARD=1", "FPGA_RUNTIME=1"}
+	if !reflect.DeepEqual(spec.Process.Env, expectEnv) {
+		t.Errorf("unexpected process environment %v, expected %v", spec.Process.Env, expectEnv)
+	}
+
+	if len(spec.Linux.Devices) != 2 {
+		t.Fatalf("unexpected %d devices", len(spec.Linux.Devices))
+	}
+	// /dev/null is the character device 1:3
+	if d := spec.Linux.Devices[0]; d.Path != "/dev/fpga0" || d.Type != "c" || d.Major != 1 || d.Minor != 3 || d.FileMode == nil {
+		t.Errorf("unexpected device %+v", d)
+	}
+	if d := spec.Linux.Devices[1]; d.Path != "/dev/fpga1" || d.Type != "c" || d.Major != 240 || d.Minor != 1 {
+		t.Errorf("unexpected device %+v", d)
+	}
+	if len(spec.Linux.Resources.Devices) != 2 || spec.Linux.Resources.Devices[0].Access != "rwm" {
+		t.Errorf("unexpected device cgroup rules %+v", spec.Linux.Resources.Devices)
+	}
+
+	expectMounts := []specs.Mount{
+		{Source: "/usr/lib/fpga", Destination: "/usr/lib/fpga", Type: "bind", Options: []string{"rbind", "ro"}},
+	}
+	if !reflect.DeepEqual(spec.Mounts, expectMounts) {
+		t.Errorf("unexpected mounts %+v, expected %+v", spec.Mounts, expectMounts)
+	}
+
+	if spec.Hooks == nil || len(spec.Hooks.CreateContainer) != 1 || spec.Hooks.CreateContainer[0].Path != "/usr/bin/fpga-hook" {
+		t.Errorf("unexpected hooks %+v", spec.Hooks)
+	}
+}
+
+func TestCheckHooks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cdi-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	specDir := writeSpecs(t, dir, map[string]string{"fpga.json": jsonSpec})
+	r, err := Load(specDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	uid := uint32(os.Getuid())
+	if err := r.CheckHooksOwner([]string{"vendor.com/fpga=card0"}, uid); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := r.CheckHooksOwner([]string{"vendor.com/fpga=card0"}, uid+1); err == nil {
+		t.Errorf("unexpected success with hooks owned by another user")
+	}
+	// card1 doesn't define hooks
+	if err := r.CheckHooksOwner([]string{"vendor.com/fpga=card1"}, uid+1); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := os.Chmod(filepath.Join(specDir, "fpga.json"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.CheckHooksOwner([]string{"vendor.com/fpga=card0"}, uid); err == nil {
+		t.Errorf("unexpected success with hooks writable by other users")
+	}
+
+	edits, err := r.Resolve([]string{"vendor.com/fpga=card0"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := edits.CheckHooks(CreateContainerHook); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := edits.CheckHooks(PrestartHook, PoststopHook); err == nil {
+		t.Errorf("unexpected success with an unsupported createContainer hook")
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cdi
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+// FillFromHost sets the type, major and minor numbers and file mode of the
+// device node which are not set in the spec from the host device node.
+func (d *DeviceNode) FillFromHost() error {
+	path := d.HostNodePath()
+
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		// the device node is created from its spec by the runtime
+		if os.IsNotExist(err) && d.Type != "" && (d.Type == "p" || d.Major != 0 || d.Minor != 0) {
+			return nil
+		}
+		return fmt.Errorf("while getting device node %s information: %s", path, err)
+	}
+
+	var devType string
+	switch st.Mode & unix.S_IFMT {
+	case unix.S_IFCHR:
+		devType = "c"
+	case unix.S_IFBLK:
+		devType = "b"
+	case unix.S_IFIFO:
+		devType = "p"
+	default:
+		return fmt.Errorf("%s is not a device node", path)
+	}
+
+	if d.Type == "" {
+		d.Type = devType
+	}
+	if d.Type != "p" && d.Major == 0 && d.Minor == 0 {
+		// cast to uint64 as st.Rdev is uint32 on MIPS
+		d.Major = int64(unix.Major(uint64(st.Rdev)))
+		d.Minor = int64(unix.Minor(uint64(st.Rdev)))
+	}
+	if d.FileMode == nil {
+		mode := os.FileMode(st.Mode & 0o777)
+		d.FileMode = &mode
+	}
+	return nil
+}
+
+// ApplyEnv returns env with the environment variables of the edits added,
+// replacing the variables of the same name.
+func (e *ContainerEdits) ApplyEnv(env []string) []string {
+	for _, v := range e.Env {
+		key := strings.SplitN(v, "=", 2)[0] + "="
+		found := false
+		for i := range env {
+			if strings.HasPrefix(env[i], key) {
+				env[i] = v
+				found = true
+				break
+			}
+		}
+		if !found {
+			env = append(env, v)
+		}
+	}
+	return env
+}
+
+// Apply applies the container edits to the OCI runtime spec: environment
+// variables are added to the process, device nodes are created and allowed
+// by the device cgroup, host paths are bind mounted and hooks are added to
+// their lifecycle step.
+func (e *ContainerEdits) Apply(spec *specs.Spec) error {
+	if spec.Process == nil {
+		spec.Process = &specs.Process{}
+	}
+	spec.Process.Env = e.ApplyEnv(spec.Process.Env)
+
+	if len(e.DeviceNodes) > 0 {
+		if spec.Linux == nil {
+			spec.Linux = &specs.Linux{}
+		}
+		if spec.Linux.Resources == nil {
+			spec.Linux.Resources = &specs.LinuxResources{}
+		}
+	}
+
+	for _, d := range e.DeviceNodes {
+		if err := d.FillFromHost(); err != nil {
+			return err
+		}
+
+		dev := specs.LinuxDevice{
+			Path:     d.Path,
+			Type:     d.Type,
+			Major:    d.Major,
+			Minor:    d.Minor,
+			FileMode: d.FileMode,
+			UID:      d.UID,
+			GID:      d.GID,
+		}
+		replaced := false
+		for i := range spec.Linux.Devices {
+			if spec.Linux.Devices[i].Path == d.Path {
+				spec.Linux.Devices[i] = dev
+				replaced = true
+			}
+		}
+		if !replaced {
+			spec.Linux.Devices = append(spec.Linux.Devices, dev)
+		}
+
+		if d.Type == "p" {
+			continue
+		}
+		access := d.Permissions
+		if access == "" {
+			access = "rwm"
+		}
+		major, minor := d.Major, d.Minor
+		spec.Linux.Resources.Devices = append(spec.Linux.Resources.Devices, specs.LinuxDeviceCgroup{
+			Allow:  true,
+			Type:   d.Type,
+			Major:  &major,
+			Minor:  &minor,
+			Access: access,
+		})
+	}
+
+	for _, m := range e.Mounts {
+		mnt := specs.Mount{
+			Source:      m.HostPath,
+			Destination: m.ContainerPath,
+			Type:        m.Type,
+			Options:     m.Options,
+		}
+		if mnt.Type == "" {
+			mnt.Type = "bind"
+		}
+		if mnt.Type == "bind" {
+			bind := false
+			for _, o := range mnt.Options {
+				bind = bind || o == "bind" || o == "rbind"
+			}
+			if !bind {
+				mnt.Options = append([]string{"rbind"}, mnt.Options...)
+			}
+		}
+		spec.Mounts = append(spec.Mounts, mnt)
+	}
+
+	if len(e.Hooks) > 0 && spec.Hooks == nil {
+		spec.Hooks = &specs.Hooks{}
+	}
+	for _, h := range e.Hooks {
+		hook := h.ToOCI()
+		switch h.HookName {
+		case PrestartHook:
+			spec.Hooks.Prestart = append(spec.Hooks.Prestart, hook)
+		case CreateRuntimeHook:
+			spec.Hooks.CreateRuntime = append(spec.Hooks.CreateRuntime, hook)
+		case CreateContainerHook:
+			spec.Hooks.CreateContainer = append(spec.Hooks.CreateContainer, hook)
+		case StartContainerHook:
+			spec.Hooks.StartContainer = append(spec.Hooks.StartContainer, hook)
+		case PoststartHook:
+			spec.Hooks.Poststart = append(spec.Hooks.Poststart, hook)
+		case PoststopHook:
+			spec.Hooks.Poststop = append(spec.Hooks.Poststop, hook)
+		}
+	}
+
+	return nil
+}
+
+// ToOCI returns the OCI runtime spec hook of the hook.
+func (h *Hook) ToOCI() specs.Hook {
+	return specs.Hook{
+		Path:    h.Path,
+		Args:    h.Args,
+		Env:     h.Env,
+		Timeout: h.Timeout,
+	}
+}
@@ -46,6 +46,8 @@ type Manager interface {
 	Pause() error
 	// Resume unfreezes process in the managed cgroup.
 	Resume() error
+	// Stats returns the resource usage of the managed cgroup.
+	Stats() (*Stats, error)
 }
 
 // NewManagerFromFile creates a Manager, applies the configuration at specPath, and adds pid to the cgroup.
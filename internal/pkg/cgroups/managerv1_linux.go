@@ -163,3 +163,17 @@ func (m *ManagerV1) Resume() error {
 	}
 	return m.cgroup.Thaw()
 }
+
+// Stats returns the resource usage of the managed cgroup.
+func (m *ManagerV1) Stats() (*Stats, error) {
+	if m.cgroup == nil {
+		if err := m.load(); err != nil {
+			return nil, err
+		}
+	}
+	metrics, err := m.cgroup.Stat(cgroups.IgnoreNotExist)
+	if err != nil {
+		return nil, err
+	}
+	return statsFromV1(metrics), nil
+}
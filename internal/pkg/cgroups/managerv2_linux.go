@@ -88,6 +88,7 @@ func (m *ManagerV2) ApplyFromSpec(spec *specs.LinuxResources) (err error) {
 	// Resources struct, as ToResources(s) doesn't do this. They will then be
 	// converted to ebpf programs and attached when the cgroup is created.
 	res.Devices = v2FixDevices(s.Devices)
+	v2FixSwap(res.Memory, s.Memory)
 
 	// creates cgroup
 	m.cgroup, err = cgroupsv2.NewManager(mountPoint, m.group, res)
@@ -136,6 +137,7 @@ func (m *ManagerV2) UpdateFromSpec(spec *specs.LinuxResources) (err error) {
 	// v1 device restrictions have to manually be brought across into the v2 Resources struct,
 	// as ToResources doesn't do this. They will then be converted to ebpf programs and attached.
 	res.Devices = v2FixDevices(s.Devices)
+	v2FixSwap(res.Memory, s.Memory)
 
 	// updates existing cgroup
 	m.cgroup, err = cgroupsv2.NewManager(mountPoint, m.group, res)
@@ -191,6 +193,20 @@ func (m *ManagerV2) Resume() (err error) {
 	return m.cgroup.Thaw()
 }
 
+// Stats returns the resource usage of the managed cgroup.
+func (m *ManagerV2) Stats() (*Stats, error) {
+	if m.cgroup == nil {
+		if err := m.load(); err != nil {
+			return nil, err
+		}
+	}
+	metrics, err := m.cgroup.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return statsFromV2(metrics), nil
+}
+
 // v2FixDevices modifies device entries to use an explicit, rather than implied
 // wildcard.
 //
@@ -215,3 +231,23 @@ func v2FixDevices(devs []specs.LinuxDeviceCgroup) []specs.LinuxDeviceCgroup {
 	}
 	return devs
 }
+
+// v2FixSwap converts the swap limit of mem to its cgroups v2 value.
+//
+// The OCI spec (and cgroups v1) swap limit is the limit of memory + swap
+// usage, while cgroups v2 limits swap usage only. ToResources copies the
+// value as is, so the memory limit has to be subtracted.
+func v2FixSwap(res *cgroupsv2.Memory, mem *specs.LinuxMemory) {
+	if res == nil || mem == nil || mem.Swap == nil || mem.Limit == nil {
+		return
+	}
+	// -1 is unlimited
+	if *mem.Swap < 0 || *mem.Limit < 0 {
+		return
+	}
+	swap := int64(0)
+	if *mem.Swap > *mem.Limit {
+		swap = *mem.Swap - *mem.Limit
+	}
+	res.Swap = &swap
+}
@@ -0,0 +1,242 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cgroups
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/containerd/cgroups"
+	"github.com/hpcng/singularity/internal/pkg/util/fs"
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// cpuPeriod is the CFS period, in microseconds, used to enforce a CPU limit.
+const cpuPeriod = 100000
+
+// ResourceLimits holds resource limits as set from the command line.
+// Zero values mean that the corresponding resource is not limited.
+type ResourceLimits struct {
+	// CPUs is the number of CPUs available, it may be fractional (e.g. 1.5).
+	CPUs string
+	// CPUShares is the CPU weight relative to other cgroups.
+	CPUShares int
+	// CPUSetCPUs is the list of CPUs processes can run on (e.g. 0-3,6).
+	CPUSetCPUs string
+	// Memory is the memory limit (e.g. 512M).
+	Memory string
+	// MemoryReservation is the memory soft limit.
+	MemoryReservation string
+	// MemorySwap is the memory plus swap limit, -1 allows unlimited swap.
+	MemorySwap string
+	// PidsLimit is the maximum number of processes.
+	PidsLimit int
+	// BlkioWeight is the block I/O weight, between 10 and 1000.
+	BlkioWeight int
+}
+
+// IsSet returns whether a limit is set.
+func (l ResourceLimits) IsSet() bool {
+	return l != ResourceLimits{}
+}
+
+// Resources returns the OCI LinuxResources spec corresponding to the limits,
+// suitable for NewManagerFromSpec with both cgroups v1 and v2. It returns nil
+// if no limit is set.
+func (l ResourceLimits) Resources() (*specs.LinuxResources, error) {
+	if !l.IsSet() {
+		return nil, nil
+	}
+
+	r := new(specs.LinuxResources)
+
+	if l.CPUs != "" || l.CPUShares != 0 || l.CPUSetCPUs != "" {
+		r.CPU = new(specs.LinuxCPU)
+	}
+	if l.CPUs != "" {
+		cpus, err := strconv.ParseFloat(l.CPUs, 64)
+		if err != nil || cpus <= 0 {
+			return nil, fmt.Errorf("invalid number of CPUs %q: must be a positive number", l.CPUs)
+		}
+		period := uint64(cpuPeriod)
+		quota := int64(cpus * cpuPeriod)
+		r.CPU.Period = &period
+		r.CPU.Quota = &quota
+	}
+	if l.CPUShares != 0 {
+		if l.CPUShares < 2 || l.CPUShares > 262144 {
+			return nil, fmt.Errorf("invalid CPU shares %d: must be between 2 and 262144", l.CPUShares)
+		}
+		shares := uint64(l.CPUShares)
+		r.CPU.Shares = &shares
+	}
+	if l.CPUSetCPUs != "" {
+		r.CPU.Cpus = l.CPUSetCPUs
+	}
+
+	if l.Memory != "" || l.MemoryReservation != "" || l.MemorySwap != "" {
+		r.Memory = new(specs.LinuxMemory)
+	}
+	if l.Memory != "" {
+		memory, err := parseMemory(l.Memory)
+		if err != nil {
+			return nil, err
+		}
+		r.Memory.Limit = &memory
+	}
+	if l.MemoryReservation != "" {
+		reservation, err := parseMemory(l.MemoryReservation)
+		if err != nil {
+			return nil, err
+		}
+		if r.Memory.Limit != nil && reservation > *r.Memory.Limit {
+			return nil, fmt.Errorf("memory reservation %s is greater than memory limit %s", l.MemoryReservation, l.Memory)
+		}
+		r.Memory.Reservation = &reservation
+	}
+	if l.MemorySwap != "" {
+		if r.Memory.Limit == nil {
+			return nil, fmt.Errorf("a memory limit is required to limit memory and swap usage")
+		}
+		swap := int64(-1)
+		if l.MemorySwap != "-1" {
+			var err error
+			swap, err = parseMemory(l.MemorySwap)
+			if err != nil {
+				return nil, err
+			}
+			if swap < *r.Memory.Limit {
+				return nil, fmt.Errorf("memory and swap limit %s is lower than memory limit %s", l.MemorySwap, l.Memory)
+			}
+		}
+		r.Memory.Swap = &swap
+	}
+
+	if l.PidsLimit != 0 {
+		if l.PidsLimit < 0 {
+			return nil, fmt.Errorf("invalid PIDs limit %d: must be a positive number", l.PidsLimit)
+		}
+		r.Pids = &specs.LinuxPids{Limit: int64(l.PidsLimit)}
+	}
+
+	if l.BlkioWeight != 0 {
+		if l.BlkioWeight < 10 || l.BlkioWeight > 1000 {
+			return nil, fmt.Errorf("invalid block I/O weight %d: must be between 10 and 1000", l.BlkioWeight)
+		}
+		weight := uint16(l.BlkioWeight)
+		r.BlockIO = &specs.LinuxBlockIO{Weight: &weight}
+	}
+
+	return r, nil
+}
+
+func parseMemory(s string) (int64, error) {
+	size, err := fs.ParseSize(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid memory size: %v", err)
+	}
+	if size <= 0 {
+		return 0, fmt.Errorf("invalid memory size %q: must be positive", s)
+	}
+	return size, nil
+}
+
+// requiredControllers returns the cgroup controllers needed to enforce the
+// limits of spec, for the cgroups version in use.
+func requiredControllers(spec *specs.LinuxResources, unified bool) []string {
+	var controllers []string
+
+	if c := spec.CPU; c != nil {
+		if c.Shares != nil || c.Quota != nil || c.Period != nil {
+			controllers = append(controllers, "cpu")
+		}
+		if c.Cpus != "" || c.Mems != "" {
+			controllers = append(controllers, "cpuset")
+		}
+	}
+	if spec.Memory != nil {
+		controllers = append(controllers, "memory")
+	}
+	if spec.Pids != nil {
+		controllers = append(controllers, "pids")
+	}
+	if spec.BlockIO != nil {
+		if unified {
+			controllers = append(controllers, "io")
+		} else {
+			controllers = append(controllers, "blkio")
+		}
+	}
+
+	return controllers
+}
+
+// availableControllers returns the cgroup controllers enabled on the host.
+func availableControllers(unified bool) (map[string]bool, error) {
+	controllers := make(map[string]bool)
+
+	if unified {
+		b, err := ioutil.ReadFile(filepath.Join(mountPoint, "cgroup.controllers"))
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range strings.Fields(string(b)) {
+			controllers[c] = true
+		}
+		return controllers, nil
+	}
+
+	// cgroups v1 hierarchies are listed as <id>:<controllers>:<path>
+	f, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 || fields[0] == "0" {
+			continue
+		}
+		for _, c := range strings.Split(fields[1], ",") {
+			controllers[c] = true
+		}
+	}
+	return controllers, scanner.Err()
+}
+
+// CheckResources returns an error if the limits of spec can't be enforced
+// because cgroups or a required cgroup controller are not available.
+func CheckResources(spec *specs.LinuxResources) error {
+	if spec == nil {
+		return nil
+	}
+
+	mode := cgroups.Mode()
+	if mode == cgroups.Unavailable {
+		return fmt.Errorf("cgroups are not available on this system")
+	}
+	unified := mode == cgroups.Unified
+
+	available, err := availableControllers(unified)
+	if err != nil {
+		return fmt.Errorf("while getting available cgroup controllers: %v", err)
+	}
+
+	for _, c := range requiredControllers(spec, unified) {
+		if !available[c] {
+			return fmt.Errorf("the %s cgroup controller is not available", c)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cgroups
+
+import (
+	"reflect"
+	"testing"
+
+	cgroupsv2 "github.com/containerd/cgroups/v2"
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func uint64ptr(i uint64) *uint64 {
+	return &i
+}
+
+func uint16ptr(i uint16) *uint16 {
+	return &i
+}
+
+func TestResourceLimits(t *testing.T) {
+	tests := []struct {
+		name        string
+		limits      ResourceLimits
+		expected    *specs.LinuxResources
+		expectError bool
+	}{
+		{
+			name:     "None",
+			limits:   ResourceLimits{},
+			expected: nil,
+		},
+		{
+			name:   "CPU",
+			limits: ResourceLimits{CPUs: "1.5", CPUShares: 512, CPUSetCPUs: "0-3"},
+			expected: &specs.LinuxResources{
+				CPU: &specs.LinuxCPU{
+					Period: uint64ptr(100000),
+					Quota:  Int64ptr(150000),
+					Shares: uint64ptr(512),
+					Cpus:   "0-3",
+				},
+			},
+		},
+		{
+			name:   "Memory",
+			limits: ResourceLimits{Memory: "1G", MemoryReservation: "512M", MemorySwap: "2G"},
+			expected: &specs.LinuxResources{
+				Memory: &specs.LinuxMemory{
+					Limit:       Int64ptr(1 << 30),
+					Reservation: Int64ptr(512 << 20),
+					Swap:        Int64ptr(2 << 30),
+				},
+			},
+		},
+		{
+			name:   "UnlimitedSwap",
+			limits: ResourceLimits{Memory: "1G", MemorySwap: "-1"},
+			expected: &specs.LinuxResources{
+				Memory: &specs.LinuxMemory{
+					Limit: Int64ptr(1 << 30),
+					Swap:  Int64ptr(-1),
+				},
+			},
+		},
+		{
+			name:   "PidsBlkio",
+			limits: ResourceLimits{PidsLimit: 100, BlkioWeight: 500},
+			expected: &specs.LinuxResources{
+				Pids:    &specs.LinuxPids{Limit: 100},
+				BlockIO: &specs.LinuxBlockIO{Weight: uint16ptr(500)},
+			},
+		},
+		{
+			name:        "InvalidCPUs",
+			limits:      ResourceLimits{CPUs: "-1"},
+			expectError: true,
+		},
+		{
+			name:        "InvalidCPUShares",
+			limits:      ResourceLimits{CPUShares: 1},
+			expectError: true,
+		},
+		{
+			name:        "InvalidMemory",
+			limits:      ResourceLimits{Memory: "1X"},
+			expectError: true,
+		},
+		{
+			name:        "ReservationAboveLimit",
+			limits:      ResourceLimits{Memory: "512M", MemoryReservation: "1G"},
+			expectError: true,
+		},
+		{
+			name:        "SwapWithoutMemory",
+			limits:      ResourceLimits{MemorySwap: "1G"},
+			expectError: true,
+		},
+		{
+			name:        "SwapBelowMemory",
+			limits:      ResourceLimits{Memory: "1G", MemorySwap: "512M"},
+			expectError: true,
+		},
+		{
+			name:        "InvalidPidsLimit",
+			limits:      ResourceLimits{PidsLimit: -1},
+			expectError: true,
+		},
+		{
+			name:        "InvalidBlkioWeight",
+			limits:      ResourceLimits{BlkioWeight: 5000},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := tt.limits.Resources()
+			if tt.expectError {
+				if err == nil {
+					t.Fatalf("unexpected success")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(r, tt.expected) {
+				t.Errorf("unexpected resources: got %+v, expected %+v", r, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRequiredControllers(t *testing.T) {
+	spec := &specs.LinuxResources{
+		CPU:     &specs.LinuxCPU{Quota: Int64ptr(50000), Cpus: "0"},
+		Memory:  &specs.LinuxMemory{Limit: Int64ptr(1 << 30)},
+		Pids:    &specs.LinuxPids{Limit: 10},
+		BlockIO: &specs.LinuxBlockIO{Weight: uint16ptr(100)},
+	}
+
+	if c := requiredControllers(spec, false); !reflect.DeepEqual(c, []string{"cpu", "cpuset", "memory", "pids", "blkio"}) {
+		t.Errorf("unexpected cgroups v1 controllers: %v", c)
+	}
+	if c := requiredControllers(spec, true); !reflect.DeepEqual(c, []string{"cpu", "cpuset", "memory", "pids", "io"}) {
+		t.Errorf("unexpected cgroups v2 controllers: %v", c)
+	}
+}
+
+func TestV2FixSwap(t *testing.T) {
+	tests := []struct {
+		name     string
+		mem      *specs.LinuxMemory
+		expected *int64
+	}{
+		{
+			name:     "NoSwap",
+			mem:      &specs.LinuxMemory{Limit: Int64ptr(1 << 30)},
+			expected: nil,
+		},
+		{
+			name:     "Swap",
+			mem:      &specs.LinuxMemory{Limit: Int64ptr(1 << 30), Swap: Int64ptr(3 << 30)},
+			expected: Int64ptr(2 << 30),
+		},
+		{
+			name:     "NoExtraSwap",
+			mem:      &specs.LinuxMemory{Limit: Int64ptr(1 << 30), Swap: Int64ptr(1 << 30)},
+			expected: Int64ptr(0),
+		},
+		{
+			name:     "Unlimited",
+			mem:      &specs.LinuxMemory{Limit: Int64ptr(1 << 30), Swap: Int64ptr(-1)},
+			expected: Int64ptr(-1),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := cgroupsv2.ToResources(&specs.LinuxResources{Memory: tt.mem})
+			v2FixSwap(res.Memory, tt.mem)
+			if !reflect.DeepEqual(res.Memory.Swap, tt.expected) {
+				t.Errorf("unexpected swap limit: got %v, expected %v", res.Memory.Swap, tt.expected)
+			}
+		})
+	}
+}
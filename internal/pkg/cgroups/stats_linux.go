@@ -0,0 +1,166 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cgroups
+
+import (
+	"strings"
+
+	statsv1 "github.com/containerd/cgroups/stats/v1"
+	statsv2 "github.com/containerd/cgroups/v2/stats"
+)
+
+// unlimited is the threshold above which a cgroup limit is considered
+// unset, cgroups v1 reports unset memory limits as the largest page
+// aligned signed 64 bits value and cgroups v2 as the largest unsigned
+// 64 bits value.
+const unlimited = 1 << 62
+
+// Stats holds the resource usage of a cgroup. It is a common subset
+// of the cgroups v1 and v2 metrics.
+type Stats struct {
+	CPU    CPUStats    `json:"cpu"`
+	Memory MemoryStats `json:"memory"`
+	Pids   PidsStats   `json:"pids"`
+	BlkIO  BlkIOStats  `json:"blkio"`
+}
+
+// CPUStats holds the CPU time consumed by the processes of a cgroup,
+// in nanoseconds.
+type CPUStats struct {
+	Usage  uint64 `json:"usage"`
+	User   uint64 `json:"user"`
+	System uint64 `json:"system"`
+	// ThrottledTime is the total time processes were throttled because
+	// of a CPU quota.
+	ThrottledTime uint64 `json:"throttledTime"`
+}
+
+// MemoryStats holds the memory usage of a cgroup, in bytes.
+type MemoryStats struct {
+	// Usage is the memory in use, excluding the inactive page cache
+	// which can be reclaimed by the kernel.
+	Usage uint64 `json:"usage"`
+	// Limit is the memory limit of the cgroup, 0 means unlimited.
+	Limit uint64 `json:"limit"`
+	// Swap is the swap space in use.
+	Swap uint64 `json:"swap"`
+}
+
+// PidsStats holds the number of processes in a cgroup.
+type PidsStats struct {
+	Current uint64 `json:"current"`
+	// Limit is the maximum number of processes, 0 means unlimited.
+	Limit uint64 `json:"limit"`
+}
+
+// BlkIOStats holds the block I/O of a cgroup, summed across all devices.
+type BlkIOStats struct {
+	ReadBytes  uint64 `json:"readBytes"`
+	WriteBytes uint64 `json:"writeBytes"`
+	ReadOps    uint64 `json:"readOps"`
+	WriteOps   uint64 `json:"writeOps"`
+}
+
+func limit(l uint64) uint64 {
+	if l >= unlimited {
+		return 0
+	}
+	return l
+}
+
+func subOrZero(a, b uint64) uint64 {
+	if b > a {
+		return 0
+	}
+	return a - b
+}
+
+// statsFromV1 converts cgroups v1 metrics to Stats.
+func statsFromV1(m *statsv1.Metrics) *Stats {
+	s := new(Stats)
+
+	if m.CPU != nil {
+		if m.CPU.Usage != nil {
+			s.CPU.Usage = m.CPU.Usage.Total
+			s.CPU.User = m.CPU.Usage.User
+			s.CPU.System = m.CPU.Usage.Kernel
+		}
+		if m.CPU.Throttling != nil {
+			s.CPU.ThrottledTime = m.CPU.Throttling.ThrottledTime
+		}
+	}
+
+	if m.Memory != nil {
+		if m.Memory.Usage != nil {
+			s.Memory.Usage = subOrZero(m.Memory.Usage.Usage, m.Memory.TotalInactiveFile)
+			s.Memory.Limit = limit(m.Memory.Usage.Limit)
+		}
+		// memory.memsw accounts memory and swap together
+		if m.Memory.Swap != nil && m.Memory.Usage != nil {
+			s.Memory.Swap = subOrZero(m.Memory.Swap.Usage, m.Memory.Usage.Usage)
+		}
+	}
+
+	if m.Pids != nil {
+		s.Pids.Current = m.Pids.Current
+		s.Pids.Limit = limit(m.Pids.Limit)
+	}
+
+	if m.Blkio != nil {
+		for _, e := range m.Blkio.IoServiceBytesRecursive {
+			switch strings.ToLower(e.Op) {
+			case "read":
+				s.BlkIO.ReadBytes += e.Value
+			case "write":
+				s.BlkIO.WriteBytes += e.Value
+			}
+		}
+		for _, e := range m.Blkio.IoServicedRecursive {
+			switch strings.ToLower(e.Op) {
+			case "read":
+				s.BlkIO.ReadOps += e.Value
+			case "write":
+				s.BlkIO.WriteOps += e.Value
+			}
+		}
+	}
+
+	return s
+}
+
+// statsFromV2 converts cgroups v2 metrics to Stats.
+func statsFromV2(m *statsv2.Metrics) *Stats {
+	s := new(Stats)
+
+	if m.CPU != nil {
+		s.CPU.Usage = m.CPU.UsageUsec * 1000
+		s.CPU.User = m.CPU.UserUsec * 1000
+		s.CPU.System = m.CPU.SystemUsec * 1000
+		s.CPU.ThrottledTime = m.CPU.ThrottledUsec * 1000
+	}
+
+	if m.Memory != nil {
+		s.Memory.Usage = subOrZero(m.Memory.Usage, m.Memory.InactiveFile)
+		s.Memory.Limit = limit(m.Memory.UsageLimit)
+		s.Memory.Swap = m.Memory.SwapUsage
+	}
+
+	if m.Pids != nil {
+		s.Pids.Current = m.Pids.Current
+		s.Pids.Limit = limit(m.Pids.Limit)
+	}
+
+	if m.Io != nil {
+		for _, e := range m.Io.Usage {
+			s.BlkIO.ReadBytes += e.Rbytes
+			s.BlkIO.WriteBytes += e.Wbytes
+			s.BlkIO.ReadOps += e.Rios
+			s.BlkIO.WriteOps += e.Wios
+		}
+	}
+
+	return s
+}
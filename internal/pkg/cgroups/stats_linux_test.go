@@ -0,0 +1,96 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cgroups
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	statsv1 "github.com/containerd/cgroups/stats/v1"
+	statsv2 "github.com/containerd/cgroups/v2/stats"
+)
+
+func TestStatsFromV1(t *testing.T) {
+	metrics := &statsv1.Metrics{
+		CPU: &statsv1.CPUStat{
+			Usage: &statsv1.CPUUsage{
+				Total:  3000,
+				User:   2000,
+				Kernel: 1000,
+			},
+			Throttling: &statsv1.Throttle{ThrottledTime: 10},
+		},
+		Memory: &statsv1.MemoryStat{
+			TotalInactiveFile: 1024,
+			Usage:             &statsv1.MemoryEntry{Usage: 4096, Limit: 0x7FFFFFFFFFFFF000},
+			Swap:              &statsv1.MemoryEntry{Usage: 5120},
+		},
+		Pids: &statsv1.PidsStat{Current: 3, Limit: 16},
+		Blkio: &statsv1.BlkIOStat{
+			IoServiceBytesRecursive: []*statsv1.BlkIOEntry{
+				{Op: "Read", Value: 100},
+				{Op: "Write", Value: 200},
+				{Op: "Total", Value: 300},
+				{Op: "Read", Value: 10},
+			},
+			IoServicedRecursive: []*statsv1.BlkIOEntry{
+				{Op: "Read", Value: 1},
+				{Op: "Write", Value: 2},
+			},
+		},
+	}
+
+	expected := &Stats{
+		CPU:    CPUStats{Usage: 3000, User: 2000, System: 1000, ThrottledTime: 10},
+		Memory: MemoryStats{Usage: 3072, Limit: 0, Swap: 1024},
+		Pids:   PidsStats{Current: 3, Limit: 16},
+		BlkIO:  BlkIOStats{ReadBytes: 110, WriteBytes: 200, ReadOps: 1, WriteOps: 2},
+	}
+
+	if s := statsFromV1(metrics); !reflect.DeepEqual(s, expected) {
+		t.Errorf("unexpected stats: got %+v, expected %+v", s, expected)
+	}
+
+	if s := statsFromV1(&statsv1.Metrics{}); !reflect.DeepEqual(s, &Stats{}) {
+		t.Errorf("unexpected stats for empty metrics: %+v", s)
+	}
+}
+
+func TestStatsFromV2(t *testing.T) {
+	metrics := &statsv2.Metrics{
+		CPU: &statsv2.CPUStat{
+			UsageUsec:     3,
+			UserUsec:      2,
+			SystemUsec:    1,
+			ThrottledUsec: 4,
+		},
+		Memory: &statsv2.MemoryStat{
+			Usage:        4096,
+			InactiveFile: 8192,
+			UsageLimit:   math.MaxUint64,
+			SwapUsage:    512,
+		},
+		Pids: &statsv2.PidsStat{Current: 3},
+		Io: &statsv2.IOStat{
+			Usage: []*statsv2.IOEntry{
+				{Rbytes: 100, Wbytes: 200, Rios: 1, Wios: 2},
+				{Rbytes: 10, Wbytes: 20, Rios: 3, Wios: 4},
+			},
+		},
+	}
+
+	expected := &Stats{
+		CPU:    CPUStats{Usage: 3000, User: 2000, System: 1000, ThrottledTime: 4000},
+		Memory: MemoryStats{Usage: 0, Limit: 0, Swap: 512},
+		Pids:   PidsStats{Current: 3},
+		BlkIO:  BlkIOStats{ReadBytes: 110, WriteBytes: 220, ReadOps: 4, WriteOps: 6},
+	}
+
+	if s := statsFromV2(metrics); !reflect.DeepEqual(s, expected) {
+		t.Errorf("unexpected stats: got %+v, expected %+v", s, expected)
+	}
+}
@@ -21,8 +21,9 @@ import (
 	useragent "github.com/hpcng/singularity/pkg/util/user-agent"
 )
 
-// pull will build a SIF image into the cache if directTo="", or a specific file if directTo is set.
-func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom, tmpDir string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS, noCleanUp bool) (imagePath string, err error) {
+// systemContext returns the containers/image system context used to
+// interact with registries.
+func systemContext(tmpDir string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS bool) *ocitypes.SystemContext {
 	// DockerInsecureSkipTLSVerify is set only if --no-https is specified to honor
 	// configuration from /etc/containers/registries.conf because DockerInsecureSkipTLSVerify
 	// can have three possible values true/false and undefined, so we left it as undefined instead
@@ -38,6 +39,12 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom, tmpDi
 	if noHTTPS {
 		sysCtx.DockerInsecureSkipTLSVerify = ocitypes.NewOptionalBool(true)
 	}
+	return sysCtx
+}
+
+// pull will build a SIF image into the cache if directTo="", or a specific file if directTo is set.
+func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom, tmpDir string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS, noCleanUp bool) (imagePath string, err error) {
+	sysCtx := systemContext(tmpDir, ociAuth, noHTTPS)
 
 	hash, err := oci.ImageSHA(ctx, pullFrom, sysCtx)
 	if err != nil {
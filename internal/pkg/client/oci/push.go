@@ -0,0 +1,58 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/containers/image/v5/copy"
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/signature"
+	ocitypes "github.com/containers/image/v5/types"
+	"github.com/hpcng/singularity/internal/pkg/ocisif"
+	"github.com/hpcng/singularity/pkg/sylog"
+)
+
+// Push converts the SIF or sandbox image sourceFile into an OCI image and
+// uploads it to the registry reference pushTo (e.g. docker://registry/repo:tag).
+func Push(ctx context.Context, sourceFile, pushTo, tmpDir string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS bool) error {
+	ref := strings.TrimPrefix(pushTo, "docker:")
+	if !strings.HasPrefix(ref, "//") {
+		return fmt.Errorf("not a valid docker reference: %s", pushTo)
+	}
+
+	destRef, err := docker.ParseReference(ref)
+	if err != nil {
+		return fmt.Errorf("invalid image destination: %v", err)
+	}
+
+	img, err := ocisif.Convert(sourceFile, tmpDir)
+	if err != nil {
+		return fmt.Errorf("while converting %s to an OCI image: %v", sourceFile, err)
+	}
+	defer img.Close()
+
+	policy := &signature.Policy{Default: []signature.PolicyRequirement{signature.NewPRInsecureAcceptAnything()}}
+	policyCtx, err := signature.NewPolicyContext(policy)
+	if err != nil {
+		return err
+	}
+	defer policyCtx.Destroy()
+
+	sylog.Infof("Pushing OCI image to %s", destRef.DockerReference())
+
+	_, err = copy.Image(ctx, policyCtx, destRef, img.Reference, &copy.Options{
+		ReportWriter:   sylog.Writer(),
+		DestinationCtx: systemContext(tmpDir, ociAuth, noHTTPS),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to push image: %v", err)
+	}
+
+	return nil
+}
@@ -8,6 +8,7 @@ package client
 import (
 	"context"
 	"io"
+	"os"
 
 	"github.com/hpcng/singularity/pkg/sylog"
 	"github.com/vbauerster/mpb/v6"
@@ -32,7 +33,9 @@ func ProgressBarCallback(ctx context.Context) ProgressCallback {
 	}
 
 	return func(totalSize int64, r io.Reader, w io.Writer) error {
-		p := mpb.New()
+		// write to stderr like the log messages, stdout may carry the
+		// output of a command, e.g. build events
+		p := mpb.New(mpb.WithOutput(os.Stderr))
 		var bar *mpb.Bar
 		if totalSize > 0 {
 			bar = p.AddBar(totalSize,
@@ -0,0 +1,188 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package squashfs
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// Compression identifiers of the squashfs super block.
+const (
+	compGzip = 1
+	compLzma = 2
+	compLzo  = 3
+	compXz   = 4
+	compLz4  = 5
+	compZstd = 6
+)
+
+// compNames are the names of the compression algorithms, as used by
+// mksquashfs.
+var compNames = map[uint16]string{
+	compGzip: "gzip",
+	compLzma: "lzma",
+	compLzo:  "lzo",
+	compXz:   "xz",
+	compLz4:  "lz4",
+	compZstd: "zstd",
+}
+
+// decompressor decompresses a block src, whose uncompressed size is at
+// most max bytes.
+type decompressor func(src []byte, max int) ([]byte, error)
+
+// newDecompressor returns the decompressor of the compression comp.
+func newDecompressor(comp uint16) (decompressor, error) {
+	switch comp {
+	case compGzip:
+		return func(src []byte, max int) ([]byte, error) {
+			r, err := zlib.NewReader(bytes.NewReader(src))
+			if err != nil {
+				return nil, err
+			}
+			defer r.Close()
+			return readMax(r, max)
+		}, nil
+	case compLzma:
+		return func(src []byte, max int) ([]byte, error) {
+			r, err := lzma.NewReader(bytes.NewReader(src))
+			if err != nil {
+				return nil, err
+			}
+			return readMax(r, max)
+		}, nil
+	case compXz:
+		return func(src []byte, max int) ([]byte, error) {
+			r, err := xz.NewReader(bytes.NewReader(src))
+			if err != nil {
+				return nil, err
+			}
+			return readMax(r, max)
+		}, nil
+	case compLz4:
+		return lz4Decompress, nil
+	case compZstd:
+		// DecodeAll is safe for concurrent use
+		d, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return func(src []byte, max int) ([]byte, error) {
+			dst, err := d.DecodeAll(src, make([]byte, 0, max))
+			if err != nil {
+				return nil, err
+			} else if len(dst) > max {
+				return nil, errBlockTooLarge
+			}
+			return dst, nil
+		}, nil
+	}
+
+	if name, ok := compNames[comp]; ok {
+		return nil, fmt.Errorf("%s compression is not supported", name)
+	}
+	return nil, fmt.Errorf("unknown compression %d", comp)
+}
+
+var errBlockTooLarge = errors.New("uncompressed block is too large")
+
+// readMax reads r until EOF, it returns an error if more than max bytes
+// are read.
+func readMax(r io.Reader, max int) ([]byte, error) {
+	var buf bytes.Buffer
+
+	n, err := io.Copy(&buf, io.LimitReader(r, int64(max)+1))
+	if err != nil {
+		return nil, err
+	} else if n > int64(max) {
+		return nil, errBlockTooLarge
+	}
+	return buf.Bytes(), nil
+}
+
+var errLz4Corrupted = errors.New("corrupted lz4 block")
+
+// lz4Decompress decompresses an LZ4 block, squashfs uses the LZ4 block
+// format without frame.
+func lz4Decompress(src []byte, max int) ([]byte, error) {
+	dst := make([]byte, 0, max)
+
+	// readLength reads the extension bytes of a literal or match length.
+	readLength := func(i int, n int) (int, int, error) {
+		for {
+			if i >= len(src) {
+				return 0, 0, errLz4Corrupted
+			}
+			b := src[i]
+			i++
+			n += int(b)
+			if b != 255 {
+				return i, n, nil
+			}
+		}
+	}
+
+	for i := 0; i < len(src); {
+		token := src[i]
+		i++
+
+		var err error
+
+		literals := int(token >> 4)
+		if literals == 15 {
+			if i, literals, err = readLength(i, literals); err != nil {
+				return nil, err
+			}
+		}
+		if i+literals > len(src) || len(dst)+literals > max {
+			return nil, errLz4Corrupted
+		}
+		dst = append(dst, src[i:i+literals]...)
+		i += literals
+
+		// the last sequence has only literals
+		if i == len(src) {
+			break
+		}
+
+		if i+2 > len(src) {
+			return nil, errLz4Corrupted
+		}
+		offset := int(src[i]) | int(src[i+1])<<8
+		i += 2
+		if offset == 0 || offset > len(dst) {
+			return nil, errLz4Corrupted
+		}
+
+		match := int(token & 0xf)
+		if match == 15 {
+			if i, match, err = readLength(i, match); err != nil {
+				return nil, err
+			}
+		}
+		match += 4
+		if len(dst)+match > max {
+			return nil, errLz4Corrupted
+		}
+
+		// matches may overlap the bytes they produce, so they are copied
+		// byte by byte
+		start := len(dst) - offset
+		for j := 0; j < match; j++ {
+			dst = append(dst, dst[start+j])
+		}
+	}
+
+	return dst, nil
+}
@@ -0,0 +1,144 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package squashfs
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+func compress(t *testing.T, comp uint16, data []byte) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	var err error
+
+	switch comp {
+	case compGzip:
+		w = zlib.NewWriter(&buf)
+	case compLzma:
+		w, err = lzma.NewWriter(&buf)
+	case compXz:
+		w, err = xz.NewWriter(&buf)
+	case compZstd:
+		enc, err := zstd.NewWriter(nil)
+		if err != nil {
+			t.Fatalf("failed to create zstd encoder: %s", err)
+		}
+		return enc.EncodeAll(data, nil)
+	}
+	if err != nil {
+		t.Fatalf("failed to create %s writer: %s", compNames[comp], err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("failed to compress: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to compress: %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecompressor(t *testing.T) {
+	data := bytes.Repeat([]byte("squashfs block "), 500)
+
+	for _, comp := range []uint16{compGzip, compLzma, compXz, compZstd} {
+		t.Run(compNames[comp], func(t *testing.T) {
+			d, err := newDecompressor(comp)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			src := compress(t, comp, data)
+
+			got, err := d(src, len(data))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("unexpected decompressed data")
+			}
+
+			if _, err := d(src, len(data)-1); err == nil {
+				t.Errorf("unexpected success with a block larger than the maximum size")
+			}
+		})
+	}
+
+	if _, err := newDecompressor(compLzo); err == nil {
+		t.Errorf("unexpected success with lzo compression")
+	}
+}
+
+func TestLz4Decompress(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    []byte
+		max    int
+		want   []byte
+		expErr bool
+	}{
+		{
+			name: "Literals",
+			src:  append([]byte{0x50}, "hello"...),
+			max:  5,
+			want: []byte("hello"),
+		},
+		{
+			// "abc" then a match of 9 bytes at offset 3, then "!"
+			name: "OverlappingMatch",
+			src:  []byte{0x35, 'a', 'b', 'c', 3, 0, 0x10, '!'},
+			max:  13,
+			want: []byte("abcabcabcabc!"),
+		},
+		{
+			// 15 + 5 literals with a length extension byte
+			name: "LongLiterals",
+			src:  append([]byte{0xf0, 5}, bytes.Repeat([]byte("x"), 20)...),
+			max:  20,
+			want: bytes.Repeat([]byte("x"), 20),
+		},
+		{
+			name:   "OffsetBeforeStart",
+			src:    []byte{0x10, 'a', 2, 0, 0x10, '!'},
+			max:    20,
+			expErr: true,
+		},
+		{
+			name:   "TooLarge",
+			src:    append([]byte{0x50}, "hello"...),
+			max:    4,
+			expErr: true,
+		},
+		{
+			name:   "Truncated",
+			src:    []byte{0x50, 'h'},
+			max:    5,
+			expErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := lz4Decompress(tt.src, tt.max)
+			if tt.expErr {
+				if err == nil {
+					t.Errorf("unexpected success")
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("unexpected data: got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
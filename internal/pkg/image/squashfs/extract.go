@@ -0,0 +1,104 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package squashfs
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/hpcng/singularity/pkg/sylog"
+)
+
+// Extract copies the file or directory name of the filesystem to the
+// host path dest, which must not exist. Symbolic links are followed for
+// name, but are copied as is when found in directories. Hard links,
+// permissions and modification times are preserved, except the setuid and
+// setgid bits, file ownership is not preserved, and device and socket
+// files are skipped.
+func (f *FS) Extract(name, dest string) error {
+	in, err := f.resolve("extract", name, true)
+	if err != nil {
+		return err
+	}
+	return f.extract(in, dest, make(map[uint32]string))
+}
+
+// extract copies the inode in to the host path dest, links holds the
+// paths of the regular files already extracted with multiple links,
+// indexed by inode number.
+func (f *FS) extract(in *inode, dest string, links map[uint32]string) error {
+	perm := os.FileMode(in.perm & 0o777)
+	if in.perm&0o1000 != 0 {
+		perm |= os.ModeSticky
+	}
+	mtime := time.Unix(int64(in.mtime), 0)
+
+	switch in.typ {
+	case typeDir:
+		// the directory is writable until its content is extracted
+		if err := os.Mkdir(dest, 0o700); err != nil {
+			return err
+		}
+		entries, err := f.readDir(in)
+		if err != nil {
+			return fmt.Errorf("while reading directory %s: %s", dest, err)
+		}
+		for _, e := range entries {
+			child, err := f.inode(e.ref)
+			if err != nil {
+				return err
+			}
+			if err := f.extract(child, filepath.Join(dest, e.name), links); err != nil {
+				return err
+			}
+		}
+	case typeFile:
+		if path, ok := links[in.ino]; ok {
+			return os.Link(path, dest)
+		}
+		if err := f.extractFile(in, dest); err != nil {
+			return err
+		}
+		if in.nlink > 1 {
+			links[in.ino] = dest
+		}
+	case typeSymlink:
+		// symbolic links times are not preserved
+		return os.Symlink(in.target, dest)
+	case typeFifo:
+		if err := syscall.Mkfifo(dest, 0o600); err != nil {
+			return &os.PathError{Op: "mkfifo", Path: dest, Err: err}
+		}
+	default:
+		sylog.Warningf("Skipping %s: device and socket files are not extracted", dest)
+		return nil
+	}
+
+	if err := os.Chmod(dest, perm); err != nil {
+		return err
+	}
+	return os.Chtimes(dest, mtime, mtime)
+}
+
+// extractFile copies the content of the regular file inode in to the new
+// host file dest.
+func (f *FS) extractFile(in *inode, dest string) error {
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+
+	src := &file{f: f, fi: &fileInfo{name: filepath.Base(dest), in: in}, path: dest}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		return fmt.Errorf("while extracting %s: %s", dest, err)
+	}
+	return out.Close()
+}
@@ -0,0 +1,366 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package squashfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxSymlinks is the maximum number of symbolic links followed while
+// resolving a path.
+const maxSymlinks = 40
+
+var (
+	errNotDir       = errors.New("not a directory")
+	errNotSymlink   = errors.New("not a symbolic link")
+	errNotRegular   = errors.New("not a regular file")
+	errTooManyLinks = errors.New("too many levels of symbolic links")
+)
+
+// Stat holds the attributes of a file which are not part of fs.FileInfo,
+// it is returned by the Sys method of the file information.
+type Stat struct {
+	UID   uint32
+	GID   uint32
+	Nlink uint32
+	Ino   uint32
+	// Rdev is the device number of block and character devices.
+	Rdev uint32
+}
+
+// fileInfo is the information of a file.
+type fileInfo struct {
+	name string
+	in   *inode
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return int64(fi.in.size) }
+func (fi *fileInfo) Mode() fs.FileMode  { return fi.in.mode() }
+func (fi *fileInfo) ModTime() time.Time { return time.Unix(int64(fi.in.mtime), 0) }
+func (fi *fileInfo) IsDir() bool        { return fi.in.isDir() }
+
+func (fi *fileInfo) Sys() interface{} {
+	return &Stat{
+		UID:   fi.in.uid,
+		GID:   fi.in.gid,
+		Nlink: fi.in.nlink,
+		Ino:   fi.in.ino,
+		Rdev:  fi.in.rdev,
+	}
+}
+
+// resolve returns the inode of the path name, symbolic links are followed
+// in the parent directories, and for the last element if follow is set.
+// Symbolic links are resolved inside the filesystem, absolute targets are
+// relative to the filesystem root and .. never goes above the root.
+func (f *FS) resolve(op, name string, follow bool) (*inode, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	var components []string
+	if name != "." {
+		components = strings.Split(name, "/")
+	}
+
+	dirs := []*inode{f.root}
+	links := 0
+
+	for len(components) > 0 {
+		c := components[0]
+		components = components[1:]
+
+		switch c {
+		case "", ".":
+			continue
+		case "..":
+			if len(dirs) > 1 {
+				dirs = dirs[:len(dirs)-1]
+			}
+			continue
+		}
+
+		dir := dirs[len(dirs)-1]
+		if !dir.isDir() {
+			return nil, &fs.PathError{Op: op, Path: name, Err: errNotDir}
+		}
+
+		in, err := f.lookup(dir, c)
+		if err != nil {
+			return nil, &fs.PathError{Op: op, Path: name, Err: err}
+		}
+
+		if in.typ == typeSymlink && (len(components) > 0 || follow) {
+			links++
+			if links > maxSymlinks {
+				return nil, &fs.PathError{Op: op, Path: name, Err: errTooManyLinks}
+			}
+			if strings.HasPrefix(in.target, "/") {
+				dirs = dirs[:1]
+			}
+			components = append(strings.Split(in.target, "/"), components...)
+			continue
+		}
+
+		dirs = append(dirs, in)
+	}
+
+	return dirs[len(dirs)-1], nil
+}
+
+// Open opens the file name, following symbolic links.
+func (f *FS) Open(name string) (fs.File, error) {
+	in, err := f.resolve("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	fi := &fileInfo{name: path.Base(name), in: in}
+	if in.isDir() {
+		return &dir{f: f, fi: fi}, nil
+	}
+	return &file{f: f, fi: fi, path: name}, nil
+}
+
+// Stat returns the information of the file name, following symbolic
+// links.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	in, err := f.resolve("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{name: path.Base(name), in: in}, nil
+}
+
+// Lstat returns the information of the file name, without following a
+// symbolic link.
+func (f *FS) Lstat(name string) (fs.FileInfo, error) {
+	in, err := f.resolve("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{name: path.Base(name), in: in}, nil
+}
+
+// ReadLink returns the target of the symbolic link name.
+func (f *FS) ReadLink(name string) (string, error) {
+	in, err := f.resolve("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if in.typ != typeSymlink {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: errNotSymlink}
+	}
+	return in.target, nil
+}
+
+// ReadDir returns the entries of the directory name, sorted by name.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	in, err := f.resolve("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !in.isDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errNotDir}
+	}
+
+	entries, err := f.readDir(in)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+
+	list := make([]fs.DirEntry, len(entries))
+	for i, e := range entries {
+		list[i] = e
+	}
+	return list, nil
+}
+
+// file is an opened file which is not a directory.
+type file struct {
+	f    *FS
+	fi   *fileInfo
+	path string
+	off  int64
+
+	mu sync.Mutex
+	// positions are the offsets of the data blocks in the image
+	positions []int64
+	// block is the last data block read, with its index
+	block      []byte
+	blockIndex int64
+}
+
+func (fl *file) Stat() (fs.FileInfo, error) {
+	return fl.fi, nil
+}
+
+func (fl *file) Close() error {
+	return nil
+}
+
+func (fl *file) Read(p []byte) (int, error) {
+	n, err := fl.ReadAt(p, fl.off)
+	fl.off += int64(n)
+	return n, err
+}
+
+// Seek implements io.Seeker.
+func (fl *file) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += fl.off
+	case io.SeekEnd:
+		offset += fl.fi.Size()
+	default:
+		return 0, &fs.PathError{Op: "seek", Path: fl.path, Err: fs.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: fl.path, Err: fs.ErrInvalid}
+	}
+	fl.off = offset
+	return offset, nil
+}
+
+// ReadAt implements io.ReaderAt.
+func (fl *file) ReadAt(p []byte, off int64) (int, error) {
+	in := fl.fi.in
+	if in.typ != typeFile {
+		return 0, &fs.PathError{Op: "read", Path: fl.path, Err: errNotRegular}
+	}
+
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+
+	size := int64(in.size)
+	blockSize := int64(fl.f.sb.BlockSize)
+
+	n := 0
+	for n < len(p) && off < size {
+		i := off / blockSize
+		data, err := fl.readBlock(i)
+		if err != nil {
+			return n, &fs.PathError{Op: "read", Path: fl.path, Err: err}
+		}
+		c := copy(p[n:], data[off-i*blockSize:])
+		n += c
+		off += int64(c)
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// readBlock returns the data block i of the file.
+func (fl *file) readBlock(i int64) ([]byte, error) {
+	if fl.block != nil && fl.blockIndex == i {
+		return fl.block, nil
+	}
+
+	in := fl.fi.in
+	blockSize := int64(fl.f.sb.BlockSize)
+
+	// length of the block, the last one may be shorter
+	length := int64(in.size) - i*blockSize
+	if length > blockSize {
+		length = blockSize
+	}
+
+	var data []byte
+
+	if i < int64(len(in.blockSizes)) {
+		if fl.positions == nil {
+			fl.positions = make([]int64, len(in.blockSizes))
+			pos := int64(in.blocksStart)
+			for j, s := range in.blockSizes {
+				fl.positions[j] = pos
+				pos += int64(s &^ dataUncompressed)
+			}
+		}
+
+		var err error
+		if data, err = fl.f.dataBlock(fl.positions[i], in.blockSizes[i], int(length)); err != nil {
+			return nil, err
+		}
+	} else {
+		if in.fragment == noFragment {
+			return nil, ErrCorrupted
+		}
+		fragment, err := fl.f.fragment(in.fragment)
+		if err != nil {
+			return nil, err
+		}
+		start := int64(in.fragmentOffset)
+		if start+length > int64(len(fragment)) {
+			return nil, ErrCorrupted
+		}
+		data = fragment[start : start+length]
+	}
+
+	if int64(len(data)) != length {
+		return nil, ErrCorrupted
+	}
+
+	fl.block, fl.blockIndex = data, i
+	return data, nil
+}
+
+// dir is an opened directory.
+type dir struct {
+	f       *FS
+	fi      *fileInfo
+	entries []*dirEntry
+	read    bool
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) {
+	return d.fi, nil
+}
+
+func (d *dir) Close() error {
+	return nil
+}
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.fi.name, Err: errors.New("is a directory")}
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		entries, err := d.f.readDir(d.fi.in)
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: d.fi.name, Err: err}
+		}
+		d.entries, d.read = entries, true
+	}
+
+	count := len(d.entries)
+	if n > 0 && n < count {
+		count = n
+	}
+	if n > 0 && count == 0 {
+		return nil, io.EOF
+	}
+
+	list := make([]fs.DirEntry, count)
+	for i := range list {
+		list[i] = d.entries[i]
+	}
+	d.entries = d.entries[count:]
+
+	return list, nil
+}
@@ -0,0 +1,375 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package squashfs
+
+import (
+	"io/fs"
+	"strings"
+)
+
+// Inode types, extended types are the basic type plus 7.
+const (
+	typeDir     = 1
+	typeFile    = 2
+	typeSymlink = 3
+	typeBlock   = 4
+	typeChar    = 5
+	typeFifo    = 6
+	typeSocket  = 7
+	extended    = 7
+)
+
+// inodeHeader is the header common to all inodes.
+type inodeHeader struct {
+	Type        uint16
+	Permissions uint16
+	UIDIndex    uint16
+	GIDIndex    uint16
+	MTime       uint32
+	Number      uint32
+}
+
+// inode is a decoded inode.
+type inode struct {
+	typ   uint16
+	perm  uint16
+	uid   uint32
+	gid   uint32
+	mtime uint32
+	ino   uint32
+	nlink uint32
+	size  uint64
+
+	// directories
+	dirBlock  uint32
+	dirOffset uint16
+
+	// regular files
+	blocksStart    uint64
+	blockSizes     []uint32
+	fragment       uint32
+	fragmentOffset uint32
+
+	// symbolic links
+	target string
+
+	// block and character devices
+	rdev uint32
+}
+
+func (in *inode) isDir() bool {
+	return in.typ == typeDir
+}
+
+// mode returns the file mode of the inode.
+func (in *inode) mode() fs.FileMode {
+	m := fs.FileMode(in.perm & 0o777)
+	if in.perm&0o4000 != 0 {
+		m |= fs.ModeSetuid
+	}
+	if in.perm&0o2000 != 0 {
+		m |= fs.ModeSetgid
+	}
+	if in.perm&0o1000 != 0 {
+		m |= fs.ModeSticky
+	}
+	return m | typeMode(in.typ)
+}
+
+// typeMode returns the file mode type bits of the inode type typ.
+func typeMode(typ uint16) fs.FileMode {
+	switch typ {
+	case typeDir:
+		return fs.ModeDir
+	case typeSymlink:
+		return fs.ModeSymlink
+	case typeBlock:
+		return fs.ModeDevice
+	case typeChar:
+		return fs.ModeDevice | fs.ModeCharDevice
+	case typeFifo:
+		return fs.ModeNamedPipe
+	case typeSocket:
+		return fs.ModeSocket
+	}
+	return 0
+}
+
+// inode returns the inode referenced by ref, the upper bits are the
+// offset of the metadata block in the inode table, the lower 16 bits are
+// the offset of the inode in the uncompressed block.
+func (f *FS) inode(ref uint64) (*inode, error) {
+	r, err := f.newMetadataReader(int64(f.sb.InodeTableStart+(ref>>16)), int(ref&0xffff))
+	if err != nil {
+		return nil, err
+	}
+
+	var h inodeHeader
+	if err := r.read(&h); err != nil {
+		return nil, err
+	}
+
+	in := &inode{
+		perm:  h.Permissions & 0o7777,
+		mtime: h.MTime,
+		ino:   h.Number,
+	}
+	if in.uid, err = f.id(h.UIDIndex); err != nil {
+		return nil, err
+	}
+	if in.gid, err = f.id(h.GIDIndex); err != nil {
+		return nil, err
+	}
+
+	in.typ = h.Type
+	if in.typ > extended {
+		in.typ -= extended
+	}
+
+	switch h.Type {
+	case typeDir:
+		var d struct {
+			Block  uint32
+			Nlink  uint32
+			Size   uint16
+			Offset uint16
+			Parent uint32
+		}
+		err = r.read(&d)
+		in.dirBlock, in.nlink, in.size, in.dirOffset = d.Block, d.Nlink, uint64(d.Size), d.Offset
+	case typeDir + extended:
+		// the directory index following the inode is not used
+		var d struct {
+			Nlink      uint32
+			Size       uint32
+			Block      uint32
+			Parent     uint32
+			IndexCount uint16
+			Offset     uint16
+			Xattr      uint32
+		}
+		err = r.read(&d)
+		in.dirBlock, in.nlink, in.size, in.dirOffset = d.Block, d.Nlink, uint64(d.Size), d.Offset
+	case typeFile:
+		var d struct {
+			BlocksStart    uint32
+			Fragment       uint32
+			FragmentOffset uint32
+			Size           uint32
+		}
+		if err = r.read(&d); err == nil {
+			in.nlink = 1
+			in.blocksStart, in.fragment, in.fragmentOffset, in.size = uint64(d.BlocksStart), d.Fragment, d.FragmentOffset, uint64(d.Size)
+			err = f.readBlockSizes(r, in)
+		}
+	case typeFile + extended:
+		var d struct {
+			BlocksStart    uint64
+			Size           uint64
+			Sparse         uint64
+			Nlink          uint32
+			Fragment       uint32
+			FragmentOffset uint32
+			Xattr          uint32
+		}
+		if err = r.read(&d); err == nil {
+			in.nlink = d.Nlink
+			in.blocksStart, in.fragment, in.fragmentOffset, in.size = d.BlocksStart, d.Fragment, d.FragmentOffset, d.Size
+			err = f.readBlockSizes(r, in)
+		}
+	case typeSymlink, typeSymlink + extended:
+		var d struct {
+			Nlink uint32
+			Size  uint32
+		}
+		if err = r.read(&d); err == nil {
+			if d.Size > 4096 {
+				return nil, ErrCorrupted
+			}
+			target := make([]byte, d.Size)
+			if err = r.read(target); err == nil {
+				in.nlink, in.size, in.target = d.Nlink, uint64(d.Size), string(target)
+			}
+		}
+	case typeBlock, typeChar, typeBlock + extended, typeChar + extended:
+		var d struct {
+			Nlink uint32
+			Rdev  uint32
+		}
+		err = r.read(&d)
+		in.nlink, in.rdev = d.Nlink, d.Rdev
+	case typeFifo, typeSocket, typeFifo + extended, typeSocket + extended:
+		err = r.read(&in.nlink)
+	default:
+		return nil, ErrCorrupted
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return in, nil
+}
+
+// readBlockSizes reads the sizes of the data blocks of the regular file
+// inode in, which follow the inode.
+func (f *FS) readBlockSizes(r *metadataReader, in *inode) error {
+	blockSize := uint64(f.sb.BlockSize)
+
+	count := in.size / blockSize
+	if in.fragment == noFragment && in.size%blockSize != 0 {
+		count++
+	}
+
+	// a block size takes 4 bytes of metadata, so a file can't have more
+	// blocks than the metadata left in the image holds, knowing that a
+	// compressed metadata block takes at least 3 bytes
+	stored := uint64(len(r.data)) / 4
+	if r.next > f.size {
+		return ErrCorrupted
+	}
+	if left := uint64(f.size-r.next)/3 + 1; count > stored && (count-stored)/(metadataSize/4) > left {
+		return ErrCorrupted
+	}
+
+	// sizes are read by metadata block, so memory is only allocated
+	// for the metadata actually stored in the image
+	in.blockSizes = make([]uint32, 0, minBlocks(count, metadataSize/4))
+	for n := uint64(0); n < count; {
+		chunk := make([]uint32, minBlocks(count-n, metadataSize/4))
+		if err := r.read(chunk); err != nil {
+			return err
+		}
+		in.blockSizes = append(in.blockSizes, chunk...)
+		n += uint64(len(chunk))
+	}
+
+	return nil
+}
+
+func minBlocks(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// dirEntry is a directory entry.
+type dirEntry struct {
+	f    *FS
+	name string
+	ref  uint64
+	typ  uint16
+}
+
+// Name returns the name of the entry.
+func (e *dirEntry) Name() string {
+	return e.name
+}
+
+// IsDir returns whether the entry is a directory.
+func (e *dirEntry) IsDir() bool {
+	return e.typ == typeDir
+}
+
+// Type returns the type bits of the entry mode.
+func (e *dirEntry) Type() fs.FileMode {
+	return typeMode(e.typ)
+}
+
+// Info returns the information of the entry, symbolic links are not
+// followed.
+func (e *dirEntry) Info() (fs.FileInfo, error) {
+	in, err := e.f.inode(e.ref)
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{name: e.name, in: in}, nil
+}
+
+// readDir returns the entries of the directory inode in, sorted by name.
+func (f *FS) readDir(in *inode) ([]*dirEntry, error) {
+	// the directory size includes 3 bytes for the . and .. entries, which
+	// are not stored
+	if in.size <= 3 {
+		return nil, nil
+	}
+	remaining := int64(in.size) - 3
+
+	r, err := f.newMetadataReader(int64(f.sb.DirectoryTableStart)+int64(in.dirBlock), int(in.dirOffset))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*dirEntry
+
+	for remaining > 0 {
+		var h struct {
+			Count  uint32
+			Start  uint32
+			Number uint32
+		}
+		if err := r.read(&h); err != nil {
+			return nil, err
+		}
+		remaining -= 12
+		if h.Count >= 256 {
+			return nil, ErrCorrupted
+		}
+
+		for i := uint32(0); i <= h.Count; i++ {
+			var e struct {
+				Offset      uint16
+				InodeOffset int16
+				Type        uint16
+				NameSize    uint16
+			}
+			if err := r.read(&e); err != nil {
+				return nil, err
+			}
+			name := make([]byte, int(e.NameSize)+1)
+			if err := r.read(name); err != nil {
+				return nil, err
+			}
+			remaining -= 8 + int64(len(name))
+
+			typ := e.Type
+			if typ > extended {
+				typ -= extended
+			}
+			// entry names can't be used to escape a directory
+			if n := string(name); n == "." || n == ".." || strings.Contains(n, "/") {
+				return nil, ErrCorrupted
+			}
+
+			entries = append(entries, &dirEntry{
+				f:    f,
+				name: string(name),
+				ref:  uint64(h.Start)<<16 | uint64(e.Offset),
+				typ:  typ,
+			})
+		}
+	}
+
+	if remaining != 0 {
+		return nil, ErrCorrupted
+	}
+
+	return entries, nil
+}
+
+// lookup returns the entry name of the directory inode in.
+func (f *FS) lookup(in *inode, name string) (*inode, error) {
+	entries, err := f.readDir(in)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.name == name {
+			return f.inode(e.ref)
+		}
+	}
+	return nil, fs.ErrNotExist
+}
@@ -0,0 +1,366 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package squashfs implements a read-only squashfs 4.0 filesystem, so
+// the content of images can be read without unsquashfs, privileges or
+// FUSE. Images compressed with gzip, lzma, xz, lz4 and zstd are supported.
+package squashfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/hpcng/singularity/pkg/image"
+)
+
+const (
+	// superMagic is the magic number of squashfs images.
+	superMagic = 0x73717368
+	// metadataSize is the maximum size of uncompressed metadata blocks.
+	metadataSize = 8192
+	// metadataUncompressed is set in metadata block headers for
+	// uncompressed blocks.
+	metadataUncompressed = 0x8000
+	// dataUncompressed is set in data block sizes for uncompressed blocks.
+	dataUncompressed = 1 << 24
+	// noFragment is the fragment index of files without fragment.
+	noFragment = 0xffffffff
+	// metadataCacheSize is the number of metadata blocks kept in cache.
+	metadataCacheSize = 128
+)
+
+// superBlock is the squashfs 4.0 super block.
+type superBlock struct {
+	Magic               uint32
+	InodeCount          uint32
+	ModificationTime    uint32
+	BlockSize           uint32
+	FragmentCount       uint32
+	Compression         uint16
+	BlockLog            uint16
+	Flags               uint16
+	IDCount             uint16
+	VersionMajor        uint16
+	VersionMinor        uint16
+	RootInode           uint64
+	BytesUsed           uint64
+	IDTableStart        uint64
+	XattrIDTableStart   uint64
+	InodeTableStart     uint64
+	DirectoryTableStart uint64
+	FragmentTableStart  uint64
+	ExportTableStart    uint64
+}
+
+// ErrCorrupted is returned for invalid squashfs images.
+var ErrCorrupted = errors.New("corrupted squashfs image")
+
+// FS is a read-only squashfs filesystem. It implements fs.FS, fs.StatFS and
+// fs.ReadDirFS, and is safe for concurrent use.
+type FS struct {
+	r          io.ReaderAt
+	size       int64
+	sb         superBlock
+	decompress decompressor
+	ids        []uint32
+	root       *inode
+
+	mu        sync.Mutex
+	metadata  map[int64]*metadataBlock
+	fragments []uint64
+}
+
+// metadataBlock is a decompressed metadata block.
+type metadataBlock struct {
+	data []byte
+	next int64
+}
+
+// New returns the squashfs filesystem read from r, whose size is the
+// size of the image. Sizes and offsets read from the image are checked
+// against it.
+func New(r io.ReaderAt, size int64) (*FS, error) {
+	f := &FS{
+		r:        r,
+		size:     size,
+		metadata: make(map[int64]*metadataBlock),
+	}
+
+	sr := io.NewSectionReader(r, 0, int64(binary.Size(f.sb)))
+	if err := binary.Read(sr, binary.LittleEndian, &f.sb); err != nil {
+		return nil, fmt.Errorf("while reading super block: %s", err)
+	}
+	if f.sb.Magic != superMagic {
+		return nil, fmt.Errorf("not a squashfs image")
+	}
+	if f.sb.VersionMajor != 4 || f.sb.VersionMinor != 0 {
+		return nil, fmt.Errorf("squashfs version %d.%d is not supported", f.sb.VersionMajor, f.sb.VersionMinor)
+	}
+	if f.sb.BlockSize == 0 || f.sb.BlockSize > 1<<20 || f.sb.BlockSize != 1<<f.sb.BlockLog {
+		return nil, ErrCorrupted
+	}
+	if size < 0 || f.sb.BytesUsed > uint64(size) {
+		return nil, ErrCorrupted
+	}
+
+	var err error
+
+	if f.decompress, err = newDecompressor(f.sb.Compression); err != nil {
+		return nil, err
+	}
+	if err := f.readIDs(); err != nil {
+		return nil, fmt.Errorf("while reading id table: %s", err)
+	}
+	if f.root, err = f.inode(f.sb.RootInode); err != nil {
+		return nil, fmt.Errorf("while reading root inode: %s", err)
+	}
+	if !f.root.isDir() {
+		return nil, ErrCorrupted
+	}
+
+	return f, nil
+}
+
+// FromImage returns the squashfs filesystem of the root filesystem
+// partition of img. The filesystem reads img.File, which must stay open
+// while the filesystem is used.
+func FromImage(img *image.Image) (*FS, error) {
+	part, err := img.GetRootFsPartition()
+	if err != nil {
+		return nil, fmt.Errorf("while getting root filesystem in %s: %s", img.Name, err)
+	}
+
+	switch part.Type {
+	case image.SQUASHFS:
+	case image.ENCRYPTSQUASHFS:
+		return nil, fmt.Errorf("images with an encrypted root filesystem are not supported")
+	default:
+		return nil, fmt.Errorf("images with a non squashfs root filesystem are not supported")
+	}
+
+	return New(io.NewSectionReader(img.File, int64(part.Offset), int64(part.Size)), int64(part.Size))
+}
+
+// Compression returns the name of the compression algorithm of the
+// filesystem.
+func (f *FS) Compression() string {
+	return compNames[f.sb.Compression]
+}
+
+// readAt reads len(b) bytes at offset off of the image.
+func (f *FS) readAt(b []byte, off int64) error {
+	// ReadAt may return io.EOF with a full read at the end of the image
+	if n, err := f.r.ReadAt(b, off); err != nil && n != len(b) {
+		if err == io.EOF {
+			return ErrCorrupted
+		}
+		return err
+	}
+	return nil
+}
+
+// metadataBlock returns the metadata block stored at the offset pos of
+// the image.
+func (f *FS) metadataBlock(pos int64) (*metadataBlock, error) {
+	f.mu.Lock()
+	b, ok := f.metadata[pos]
+	f.mu.Unlock()
+	if ok {
+		return b, nil
+	}
+
+	var header [2]byte
+	if err := f.readAt(header[:], pos); err != nil {
+		return nil, err
+	}
+	size := binary.LittleEndian.Uint16(header[:])
+	compressed := size&metadataUncompressed == 0
+	size &^= metadataUncompressed
+	if size > metadataSize {
+		return nil, ErrCorrupted
+	}
+
+	data := make([]byte, size)
+	if err := f.readAt(data, pos+2); err != nil {
+		return nil, err
+	}
+	if compressed {
+		var err error
+		if data, err = f.decompress(data, metadataSize); err != nil {
+			return nil, fmt.Errorf("while decompressing metadata block: %s", err)
+		}
+	}
+
+	b = &metadataBlock{data: data, next: pos + 2 + int64(size)}
+
+	f.mu.Lock()
+	if len(f.metadata) >= metadataCacheSize {
+		f.metadata = make(map[int64]*metadataBlock)
+	}
+	f.metadata[pos] = b
+	f.mu.Unlock()
+
+	return b, nil
+}
+
+// metadataReader reads the metadata stored from an offset in a metadata
+// block, across the following blocks.
+type metadataReader struct {
+	f    *FS
+	data []byte
+	next int64
+}
+
+// newMetadataReader returns a metadata reader starting at offset off of
+// the metadata block at pos.
+func (f *FS) newMetadataReader(pos int64, off int) (*metadataReader, error) {
+	b, err := f.metadataBlock(pos)
+	if err != nil {
+		return nil, err
+	}
+	if off > len(b.data) {
+		return nil, ErrCorrupted
+	}
+	return &metadataReader{f: f, data: b.data[off:], next: b.next}, nil
+}
+
+func (r *metadataReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(r.data) == 0 {
+			b, err := r.f.metadataBlock(r.next)
+			if err != nil {
+				return n, err
+			}
+			if len(b.data) == 0 {
+				return n, ErrCorrupted
+			}
+			r.data, r.next = b.data, b.next
+		}
+		c := copy(p[n:], r.data)
+		r.data = r.data[c:]
+		n += c
+	}
+	return n, nil
+}
+
+// read decodes little endian data from the reader into v.
+func (r *metadataReader) read(v interface{}) error {
+	return binary.Read(r, binary.LittleEndian, v)
+}
+
+// readTable returns a reader of the count entries of a table stored in
+// consecutive metadata blocks, whose locations are listed at the offset
+// start of the image. It returns nil for empty tables.
+func (f *FS) readTable(start uint64, count int) (*metadataReader, error) {
+	if count == 0 {
+		return nil, nil
+	}
+
+	var first [8]byte
+	if err := f.readAt(first[:], int64(start)); err != nil {
+		return nil, err
+	}
+	return f.newMetadataReader(int64(binary.LittleEndian.Uint64(first[:])), 0)
+}
+
+// readIDs reads the uid and gid table.
+func (f *FS) readIDs() error {
+	count := int(f.sb.IDCount)
+
+	r, err := f.readTable(f.sb.IDTableStart, count)
+	if err != nil || r == nil {
+		return err
+	}
+
+	f.ids = make([]uint32, count)
+	return r.read(f.ids)
+}
+
+// id returns the uid or gid of the index i of the id table.
+func (f *FS) id(i uint16) (uint32, error) {
+	if int(i) >= len(f.ids) {
+		return 0, ErrCorrupted
+	}
+	return f.ids[i], nil
+}
+
+// fragmentEntry is an entry of the fragment table.
+type fragmentEntry struct {
+	Start  uint64
+	Size   uint32
+	Unused uint32
+}
+
+// fragment returns the fragment block i, uncompressed.
+func (f *FS) fragment(i uint32) ([]byte, error) {
+	if i >= f.sb.FragmentCount {
+		return nil, ErrCorrupted
+	}
+
+	f.mu.Lock()
+	fragments := f.fragments
+	f.mu.Unlock()
+
+	if fragments == nil {
+		count := int(f.sb.FragmentCount)
+		blocks := (count*16 + metadataSize - 1) / metadataSize
+
+		pointers := make([]uint64, blocks)
+		sr := io.NewSectionReader(f.r, int64(f.sb.FragmentTableStart), int64(blocks*8))
+		if err := binary.Read(sr, binary.LittleEndian, pointers); err != nil {
+			return nil, fmt.Errorf("while reading fragment table: %s", err)
+		}
+
+		f.mu.Lock()
+		f.fragments = pointers
+		f.mu.Unlock()
+		fragments = pointers
+	}
+
+	off := int(i) * 16
+	r, err := f.newMetadataReader(int64(fragments[off/metadataSize]), off%metadataSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var e fragmentEntry
+	if err := r.read(&e); err != nil {
+		return nil, err
+	}
+
+	return f.dataBlock(int64(e.Start), e.Size, int(f.sb.BlockSize))
+}
+
+// dataBlock returns the uncompressed data block stored at the offset pos
+// of the image, with the on disk size field size. Sparse blocks are
+// returned as blocks of zeros of length sparse.
+func (f *FS) dataBlock(pos int64, size uint32, sparse int) ([]byte, error) {
+	compressed := size&dataUncompressed == 0
+	size &^= dataUncompressed
+
+	if size == 0 {
+		return make([]byte, sparse), nil
+	} else if size > f.sb.BlockSize {
+		return nil, ErrCorrupted
+	}
+
+	data := make([]byte, size)
+	if err := f.readAt(data, pos); err != nil {
+		return nil, err
+	}
+	if !compressed {
+		return data, nil
+	}
+
+	data, err := f.decompress(data, int(f.sb.BlockSize))
+	if err != nil {
+		return nil, fmt.Errorf("while decompressing data block: %s", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,267 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package squashfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+// createTree creates the directory tree packed in test images, regular
+// files are stored in the data directory and symbolic links at the root.
+func createTree(t *testing.T, dir string, large []byte) {
+	files := map[string][]byte{
+		"data/file":       []byte("small file\n"),
+		"data/empty":      nil,
+		"data/large":      large,
+		"data/sub/nested": []byte("nested\n"),
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to create directory: %s", err)
+		}
+		if err := ioutil.WriteFile(path, content, 0o644); err != nil {
+			t.Fatalf("failed to write %s: %s", path, err)
+		}
+	}
+
+	links := map[string]string{
+		"link":     "data/large",
+		"abs":      "/data/sub",
+		"relative": "data/sub/../file",
+		"escape":   "../../data/file",
+		"loop":     "loop",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Fatalf("failed to create symlink: %s", err)
+		}
+	}
+
+	if err := os.Link(filepath.Join(dir, "data/file"), filepath.Join(dir, "data/hardlink")); err != nil {
+		t.Fatalf("failed to create hard link: %s", err)
+	}
+	if err := os.Chmod(filepath.Join(dir, "data/sub"), 0o1750); err != nil {
+		t.Fatalf("failed to change mode: %s", err)
+	}
+}
+
+// createImage packs the directory dir in a squashfs image compressed with
+// comp, it skips the test if mksquashfs doesn't support comp.
+func createImage(t *testing.T, dir, comp string) *os.File {
+	mk, err := exec.LookPath("mksquashfs")
+	if err != nil {
+		t.Skip("mksquashfs not found")
+	}
+
+	image := filepath.Join(t.TempDir(), "image.sqfs")
+
+	cmd := exec.Command(mk, dir, image, "-noappend", "-no-progress", "-comp", comp)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("mksquashfs doesn't support %s compression: %s", comp, out)
+	}
+
+	f, err := os.Open(image)
+	if err != nil {
+		t.Fatalf("failed to open image: %s", err)
+	}
+	return f
+}
+
+// imageSize returns the size of the image file f.
+func imageSize(t *testing.T, f *os.File) int64 {
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatalf("failed to stat image: %s", err)
+	}
+	return fi.Size()
+}
+
+func TestFS(t *testing.T) {
+	// the first block of random data is stored uncompressed, the second
+	// one is compressed, and the end of the file is stored in a fragment
+	large := make([]byte, 300*1024)
+	rand.New(rand.NewSource(1)).Read(large[:128*1024])
+	copy(large[128*1024:], bytes.Repeat([]byte("compressible"), 15000))
+
+	dir := t.TempDir()
+	createTree(t, dir, large)
+
+	for _, comp := range []string{"gzip", "lzma", "xz", "lz4", "zstd"} {
+		t.Run(comp, func(t *testing.T) {
+			img := createImage(t, dir, comp)
+			defer img.Close()
+
+			f, err := New(img, imageSize(t, img))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if f.Compression() != comp {
+				t.Errorf("unexpected compression %s", f.Compression())
+			}
+
+			data, err := fs.Sub(f, "data")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if err := fstest.TestFS(data, "file", "empty", "large", "sub/nested", "hardlink"); err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+
+			readTests := []struct {
+				name string
+				want []byte
+			}{
+				{"data/file", []byte("small file\n")},
+				{"data/empty", []byte{}},
+				{"data/large", large},
+				{"data/hardlink", []byte("small file\n")},
+				{"link", large},
+				{"abs/nested", []byte("nested\n")},
+				{"relative", []byte("small file\n")},
+				{"escape", []byte("small file\n")},
+			}
+			for _, tt := range readTests {
+				got, err := fs.ReadFile(f, tt.name)
+				if err != nil {
+					t.Errorf("unexpected error reading %s: %s", tt.name, err)
+				} else if !bytes.Equal(got, tt.want) {
+					t.Errorf("unexpected content of %s", tt.name)
+				}
+			}
+
+			if _, err := fs.ReadFile(f, "loop"); err == nil {
+				t.Errorf("unexpected success reading a symbolic link loop")
+			}
+			if _, err := f.Open("missing"); !os.IsNotExist(err) {
+				t.Errorf("unexpected error opening a missing file: %v", err)
+			}
+
+			if target, err := f.ReadLink("abs"); err != nil || target != "/data/sub" {
+				t.Errorf("unexpected link target %q: %v", target, err)
+			}
+			fi, err := f.Lstat("abs")
+			if err != nil || fi.Mode()&fs.ModeSymlink == 0 {
+				t.Errorf("unexpected lstat result %v: %v", fi, err)
+			}
+			fi, err = f.Stat("abs")
+			if err != nil || fi.Mode() != fs.ModeDir|fs.ModeSticky|0o750 {
+				t.Errorf("unexpected stat result %v: %v", fi, err)
+			}
+		})
+	}
+}
+
+func TestExtract(t *testing.T) {
+	large := bytes.Repeat([]byte("large file\n"), 20000)
+
+	dir := t.TempDir()
+	createTree(t, dir, large)
+
+	img := createImage(t, dir, "gzip")
+	defer img.Close()
+
+	f, err := New(img, imageSize(t, img))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	dest := filepath.Join(t.TempDir(), "rootfs")
+	if err := f.Extract(".", dest); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	got, err := ioutil.ReadFile(filepath.Join(dest, "data/large"))
+	if err != nil || !bytes.Equal(got, large) {
+		t.Errorf("unexpected content of data/large: %v", err)
+	}
+	if target, err := os.Readlink(filepath.Join(dest, "abs")); err != nil || target != "/data/sub" {
+		t.Errorf("unexpected link target %q: %v", target, err)
+	}
+	fi, err := os.Stat(filepath.Join(dest, "data/sub"))
+	if err != nil || fi.Mode() != os.ModeDir|os.ModeSticky|0o750 {
+		t.Errorf("unexpected mode of data/sub: %v: %v", fi, err)
+	}
+	a, errA := os.Stat(filepath.Join(dest, "data/file"))
+	b, errB := os.Stat(filepath.Join(dest, "data/hardlink"))
+	if errA != nil || errB != nil || !os.SameFile(a, b) {
+		t.Errorf("hard link not preserved")
+	}
+
+	// a symbolic link is followed when extracted directly
+	file := filepath.Join(t.TempDir(), "file")
+	if err := f.Extract("relative", file); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got, err := ioutil.ReadFile(file); err != nil || string(got) != "small file\n" {
+		t.Errorf("unexpected content %q: %v", got, err)
+	}
+
+	if err := f.Extract("data/file", file); err == nil {
+		t.Errorf("unexpected success with an existing destination")
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	if _, err := New(bytes.NewReader(make([]byte, 4096)), 4096); err == nil {
+		t.Errorf("unexpected success with an invalid image")
+	}
+	if _, err := New(bytes.NewReader([]byte("hsqs")), 4); err == nil {
+		t.Errorf("unexpected success with a truncated image")
+	}
+
+	// the super block claims more bytes than the image holds
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, superBlock{
+		Magic:        superMagic,
+		BlockSize:    1 << 17,
+		BlockLog:     17,
+		Compression:  1,
+		VersionMajor: 4,
+		BytesUsed:    1 << 62,
+	})
+	b.Write(make([]byte, 4096-b.Len()))
+	if _, err := New(bytes.NewReader(b.Bytes()), int64(b.Len())); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("unexpected error with a corrupted super block: %v", err)
+	}
+}
+
+func TestReadBlockSizes(t *testing.T) {
+	img := make([]byte, 4096)
+	f := &FS{
+		r:        bytes.NewReader(img),
+		size:     int64(len(img)),
+		sb:       superBlock{BlockSize: 1 << 17},
+		metadata: make(map[int64]*metadataBlock),
+	}
+
+	sizes := []byte{1, 0, 0, 0, 2, 0, 0, 0}
+	r := &metadataReader{f: f, data: sizes, next: int64(len(img))}
+	in := &inode{size: 1<<18 + 1, fragment: 0}
+	if err := f.readBlockSizes(r, in); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(in.blockSizes) != 2 || in.blockSizes[0] != 1 || in.blockSizes[1] != 2 {
+		t.Errorf("unexpected block sizes %v", in.blockSizes)
+	}
+
+	// an extended file inode claiming more blocks than the image holds
+	r = &metadataReader{f: f, data: sizes, next: 0}
+	in = &inode{size: 1 << 62, fragment: noFragment}
+	if err := f.readBlockSizes(r, in); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("unexpected error with a huge file size: %v", err)
+	}
+}
@@ -0,0 +1,276 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package imgdiff compares the root filesystems and the metadata of two
+// container images.
+package imgdiff
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hpcng/singularity/pkg/sylog"
+)
+
+// Kind is the kind of a file change.
+type Kind string
+
+const (
+	// Added is a file present only in the second image.
+	Added Kind = "added"
+	// Removed is a file present only in the first image.
+	Removed Kind = "removed"
+	// Modified is a file present in both images with a different type,
+	// mode, size, content or link target.
+	Modified Kind = "modified"
+)
+
+// FileInfo describes a file of a root filesystem.
+type FileInfo struct {
+	// Type is the file type: file, dir, symlink, fifo, socket, char or
+	// block.
+	Type string `json:"type"`
+	// Mode is the permission bits of the file, including the setuid,
+	// setgid and sticky bits.
+	Mode fs.FileMode `json:"mode"`
+	// Size is the size of regular files.
+	Size int64 `json:"size,omitempty"`
+	// Target is the target of symbolic links.
+	Target string `json:"target,omitempty"`
+}
+
+// FileChange is a file added, removed or modified between two root
+// filesystems.
+type FileChange struct {
+	// Path is the absolute path of the file in the container.
+	Path string `json:"path"`
+	// Kind is the kind of change.
+	Kind Kind `json:"kind"`
+	// Old is the file in the first image, nil for added files.
+	Old *FileInfo `json:"old,omitempty"`
+	// New is the file in the second image, nil for removed files.
+	New *FileInfo `json:"new,omitempty"`
+	// Content is true when the content of a regular file changed.
+	Content bool `json:"content,omitempty"`
+}
+
+// Diff holds the differences between two images.
+type Diff struct {
+	// Files are the files added, removed and modified in the second
+	// image.
+	Files []FileChange `json:"files"`
+	// Metadata are the metadata attributes which differ.
+	Metadata []MetadataChange `json:"metadata"`
+}
+
+// fileType returns the type name of the file mode m.
+func fileType(m fs.FileMode) string {
+	switch {
+	case m.IsDir():
+		return "dir"
+	case m&fs.ModeSymlink != 0:
+		return "symlink"
+	case m&fs.ModeNamedPipe != 0:
+		return "fifo"
+	case m&fs.ModeSocket != 0:
+		return "socket"
+	case m&fs.ModeCharDevice != 0:
+		return "char"
+	case m&fs.ModeDevice != 0:
+		return "block"
+	default:
+		return "file"
+	}
+}
+
+// FS is a root filesystem compared by Files.
+type FS interface {
+	fs.FS
+	// ReadLink returns the target of the symbolic link name.
+	ReadLink(name string) (string, error)
+}
+
+// dirFS is the FS of a host directory.
+type dirFS struct {
+	fs.FS
+	dir string
+}
+
+// ReadLink returns the target of the symbolic link name.
+func (d *dirFS) ReadLink(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return os.Readlink(filepath.Join(d.dir, filepath.FromSlash(name)))
+}
+
+// Dir returns the FS of the root filesystem directory dir, like a sandbox
+// image.
+func Dir(dir string) FS {
+	return &dirFS{FS: os.DirFS(dir), dir: dir}
+}
+
+// walk returns the files of the root filesystem fsys, indexed by their
+// absolute path in the container. Unreadable directories are skipped with
+// a warning.
+func walk(fsys FS) (map[string]FileInfo, error) {
+	files := make(map[string]FileInfo)
+
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if d != nil && d.IsDir() && path != "." {
+				sylog.Warningf("Skipping %s: %s", path, err)
+				return fs.SkipDir
+			}
+			return err
+		}
+		if path == "." {
+			return nil
+		}
+
+		// directory entries information don't follow symbolic links
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		info := FileInfo{
+			Type: fileType(fi.Mode()),
+			Mode: fi.Mode() & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky),
+		}
+		switch info.Type {
+		case "file":
+			info.Size = fi.Size()
+		case "symlink":
+			if info.Target, err = fsys.ReadLink(path); err != nil {
+				return err
+			}
+		}
+
+		files["/"+path] = info
+		return nil
+	})
+
+	return files, err
+}
+
+// sameContent returns whether the regular files name of the root
+// filesystems a and b have the same content.
+func sameContent(a, b FS, name string) (bool, error) {
+	fa, err := a.Open(name)
+	if err != nil {
+		return false, err
+	}
+	defer fa.Close()
+
+	fb, err := b.Open(name)
+	if err != nil {
+		return false, err
+	}
+	defer fb.Close()
+
+	bufA := make([]byte, 32*1024)
+	bufB := make([]byte, 32*1024)
+
+	for {
+		na, errA := io.ReadFull(fa, bufA)
+		nb, errB := io.ReadFull(fb, bufB)
+		if !bytes.Equal(bufA[:na], bufB[:nb]) {
+			return false, nil
+		}
+		if errA == io.EOF || errA == io.ErrUnexpectedEOF {
+			return errB == io.EOF || errB == io.ErrUnexpectedEOF, nil
+		} else if errA != nil {
+			return false, errA
+		} else if errB != nil && errB != io.EOF && errB != io.ErrUnexpectedEOF {
+			return false, errB
+		}
+	}
+}
+
+// Files compares the root filesystems a and b, and returns the files
+// added, removed and modified in b, sorted by path. Ownership and
+// modification times are not compared, as they are not preserved when
+// extracting images without privileges.
+func Files(a, b FS) ([]FileChange, error) {
+	filesA, err := walk(a)
+	if err != nil {
+		return nil, fmt.Errorf("while reading first image: %s", err)
+	}
+	filesB, err := walk(b)
+	if err != nil {
+		return nil, fmt.Errorf("while reading second image: %s", err)
+	}
+
+	var changes []FileChange
+
+	for path, oldInfo := range filesA {
+		oldInfo := oldInfo
+
+		newInfo, ok := filesB[path]
+		if !ok {
+			changes = append(changes, FileChange{Path: path, Kind: Removed, Old: &oldInfo})
+			continue
+		}
+
+		content := false
+		if oldInfo.Type == "file" && newInfo.Type == "file" && oldInfo.Size == newInfo.Size {
+			same, err := sameContent(a, b, path[1:])
+			if err != nil {
+				sylog.Warningf("Could not compare content of %s: %s", path, err)
+			}
+			content = err == nil && !same
+		}
+		if oldInfo != newInfo || content {
+			changes = append(changes, FileChange{Path: path, Kind: Modified, Old: &oldInfo, New: &newInfo, Content: content})
+		}
+	}
+
+	for path, newInfo := range filesB {
+		if _, ok := filesA[path]; !ok {
+			newInfo := newInfo
+			changes = append(changes, FileChange{Path: path, Kind: Added, New: &newInfo})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+
+	return changes, nil
+}
+
+// Details returns a short description of a modified file, listing the
+// attributes which changed.
+func (c FileChange) Details() string {
+	if c.Kind != Modified {
+		return ""
+	}
+
+	var details []string
+
+	if c.Old.Type != c.New.Type {
+		details = append(details, fmt.Sprintf("type %s -> %s", c.Old.Type, c.New.Type))
+	}
+	if c.Old.Mode != c.New.Mode {
+		details = append(details, fmt.Sprintf("mode %s -> %s", c.Old.Mode, c.New.Mode))
+	}
+	if c.Old.Size != c.New.Size {
+		details = append(details, fmt.Sprintf("size %d -> %d", c.Old.Size, c.New.Size))
+	} else if c.Content {
+		details = append(details, "content")
+	}
+	if c.Old.Target != c.New.Target {
+		details = append(details, fmt.Sprintf("target %s -> %s", c.Old.Target, c.New.Target))
+	}
+
+	return strings.Join(details, ", ")
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package imgdiff
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hpcng/singularity/pkg/inspect"
+)
+
+// createRootfs creates a root filesystem in a temporary directory with
+// the regular files files and the symbolic links links.
+func createRootfs(t *testing.T, files map[string]string, links map[string]string) string {
+	rootfs, err := ioutil.TempDir("", "imgdiff-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+
+	for name, content := range files {
+		path := filepath.Join(rootfs, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to create directory: %s", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write %s: %s", path, err)
+		}
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(rootfs, name)); err != nil {
+			t.Fatalf("failed to create symlink: %s", err)
+		}
+	}
+
+	return rootfs
+}
+
+func TestFiles(t *testing.T) {
+	rootA := createRootfs(t, map[string]string{
+		"etc/os-release": "ID=alpine\n",
+		"etc/removed":    "removed",
+		"bin/tool":       "version 1",
+		"bin/script":     "#!/bin/sh\n",
+		"usr/same":       "same",
+	}, map[string]string{
+		"bin/sh": "busybox",
+	})
+	defer os.RemoveAll(rootA)
+
+	rootB := createRootfs(t, map[string]string{
+		"etc/os-release": "ID=debian\n",
+		"etc/added":      "added",
+		"bin/tool":       "version 2",
+		"bin/script":     "#!/bin/sh\n",
+		"usr/same":       "same",
+	}, map[string]string{
+		"bin/sh": "dash",
+	})
+	defer os.RemoveAll(rootB)
+
+	if err := os.Chmod(filepath.Join(rootB, "bin/script"), 0o755); err != nil {
+		t.Fatalf("failed to change mode: %s", err)
+	}
+
+	changes, err := Files(Dir(rootA), Dir(rootB))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := []struct {
+		path    string
+		kind    Kind
+		details string
+	}{
+		{"/bin/script", Modified, "mode -rw-r--r-- -> -rwxr-xr-x"},
+		{"/bin/sh", Modified, "target busybox -> dash"},
+		{"/bin/tool", Modified, "content"},
+		{"/etc/added", Added, ""},
+		{"/etc/os-release", Modified, "content"},
+		{"/etc/removed", Removed, ""},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("unexpected changes: %+v", changes)
+	}
+	for i, w := range want {
+		c := changes[i]
+		if c.Path != w.path || c.Kind != w.kind || c.Details() != w.details {
+			t.Errorf("unexpected change: got %s %s (%s), want %s %s (%s)", c.Kind, c.Path, c.Details(), w.kind, w.path, w.details)
+		}
+	}
+}
+
+func TestFilesType(t *testing.T) {
+	rootA := createRootfs(t, map[string]string{"opt/app": "file"}, nil)
+	defer os.RemoveAll(rootA)
+
+	rootB := createRootfs(t, map[string]string{"opt/app/bin": "file"}, nil)
+	defer os.RemoveAll(rootB)
+
+	changes, err := Files(Dir(rootA), Dir(rootB))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("unexpected changes: %+v", changes)
+	}
+	if c := changes[0]; c.Path != "/opt/app" || c.Kind != Modified || c.Old.Type != "file" || c.New.Type != "dir" {
+		t.Errorf("unexpected change: %+v", c)
+	}
+	if c := changes[1]; c.Path != "/opt/app/bin" || c.Kind != Added {
+		t.Errorf("unexpected change: %+v", c)
+	}
+}
+
+func TestMetadataChanges(t *testing.T) {
+	a := inspect.NewMetadata()
+	a.Attributes.Labels["org.label-schema.build-date"] = "Monday"
+	a.Attributes.Labels["removed"] = "value"
+	a.Attributes.Environment["/.singularity.d/env/90-environment.sh"] = "export A=1"
+	a.Attributes.Runscript = "#!/bin/sh\nexec app\n"
+	a.Attributes.Deffile = "bootstrap: docker\nfrom: alpine\n"
+
+	b := inspect.NewMetadata()
+	b.Attributes.Labels["org.label-schema.build-date"] = "Tuesday"
+	b.Attributes.Labels["added"] = "value"
+	b.Attributes.Environment["/.singularity.d/env/90-environment.sh"] = "export A=1"
+	b.Attributes.Runscript = "#!/bin/sh\nexec app \"$@\"\n"
+
+	want := []MetadataChange{
+		{Field: FieldLabel, Key: "added", Kind: Added, New: "value"},
+		{Field: FieldLabel, Key: "org.label-schema.build-date", Kind: Modified, Old: "Monday", New: "Tuesday"},
+		{Field: FieldLabel, Key: "removed", Kind: Removed, Old: "value"},
+		{Field: FieldRunscript, Kind: Modified, Old: a.Attributes.Runscript, New: b.Attributes.Runscript},
+		{Field: FieldDeffile, Kind: Removed, Old: a.Attributes.Deffile},
+	}
+
+	if got := MetadataChanges(a, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected changes:\ngot  %+v\nwant %+v", got, want)
+	}
+	if got := MetadataChanges(a, a); len(got) != 0 {
+		t.Errorf("unexpected changes for identical metadata: %+v", got)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package imgdiff
+
+import (
+	"sort"
+
+	"github.com/hpcng/singularity/pkg/inspect"
+)
+
+// Metadata fields compared by MetadataChanges.
+const (
+	FieldLabel       = "label"
+	FieldEnvironment = "environment"
+	FieldRunscript   = "runscript"
+	FieldDeffile     = "deffile"
+)
+
+// MetadataChange is a metadata attribute which differs between two
+// images.
+type MetadataChange struct {
+	// Field is the metadata field: label, environment, runscript or
+	// deffile.
+	Field string `json:"field"`
+	// Key is the label name or the environment file path.
+	Key string `json:"key,omitempty"`
+	// Kind is the kind of change.
+	Kind Kind `json:"kind"`
+	// Old is the value in the first image.
+	Old string `json:"old,omitempty"`
+	// New is the value in the second image.
+	New string `json:"new,omitempty"`
+}
+
+// changeKind returns the kind of change of a value from a to b, and
+// whether they differ.
+func changeKind(a string, okA bool, b string, okB bool) (Kind, bool) {
+	switch {
+	case okA && !okB:
+		return Removed, true
+	case !okA && okB:
+		return Added, true
+	case a != b:
+		return Modified, true
+	}
+	return "", false
+}
+
+// mapChanges returns the changes of the map field between a and b, sorted
+// by key.
+func mapChanges(field string, a, b map[string]string) []MetadataChange {
+	keys := make(map[string]bool)
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	var changes []MetadataChange
+
+	for _, k := range sorted {
+		va, okA := a[k]
+		vb, okB := b[k]
+		if kind, ok := changeKind(va, okA, vb, okB); ok {
+			changes = append(changes, MetadataChange{Field: field, Key: k, Kind: kind, Old: va, New: vb})
+		}
+	}
+
+	return changes
+}
+
+// MetadataChanges compares the labels, environment, runscript and
+// definition file of the images metadata a and b.
+func MetadataChanges(a, b *inspect.Metadata) []MetadataChange {
+	changes := mapChanges(FieldLabel, a.Attributes.Labels, b.Attributes.Labels)
+	changes = append(changes, mapChanges(FieldEnvironment, a.Attributes.Environment, b.Attributes.Environment)...)
+
+	scripts := []struct {
+		field string
+		a, b  string
+	}{
+		{FieldRunscript, a.Attributes.Runscript, b.Attributes.Runscript},
+		{FieldDeffile, a.Attributes.Deffile, b.Attributes.Deffile},
+	}
+	for _, s := range scripts {
+		if kind, ok := changeKind(s.a, s.a != "", s.b, s.b != ""); ok {
+			changes = append(changes, MetadataChange{Field: s.field, Kind: kind, Old: s.a, New: s.b})
+		}
+	}
+
+	return changes
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// HealthStarting is the health status of an instance until its
+	// health check succeeds or fails too many times.
+	HealthStarting = "starting"
+	// HealthHealthy is the health status of an instance whose last
+	// health check succeeded.
+	HealthHealthy = "healthy"
+	// HealthUnhealthy is the health status of an instance whose health
+	// check failed too many times in a row.
+	HealthUnhealthy = "unhealthy"
+)
+
+const (
+	// HealthcheckPath is the path of the healthcheck script in images
+	// built with a %healthcheck section.
+	HealthcheckPath = "/.singularity.d/healthcheck"
+	// DefaultHealthInterval is the default interval between two health checks.
+	DefaultHealthInterval = 30 * time.Second
+	// DefaultHealthRetries is the default number of consecutive failed
+	// health checks for an instance to be unhealthy.
+	DefaultHealthRetries = 3
+)
+
+// HealthCheck describes how the health of an instance is checked.
+type HealthCheck struct {
+	// Cmd is the shell command run inside the instance, it exits
+	// with a non zero status if the instance is unhealthy.
+	Cmd string
+	// Interval is the interval between two checks, a check running
+	// longer is considered as failed.
+	Interval time.Duration
+	// Retries is the number of consecutive failed checks for the
+	// instance to be unhealthy.
+	Retries int
+}
+
+// Check returns an error if the health check is invalid.
+func (h HealthCheck) Check() error {
+	if h.Interval <= 0 {
+		return fmt.Errorf("invalid health check interval %s: must be positive", h.Interval)
+	}
+	if h.Retries < 1 {
+		return fmt.Errorf("invalid health check retries %d: must be at least 1", h.Retries)
+	}
+	return nil
+}
+
+// Args returns the command line running the health check.
+func (h HealthCheck) Args() []string {
+	return []string{"/bin/sh", "-c", h.Cmd}
+}
+
+// HealthState tracks the health status of an instance across checks.
+type HealthState struct {
+	// Status is one of HealthStarting, HealthHealthy or HealthUnhealthy.
+	Status string
+	// Failures is the number of consecutive failed checks.
+	Failures int
+}
+
+// NewHealthState returns the health state of an instance not checked yet.
+func NewHealthState() *HealthState {
+	return &HealthState{Status: HealthStarting}
+}
+
+// Update updates the health state with the result of a check and returns
+// whether the status changed. The status only becomes unhealthy after
+// retries consecutive failures.
+func (s *HealthState) Update(ok bool, retries int) bool {
+	status := s.Status
+
+	if ok {
+		s.Failures = 0
+		s.Status = HealthHealthy
+	} else {
+		s.Failures++
+		if s.Failures >= retries {
+			s.Status = HealthUnhealthy
+		}
+	}
+
+	return status != s.Status
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHealthCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		check       HealthCheck
+		expectError bool
+	}{
+		{"Default", HealthCheck{Cmd: "true", Interval: DefaultHealthInterval, Retries: DefaultHealthRetries}, false},
+		{"NoInterval", HealthCheck{Cmd: "true", Retries: 1}, true},
+		{"NegativeInterval", HealthCheck{Cmd: "true", Interval: -time.Second, Retries: 1}, true},
+		{"NoRetries", HealthCheck{Cmd: "true", Interval: time.Second}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.check.Check()
+			if tt.expectError && err == nil {
+				t.Errorf("unexpected success")
+			} else if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestHealthState(t *testing.T) {
+	const retries = 2
+
+	steps := []struct {
+		ok       bool
+		status   string
+		changed  bool
+		failures int
+	}{
+		{false, HealthStarting, false, 1},
+		{true, HealthHealthy, true, 0},
+		{false, HealthHealthy, false, 1},
+		{false, HealthUnhealthy, true, 2},
+		{false, HealthUnhealthy, false, 3},
+		{true, HealthHealthy, true, 0},
+	}
+
+	s := NewHealthState()
+	for i, step := range steps {
+		changed := s.Update(step.ok, retries)
+		if changed != step.changed {
+			t.Errorf("step %d: unexpected status change %v", i, changed)
+		}
+		if s.Status != step.status {
+			t.Errorf("step %d: unexpected status %s, expected %s", i, s.Status, step.status)
+		}
+		if s.Failures != step.failures {
+			t.Errorf("step %d: unexpected failures %d, expected %d", i, s.Failures, step.failures)
+		}
+	}
+}
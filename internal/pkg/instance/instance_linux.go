@@ -50,6 +50,17 @@ type File struct {
 	IP         string `json:"ip"`
 	LogErrPath string `json:"logErrPath"`
 	LogOutPath string `json:"logOutPath"`
+	// Restart is the restart policy of the instance.
+	Restart string `json:"restart,omitempty"`
+	// Restarts is the number of times the instance was restarted.
+	Restarts int `json:"restarts,omitempty"`
+	// SupervisorPid is the PID of the process restarting the instance.
+	SupervisorPid int `json:"supervisorPid,omitempty"`
+	// SupervisorStartTime is the start time of the supervisor process
+	// in clock ticks after boot, to check its PID was not reused.
+	SupervisorStartTime uint64 `json:"supervisorStartTime,omitempty"`
+	// Health is the health status of the instance, if it has a health check.
+	Health string `json:"health,omitempty"`
 }
 
 // ProcName returns processus name based on instance name
@@ -0,0 +1,230 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// jsonLogRegexp matches lines written by the JSON log formatter, it's used
+// when a line can't be decoded because the logged data were not escaped.
+var jsonLogRegexp = regexp.MustCompile(`^\{"time":"([^"]*)","stream":"([^"]*)","log":"(.*)"\}$`)
+
+// LogEntry represents a line of an instance log file.
+type LogEntry struct {
+	// Time is the time the line was logged, it is zero for lines
+	// which were not written by a log formatter.
+	Time time.Time
+	// Stream is the stream the line was logged from (e.g. stdout).
+	Stream string
+	// Data is the logged data.
+	Data string
+}
+
+// DetectLogFormat returns the log format of a line written by one of the
+// LogFormats formatters, from its time and stream prefix, or an empty string
+// if the line was not written by a formatter. The prefixes of basic lines
+// with a stream and of kubernetes lines only differ by the kubernetes tag,
+// so the format of a log file must be detected once from its first line.
+func DetectLogFormat(line string) string {
+	if strings.HasPrefix(line, `{"time":"`) {
+		return JSONLogFormat
+	}
+
+	fields := strings.SplitN(line, " ", 4)
+	if _, err := time.Parse(time.RFC3339Nano, fields[0]); err != nil {
+		return ""
+	}
+	// kubernetes: <time> <stream> <F|P> <data>
+	if len(fields) >= 3 && isLogStream(fields[1]) && (fields[2] == "F" || fields[2] == "P") {
+		return KubernetesLogFormat
+	}
+	return BasicLogFormat
+}
+
+func isLogStream(s string) bool {
+	return s == "stdout" || s == "stderr"
+}
+
+// ParseLogLine parses a log line written by the LogFormats formatter format,
+// the format is detected from the line if empty. Lines which are not
+// recognized are returned as is, without time, and with the default stream.
+func ParseLogLine(line, format, stream string) LogEntry {
+	entry := LogEntry{Stream: stream, Data: line}
+
+	if format == "" {
+		format = DetectLogFormat(line)
+	}
+
+	if format == JSONLogFormat {
+		var l struct {
+			Time   time.Time `json:"time"`
+			Stream string    `json:"stream"`
+			Log    string    `json:"log"`
+		}
+		if err := json.Unmarshal([]byte(line), &l); err == nil {
+			return logEntry(l.Time, l.Stream, l.Log, stream)
+		}
+		if m := jsonLogRegexp.FindStringSubmatch(line); m != nil {
+			if t, err := time.Parse(time.RFC3339Nano, m[1]); err == nil {
+				return logEntry(t, m[2], m[3], stream)
+			}
+		}
+		return entry
+	} else if format != KubernetesLogFormat && format != BasicLogFormat {
+		return entry
+	}
+
+	fields := strings.SplitN(line, " ", 2)
+	t, err := time.Parse(time.RFC3339Nano, fields[0])
+	if err != nil {
+		return entry
+	}
+	if len(fields) == 1 {
+		return logEntry(t, "", "", stream)
+	}
+
+	if format == KubernetesLogFormat {
+		// kubernetes: <time> <stream> <F|P> <data>
+		fields = strings.SplitN(fields[1], " ", 3)
+		if len(fields) < 2 || !isLogStream(fields[0]) || (fields[1] != "F" && fields[1] != "P") {
+			return entry
+		}
+		data := ""
+		if len(fields) == 3 {
+			data = fields[2]
+		}
+		return logEntry(t, fields[0], data, stream)
+	}
+
+	// basic: <time> [<stream>] <data>
+	fields = strings.SplitN(fields[1], " ", 2)
+	if isLogStream(fields[0]) {
+		return logEntry(t, fields[0], strings.Join(fields[1:], " "), stream)
+	}
+	return logEntry(t, "", strings.Join(fields, " "), stream)
+}
+
+func logEntry(t time.Time, stream, data, defaultStream string) LogEntry {
+	if stream == "" {
+		stream = defaultStream
+	}
+	return LogEntry{Time: t, Stream: stream, Data: data}
+}
+
+// LogFile reads the entries of an instance log file incrementally.
+type LogFile struct {
+	// Path is the path of the log file.
+	Path string
+	// Stream is the stream of entries which don't record one.
+	Stream string
+	// Format is the log format of the file. If empty, it is detected
+	// from the first line written by a formatter, as all lines of a
+	// file are written with the same format.
+	Format string
+
+	offset  int64
+	partial []byte
+}
+
+// ReadEntries returns the entries written in the log file since the previous
+// call. An incomplete last line is kept until it is terminated. If the file was
+// truncated (e.g. by log rotation), it's read from the beginning.
+func (f *LogFile) ReadEntries() ([]LogEntry, error) {
+	fp, err := os.Open(f.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	fi, err := fp.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() < f.offset {
+		f.offset = 0
+		f.partial = nil
+	}
+
+	if _, err := fp.Seek(f.offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadAll(fp)
+	if err != nil {
+		return nil, err
+	}
+	f.offset += int64(len(data))
+
+	data = append(f.partial, data...)
+
+	var entries []LogEntry
+
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		line := string(data[:i])
+		if f.Format == "" {
+			f.Format = DetectLogFormat(line)
+		}
+		entries = append(entries, ParseLogLine(line, f.Format, f.Stream))
+		data = data[i+1:]
+	}
+	f.partial = append([]byte(nil), data...)
+
+	return entries, nil
+}
+
+// FilterLogEntries returns the entries logged at or after since, limited to
+// the tail last entries if tail is not negative. Entries without time are never
+// filtered out by since.
+func FilterLogEntries(entries []LogEntry, since time.Time, tail int) []LogEntry {
+	filtered := entries[:0:0]
+
+	for _, e := range entries {
+		if !since.IsZero() && !e.Time.IsZero() && e.Time.Before(since) {
+			continue
+		}
+		filtered = append(filtered, e)
+	}
+
+	if tail >= 0 && len(filtered) > tail {
+		filtered = filtered[len(filtered)-tail:]
+	}
+
+	return filtered
+}
+
+// MergeLogEntries merges entries of two log files in chronological order.
+// As the order of entries without time can't be determined, entries of a
+// are returned first in this case.
+func MergeLogEntries(a, b []LogEntry) []LogEntry {
+	merged := make([]LogEntry, 0, len(a)+len(b))
+
+	for len(a) > 0 && len(b) > 0 {
+		if !a[0].Time.IsZero() && !b[0].Time.IsZero() && b[0].Time.Before(a[0].Time) {
+			merged = append(merged, b[0])
+			b = b[1:]
+		} else {
+			merged = append(merged, a[0])
+			a = a[1:]
+		}
+	}
+	merged = append(merged, a...)
+
+	return append(merged, b...)
+}
@@ -0,0 +1,252 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLogLine(t *testing.T) {
+	logTime := time.Date(2021, 6, 1, 10, 30, 0, 123, time.UTC)
+
+	tests := []struct {
+		name     string
+		line     string
+		format   string
+		hasTime  bool
+		expected LogEntry
+	}{
+		{
+			name:     "Raw",
+			line:     "server started",
+			expected: LogEntry{Stream: "stdout", Data: "server started"},
+		},
+		{
+			name:     "RawBrace",
+			line:     "{not json",
+			expected: LogEntry{Stream: "stdout", Data: "{not json"},
+		},
+		{
+			name:     "Basic",
+			hasTime:  true,
+			line:     strings.TrimSuffix(basicLogFormatter("stderr", "error message"), "\n"),
+			expected: LogEntry{Stream: "stderr", Data: "error message"},
+		},
+		{
+			name:     "BasicNoStream",
+			hasTime:  true,
+			line:     strings.TrimSuffix(basicLogFormatter("", "hello world"), "\n"),
+			expected: LogEntry{Stream: "stdout", Data: "hello world"},
+		},
+		{
+			name:     "BasicTagged",
+			format:   BasicLogFormat,
+			hasTime:  true,
+			line:     strings.TrimSuffix(basicLogFormatter("stdout", "F message"), "\n"),
+			expected: LogEntry{Stream: "stdout", Data: "F message"},
+		},
+		{
+			name:     "BasicNoStreamTagged",
+			hasTime:  true,
+			line:     strings.TrimSuffix(basicLogFormatter("", "P message"), "\n"),
+			expected: LogEntry{Stream: "stdout", Data: "P message"},
+		},
+		{
+			name:     "BasicRawKubernetes",
+			format:   KubernetesLogFormat,
+			line:     "not a kubernetes line",
+			expected: LogEntry{Stream: "stdout", Data: "not a kubernetes line"},
+		},
+		{
+			name:     "Kubernetes",
+			hasTime:  true,
+			line:     strings.TrimSuffix(kubernetesLogFormatter("stderr", "error F message"), "\n"),
+			expected: LogEntry{Stream: "stderr", Data: "error F message"},
+		},
+		{
+			name:     "KubernetesEmpty",
+			hasTime:  true,
+			line:     strings.TrimSuffix(kubernetesLogFormatter("stderr", ""), "\n"),
+			expected: LogEntry{Stream: "stderr", Data: ""},
+		},
+		{
+			name:     "JSON",
+			hasTime:  true,
+			line:     strings.TrimSuffix(jsonLogFormatter("stderr", "error message"), "\n"),
+			expected: LogEntry{Stream: "stderr", Data: "error message"},
+		},
+		{
+			name:     "JSONUnescaped",
+			hasTime:  true,
+			line:     strings.TrimSuffix(jsonLogFormatter("stderr", `say "hello"`), "\n"),
+			expected: LogEntry{Stream: "stderr", Data: `say "hello"`},
+		},
+		{
+			name:     "Timestamp",
+			hasTime:  true,
+			line:     logTime.Format(time.RFC3339Nano) + " stdout F hello",
+			expected: LogEntry{Time: logTime, Stream: "stdout", Data: "hello"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := ParseLogLine(tt.line, tt.format, "stdout")
+			if tt.hasTime == e.Time.IsZero() {
+				t.Errorf("unexpected time %s parsed from %q", e.Time, tt.line)
+			}
+			// formatters log the current time
+			if tt.expected.Time.IsZero() {
+				e.Time = time.Time{}
+			}
+			if !reflect.DeepEqual(e, tt.expected) {
+				t.Errorf("unexpected entry: got %+v, expected %+v", e, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLogFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "log-")
+	if err != nil {
+		t.Fatalf("failed to create temporary log file: %s", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	lf := &LogFile{Path: f.Name(), Stream: "stdout"}
+
+	read := func(expected ...string) {
+		t.Helper()
+
+		entries, err := lf.ReadEntries()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		var data []string
+		for _, e := range entries {
+			data = append(data, e.Data)
+		}
+		if !reflect.DeepEqual(data, expected) {
+			t.Errorf("unexpected entries: got %q, expected %q", data, expected)
+		}
+	}
+
+	f.WriteString("first\nsec")
+	read("first")
+
+	f.WriteString("ond\nthird\n")
+	read("second", "third")
+	read()
+
+	// truncation
+	f.Truncate(0)
+	f.Seek(0, 0)
+	f.WriteString("new\n")
+	read("new")
+}
+
+func TestLogFileFormat(t *testing.T) {
+	f, err := ioutil.TempFile("", "log-")
+	if err != nil {
+		t.Fatalf("failed to create temporary log file: %s", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	// basic lines whose data looks like a kubernetes tag
+	f.WriteString(basicLogFormatter("stdout", "first"))
+	f.WriteString(basicLogFormatter("stderr", "F second"))
+	f.WriteString(basicLogFormatter("stdout", "P third"))
+
+	lf := &LogFile{Path: f.Name(), Stream: "stdout"}
+	entries, err := lf.ReadEntries()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if lf.Format != BasicLogFormat {
+		t.Errorf("unexpected detected format %q", lf.Format)
+	}
+
+	var data []string
+	for _, e := range entries {
+		data = append(data, e.Stream+" "+e.Data)
+	}
+	expected := []string{"stdout first", "stderr F second", "stdout P third"}
+	if !reflect.DeepEqual(data, expected) {
+		t.Errorf("unexpected entries: got %q, expected %q", data, expected)
+	}
+}
+
+func TestFilterMergeLogEntries(t *testing.T) {
+	now := time.Now()
+
+	out := []LogEntry{
+		{Time: now.Add(-3 * time.Minute), Data: "out1"},
+		{Time: now.Add(-1 * time.Minute), Data: "out2"},
+	}
+	err := []LogEntry{
+		{Time: now.Add(-4 * time.Minute), Data: "err1"},
+		{Time: now.Add(-2 * time.Minute), Data: "err2"},
+		{Data: "err3"},
+	}
+
+	data := func(entries []LogEntry) []string {
+		var d []string
+		for _, e := range entries {
+			d = append(d, e.Data)
+		}
+		return d
+	}
+
+	tests := []struct {
+		name     string
+		since    time.Time
+		tail     int
+		expected []string
+	}{
+		{
+			name:     "All",
+			tail:     -1,
+			expected: []string{"err1", "out1", "err2", "out2", "err3"},
+		},
+		{
+			name:     "Since",
+			since:    now.Add(-150 * time.Second),
+			tail:     -1,
+			expected: []string{"err2", "out2", "err3"},
+		},
+		{
+			name:     "Tail",
+			tail:     1,
+			expected: []string{"err3"},
+		},
+		{
+			name:     "TailInterleaved",
+			tail:     3,
+			expected: []string{"err2", "out2", "err3"},
+		},
+		{
+			name:     "TailZero",
+			tail:     0,
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filtered := FilterLogEntries(MergeLogEntries(out, err), tt.since, tt.tail)
+			if d := data(filtered); !reflect.DeepEqual(d, tt.expected) {
+				t.Errorf("unexpected entries: got %q, expected %q", d, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// RestartNo never restarts an instance.
+	RestartNo = "no"
+	// RestartOnFailure restarts an instance exiting with a non zero status.
+	RestartOnFailure = "on-failure"
+	// RestartAlways restarts an instance whatever its exit status.
+	RestartAlways = "always"
+)
+
+// RestartPolicy determines if an instance is restarted when its
+// process exits.
+type RestartPolicy struct {
+	// Mode is one of RestartNo, RestartOnFailure or RestartAlways.
+	Mode string
+	// MaxRetries is the maximum number of restarts for the
+	// RestartOnFailure mode, 0 means no limit.
+	MaxRetries int
+}
+
+// ParseRestartPolicy parses a restart policy of the form
+// no|on-failure[:N]|always. An empty string is the same as "no".
+func ParseRestartPolicy(s string) (RestartPolicy, error) {
+	p := RestartPolicy{Mode: RestartNo}
+
+	if s == "" {
+		return p, nil
+	}
+
+	mode := s
+	retries := ""
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		mode = s[:i]
+		retries = s[i+1:]
+	}
+
+	switch mode {
+	case RestartNo, RestartAlways:
+		if retries != "" {
+			return p, fmt.Errorf("maximum restart count is only supported by the %s policy", RestartOnFailure)
+		}
+	case RestartOnFailure:
+		if retries != "" {
+			n, err := strconv.Atoi(retries)
+			if err != nil || n < 0 {
+				return p, fmt.Errorf("invalid maximum restart count %q", retries)
+			}
+			p.MaxRetries = n
+		}
+	default:
+		return p, fmt.Errorf("unknown restart policy %q, must be one of %s, %s[:N] or %s", mode, RestartNo, RestartOnFailure, RestartAlways)
+	}
+
+	p.Mode = mode
+	return p, nil
+}
+
+// String returns the string representation of the restart policy.
+func (p RestartPolicy) String() string {
+	if p.Mode == RestartOnFailure && p.MaxRetries > 0 {
+		return fmt.Sprintf("%s:%d", p.Mode, p.MaxRetries)
+	}
+	if p.Mode == "" {
+		return RestartNo
+	}
+	return p.Mode
+}
+
+// ShouldRestart returns whether an instance which was already restarted
+// restarts times must be restarted after exiting with exitCode.
+func (p RestartPolicy) ShouldRestart(exitCode int, restarts int) bool {
+	switch p.Mode {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		if exitCode == 0 {
+			return false
+		}
+		return p.MaxRetries == 0 || restarts < p.MaxRetries
+	default:
+		return false
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"testing"
+)
+
+func TestParseRestartPolicy(t *testing.T) {
+	tests := []struct {
+		policy      string
+		expected    RestartPolicy
+		expectError bool
+	}{
+		{policy: "", expected: RestartPolicy{Mode: RestartNo}},
+		{policy: "no", expected: RestartPolicy{Mode: RestartNo}},
+		{policy: "always", expected: RestartPolicy{Mode: RestartAlways}},
+		{policy: "on-failure", expected: RestartPolicy{Mode: RestartOnFailure}},
+		{policy: "on-failure:3", expected: RestartPolicy{Mode: RestartOnFailure, MaxRetries: 3}},
+		{policy: "on-failure:-1", expectError: true},
+		{policy: "on-failure:x", expectError: true},
+		{policy: "always:3", expectError: true},
+		{policy: "sometimes", expectError: true},
+	}
+
+	for _, tt := range tests {
+		p, err := ParseRestartPolicy(tt.policy)
+		if tt.expectError && err == nil {
+			t.Errorf("unexpected success while parsing %q", tt.policy)
+		} else if !tt.expectError && err != nil {
+			t.Errorf("unexpected error while parsing %q: %s", tt.policy, err)
+		} else if !tt.expectError && p != tt.expected {
+			t.Errorf("unexpected policy for %q: got %+v, expected %+v", tt.policy, p, tt.expected)
+		}
+	}
+}
+
+func TestShouldRestart(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   RestartPolicy
+		exitCode int
+		restarts int
+		expected bool
+	}{
+		{"NoFailure", RestartPolicy{Mode: RestartNo}, 1, 0, false},
+		{"AlwaysSuccess", RestartPolicy{Mode: RestartAlways}, 0, 10, true},
+		{"OnFailureSuccess", RestartPolicy{Mode: RestartOnFailure}, 0, 0, false},
+		{"OnFailureFailure", RestartPolicy{Mode: RestartOnFailure}, 137, 100, true},
+		{"OnFailureRetries", RestartPolicy{Mode: RestartOnFailure, MaxRetries: 3}, 1, 2, true},
+		{"OnFailureMaxRetries", RestartPolicy{Mode: RestartOnFailure, MaxRetries: 3}, 1, 3, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if r := tt.policy.ShouldRestart(tt.exitCode, tt.restarts); r != tt.expected {
+				t.Errorf("unexpected restart decision: got %v, expected %v", r, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package ocisif
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hpcng/singularity/internal/pkg/util/env"
+	"github.com/hpcng/singularity/internal/pkg/util/shell/interpreter"
+	"github.com/hpcng/singularity/pkg/inspect"
+	"github.com/hpcng/singularity/pkg/sylog"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	// RunscriptPath is the path of the runscript within the container
+	// used as entrypoint for converted images.
+	RunscriptPath = "/.singularity.d/runscript"
+
+	// DeffileLabel is the label holding the definition file used to
+	// build the image.
+	DeffileLabel = "org.sylabs.singularity.deffile"
+
+	// ociRunscriptMarker is present in runscripts generated during
+	// the build of an image from an OCI source.
+	ociRunscriptMarker = "OCI_ENTRYPOINT="
+)
+
+// ImageConfig returns the OCI image configuration corresponding to the
+// container metadata. The optional base configuration is the OCI image
+// configuration stored in images built from an OCI source, its entrypoint
+// and command are kept as long as the runscript generated from them was not
+// replaced. The definition file is stored in the DeffileLabel label.
+func ImageConfig(metadata *inspect.Metadata, base *ocispec.ImageConfig) ocispec.ImageConfig {
+	config := ocispec.ImageConfig{}
+	if base != nil {
+		config = *base
+	}
+
+	attributes := metadata.Attributes
+
+	if base == nil || !strings.Contains(attributes.Runscript, ociRunscriptMarker) {
+		config.Entrypoint = nil
+		config.Cmd = nil
+		if attributes.Runscript != "" {
+			config.Entrypoint = []string{RunscriptPath}
+		}
+	}
+
+	environment, err := evaluateEnvironment(attributes.Environment)
+	if err != nil {
+		sylog.Warningf("Environment variables from the container won't be set in the image configuration: %s", err)
+	}
+	config.Env = withDefaultPath(environment)
+
+	if len(attributes.Labels) > 0 || attributes.Deffile != "" {
+		labels := make(map[string]string, len(config.Labels)+len(attributes.Labels)+1)
+		for k, v := range config.Labels {
+			labels[k] = v
+		}
+		for k, v := range attributes.Labels {
+			labels[k] = v
+		}
+		if attributes.Deffile != "" {
+			labels[DeffileLabel] = attributes.Deffile
+		}
+		config.Labels = labels
+	}
+
+	return config
+}
+
+// evaluateEnvironment returns the environment variables set by the
+// container environment scripts, scripts are evaluated in the same
+// order as they are sourced at runtime.
+func evaluateEnvironment(scripts map[string]string) ([]string, error) {
+	names := make([]string, 0, len(scripts))
+	for name := range scripts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return filepath.Base(names[i]) < filepath.Base(names[j])
+	})
+
+	var script strings.Builder
+	for _, name := range names {
+		script.WriteString(scripts[name])
+		script.WriteString("\n")
+	}
+
+	environment, err := interpreter.EvaluateEnv([]byte(script.String()), nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("while evaluating container environment: %s", err)
+	}
+
+	// the interpreter sets some variables on its own (eg: HOME, PWD),
+	// drop them unless they were modified by the scripts
+	shellEnv, err := interpreter.EvaluateEnv(nil, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("while evaluating shell environment: %s", err)
+	}
+	shellVars := make(map[string]bool, len(shellEnv))
+	for _, e := range shellEnv {
+		shellVars[e] = true
+	}
+
+	containerEnv := make([]string, 0, len(environment))
+	for _, e := range environment {
+		if !shellVars[e] {
+			containerEnv = append(containerEnv, e)
+		}
+	}
+
+	return containerEnv, nil
+}
+
+// withDefaultPath appends the default PATH to the environment if not set.
+func withDefaultPath(environment []string) []string {
+	for _, e := range environment {
+		if strings.HasPrefix(e, "PATH=") {
+			return environment
+		}
+	}
+	return append(environment, "PATH="+env.DefaultPath)
+}
+
+// RootfsMetadata returns the container metadata found in the
+// .singularity.d directory of the root filesystem.
+func RootfsMetadata(rootfs fs.FS) (*inspect.Metadata, error) {
+	metadata := inspect.NewMetadata()
+	attributes := &metadata.Attributes
+
+	readFile := func(name string) (string, error) {
+		b, err := fs.ReadFile(rootfs, path.Join(".singularity.d", name))
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", nil
+		}
+		return string(b), err
+	}
+
+	labels, err := readFile("labels.json")
+	if err != nil {
+		return nil, err
+	} else if labels != "" {
+		if err := json.Unmarshal([]byte(labels), &attributes.Labels); err != nil {
+			return nil, fmt.Errorf("while parsing labels: %s", err)
+		}
+	}
+
+	if attributes.Runscript, err = readFile("runscript"); err != nil {
+		return nil, err
+	}
+	if attributes.Deffile, err = readFile("Singularity"); err != nil {
+		return nil, err
+	}
+
+	for _, pattern := range []string{"env/10-docker*.sh", "env/9*-environment.sh"} {
+		matches, err := fs.Glob(rootfs, path.Join(".singularity.d", pattern))
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			b, err := fs.ReadFile(rootfs, m)
+			if err != nil {
+				return nil, err
+			}
+			attributes.Environment["/"+m] = string(b)
+		}
+	}
+
+	return metadata, nil
+}
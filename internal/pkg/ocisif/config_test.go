@@ -0,0 +1,193 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package ocisif
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hpcng/singularity/internal/pkg/util/env"
+	"github.com/hpcng/singularity/pkg/inspect"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const ociRunscript = `#!/bin/sh
+OCI_ENTRYPOINT='"/bin/server"'
+OCI_CMD=''
+`
+
+func TestImageConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		attributes  inspect.Attributes
+		base        *ocispec.ImageConfig
+		expectedCfg ocispec.ImageConfig
+	}{
+		{
+			name:       "Empty",
+			attributes: inspect.Attributes{},
+			expectedCfg: ocispec.ImageConfig{
+				Env: []string{"PATH=" + env.DefaultPath},
+			},
+		},
+		{
+			name: "Runscript",
+			attributes: inspect.Attributes{
+				Runscript: "#!/bin/sh\necho hello\n",
+				Labels: map[string]string{
+					"org.label-schema.schema-version": "1.0",
+				},
+				Environment: map[string]string{
+					"/.singularity.d/env/90-environment.sh": "export PATH=/opt/bin:/bin\nexport FOO=bar\n",
+				},
+			},
+			expectedCfg: ocispec.ImageConfig{
+				Entrypoint: []string{RunscriptPath},
+				Env:        []string{"FOO=bar", "PATH=/opt/bin:/bin"},
+				Labels: map[string]string{
+					"org.label-schema.schema-version": "1.0",
+				},
+			},
+		},
+		{
+			name: "EnvironmentOrder",
+			attributes: inspect.Attributes{
+				Environment: map[string]string{
+					"/.singularity.d/env/90-environment.sh":        "export FOO=bar\n",
+					"/.singularity.d/env/10-docker2singularity.sh": "export FOO=\"${FOO:-docker}\"\nexport BAR=docker\n",
+				},
+			},
+			expectedCfg: ocispec.ImageConfig{
+				Env: []string{"BAR=docker", "FOO=bar", "PATH=" + env.DefaultPath},
+			},
+		},
+		{
+			name: "OCIBase",
+			attributes: inspect.Attributes{
+				Runscript: ociRunscript,
+				Labels: map[string]string{
+					"maintainer": "singularity",
+				},
+			},
+			base: &ocispec.ImageConfig{
+				Entrypoint: []string{"/bin/server"},
+				Cmd:        []string{"--port", "8080"},
+				WorkingDir: "/srv",
+				Labels: map[string]string{
+					"maintainer": "docker",
+					"version":    "1.0",
+				},
+			},
+			expectedCfg: ocispec.ImageConfig{
+				Entrypoint: []string{"/bin/server"},
+				Cmd:        []string{"--port", "8080"},
+				WorkingDir: "/srv",
+				Env:        []string{"PATH=" + env.DefaultPath},
+				Labels: map[string]string{
+					"maintainer": "singularity",
+					"version":    "1.0",
+				},
+			},
+		},
+		{
+			name: "Deffile",
+			attributes: inspect.Attributes{
+				Deffile: "bootstrap: docker\nfrom: alpine\n",
+				Labels: map[string]string{
+					"version": "1.0",
+				},
+			},
+			expectedCfg: ocispec.ImageConfig{
+				Env: []string{"PATH=" + env.DefaultPath},
+				Labels: map[string]string{
+					"version":    "1.0",
+					DeffileLabel: "bootstrap: docker\nfrom: alpine\n",
+				},
+			},
+		},
+		{
+			name: "OCIBaseReplacedRunscript",
+			attributes: inspect.Attributes{
+				Runscript: "#!/bin/sh\nexec /bin/other\n",
+			},
+			base: &ocispec.ImageConfig{
+				Entrypoint: []string{"/bin/server"},
+				Cmd:        []string{"--port", "8080"},
+			},
+			expectedCfg: ocispec.ImageConfig{
+				Entrypoint: []string{RunscriptPath},
+				Env:        []string{"PATH=" + env.DefaultPath},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata := inspect.NewMetadata()
+			metadata.Attributes = tt.attributes
+
+			cfg := ImageConfig(metadata, tt.base)
+			if !reflect.DeepEqual(cfg, tt.expectedCfg) {
+				t.Errorf("unexpected image config: got %+v, expected %+v", cfg, tt.expectedCfg)
+			}
+		})
+	}
+}
+
+func TestRootfsMetadata(t *testing.T) {
+	rootfs, err := ioutil.TempDir("", "rootfs-")
+	if err != nil {
+		t.Fatalf("while creating temporary directory: %s", err)
+	}
+	defer os.RemoveAll(rootfs)
+
+	files := map[string]string{
+		".singularity.d/labels.json":                  `{"version": "1.0"}`,
+		".singularity.d/runscript":                    "#!/bin/sh\necho hello\n",
+		".singularity.d/Singularity":                  "bootstrap: docker\nfrom: alpine\n",
+		".singularity.d/env/01-base.sh":               "export IGNORED=1\n",
+		".singularity.d/env/10-docker2singularity.sh": "export BAR=docker\n",
+		".singularity.d/env/90-environment.sh":        "export FOO=bar\n",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(rootfs, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("while creating directory: %s", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("while writing %s: %s", path, err)
+		}
+	}
+
+	metadata, err := RootfsMetadata(os.DirFS(rootfs))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	attributes := metadata.Attributes
+
+	if attributes.Labels["version"] != "1.0" {
+		t.Errorf("unexpected labels: %v", attributes.Labels)
+	}
+	if attributes.Runscript != files[".singularity.d/runscript"] {
+		t.Errorf("unexpected runscript: %q", attributes.Runscript)
+	}
+	if attributes.Deffile != files[".singularity.d/Singularity"] {
+		t.Errorf("unexpected deffile: %q", attributes.Deffile)
+	}
+
+	expectedEnv := map[string]string{
+		"/.singularity.d/env/10-docker2singularity.sh": files[".singularity.d/env/10-docker2singularity.sh"],
+		"/.singularity.d/env/90-environment.sh":        files[".singularity.d/env/90-environment.sh"],
+	}
+	if !reflect.DeepEqual(attributes.Environment, expectedEnv) {
+		t.Errorf("unexpected environment: got %v, expected %v", attributes.Environment, expectedEnv)
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package ocisif
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/hpcng/singularity/pkg/sylog"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// LayoutTag is the tag of the image written in the OCI layout.
+const LayoutTag = "latest"
+
+// writeLayout writes an OCI image layout in dir containing a single image
+// tagged with LayoutTag, the image is composed of one layer holding the
+// content of rootfs and of the image configuration config. The diff ID
+// of the layer is added to config.
+func writeLayout(dir, rootfs string, config *ocispec.Image) error {
+	blobsDir := filepath.Join(dir, "blobs", digest.Canonical.String())
+	if err := os.MkdirAll(blobsDir, 0o755); err != nil {
+		return err
+	}
+
+	layerDesc, diffID, err := writeLayerBlob(blobsDir, rootfs)
+	if err != nil {
+		return fmt.Errorf("while creating layer: %s", err)
+	}
+	config.RootFS.DiffIDs = []digest.Digest{diffID}
+
+	configDesc, err := writeJSONBlob(blobsDir, ocispec.MediaTypeImageConfig, config)
+	if err != nil {
+		return fmt.Errorf("while writing image configuration: %s", err)
+	}
+
+	manifest := ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Config:    configDesc,
+		Layers:    []ocispec.Descriptor{layerDesc},
+	}
+	manifestDesc, err := writeJSONBlob(blobsDir, ocispec.MediaTypeImageManifest, manifest)
+	if err != nil {
+		return fmt.Errorf("while writing image manifest: %s", err)
+	}
+	manifestDesc.Annotations = map[string]string{
+		ocispec.AnnotationRefName: LayoutTag,
+	}
+	manifestDesc.Platform = &ocispec.Platform{
+		Architecture: config.Architecture,
+		OS:           config.OS,
+	}
+
+	index := ocispec.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Manifests: []ocispec.Descriptor{manifestDesc},
+	}
+	if err := writeJSONFile(filepath.Join(dir, "index.json"), index); err != nil {
+		return err
+	}
+
+	layout := ocispec.ImageLayout{Version: ocispec.ImageLayoutVersion}
+
+	return writeJSONFile(filepath.Join(dir, ocispec.ImageLayoutFile), layout)
+}
+
+func writeJSONFile(path string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0o644)
+}
+
+// writeJSONBlob writes the JSON encoding of v as a blob in blobsDir and
+// returns its descriptor.
+func writeJSONBlob(blobsDir, mediaType string, v interface{}) (ocispec.Descriptor, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	desc := ocispec.Descriptor{
+		MediaType: mediaType,
+		Digest:    digest.FromBytes(b),
+		Size:      int64(len(b)),
+	}
+
+	return desc, ioutil.WriteFile(filepath.Join(blobsDir, desc.Digest.Encoded()), b, 0o644)
+}
+
+// writeLayerBlob writes a gzip compressed layer with the content of rootfs
+// as a blob in blobsDir, it returns the layer descriptor and the digest of
+// the uncompressed layer.
+func writeLayerBlob(blobsDir, rootfs string) (ocispec.Descriptor, digest.Digest, error) {
+	f, err := ioutil.TempFile(blobsDir, "layer-")
+	if err != nil {
+		return ocispec.Descriptor{}, "", err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	compressed := digest.Canonical.Digester()
+	uncompressed := digest.Canonical.Digester()
+
+	cw := &countWriter{w: io.MultiWriter(f, compressed.Hash())}
+	gw := gzip.NewWriter(cw)
+
+	if err := writeLayer(io.MultiWriter(gw, uncompressed.Hash()), rootfs); err != nil {
+		return ocispec.Descriptor{}, "", err
+	}
+	if err := gw.Close(); err != nil {
+		return ocispec.Descriptor{}, "", err
+	}
+	if err := f.Close(); err != nil {
+		return ocispec.Descriptor{}, "", err
+	}
+
+	desc := ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageLayerGzip,
+		Digest:    compressed.Digest(),
+		Size:      cw.n,
+	}
+
+	if err := os.Rename(f.Name(), filepath.Join(blobsDir, desc.Digest.Encoded())); err != nil {
+		return ocispec.Descriptor{}, "", err
+	}
+
+	return desc, uncompressed.Digest(), nil
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// writeLayer writes a tar stream of the rootfs directory content into w.
+// When run as an unprivileged user, files owned by the user are recorded as
+// owned by root, as it is the case for a root filesystem extracted by an
+// unprivileged user from an image built by root.
+func writeLayer(w io.Writer, rootfs string) error {
+	tw := tar.NewWriter(w)
+
+	uid := os.Getuid()
+	gid := os.Getgid()
+
+	type inode struct {
+		dev uint64
+		ino uint64
+	}
+	links := make(map[inode]string)
+
+	err := filepath.Walk(rootfs, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name, err := filepath.Rel(rootfs, path)
+		if err != nil {
+			return err
+		} else if name == "." {
+			return nil
+		}
+
+		if fi.Mode()&os.ModeSocket != 0 {
+			sylog.Debugf("Ignoring socket %s", name)
+			return nil
+		}
+
+		link := ""
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+
+		hdr, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return fmt.Errorf("while creating tar header for %s: %s", name, err)
+		}
+		hdr.Name = filepath.ToSlash(name)
+		if fi.IsDir() {
+			hdr.Name += "/"
+		}
+		hdr.Uname = ""
+		hdr.Gname = ""
+		hdr.AccessTime = time.Time{}
+		hdr.ChangeTime = time.Time{}
+
+		if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+			if uid != 0 && int(st.Uid) == uid {
+				hdr.Uid = 0
+			}
+			if uid != 0 && int(st.Gid) == gid {
+				hdr.Gid = 0
+			}
+			if fi.Mode().IsRegular() && st.Nlink > 1 {
+				key := inode{dev: uint64(st.Dev), ino: st.Ino}
+				if target, ok := links[key]; ok {
+					hdr.Typeflag = tar.TypeLink
+					hdr.Linkname = target
+					hdr.Size = 0
+				} else {
+					links[key] = hdr.Name
+				}
+			}
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
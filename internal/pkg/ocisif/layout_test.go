@@ -0,0 +1,185 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package ocisif
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func createRootfs(t *testing.T) string {
+	rootfs, err := ioutil.TempDir("", "rootfs-")
+	if err != nil {
+		t.Fatalf("while creating temporary directory: %s", err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(rootfs, "bin"), 0o755); err != nil {
+		t.Fatalf("while creating directory: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(rootfs, "bin", "sh"), []byte("shell"), 0o755); err != nil {
+		t.Fatalf("while writing file: %s", err)
+	}
+	if err := os.Link(filepath.Join(rootfs, "bin", "sh"), filepath.Join(rootfs, "bin", "bash")); err != nil {
+		t.Fatalf("while creating hard link: %s", err)
+	}
+	if err := os.Symlink("sh", filepath.Join(rootfs, "bin", "ash")); err != nil {
+		t.Fatalf("while creating symlink: %s", err)
+	}
+
+	return rootfs
+}
+
+func readJSON(t *testing.T, path string, v interface{}) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("while reading %s: %s", path, err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		t.Fatalf("while decoding %s: %s", path, err)
+	}
+}
+
+func TestWriteLayer(t *testing.T) {
+	rootfs := createRootfs(t)
+	defer os.RemoveAll(rootfs)
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeLayer(pw, rootfs))
+	}()
+
+	entries := make(map[string]*tar.Header)
+
+	tr := tar.NewReader(pr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("while reading layer: %s", err)
+		}
+		entries[hdr.Name] = hdr
+	}
+
+	expected := map[string]byte{
+		"bin/":     tar.TypeDir,
+		"bin/ash":  tar.TypeSymlink,
+		"bin/bash": tar.TypeReg,
+		"bin/sh":   tar.TypeLink,
+	}
+
+	if len(entries) != len(expected) {
+		t.Fatalf("unexpected number of entries: got %d, expected %d", len(entries), len(expected))
+	}
+
+	for name, typ := range expected {
+		hdr, ok := entries[name]
+		if !ok {
+			t.Errorf("entry %s not found in layer", name)
+			continue
+		}
+		if hdr.Typeflag != typ {
+			t.Errorf("unexpected type for %s: got %c, expected %c", name, hdr.Typeflag, typ)
+		}
+		if hdr.Uid != 0 || hdr.Gid != 0 {
+			t.Errorf("unexpected ownership for %s: %d:%d", name, hdr.Uid, hdr.Gid)
+		}
+	}
+
+	if entries["bin/sh"].Linkname != "bin/bash" {
+		t.Errorf("unexpected hard link target: %s", entries["bin/sh"].Linkname)
+	}
+	if entries["bin/ash"].Linkname != "sh" {
+		t.Errorf("unexpected symlink target: %s", entries["bin/ash"].Linkname)
+	}
+}
+
+func TestWriteLayout(t *testing.T) {
+	rootfs := createRootfs(t)
+	defer os.RemoveAll(rootfs)
+
+	dir, err := ioutil.TempDir("", "layout-")
+	if err != nil {
+		t.Fatalf("while creating temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := &ocispec.Image{
+		Architecture: "amd64",
+		OS:           "linux",
+		RootFS:       ocispec.RootFS{Type: "layers"},
+	}
+
+	if err := writeLayout(dir, rootfs, config); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var layout ocispec.ImageLayout
+	readJSON(t, filepath.Join(dir, ocispec.ImageLayoutFile), &layout)
+	if layout.Version != ocispec.ImageLayoutVersion {
+		t.Errorf("unexpected layout version: %s", layout.Version)
+	}
+
+	var index ocispec.Index
+	readJSON(t, filepath.Join(dir, "index.json"), &index)
+	if len(index.Manifests) != 1 {
+		t.Fatalf("unexpected number of manifests: %d", len(index.Manifests))
+	}
+	if tag := index.Manifests[0].Annotations[ocispec.AnnotationRefName]; tag != LayoutTag {
+		t.Errorf("unexpected manifest tag: %s", tag)
+	}
+
+	blobPath := func(d digest.Digest) string {
+		return filepath.Join(dir, "blobs", d.Algorithm().String(), d.Encoded())
+	}
+
+	var manifest ocispec.Manifest
+	readJSON(t, blobPath(index.Manifests[0].Digest), &manifest)
+	if len(manifest.Layers) != 1 {
+		t.Fatalf("unexpected number of layers: %d", len(manifest.Layers))
+	}
+
+	var imgConfig ocispec.Image
+	readJSON(t, blobPath(manifest.Config.Digest), &imgConfig)
+	if len(imgConfig.RootFS.DiffIDs) != 1 {
+		t.Fatalf("unexpected number of diff IDs: %d", len(imgConfig.RootFS.DiffIDs))
+	}
+
+	f, err := os.Open(blobPath(manifest.Layers[0].Digest))
+	if err != nil {
+		t.Fatalf("while opening layer: %s", err)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatalf("while getting layer size: %s", err)
+	}
+	if fi.Size() != manifest.Layers[0].Size {
+		t.Errorf("unexpected layer size: got %d, expected %d", manifest.Layers[0].Size, fi.Size())
+	}
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("while decompressing layer: %s", err)
+	}
+	diffID, err := digest.Canonical.FromReader(gr)
+	if err != nil {
+		t.Fatalf("while computing layer diff ID: %s", err)
+	}
+	if diffID != imgConfig.RootFS.DiffIDs[0] {
+		t.Errorf("unexpected diff ID: got %s, expected %s", imgConfig.RootFS.DiffIDs[0], diffID)
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package ocisif converts Singularity SIF and sandbox images into OCI
+// images, so they can be handled by the containers/image transports.
+package ocisif
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	ocilayout "github.com/containers/image/v5/oci/layout"
+	"github.com/containers/image/v5/types"
+	"github.com/hpcng/sif/pkg/sif"
+	"github.com/hpcng/singularity/internal/pkg/image/unpacker"
+	"github.com/hpcng/singularity/internal/pkg/util/fs"
+	"github.com/hpcng/singularity/pkg/image"
+	"github.com/hpcng/singularity/pkg/inspect"
+	"github.com/hpcng/singularity/pkg/sylog"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Image holds an OCI image converted from a Singularity image.
+type Image struct {
+	// Reference is the containers/image reference to the converted image.
+	Reference types.ImageReference
+	// Config is the OCI image configuration of the converted image.
+	Config ocispec.Image
+
+	workDir string
+}
+
+// Close removes all temporary files created during conversion.
+func (i *Image) Close() error {
+	return fs.ForceRemoveAll(i.workDir)
+}
+
+// Convert converts the Singularity image located at path into a single
+// layer OCI image stored in an OCI layout created in a temporary directory
+// under tmpDir. Callers must call Close on the returned image to remove
+// temporary files once done.
+func Convert(path, tmpDir string) (*Image, error) {
+	img, err := image.Init(path, false)
+	if err != nil {
+		return nil, fmt.Errorf("could not open image %s: %s", path, err)
+	}
+	defer img.File.Close()
+
+	workDir, err := ioutil.TempDir(tmpDir, "oci-convert-")
+	if err != nil {
+		return nil, fmt.Errorf("could not create temporary directory: %s", err)
+	}
+
+	ociImage := &Image{workDir: workDir}
+
+	if err := ociImage.convert(img); err != nil {
+		ociImage.Close()
+		return nil, err
+	}
+
+	return ociImage, nil
+}
+
+func (i *Image) convert(img *image.Image) error {
+	rootfs, err := extractRootfs(img, i.workDir)
+	if err != nil {
+		return err
+	}
+
+	metadata, err := getMetadata(img, rootfs)
+	if err != nil {
+		return fmt.Errorf("while reading image metadata: %s", err)
+	}
+
+	baseConfig, err := getOCIConfig(img)
+	if err != nil {
+		return fmt.Errorf("while reading image OCI configuration: %s", err)
+	}
+
+	imgConfig := ImageConfig(metadata, baseConfig)
+
+	arch, created, err := imageInfo(img)
+	if err != nil {
+		return err
+	}
+
+	i.Config = ocispec.Image{
+		Created:      &created,
+		Architecture: arch,
+		OS:           "linux",
+		Config:       imgConfig,
+		RootFS: ocispec.RootFS{
+			Type: "layers",
+		},
+	}
+
+	layoutDir := filepath.Join(i.workDir, "layout")
+
+	sylog.Infof("Creating OCI image layer from %s", img.Path)
+
+	if err := writeLayout(layoutDir, rootfs, &i.Config); err != nil {
+		return fmt.Errorf("while writing OCI layout: %s", err)
+	}
+
+	i.Reference, err = ocilayout.ParseReference(layoutDir + ":" + LayoutTag)
+	if err != nil {
+		return fmt.Errorf("while parsing OCI layout reference: %s", err)
+	}
+
+	return nil
+}
+
+// extractRootfs returns the root filesystem directory of the image,
+// SIF and squashfs images are extracted into workDir.
+func extractRootfs(img *image.Image, workDir string) (string, error) {
+	if img.Type == image.SANDBOX {
+		return img.Path, nil
+	}
+
+	part, err := img.GetRootFsPartition()
+	if err != nil {
+		return "", fmt.Errorf("while getting root filesystem in %s: %s", img.Name, err)
+	}
+
+	switch part.Type {
+	case image.SQUASHFS:
+	case image.ENCRYPTSQUASHFS:
+		return "", fmt.Errorf("conversion of images with an encrypted root filesystem is not supported")
+	default:
+		return "", fmt.Errorf("conversion of images with a non squashfs root filesystem is not supported")
+	}
+
+	reader, err := image.NewPartitionReader(img, "", 0)
+	if err != nil {
+		return "", fmt.Errorf("could not extract root filesystem: %s", err)
+	}
+
+	rootfs := filepath.Join(workDir, "rootfs")
+
+	s := unpacker.NewSquashfs()
+	if err := s.ExtractAll(reader, rootfs); err != nil {
+		return "", fmt.Errorf("root filesystem extraction failed: %s", err)
+	}
+
+	return rootfs, nil
+}
+
+// getMetadata returns the container metadata, for SIF images the metadata
+// are read from the inspect metadata descriptor if present, otherwise they
+// are read from the files stored in the root filesystem.
+func getMetadata(img *image.Image, rootfs string) (*inspect.Metadata, error) {
+	if img.Type == image.SIF {
+		r, err := image.NewSectionReader(img, image.SIFDescInspectMetadataJSON, -1)
+		if err == nil {
+			metadata := new(inspect.Metadata)
+			if err := json.NewDecoder(r).Decode(metadata); err != nil {
+				return nil, fmt.Errorf("while decoding inspect metadata: %s", err)
+			}
+			return metadata, nil
+		} else if err != image.ErrNoSection {
+			return nil, err
+		}
+	}
+
+	return RootfsMetadata(os.DirFS(rootfs))
+}
+
+// getOCIConfig returns the OCI image configuration stored in SIF images
+// built from an OCI source, it returns nil if there is none.
+func getOCIConfig(img *image.Image) (*ocispec.ImageConfig, error) {
+	if img.Type != image.SIF {
+		return nil, nil
+	}
+
+	r, err := image.NewSectionReader(img, image.SIFDescOCIConfigJSON, -1)
+	if err == image.ErrNoSection {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	config := new(ocispec.ImageConfig)
+	if err := json.NewDecoder(r).Decode(config); err != nil {
+		return nil, fmt.Errorf("while decoding OCI configuration: %s", err)
+	}
+
+	return config, nil
+}
+
+// imageInfo returns the architecture and the creation time of the image.
+func imageInfo(img *image.Image) (string, time.Time, error) {
+	if img.Type != image.SIF {
+		fi, err := os.Stat(img.Path)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		return runtime.GOARCH, fi.ModTime().UTC(), nil
+	}
+
+	fimg, err := sif.LoadContainer(img.Path, true)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("unable to open: %v: %v", img.Path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	arch := sif.GetGoArch(string(fimg.Header.Arch[:sif.HdrArchLen-1]))
+	if arch == "unknown" {
+		return "", time.Time{}, fmt.Errorf("unknown architecture in SIF file")
+	}
+
+	return arch, time.Unix(fimg.Header.Ctime, 0).UTC(), nil
+}
@@ -208,6 +208,12 @@ func (g *Generator) AddLinuxGIDMapping(host, container, size uint32) {
 	g.Config.Linux.GIDMappings = append(g.Config.Linux.GIDMappings, idMapping)
 }
 
+// SetLinuxResources sets the cgroups resource limits of the container.
+func (g *Generator) SetLinuxResources(resources *specs.LinuxResources) {
+	g.initLinux()
+	g.Config.Linux.Resources = resources
+}
+
 // AddProcessRlimits adds a container process rlimit.
 func (g *Generator) AddProcessRlimits(rType string, rHard uint64, rSoft uint64) {
 	g.initProcess()
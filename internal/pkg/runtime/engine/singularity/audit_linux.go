@@ -0,0 +1,251 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hpcng/sif/pkg/integrity"
+	"github.com/hpcng/sif/pkg/sif"
+	"github.com/hpcng/singularity/internal/pkg/audit"
+	"github.com/hpcng/singularity/internal/pkg/buildcfg"
+	"github.com/hpcng/singularity/internal/pkg/plugin"
+	"github.com/hpcng/singularity/internal/pkg/runtime/engine/config/starter"
+	"github.com/hpcng/singularity/internal/pkg/util/priv"
+	"github.com/hpcng/singularity/internal/pkg/util/user"
+	"github.com/hpcng/singularity/internal/pkg/util/x509sig"
+	"github.com/hpcng/singularity/pkg/image"
+	singularitycallback "github.com/hpcng/singularity/pkg/plugin/callback/runtime/engine/singularity"
+	"github.com/hpcng/singularity/pkg/sylog"
+	"github.com/hpcng/singularity/pkg/sypgp"
+	"github.com/hpcng/singularity/pkg/util/singularityconf"
+)
+
+// imageDigest returns the SHA256 digest of the image file.
+func imageDigest(img *image.Image) (string, error) {
+	fi, err := img.File.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(img.File, 0, fi.Size())); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// imageSigners returns the fingerprints of the PGP keys of the global
+// keyring whose signatures of all objects of the SIF image are valid.
+// Signatures which don't verify, and signatures from keys which are not in
+// the global keyring, are not reported.
+func imageSigners(img *image.Image) ([]string, error) {
+	f, err := sif.LoadContainerFp(img.File, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// X.509 signatures and time-stamps are hidden from the verifier
+	signed := false
+	for _, od := range f.DescrArr {
+		if !od.Used || od.Datatype != sif.DataSignature {
+			continue
+		}
+		if name := od.GetName(); name != image.SIFDescX509Signature && name != image.SIFDescTimestamp {
+			signed = true
+			break
+		}
+	}
+	if !signed {
+		return nil, nil
+	}
+
+	keyring := sypgp.NewHandle(buildcfg.SINGULARITY_CONFDIR, sypgp.GlobalHandleOpt())
+	kr, err := keyring.LoadPubKeyring()
+	if err != nil {
+		return nil, fmt.Errorf("while loading global keyring: %s", err)
+	}
+
+	// note the keys of valid and invalid signatures, errors are ignored
+	// to keep verifying the other signatures
+	valid := make(map[[20]byte]bool)
+	invalid := make(map[[20]byte]bool)
+	cb := func(r integrity.VerifyResult) bool {
+		if e := r.Entity(); e != nil && r.Error() == nil {
+			valid[e.PrimaryKey.Fingerprint] = true
+		} else if e != nil {
+			invalid[e.PrimaryKey.Fingerprint] = true
+		}
+		return true
+	}
+
+	v, err := integrity.NewVerifier(
+		x509sig.HideSignatures(&f),
+		integrity.OptVerifyWithKeyRing(kr),
+		integrity.OptVerifyCallback(cb),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.Verify(); err != nil {
+		return nil, err
+	}
+	fps, err := v.AllSignedBy()
+	if err != nil {
+		return nil, err
+	}
+
+	signers := make([]string, 0, len(fps))
+	for _, fp := range fps {
+		if !valid[fp] || invalid[fp] {
+			continue
+		}
+		signers = append(signers, fmt.Sprintf("%X", fp))
+	}
+	return signers, nil
+}
+
+// loadAuditCallbacks returns the plugin callbacks receiving audit records.
+func loadAuditCallbacks() ([]singularitycallback.AuditRecord, error) {
+	callbackType := (singularitycallback.AuditRecord)(nil)
+	callbacks, err := plugin.LoadCallbacks(callbackType)
+	if err != nil {
+		return nil, fmt.Errorf("while loading plugins callbacks '%T': %s", callbackType, err)
+	}
+
+	auditCallbacks := make([]singularitycallback.AuditRecord, 0, len(callbacks))
+	for _, callback := range callbacks {
+		auditCallbacks = append(auditCallbacks, callback.(singularitycallback.AuditRecord))
+	}
+	return auditCallbacks, nil
+}
+
+// prepareAudit is called during stage 1 to fill the audit record of the
+// container, when an audit log is configured in singularity.conf or when a
+// plugin receives audit records. Images must have been loaded beforehand.
+func (e *EngineOperations) prepareAudit(starterConfig *starter.Config) error {
+	e.EngineConfig.SetAudit(nil)
+
+	callbacks, err := loadAuditCallbacks()
+	if err != nil {
+		return err
+	}
+	if e.EngineConfig.File.AuditLog == audit.SinkNone && len(callbacks) == 0 {
+		return nil
+	}
+
+	r := &audit.Record{
+		ContainerID: e.CommonConfig.ContainerID,
+		Instance:    e.EngineConfig.GetInstance(),
+		UID:         os.Getuid(),
+		GID:         os.Getgid(),
+		Image:       e.EngineConfig.GetImage(),
+		Fakeroot:    e.EngineConfig.GetFakeroot(),
+		Setuid:      starterConfig.GetIsSUID(),
+		Args:        e.EngineConfig.OciConfig.Process.Args,
+	}
+
+	if pw, err := user.Current(); err == nil {
+		r.User = pw.Name
+	}
+
+	for _, b := range e.EngineConfig.GetBindPath() {
+		r.Binds = append(r.Binds, b.Source+":"+b.Destination)
+	}
+
+	if e.EngineConfig.OciConfig.Linux != nil {
+		for _, ns := range e.EngineConfig.OciConfig.Linux.Namespaces {
+			r.Namespaces = append(r.Namespaces, nsProcName[ns.Type])
+		}
+	}
+
+	// the first image is the root filesystem, the image list is empty
+	// when joining an instance
+	if images := e.EngineConfig.GetImageList(); len(images) > 0 {
+		img := &images[0]
+		r.Image = img.Path
+
+		if img.Type != image.SANDBOX {
+			if r.Digest, err = imageDigest(img); err != nil {
+				sylog.Warningf("Could not compute image digest for audit log: %s", err)
+			}
+		}
+		if img.Type == image.SIF {
+			if r.Signers, err = imageSigners(img); err != nil {
+				sylog.Warningf("Could not get image signers for audit log: %s", err)
+			}
+		}
+	}
+
+	e.EngineConfig.SetAudit(r)
+
+	return nil
+}
+
+// writeAudit is called from master to send the audit record r to the sink
+// configured in singularity.conf and to plugins. As the container is already
+// running or stopped, errors are only reported as warnings.
+func (e *EngineOperations) writeAudit(r *audit.Record) {
+	// singularity.conf is not passed across stages, parse it
+	// when not already done by this process
+	if e.EngineConfig.File == nil || e.EngineConfig.File.AuditLog == "" {
+		configurationFile := buildcfg.SINGULARITY_CONF_FILE
+		if buildcfg.SINGULARITY_SUID_INSTALL == 0 || os.Geteuid() == 0 {
+			configFile := e.EngineConfig.GetConfigurationFile()
+			if configFile != "" {
+				configurationFile = configFile
+			}
+		}
+
+		file, err := singularityconf.Parse(configurationFile)
+		if err != nil {
+			sylog.Warningf("Could not write audit record: unable to parse singularity.conf file: %s", err)
+			return
+		}
+		e.EngineConfig.File = file
+	}
+
+	if sink := e.EngineConfig.File.AuditLog; sink != audit.SinkNone {
+		// in setuid workflow, the audit log is usually only
+		// writable by root
+		escalate := r.Setuid && os.Geteuid() != 0
+		if escalate {
+			if err := priv.Escalate(); err != nil {
+				sylog.Debugf("Could not escalate privileges to write audit record: %s", err)
+			}
+		}
+
+		w, err := audit.NewWriter(sink, e.EngineConfig.File.AuditLogPath)
+
+		if escalate {
+			priv.Drop()
+		}
+
+		if err != nil {
+			sylog.Warningf("Could not write audit record: %s", err)
+		} else {
+			if err := w.Write(r); err != nil {
+				sylog.Warningf("Could not write audit record: %s", err)
+			}
+			w.Close()
+		}
+	}
+
+	callbacks, err := loadAuditCallbacks()
+	if err != nil {
+		sylog.Warningf("%s", err)
+		return
+	}
+	for _, callback := range callbacks {
+		if err := callback(e.CommonConfig, r); err != nil {
+			sylog.Warningf("Audit plugin callback failed: %s", err)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/hpcng/singularity/internal/pkg/cdi"
+	"github.com/hpcng/singularity/internal/pkg/util/exec"
+	"github.com/hpcng/singularity/internal/pkg/util/fs/mount"
+	"github.com/hpcng/singularity/pkg/sylog"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// resolveCDIEdits returns the container edits of the CDI devices requested
+// with --device, or nil if no device was requested. Only the device hooks
+// run by this engine are allowed, and for unprivileged users the hooks must
+// be defined in spec files owned by root, as they are executed by master
+// with its privileges.
+func (e *EngineOperations) resolveCDIEdits() (*cdi.ContainerEdits, error) {
+	devices := e.EngineConfig.GetCDIDevices()
+	if len(devices) == 0 {
+		return nil, nil
+	}
+
+	registry, err := cdi.Load(cdi.DefaultSpecDirs...)
+	if err != nil {
+		return nil, fmt.Errorf("while loading CDI specs: %s", err)
+	}
+	if os.Getuid() != 0 {
+		if err := registry.CheckHooksOwner(devices, 0); err != nil {
+			return nil, err
+		}
+	}
+	edits, err := registry.Resolve(devices)
+	if err != nil {
+		return nil, err
+	}
+
+	// createContainer hooks must run in the container namespaces before
+	// the root filesystem is pivoted, which is done by the RPC server
+	hooks := []string{
+		cdi.PrestartHook,
+		cdi.CreateRuntimeHook,
+		cdi.StartContainerHook,
+		cdi.PoststartHook,
+		cdi.PoststopHook,
+	}
+	if err := edits.CheckHooks(hooks...); err != nil {
+		return nil, err
+	}
+	return edits, nil
+}
+
+// prepareCDIConfig is called during stage 1 to check the CDI devices
+// requested with --device and to set their startContainer hooks, which
+// are executed by the container process.
+func (e *EngineOperations) prepareCDIConfig() error {
+	edits, err := e.resolveCDIEdits()
+	if err != nil || edits == nil {
+		return err
+	}
+
+	hooks := edits.HooksByName(cdi.StartContainerHook)
+	if len(hooks) == 0 {
+		return nil
+	}
+	if e.EngineConfig.OciConfig.Hooks == nil {
+		e.EngineConfig.OciConfig.Hooks = &specs.Hooks{}
+	}
+	for _, h := range hooks {
+		e.EngineConfig.OciConfig.Hooks.StartContainer = append(e.EngineConfig.OciConfig.Hooks.StartContainer, h.ToOCI())
+	}
+	return nil
+}
+
+// loadCDIEdits resolves the container edits of the CDI devices requested
+// with --device. The CDI spec files are read again by the master process,
+// as only the device names are passed by the user.
+func (e *EngineOperations) loadCDIEdits() (err error) {
+	cdiEdits, err = e.resolveCDIEdits()
+	return err
+}
+
+// runCDIHooks executes from master the CDI device hooks of the lifecycle
+// steps names, the container state is passed to hooks over stdin like OCI
+// hooks.
+func (e *EngineOperations) runCDIHooks(ctx context.Context, pid int, status specs.ContainerState, names ...string) error {
+	if cdiEdits == nil {
+		return nil
+	}
+
+	state := &specs.State{
+		Version: specs.Version,
+		ID:      e.CommonConfig.ContainerID,
+		Status:  status,
+		Pid:     pid,
+	}
+	for _, name := range names {
+		for _, h := range cdiEdits.HooksByName(name) {
+			sylog.Debugf("Running CDI %s hook %s", name, h.Path)
+			hook := h.ToOCI()
+			if err := exec.Hook(ctx, &hook, state); err != nil {
+				return fmt.Errorf("CDI %s hook %s: %s", name, h.Path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// addCDIMount adds the device nodes and mounts of the CDI devices
+// requested with --device to the mount list.
+func (c *container) addCDIMount(system *mount.System) error {
+	if cdiEdits == nil {
+		return nil
+	}
+
+	for _, d := range cdiEdits.DeviceNodes {
+		if err := c.addCDIDevice(d, system); err != nil {
+			return err
+		}
+	}
+
+	defaultFlags := uintptr(syscall.MS_BIND | c.suidFlag | syscall.MS_NODEV | syscall.MS_REC)
+
+	for _, m := range cdiEdits.Mounts {
+		if m.Type != "" && m.Type != "bind" {
+			return fmt.Errorf("CDI mount %s: unsupported mount type %s", m.ContainerPath, m.Type)
+		}
+
+		flags := defaultFlags
+		if m.Readonly() {
+			flags |= syscall.MS_RDONLY
+		}
+
+		sylog.Debugf("Adding CDI mount %s to %s", m.HostPath, m.ContainerPath)
+		if err := system.Points.AddBind(mount.BindsTag, m.HostPath, m.ContainerPath, flags); err != nil {
+			return fmt.Errorf("unable to add %s to mount list: %s", m.HostPath, err)
+		}
+		if err := system.Points.AddRemount(mount.BindsTag, m.ContainerPath, flags); err != nil {
+			return fmt.Errorf("unable to add %s for remount: %s", m.ContainerPath, err)
+		}
+	}
+
+	return nil
+}
+
+// addCDIDevice binds a CDI device node from the host. When the host /dev
+// is mounted in the container the device node is already present.
+func (c *container) addCDIDevice(d *cdi.DeviceNode, system *mount.System) error {
+	hostPath := d.HostNodePath()
+
+	if c.engine.EngineConfig.File.MountDev == "no" || c.engine.EngineConfig.GetNoDev() {
+		sylog.Warningf("Skipping CDI device %s: disallowed by configuration", d.Path)
+		return nil
+	} else if c.engine.EngineConfig.File.MountDev == "minimal" || c.engine.EngineConfig.GetContain() {
+		if _, err := c.session.GetPath(d.Path); err == nil {
+			sylog.Debugf("CDI device %s already present in staged /dev", d.Path)
+			return nil
+		}
+		if err := c.addSessionDevAt(hostPath, d.Path, system); err != nil {
+			return fmt.Errorf("while adding CDI device %s: %s", d.Path, err)
+		}
+		return nil
+	}
+
+	if hostPath != d.Path {
+		return fmt.Errorf("CDI device %s is bound from %s, which requires --contain or 'mount dev = minimal'", d.Path, hostPath)
+	}
+	return nil
+}
+
+// runStartContainerHooks is called by the container process before the
+// container command is executed, to run the CDI startContainer hooks in the
+// container namespaces. Hook paths are resolved in the container.
+func (e *EngineOperations) runStartContainerHooks() error {
+	hooks := e.EngineConfig.OciConfig.Hooks
+	if hooks == nil {
+		return nil
+	}
+
+	state := &specs.State{
+		Version: specs.Version,
+		ID:      e.CommonConfig.ContainerID,
+		Status:  specs.StateCreated,
+		Pid:     os.Getpid(),
+	}
+	for _, h := range hooks.StartContainer {
+		h := h
+		sylog.Debugf("Running CDI %s hook %s", cdi.StartContainerHook, h.Path)
+		if err := exec.Hook(context.Background(), &h, state); err != nil {
+			return fmt.Errorf("CDI %s hook %s: %s", cdi.StartContainerHook, h.Path, err)
+		}
+	}
+	return nil
+}
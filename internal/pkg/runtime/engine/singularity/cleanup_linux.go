@@ -14,6 +14,7 @@ import (
 	"strings"
 	"syscall"
 
+	"github.com/hpcng/singularity/internal/pkg/cdi"
 	"github.com/hpcng/singularity/internal/pkg/instance"
 	fakerootConfig "github.com/hpcng/singularity/internal/pkg/runtime/engine/fakeroot/config"
 	"github.com/hpcng/singularity/internal/pkg/util/bin"
@@ -23,6 +24,7 @@ import (
 	"github.com/hpcng/singularity/pkg/runtime/engine/config"
 	"github.com/hpcng/singularity/pkg/sylog"
 	"github.com/hpcng/singularity/pkg/util/capabilities"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
 )
 
 // CleanupContainer is called from master after the MonitorContainer returns.
@@ -101,6 +103,18 @@ func (e *EngineOperations) CleanupContainer(ctx context.Context, fatal error, st
 		}
 	}
 
+	if err := e.runCDIHooks(ctx, 0, specs.StateStopped, cdi.PoststopHook); err != nil {
+		sylog.Warningf("%s", err)
+	}
+
+	if err := e.stopSeccompTrace(); err != nil {
+		sylog.Errorf("could not generate seccomp profile: %s", err)
+	}
+
+	if r := e.EngineConfig.GetAudit(); r != nil {
+		e.writeAudit(r.Exit(fatal, status))
+	}
+
 	if e.EngineConfig.GetInstance() {
 		file, err := instance.Get(e.CommonConfig.ContainerID, instance.SingSubDir)
 		if err != nil {
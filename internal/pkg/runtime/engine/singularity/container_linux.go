@@ -16,6 +16,7 @@ import (
 	"syscall"
 
 	"github.com/hpcng/singularity/internal/pkg/buildcfg"
+	"github.com/hpcng/singularity/internal/pkg/cdi"
 	"github.com/hpcng/singularity/internal/pkg/cgroups"
 	"github.com/hpcng/singularity/internal/pkg/plugin"
 	"github.com/hpcng/singularity/internal/pkg/runtime/engine/singularity/rpc/client"
@@ -55,6 +56,7 @@ var (
 	imageDriver    image.Driver
 	umountPoints   []string
 	cgroupsManager cgroups.Manager
+	cdiEdits       *cdi.ContainerEdits
 )
 
 // defaultCNIConfPath is the default directory to CNI network configuration files.
@@ -115,6 +117,10 @@ func create(ctx context.Context, engine *EngineOperations, rpcOps *client.RPC, p
 		suidFlag:      syscall.MS_NOSUID,
 	}
 
+	if err := engine.loadCDIEdits(); err != nil {
+		return err
+	}
+
 	cwd := engine.EngineConfig.GetCwd()
 	if err := os.Chdir(cwd); err != nil {
 		return fmt.Errorf("can't change directory to %s: %s", cwd, err)
@@ -226,6 +232,9 @@ func create(ctx context.Context, engine *EngineOperations, rpcOps *client.RPC, p
 	if err := c.addUserbindsMount(system); err != nil {
 		return err
 	}
+	if err := c.addCDIMount(system); err != nil {
+		return err
+	}
 	if err := c.addTmpMount(system); err != nil {
 		return err
 	}
@@ -278,6 +287,12 @@ func create(ctx context.Context, engine *EngineOperations, rpcOps *client.RPC, p
 		}
 	}
 
+	// CDI prestart and createRuntime hooks run in the runtime namespaces
+	// once the container is created, before chroot
+	if err := engine.runCDIHooks(ctx, pid, specs.StateCreating, cdi.PrestartHook, cdi.CreateRuntimeHook); err != nil {
+		return err
+	}
+
 	// chroot from RPC server current working directory since
 	// it's already in final directory after chdirFinal call
 	sylog.Debugf("Chroot into %s\n", c.session.FinalPath())
@@ -303,6 +318,11 @@ func create(ctx context.Context, engine *EngineOperations, rpcOps *client.RPC, p
 			if err != nil {
 				return fmt.Errorf("while applying cgroups config: %v", err)
 			}
+		} else if resources := engine.EngineConfig.GetCgroupsResources(); resources != nil {
+			cgroupsManager, err = cgroups.NewManagerFromSpec(resources, pid, "")
+			if err != nil {
+				return fmt.Errorf("while applying resource limits: %v", err)
+			}
 		}
 	}
 
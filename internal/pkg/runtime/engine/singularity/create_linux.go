@@ -33,6 +33,12 @@ func (e *EngineOperations) CreateContainer(ctx context.Context, pid int, rpcConn
 	}
 
 	if e.EngineConfig.GetInstanceJoin() {
+		if err := e.startSeccompTrace(); err != nil {
+			return err
+		}
+		if r := e.EngineConfig.GetAudit(); r != nil {
+			e.writeAudit(r.Start())
+		}
 		return nil
 	}
 
@@ -44,5 +50,17 @@ func (e *EngineOperations) CreateContainer(ctx context.Context, pid int, rpcConn
 		return fmt.Errorf("failed to initialize RPC client")
 	}
 
-	return create(ctx, e, rpcOps, pid)
+	if err := create(ctx, e, rpcOps, pid); err != nil {
+		return err
+	}
+
+	if err := e.startSeccompTrace(); err != nil {
+		return err
+	}
+
+	if r := e.EngineConfig.GetAudit(); r != nil {
+		e.writeAudit(r.Start())
+	}
+
+	return nil
 }
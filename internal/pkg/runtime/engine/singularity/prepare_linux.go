@@ -148,6 +148,10 @@ func (e *EngineOperations) PrepareConfig(starterConfig *starter.Config) error {
 		}
 	}
 
+	if err := e.prepareAudit(starterConfig); err != nil {
+		return err
+	}
+
 	starterConfig.SetMasterPropagateMount(true)
 	starterConfig.SetNoNewPrivs(e.EngineConfig.OciConfig.Process.NoNewPrivileges)
 
@@ -643,6 +647,12 @@ func (e *EngineOperations) prepareContainerConfig(starterConfig *starter.Config)
 			return err
 		}
 	}
+	if err := e.prepareSeccompTrace(); err != nil {
+		return err
+	}
+	if err := e.prepareCDIConfig(); err != nil {
+		return err
+	}
 
 	// open file descriptors (autofs bug path)
 	return e.prepareAutofs(starterConfig)
@@ -904,6 +914,9 @@ func (e *EngineOperations) prepareInstanceJoinConfig(starterConfig *starter.Conf
 		}
 		e.EngineConfig.OciConfig.Linux.Seccomp = instanceEngineConfig.OciConfig.Linux.Seccomp
 	}
+	if err := e.prepareSeccompTrace(); err != nil {
+		return err
+	}
 
 	if file.Cgroup {
 		sylog.Debugf("Adding process to instance cgroup")
@@ -28,6 +28,7 @@ import (
 	"time"
 	"unsafe"
 
+	"github.com/hpcng/singularity/internal/pkg/cdi"
 	"github.com/hpcng/singularity/internal/pkg/instance"
 	"github.com/hpcng/singularity/internal/pkg/plugin"
 	"github.com/hpcng/singularity/internal/pkg/security"
@@ -40,6 +41,7 @@ import (
 	singularitycallback "github.com/hpcng/singularity/pkg/plugin/callback/runtime/engine/singularity"
 	singularityConfig "github.com/hpcng/singularity/pkg/runtime/engine/singularity/config"
 	"github.com/hpcng/singularity/pkg/sylog"
+	"github.com/hpcng/singularity/pkg/util/fs/proc"
 	"github.com/hpcng/singularity/pkg/util/rlimit"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"golang.org/x/crypto/ssh/terminal"
@@ -150,6 +152,10 @@ func (e *EngineOperations) StartProcess(masterConnFd int) error {
 		}
 	}
 
+	if err := e.runStartContainerHooks(); err != nil {
+		return err
+	}
+
 	if err := security.Configure(&e.EngineConfig.OciConfig.Spec); err != nil {
 		return fmt.Errorf("failed to apply security configuration: %s", err)
 	}
@@ -333,6 +339,10 @@ func (e *EngineOperations) PostStartProcess(ctx context.Context, pid int) error
 		}
 	}
 
+	if err := e.runCDIHooks(ctx, pid, specs.StateRunning, cdi.PoststartHook); err != nil {
+		return err
+	}
+
 	if e.EngineConfig.GetInstance() {
 		name := e.CommonConfig.ContainerID
 
@@ -361,6 +371,16 @@ func (e *EngineOperations) PostStartProcess(ctx context.Context, pid int) error
 		file.Image = e.EngineConfig.GetImage()
 		file.LogErrPath = logErrPath
 		file.LogOutPath = logOutPath
+		file.Restart = e.EngineConfig.GetRestartPolicy()
+		file.Restarts = e.EngineConfig.GetRestartCount()
+		if pid := e.EngineConfig.GetSupervisorPid(); pid > 0 {
+			if err := setInstanceSupervisor(file, pid, pw.UID); err != nil {
+				return err
+			}
+		}
+		if e.EngineConfig.GetHealthCmd() != "" {
+			file.Health = instance.HealthStarting
+		}
 
 		ip, err := e.getIP()
 		if err != nil {
@@ -399,7 +419,7 @@ func (e *EngineOperations) PostStartProcess(ctx context.Context, pid int) error
 
 		// If we are using cgroups with this instance then mark that in the instance config.
 		// We don't store the path, as we will get the cgroup manager by Pid.
-		if e.EngineConfig.GetCgroupsPath() != "" {
+		if e.EngineConfig.GetCgroupsPath() != "" || e.EngineConfig.GetCgroupsResources() != nil {
 			file.Cgroup = true
 		}
 
@@ -575,6 +595,29 @@ func (e *EngineOperations) getIP() (string, error) {
 	return "", errors.New("could not get ip")
 }
 
+// setInstanceSupervisor records the supervisor process pid in the instance
+// file along with its start time, so it's not signaled by instance stop once
+// its PID is reused. The supervisor PID comes from the user configuration, it
+// must be a process owned by the user.
+func setInstanceSupervisor(file *instance.File, pid int, uid uint32) error {
+	fi, err := os.Stat(fmt.Sprintf("/proc/%d", pid))
+	if err != nil {
+		return fmt.Errorf("while checking instance supervisor: %s", err)
+	}
+	if st := fi.Sys().(*syscall.Stat_t); st.Uid != uid {
+		return fmt.Errorf("instance supervisor process %d is not owned by user %d", pid, uid)
+	}
+
+	startTime, err := proc.StartTime(pid)
+	if err != nil {
+		return fmt.Errorf("while getting instance supervisor start time: %s", err)
+	}
+	file.SupervisorPid = pid
+	file.SupervisorStartTime = startTime
+
+	return nil
+}
+
 func getExecError(err error, args []string, shell string) error {
 	// We know the shell exists at this point, so let's inspect its architecture
 	if shell == "" {
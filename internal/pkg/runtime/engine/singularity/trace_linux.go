@@ -0,0 +1,105 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hpcng/singularity/internal/pkg/security"
+	"github.com/hpcng/singularity/internal/pkg/security/seccomp"
+	"github.com/hpcng/singularity/internal/pkg/util/priv"
+	"github.com/hpcng/singularity/pkg/sylog"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// seccompTracer collects the syscalls made by the container when a seccomp
+// profile is generated with --security seccomp-trace:<file>.
+var seccompTracer *seccomp.Tracer
+
+// getSeccompTraceProfile returns the path of the seccomp profile to generate,
+// or an empty string if syscalls are not traced.
+func (e *EngineOperations) getSeccompTraceProfile() string {
+	path := security.GetParam(e.EngineConfig.GetSecurity(), "seccomp-trace")
+	if path != "" && !filepath.IsAbs(path) {
+		path = filepath.Join(e.EngineConfig.GetCwd(), path)
+	}
+	return path
+}
+
+// prepareSeccompTrace is called during stage 1 to replace the seccomp filter
+// of the container by a filter logging all syscalls, when a seccomp profile
+// is generated.
+func (e *EngineOperations) prepareSeccompTrace() error {
+	path := e.getSeccompTraceProfile()
+	if path == "" {
+		return nil
+	}
+
+	if security.GetParam(e.EngineConfig.GetSecurity(), "seccomp") != "" {
+		return fmt.Errorf("seccomp and seccomp-trace security options can't be used together")
+	}
+	if !seccomp.Enabled() {
+		return fmt.Errorf("seccomp-trace requested but seccomp is not enabled, seccomp library is missing or too old")
+	}
+
+	sylog.Debugf("Tracing syscalls to generate seccomp profile %s", path)
+
+	if e.EngineConfig.OciConfig.Linux == nil {
+		e.EngineConfig.OciConfig.Linux = &specs.Linux{}
+	}
+	e.EngineConfig.OciConfig.Linux.Seccomp = seccomp.TraceConfig()
+
+	return nil
+}
+
+// startSeccompTrace is called from master before the container process
+// starts, to collect the syscalls logged by the kernel from now on.
+func (e *EngineOperations) startSeccompTrace() error {
+	if e.getSeccompTraceProfile() == "" {
+		return nil
+	}
+
+	// reading the kernel log is usually restricted to privileged users
+	if os.Geteuid() != 0 {
+		priv.Escalate()
+		defer priv.Drop()
+	}
+
+	t, err := seccomp.NewTracer(os.Getuid())
+	if err != nil {
+		return fmt.Errorf("while starting seccomp trace: %s", err)
+	}
+	seccompTracer = t
+
+	return nil
+}
+
+// stopSeccompTrace is called from master once the container exited, to
+// write the seccomp profile allowing the syscalls it made.
+func (e *EngineOperations) stopSeccompTrace() error {
+	if seccompTracer == nil {
+		return nil
+	}
+	defer seccompTracer.Close()
+
+	syscalls, err := seccompTracer.Syscalls()
+	if err != nil {
+		return fmt.Errorf("while collecting traced syscalls: %s", err)
+	}
+	if len(syscalls) == 0 {
+		return fmt.Errorf("no traced syscall found in kernel log: check that 'log' is listed in /proc/sys/kernel/seccomp/actions_logged and that no audit daemon is running")
+	}
+
+	path := e.getSeccompTraceProfile()
+	if err := seccomp.WriteTraceProfile(path, syscalls); err != nil {
+		return err
+	}
+	sylog.Infof("Seccomp profile allowing %d traced syscalls written to %s", len(syscalls), path)
+
+	return nil
+}
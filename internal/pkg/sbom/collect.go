@@ -0,0 +1,295 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sbom
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/hpcng/singularity/internal/pkg/util/bin"
+	"github.com/hpcng/singularity/pkg/sylog"
+)
+
+// collectDpkg returns the installed packages of the dpkg status database,
+// and of the status.d directory used by distroless images.
+func collectDpkg(rootfs string) ([]Package, error) {
+	files := []string{filepath.Join(rootfs, "var/lib/dpkg/status")}
+
+	statusd, err := filepath.Glob(filepath.Join(rootfs, "var/lib/dpkg/status.d/*"))
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, statusd...)
+
+	var pkgs []Package
+
+	for _, file := range files {
+		paragraphs, err := readFields(file, false)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range paragraphs {
+			// status.d files don't have a status field
+			if status, ok := p["Status"]; ok && !strings.HasSuffix(status, " installed") {
+				continue
+			}
+			if p["Package"] == "" {
+				continue
+			}
+			pkgs = append(pkgs, Package{
+				Type:    TypeDeb,
+				Name:    p["Package"],
+				Version: p["Version"],
+				Arch:    p["Architecture"],
+			})
+		}
+	}
+
+	return pkgs, nil
+}
+
+// collectApk returns the installed packages of the apk database.
+func collectApk(rootfs string) ([]Package, error) {
+	paragraphs, err := readFields(filepath.Join(rootfs, "lib/apk/db/installed"), false)
+	if err != nil {
+		return nil, err
+	}
+
+	var pkgs []Package
+
+	for _, p := range paragraphs {
+		if p["P"] == "" {
+			continue
+		}
+		pkgs = append(pkgs, Package{
+			Type:    TypeApk,
+			Name:    p["P"],
+			Version: p["V"],
+			Arch:    p["A"],
+			License: p["L"],
+		})
+	}
+
+	return pkgs, nil
+}
+
+// rpmQueryFormat is the query format of rpm, with one package per line.
+const rpmQueryFormat = `%{NAME}\t%|EPOCH?{%{EPOCH}:}:{}|%{VERSION}-%{RELEASE}\t%{ARCH}\t%{LICENSE}\n`
+
+// collectRPM returns the installed packages of the rpm database, queried
+// with the rpm command of the host as the database format can't be read
+// directly.
+func collectRPM(rootfs string) ([]Package, error) {
+	found := false
+	for _, dir := range []string{"var/lib/rpm", "usr/lib/sysimage/rpm"} {
+		if fi, err := os.Stat(filepath.Join(rootfs, dir)); err == nil && fi.IsDir() {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+
+	rpm, err := bin.FindBin("rpm")
+	if err != nil {
+		sylog.Warningf("rpm command not found, rpm packages are not included in the SBOM")
+		return nil, nil
+	}
+
+	var stderr bytes.Buffer
+
+	cmd := exec.Command(rpm, "--root", rootfs, "-qa", "--qf", rpmQueryFormat)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("while querying rpm database: %s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return parseRPMQuery(out), nil
+}
+
+// parseRPMQuery parses the output of rpm queried with rpmQueryFormat.
+func parseRPMQuery(out []byte) []Package {
+	var pkgs []Package
+
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 4 || fields[0] == "" {
+			continue
+		}
+		// gpg-pubkey entries are imported keys, not packages
+		if fields[0] == "gpg-pubkey" {
+			continue
+		}
+		arch := fields[2]
+		if arch == "(none)" {
+			arch = ""
+		}
+		license := fields[3]
+		if license == "(none)" {
+			license = ""
+		}
+		pkgs = append(pkgs, Package{
+			Type:    TypeRPM,
+			Name:    fields[0],
+			Version: fields[1],
+			Arch:    arch,
+			License: license,
+		})
+	}
+
+	return pkgs
+}
+
+// skipDirs are the root filesystem directories which are not searched for
+// Python packages.
+var skipDirs = map[string]bool{
+	"dev":  true,
+	"proc": true,
+	"sys":  true,
+	"tmp":  true,
+}
+
+// collectPython returns the Python packages installed with pip, found in
+// dist-info and egg-info metadata of site-packages and dist-packages
+// directories, and the packages of conda environments, found in conda-meta
+// directories.
+func collectPython(rootfs string) ([]Package, error) {
+	var pkgs []Package
+
+	err := filepath.Walk(rootfs, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			// unreadable directories are skipped
+			if fi != nil && fi.IsDir() && path != rootfs {
+				sylog.Debugf("Skipping %s: %s", path, err)
+				return filepath.SkipDir
+			}
+			return err
+		}
+
+		name := fi.Name()
+		parent := filepath.Base(filepath.Dir(path))
+		inSitePackages := parent == "site-packages" || parent == "dist-packages"
+
+		switch {
+		case fi.IsDir() && filepath.Dir(path) == rootfs && skipDirs[name]:
+			return filepath.SkipDir
+		case fi.IsDir() && name == "conda-meta":
+			p, err := readConda(path)
+			if err != nil {
+				return err
+			}
+			pkgs = append(pkgs, p...)
+			return filepath.SkipDir
+		case fi.IsDir() && inSitePackages && strings.HasSuffix(name, ".dist-info"):
+			if p, ok, err := readPythonMetadata(filepath.Join(path, "METADATA")); err != nil {
+				return err
+			} else if ok {
+				pkgs = append(pkgs, p)
+			}
+			return filepath.SkipDir
+		case fi.IsDir() && inSitePackages && strings.HasSuffix(name, ".egg-info"):
+			if p, ok, err := readPythonMetadata(filepath.Join(path, "PKG-INFO")); err != nil {
+				return err
+			} else if ok {
+				pkgs = append(pkgs, p)
+			}
+			return filepath.SkipDir
+		case fi.Mode().IsRegular() && inSitePackages && strings.HasSuffix(name, ".egg-info"):
+			if p, ok, err := readPythonMetadata(path); err != nil {
+				return err
+			} else if ok {
+				pkgs = append(pkgs, p)
+			}
+		}
+		return nil
+	})
+
+	return pkgs, err
+}
+
+// readPythonMetadata returns the package described by the Python core
+// metadata file path, and whether it describes a package.
+func readPythonMetadata(path string) (Package, bool, error) {
+	paragraphs, err := readFields(path, true)
+	if err != nil || len(paragraphs) == 0 {
+		return Package{}, false, err
+	}
+
+	p := paragraphs[0]
+	if p["Name"] == "" {
+		return Package{}, false, nil
+	}
+
+	license := p["License"]
+	if license == "UNKNOWN" || strings.Contains(license, "\n") {
+		// license texts are sometimes used instead of a license name
+		license = ""
+	}
+
+	return Package{
+		Type:    TypePyPI,
+		Name:    p["Name"],
+		Version: p["Version"],
+		License: license,
+	}, true, nil
+}
+
+// condaMeta is the package metadata of a conda-meta JSON file.
+type condaMeta struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Subdir  string `json:"subdir"`
+	License string `json:"license"`
+}
+
+// readConda returns the packages described by the JSON files of the
+// conda-meta directory dir.
+func readConda(dir string) ([]Package, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var pkgs []Package
+
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		var meta condaMeta
+		if err := json.Unmarshal(data, &meta); err != nil {
+			sylog.Debugf("Skipping conda metadata %s: %s", file, err)
+			continue
+		}
+		if meta.Name == "" {
+			continue
+		}
+
+		arch := meta.Subdir
+		if arch == "noarch" {
+			arch = ""
+		}
+		pkgs = append(pkgs, Package{
+			Type:    TypeConda,
+			Name:    meta.Name,
+			Version: meta.Version,
+			Arch:    arch,
+			License: meta.License,
+		})
+	}
+
+	return pkgs, nil
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package sbom collects the packages installed in a container root
+// filesystem, and describes them in an SPDX software bill of materials.
+package sbom
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hpcng/singularity/pkg/sylog"
+)
+
+// Package types, as package URL types.
+const (
+	TypeDeb   = "deb"
+	TypeRPM   = "rpm"
+	TypeApk   = "apk"
+	TypePyPI  = "pypi"
+	TypeConda = "conda"
+)
+
+// Package is a package installed in a root filesystem.
+type Package struct {
+	// Type is the package URL type of the package manager.
+	Type string
+	// Name is the package name.
+	Name string
+	// Version is the package version.
+	Version string
+	// Arch is the package architecture, if any.
+	Arch string
+	// License is the license declared by the package, if any.
+	License string
+}
+
+// PURL returns the package URL of the package, distro is the ID of the
+// distribution of the root filesystem.
+func (p Package) PURL(distro string) string {
+	var purl string
+
+	switch p.Type {
+	case TypeDeb, TypeRPM, TypeApk:
+		if distro == "" {
+			distro = "unknown"
+		}
+		purl = fmt.Sprintf("pkg:%s/%s/%s@%s", p.Type, distro, url.PathEscape(p.Name), url.QueryEscape(p.Version))
+	case TypePyPI:
+		// PyPI names are case insensitive, and '_' is equivalent to '-'
+		name := strings.ReplaceAll(strings.ToLower(p.Name), "_", "-")
+		purl = fmt.Sprintf("pkg:%s/%s@%s", p.Type, url.PathEscape(name), url.QueryEscape(p.Version))
+	default:
+		purl = fmt.Sprintf("pkg:%s/%s@%s", p.Type, url.PathEscape(p.Name), url.QueryEscape(p.Version))
+	}
+
+	if p.Arch != "" {
+		purl += "?arch=" + url.QueryEscape(p.Arch)
+	}
+	return purl
+}
+
+// collector returns the packages of a package manager found in rootfs.
+type collector func(rootfs string) ([]Package, error)
+
+var collectors = []struct {
+	name    string
+	collect collector
+}{
+	{"dpkg", collectDpkg},
+	{"apk", collectApk},
+	{"rpm", collectRPM},
+	{"python", collectPython},
+}
+
+// Collect returns the packages installed in rootfs by the dpkg, rpm and
+// apk package managers, and the pip and conda Python packages, sorted
+// by type, name and version.
+func Collect(rootfs string) ([]Package, error) {
+	var pkgs []Package
+
+	for _, c := range collectors {
+		p, err := c.collect(rootfs)
+		if err != nil {
+			return nil, fmt.Errorf("while collecting %s packages: %s", c.name, err)
+		}
+		sylog.Debugf("Found %d %s packages", len(p), c.name)
+		pkgs = append(pkgs, p...)
+	}
+
+	sort.Slice(pkgs, func(i, j int) bool {
+		if pkgs[i].Type != pkgs[j].Type {
+			return pkgs[i].Type < pkgs[j].Type
+		}
+		if pkgs[i].Name != pkgs[j].Name {
+			return pkgs[i].Name < pkgs[j].Name
+		}
+		if pkgs[i].Version != pkgs[j].Version {
+			return pkgs[i].Version < pkgs[j].Version
+		}
+		return pkgs[i].Arch < pkgs[j].Arch
+	})
+
+	// packages can be found twice, e.g. with an egg-info file and directory
+	uniq := pkgs[:0]
+	for i, p := range pkgs {
+		if i > 0 && p == pkgs[i-1] {
+			continue
+		}
+		uniq = append(uniq, p)
+	}
+
+	return uniq, nil
+}
+
+// Distro returns the ID of the distribution of rootfs read from its
+// os-release file, or an empty string if not found.
+func Distro(rootfs string) string {
+	for _, path := range []string{"etc/os-release", "usr/lib/os-release"} {
+		f, err := os.Open(filepath.Join(rootfs, path))
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if strings.HasPrefix(line, "ID=") {
+				return strings.Trim(strings.TrimPrefix(line, "ID="), `"'`)
+			}
+		}
+		return ""
+	}
+	return ""
+}
+
+// readFields reads the paragraphs of "Key: value" fields of the file path,
+// separated by empty lines, as used by the dpkg, apk and Python package
+// metadata. Continuation lines starting with a space are appended to the
+// previous field. Only the first paragraph is read if firstOnly is true.
+// It returns no paragraph if the file doesn't exist.
+func readFields(path string, firstOnly bool) ([]map[string]string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var paragraphs []map[string]string
+	fields := make(map[string]string)
+	last := ""
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if strings.TrimSpace(line) == "" {
+			if len(fields) > 0 {
+				paragraphs = append(paragraphs, fields)
+				if firstOnly {
+					return paragraphs, nil
+				}
+				fields = make(map[string]string)
+			}
+			last = ""
+			continue
+		}
+
+		if line[0] == ' ' || line[0] == '\t' {
+			if last != "" {
+				fields[last] += "\n" + strings.TrimSpace(line)
+			}
+			continue
+		}
+
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		last = strings.TrimSpace(kv[0])
+		// keep the first occurrence of repeated fields
+		if _, ok := fields[last]; !ok {
+			fields[last] = strings.TrimSpace(kv[1])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(fields) > 0 {
+		paragraphs = append(paragraphs, fields)
+	}
+
+	return paragraphs, nil
+}
@@ -0,0 +1,190 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sbom
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const dpkgStatus = `Package: libc6
+Status: install ok installed
+Architecture: amd64
+Version: 2.31-13+deb11u2
+Description: GNU C Library: Shared libraries
+ Contains the standard libraries that are used by nearly all programs on
+ the system.
+
+Package: removed
+Status: deinstall ok config-files
+Architecture: amd64
+Version: 1.0
+
+Package: bash
+Status: install ok installed
+Architecture: amd64
+Version: 5.1-2+b3
+`
+
+const apkInstalled = `C:Q1abc=
+P:musl
+V:1.2.2-r7
+A:x86_64
+L:MIT
+
+C:Q1def=
+P:busybox
+V:1.34.1-r3
+A:x86_64
+L:GPL-2.0-only
+`
+
+const pythonMetadata = `Metadata-Version: 2.1
+Name: PyYAML
+Version: 6.0
+License: MIT
+
+Description: YAML parser and emitter for Python
+Name: NotAPackage
+`
+
+const condaMetadata = `{
+  "name": "numpy",
+  "version": "1.21.2",
+  "subdir": "linux-64",
+  "license": "BSD-3-Clause"
+}`
+
+func writeFile(t *testing.T, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("failed to create directory: %s", err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write %s: %s", path, err)
+	}
+}
+
+func TestCollect(t *testing.T) {
+	rootfs, err := ioutil.TempDir("", "sbom-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(rootfs)
+
+	writeFile(t, filepath.Join(rootfs, "var/lib/dpkg/status"), dpkgStatus)
+	writeFile(t, filepath.Join(rootfs, "lib/apk/db/installed"), apkInstalled)
+	writeFile(t, filepath.Join(rootfs, "usr/lib/python3/dist-packages/PyYAML-6.0.dist-info/METADATA"), pythonMetadata)
+	// a dist-info directory outside of site-packages is not an installed package
+	writeFile(t, filepath.Join(rootfs, "opt/src/PyYAML-5.0.dist-info/METADATA"), pythonMetadata)
+	writeFile(t, filepath.Join(rootfs, "opt/conda/conda-meta/numpy-1.21.2-py39_0.json"), condaMetadata)
+	writeFile(t, filepath.Join(rootfs, "etc/os-release"), "NAME=\"Debian GNU/Linux\"\nID=debian\n")
+
+	pkgs, err := Collect(rootfs)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := []Package{
+		{Type: TypeApk, Name: "busybox", Version: "1.34.1-r3", Arch: "x86_64", License: "GPL-2.0-only"},
+		{Type: TypeApk, Name: "musl", Version: "1.2.2-r7", Arch: "x86_64", License: "MIT"},
+		{Type: TypeConda, Name: "numpy", Version: "1.21.2", Arch: "linux-64", License: "BSD-3-Clause"},
+		{Type: TypeDeb, Name: "bash", Version: "5.1-2+b3", Arch: "amd64"},
+		{Type: TypeDeb, Name: "libc6", Version: "2.31-13+deb11u2", Arch: "amd64"},
+		{Type: TypePyPI, Name: "PyYAML", Version: "6.0", License: "MIT"},
+	}
+	if !reflect.DeepEqual(pkgs, want) {
+		t.Errorf("unexpected packages:\ngot  %+v\nwant %+v", pkgs, want)
+	}
+
+	if distro := Distro(rootfs); distro != "debian" {
+		t.Errorf("unexpected distro: got %q, want debian", distro)
+	}
+}
+
+func TestParseRPMQuery(t *testing.T) {
+	out := "bash\t5.1.8-2.el9\tx86_64\tGPLv3+\n" +
+		"gpg-pubkey\t8483c65d-5ccc5b19\t(none)\tpubkey\n" +
+		"shadow-utils\t2:4.9-3.el9\tx86_64\tBSD and GPLv2+\n"
+
+	want := []Package{
+		{Type: TypeRPM, Name: "bash", Version: "5.1.8-2.el9", Arch: "x86_64", License: "GPLv3+"},
+		{Type: TypeRPM, Name: "shadow-utils", Version: "2:4.9-3.el9", Arch: "x86_64", License: "BSD and GPLv2+"},
+	}
+	if got := parseRPMQuery([]byte(out)); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected packages:\ngot  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestPURL(t *testing.T) {
+	tests := []struct {
+		pkg    Package
+		distro string
+		want   string
+	}{
+		{
+			pkg:    Package{Type: TypeDeb, Name: "libc6", Version: "2.31-13+deb11u2", Arch: "amd64"},
+			distro: "debian",
+			want:   "pkg:deb/debian/libc6@2.31-13%2Bdeb11u2?arch=amd64",
+		},
+		{
+			pkg:    Package{Type: TypeRPM, Name: "shadow-utils", Version: "2:4.9-3.el9", Arch: "x86_64"},
+			distro: "rocky",
+			want:   "pkg:rpm/rocky/shadow-utils@2%3A4.9-3.el9?arch=x86_64",
+		},
+		{
+			pkg:  Package{Type: TypeApk, Name: "musl", Version: "1.2.2-r7"},
+			want: "pkg:apk/unknown/musl@1.2.2-r7",
+		},
+		{
+			pkg:  Package{Type: TypePyPI, Name: "Typing_Extensions", Version: "3.10.0.2"},
+			want: "pkg:pypi/typing-extensions@3.10.0.2",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := tt.pkg.PURL(tt.distro); got != tt.want {
+			t.Errorf("unexpected purl: got %s, want %s", got, tt.want)
+		}
+	}
+}
+
+func TestNewSPDX(t *testing.T) {
+	pkgs := []Package{
+		{Type: TypeDeb, Name: "bash", Version: "5.1-2+b3", Arch: "amd64", License: "GPL-3"},
+	}
+	created := time.Unix(1600000000, 0)
+
+	doc, err := NewSPDX("image.sif", "debian", "Tool: singularity", created, pkgs)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if doc.CreationInfo.Created != "2020-09-13T12:26:40Z" {
+		t.Errorf("unexpected creation time: %s", doc.CreationInfo.Created)
+	}
+	if len(doc.Packages) != 2 || len(doc.Relationships) != 2 {
+		t.Fatalf("unexpected packages or relationships: %+v", doc)
+	}
+	p := doc.Packages[1]
+	if p.Name != "bash" || p.VersionInfo != "5.1-2+b3" || p.LicenseComments != "Declared license: GPL-3" {
+		t.Errorf("unexpected package: %+v", p)
+	}
+	if p.ExternalRefs[0].ReferenceLocator != "pkg:deb/debian/bash@5.1-2%2Bb3?arch=amd64" {
+		t.Errorf("unexpected package URL: %s", p.ExternalRefs[0].ReferenceLocator)
+	}
+
+	other, err := NewSPDX("image.sif", "debian", "Tool: singularity", created, pkgs)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if doc.DocumentNamespace != other.DocumentNamespace {
+		t.Errorf("document namespaces differ for identical inputs: %s and %s", doc.DocumentNamespace, other.DocumentNamespace)
+	}
+}
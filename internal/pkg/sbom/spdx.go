@@ -0,0 +1,143 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sbom
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	spdxVersion     = "SPDX-2.2"
+	spdxDataLicense = "CC0-1.0"
+	spdxNoAssertion = "NOASSERTION"
+	spdxDocumentID  = "SPDXRef-DOCUMENT"
+	spdxImageID     = "SPDXRef-Image"
+	spdxNamespace   = "https://sylabs.io/spdx/"
+)
+
+// Document is an SPDX document in the JSON format.
+type Document struct {
+	SPDXVersion       string         `json:"spdxVersion"`
+	DataLicense       string         `json:"dataLicense"`
+	SPDXID            string         `json:"SPDXID"`
+	Name              string         `json:"name"`
+	DocumentNamespace string         `json:"documentNamespace"`
+	CreationInfo      CreationInfo   `json:"creationInfo"`
+	Packages          []SPDXPackage  `json:"packages"`
+	Relationships     []Relationship `json:"relationships"`
+}
+
+// CreationInfo is the creation information of an SPDX document.
+type CreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+// SPDXPackage is a package of an SPDX document.
+type SPDXPackage struct {
+	SPDXID           string        `json:"SPDXID"`
+	Name             string        `json:"name"`
+	VersionInfo      string        `json:"versionInfo,omitempty"`
+	DownloadLocation string        `json:"downloadLocation"`
+	FilesAnalyzed    bool          `json:"filesAnalyzed"`
+	LicenseConcluded string        `json:"licenseConcluded"`
+	LicenseDeclared  string        `json:"licenseDeclared"`
+	LicenseComments  string        `json:"licenseComments,omitempty"`
+	CopyrightText    string        `json:"copyrightText"`
+	ExternalRefs     []ExternalRef `json:"externalRefs,omitempty"`
+}
+
+// ExternalRef is an external reference of an SPDX package.
+type ExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+// Relationship is a relationship between SPDX elements.
+type Relationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// NewSPDX returns the SPDX document of the image name containing the
+// packages pkgs, installed in a root filesystem of the distribution distro.
+// The document namespace is derived from its content, so identical
+// inputs give identical documents.
+func NewSPDX(name, distro, creator string, created time.Time, pkgs []Package) (*Document, error) {
+	doc := &Document{
+		SPDXVersion: spdxVersion,
+		DataLicense: spdxDataLicense,
+		SPDXID:      spdxDocumentID,
+		Name:        name,
+		CreationInfo: CreationInfo{
+			Created:  created.UTC().Format(time.RFC3339),
+			Creators: []string{creator},
+		},
+		Packages: []SPDXPackage{
+			{
+				SPDXID:           spdxImageID,
+				Name:             name,
+				DownloadLocation: spdxNoAssertion,
+				LicenseConcluded: spdxNoAssertion,
+				LicenseDeclared:  spdxNoAssertion,
+				CopyrightText:    spdxNoAssertion,
+			},
+		},
+		Relationships: []Relationship{
+			{
+				SPDXElementID:      spdxDocumentID,
+				RelationshipType:   "DESCRIBES",
+				RelatedSPDXElement: spdxImageID,
+			},
+		},
+	}
+
+	for i, p := range pkgs {
+		id := fmt.Sprintf("SPDXRef-Package-%s-%d", p.Type, i)
+
+		sp := SPDXPackage{
+			SPDXID:           id,
+			Name:             p.Name,
+			VersionInfo:      p.Version,
+			DownloadLocation: spdxNoAssertion,
+			LicenseConcluded: spdxNoAssertion,
+			// declared licenses are free form and not always valid
+			// SPDX license expressions
+			LicenseDeclared: spdxNoAssertion,
+			CopyrightText:   spdxNoAssertion,
+			ExternalRefs: []ExternalRef{
+				{
+					ReferenceCategory: "PACKAGE-MANAGER",
+					ReferenceType:     "purl",
+					ReferenceLocator:  p.PURL(distro),
+				},
+			},
+		}
+		if p.License != "" {
+			sp.LicenseComments = "Declared license: " + p.License
+		}
+
+		doc.Packages = append(doc.Packages, sp)
+		doc.Relationships = append(doc.Relationships, Relationship{
+			SPDXElementID:      spdxImageID,
+			RelationshipType:   "CONTAINS",
+			RelatedSPDXElement: id,
+		})
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	doc.DocumentNamespace = fmt.Sprintf("%s%s-%x", spdxNamespace, name, sha256.Sum256(data))
+
+	return doc, nil
+}
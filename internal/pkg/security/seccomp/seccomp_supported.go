@@ -12,6 +12,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"sort"
 	"syscall"
 
 	"github.com/hpcng/singularity/internal/pkg/runtime/engine/config/oci/generate"
@@ -47,6 +48,7 @@ var scmpActionMap = map[specs.LinuxSeccompAction]lseccomp.ScmpAction{
 	specs.ActErrno: lseccomp.ActErrno,
 	specs.ActTrace: lseccomp.ActTrace,
 	specs.ActAllow: lseccomp.ActAllow,
+	specs.ActLog:   lseccomp.ActLog,
 }
 
 var scmpCompareOpMap = map[specs.LinuxSeccompOperator]lseccomp.ScmpCompareOp{
@@ -220,3 +222,46 @@ func LoadProfileFromFile(profile string, generator *generate.Generator) error {
 
 	return nil
 }
+
+// traceProfile returns a profile allowing the traced syscalls, and denying all others.
+func traceProfile(syscalls []TracedSyscall) (*specs.LinuxSeccomp, error) {
+	profile := &specs.LinuxSeccomp{
+		DefaultAction: specs.ActErrno,
+	}
+
+	archs := make(map[specs.Arch]bool)
+	names := make(map[string]bool)
+
+	for _, s := range syscalls {
+		scmpArch, ok := scmpArchMap[s.Arch]
+		if !ok {
+			return nil, fmt.Errorf("invalid architecture '%s' specified", s.Arch)
+		}
+		name, err := lseccomp.ScmpSyscall(s.Number).GetNameByArch(scmpArch)
+		if err != nil {
+			sylog.Warningf("Ignoring unknown syscall %d for architecture %s", s.Number, s.Arch)
+			continue
+		}
+
+		if !archs[s.Arch] {
+			archs[s.Arch] = true
+			profile.Architectures = append(profile.Architectures, s.Arch)
+		}
+		names[name] = true
+	}
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no syscall traced")
+	}
+
+	rule := specs.LinuxSyscall{
+		Action: specs.ActAllow,
+	}
+	for name := range names {
+		rule.Names = append(rule.Names, name)
+	}
+	sort.Strings(rule.Names)
+	profile.Syscalls = []specs.LinuxSyscall{rule}
+
+	return profile, nil
+}
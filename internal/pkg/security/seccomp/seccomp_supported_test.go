@@ -11,12 +11,15 @@ package seccomp
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
 	"syscall"
 	"testing"
 
 	"github.com/hpcng/singularity/internal/pkg/runtime/engine/config/oci/generate"
 	"github.com/hpcng/singularity/internal/pkg/test"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
+	lseccomp "github.com/seccomp/libseccomp-golang"
 )
 
 func defaultProfile() *specs.LinuxSeccomp {
@@ -98,3 +101,53 @@ func TestLoadProfileFromFile(t *testing.T) {
 
 	testFchmod(t)
 }
+
+func TestWriteTraceProfile(t *testing.T) {
+	native, err := lseccomp.GetNativeArch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var arch specs.Arch
+	for a, scmpArch := range scmpArchMap {
+		if a != "" && scmpArch == native {
+			arch = a
+		}
+	}
+
+	var syscalls []TracedSyscall
+	for _, name := range []string{"write", "read", "read"} {
+		nr, err := lseccomp.GetSyscallFromName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		syscalls = append(syscalls, TracedSyscall{Arch: arch, Number: int(nr)})
+	}
+
+	path := filepath.Join(t.TempDir(), "profile.json")
+
+	if err := WriteTraceProfile(path, nil); err == nil {
+		t.Errorf("should have failed without traced syscalls")
+	}
+	if err := WriteTraceProfile(path, syscalls); err != nil {
+		t.Fatal(err)
+	}
+
+	gen := generate.New(nil)
+	if err := LoadProfileFromFile(path, gen); err != nil {
+		t.Fatal(err)
+	}
+
+	profile := gen.Config.Linux.Seccomp
+	if got, want := profile.DefaultAction, specs.ActErrno; got != want {
+		t.Errorf("got default action %v, want %v", got, want)
+	}
+	if got, want := len(profile.Syscalls), 1; got != want {
+		t.Fatalf("got %v syscall rules, want %v", got, want)
+	}
+	if got, want := profile.Syscalls[0].Names, []string{"read", "write"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got syscalls %v, want %v", got, want)
+	}
+	if got, want := profile.Syscalls[0].Action, specs.ActAllow; got != want {
+		t.Errorf("got action %v, want %v", got, want)
+	}
+}
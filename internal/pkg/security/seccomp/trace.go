@@ -0,0 +1,214 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package seccomp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+// kmsgPath is the kernel log device, where the kernel audit subsystem
+// writes seccomp records when no audit daemon is running.
+const kmsgPath = "/dev/kmsg"
+
+const (
+	// auditTypeSeccomp is the type of kernel audit records of seccomp actions.
+	auditTypeSeccomp = "1326"
+	// retLog is the seccomp return value of a syscall allowed after being logged.
+	retLog = "0x7ffc0000"
+)
+
+// traceReadRetries is the maximum number of times the kernel log is read
+// again when collecting syscalls, while records are still being logged.
+const traceReadRetries = 10
+
+// auditArchMap maps the AUDIT_ARCH_* values used in audit records to architectures.
+var auditArchMap = map[uint32]specs.Arch{
+	0x40000003: specs.ArchX86,
+	0xc000003e: specs.ArchX86_64,
+	0x40000028: specs.ArchARM,
+	0xc00000b7: specs.ArchAARCH64,
+	0x00000008: specs.ArchMIPS,
+	0x80000008: specs.ArchMIPS64,
+	0xa0000008: specs.ArchMIPS64N32,
+	0x40000008: specs.ArchMIPSEL,
+	0xc0000008: specs.ArchMIPSEL64,
+	0xe0000008: specs.ArchMIPSEL64N32,
+	0x00000014: specs.ArchPPC,
+	0x80000015: specs.ArchPPC64,
+	0xc0000015: specs.ArchPPC64LE,
+	0x00000016: specs.ArchS390,
+	0x80000016: specs.ArchS390X,
+}
+
+// TracedSyscall is a syscall logged by the kernel for a traced process.
+type TracedSyscall struct {
+	Arch   specs.Arch
+	Number int
+}
+
+// TraceConfig returns the seccomp configuration of a traced container: all
+// syscalls are allowed and logged by the kernel audit subsystem, to be
+// collected by a Tracer.
+func TraceConfig() *specs.LinuxSeccomp {
+	return &specs.LinuxSeccomp{
+		DefaultAction: specs.ActLog,
+	}
+}
+
+// parseTraceRecord returns the syscall logged in the kernel log record rec
+// if it is a seccomp record of a process run by uid under the trace filter.
+func parseTraceRecord(rec string, uid int) (TracedSyscall, bool) {
+	// kernel log records are formatted as "<prefix>;<message>\n",
+	// possibly followed by continuation lines
+	if i := strings.IndexByte(rec, ';'); i >= 0 {
+		rec = rec[i+1:]
+	}
+	if i := strings.IndexByte(rec, '\n'); i >= 0 {
+		rec = rec[:i]
+	}
+
+	// untrusted values, such as the command name, are either quoted
+	// or hex encoded by the kernel, they never contain spaces
+	fields := make(map[string]string)
+	for _, f := range strings.Fields(rec) {
+		if kv := strings.SplitN(f, "=", 2); len(kv) == 2 {
+			if _, ok := fields[kv[0]]; !ok {
+				fields[kv[0]] = kv[1]
+			}
+		}
+	}
+
+	if fields["type"] != auditTypeSeccomp || fields["code"] != retLog {
+		return TracedSyscall{}, false
+	}
+	if fields["uid"] != strconv.Itoa(uid) {
+		return TracedSyscall{}, false
+	}
+
+	arch, err := strconv.ParseUint(fields["arch"], 16, 32)
+	if err != nil {
+		return TracedSyscall{}, false
+	}
+	specArch, ok := auditArchMap[uint32(arch)]
+	if !ok {
+		return TracedSyscall{}, false
+	}
+	nr, err := strconv.Atoi(fields["syscall"])
+	if err != nil {
+		return TracedSyscall{}, false
+	}
+
+	return TracedSyscall{Arch: specArch, Number: nr}, true
+}
+
+// Tracer collects the syscalls logged by the kernel for the processes of a
+// user running with the seccomp configuration returned by TraceConfig.
+type Tracer struct {
+	fd  int
+	uid int
+}
+
+// NewTracer returns a Tracer collecting syscalls made by uid from now on.
+// Reading the kernel log usually requires privileges.
+func NewTracer(uid int) (*Tracer, error) {
+	fd, err := unix.Open(kmsgPath, unix.O_RDONLY|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("while opening %s: %s", kmsgPath, err)
+	}
+	// skip records logged before the container started
+	if _, err := unix.Seek(fd, 0, unix.SEEK_END); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("while seeking %s: %s", kmsgPath, err)
+	}
+	return &Tracer{fd: fd, uid: uid}, nil
+}
+
+// read adds to syscalls the syscalls logged since the last read, and returns
+// the number of records read.
+func (t *Tracer) read(syscalls map[TracedSyscall]struct{}) (int, error) {
+	n := 0
+	buf := make([]byte, 8192)
+	for {
+		// each read returns a single record
+		l, err := unix.Read(t.fd, buf)
+		if err == unix.EAGAIN {
+			return n, nil
+		} else if err == unix.EPIPE {
+			// records were overwritten before being read
+			continue
+		} else if err != nil {
+			return n, fmt.Errorf("while reading %s: %s", kmsgPath, err)
+		}
+		n++
+
+		if s, ok := parseTraceRecord(string(buf[:l]), t.uid); ok {
+			syscalls[s] = struct{}{}
+		}
+	}
+}
+
+// Syscalls returns the syscalls logged since the Tracer was created, sorted by
+// architecture and number.
+func (t *Tracer) Syscalls() ([]TracedSyscall, error) {
+	m := make(map[TracedSyscall]struct{})
+
+	// audit records are logged asynchronously by the kernel, wait until
+	// no record is logged for a while
+	for i := 0; i < traceReadRetries; i++ {
+		n, err := t.read(m)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	syscalls := make([]TracedSyscall, 0, len(m))
+	for s := range m {
+		syscalls = append(syscalls, s)
+	}
+	sort.Slice(syscalls, func(i, j int) bool {
+		if syscalls[i].Arch != syscalls[j].Arch {
+			return syscalls[i].Arch < syscalls[j].Arch
+		}
+		return syscalls[i].Number < syscalls[j].Number
+	})
+	return syscalls, nil
+}
+
+// Close closes the kernel log.
+func (t *Tracer) Close() error {
+	return unix.Close(t.fd)
+}
+
+// WriteTraceProfile writes to path the profile allowing syscalls, and denying
+// all others, in the format read by LoadProfileFromFile.
+func WriteTraceProfile(path string, syscalls []TracedSyscall) error {
+	profile, err := traceProfile(syscalls)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(profile, "", "\t")
+	if err != nil {
+		return fmt.Errorf("while encoding seccomp profile: %s", err)
+	}
+	if err := ioutil.WriteFile(path, append(b, '\n'), 0o644); err != nil {
+		return fmt.Errorf("while writing seccomp profile: %s", err)
+	}
+	return nil
+}
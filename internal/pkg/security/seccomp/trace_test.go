@@ -0,0 +1,96 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package seccomp
+
+import (
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestParseTraceRecord(t *testing.T) {
+	const record = `audit: type=1326 audit(1634567890.123:45): auid=1000 uid=1000 gid=1000 ses=3 ` +
+		`subj=unconfined pid=4321 comm="ls" exe="/usr/bin/ls" sig=0 arch=c000003e syscall=257 ` +
+		`compat=0 ip=0x7f1e2d3c4b5a code=0x7ffc0000`
+
+	tests := []struct {
+		name   string
+		record string
+		uid    int
+		want   TracedSyscall
+		wantOk bool
+	}{
+		{
+			name:   "Logged",
+			record: "5,1234,5678901,-;" + record + "\n",
+			uid:    1000,
+			want:   TracedSyscall{Arch: specs.ArchX86_64, Number: 257},
+			wantOk: true,
+		},
+		{
+			name:   "Continuation",
+			record: "5,1234,5678901,-;" + record + "\n SUBSYSTEM=audit\n",
+			uid:    1000,
+			want:   TracedSyscall{Arch: specs.ArchX86_64, Number: 257},
+			wantOk: true,
+		},
+		{
+			name:   "AArch64",
+			record: "5,1234,5678901,-;audit: type=1326 uid=0 arch=c00000b7 syscall=56 code=0x7ffc0000\n",
+			uid:    0,
+			want:   TracedSyscall{Arch: specs.ArchAARCH64, Number: 56},
+			wantOk: true,
+		},
+		{
+			name:   "OtherUser",
+			record: "5,1234,5678901,-;" + record + "\n",
+			uid:    1001,
+		},
+		{
+			name:   "AuditUserOnly",
+			record: "5,1234,5678901,-;audit: type=1326 auid=1000 uid=0 arch=c000003e syscall=257 code=0x7ffc0000\n",
+			uid:    1000,
+		},
+		{
+			name:   "Killed",
+			record: "5,1234,5678901,-;audit: type=1326 uid=1000 arch=c000003e syscall=257 code=0x0\n",
+			uid:    1000,
+		},
+		{
+			name:   "OtherType",
+			record: "5,1234,5678901,-;audit: type=1400 uid=1000 arch=c000003e syscall=257 code=0x7ffc0000\n",
+			uid:    1000,
+		},
+		{
+			name:   "UnknownArch",
+			record: "5,1234,5678901,-;audit: type=1326 uid=1000 arch=deadbeef syscall=257 code=0x7ffc0000\n",
+			uid:    1000,
+		},
+		{
+			name:   "BadSyscall",
+			record: "5,1234,5678901,-;audit: type=1326 uid=1000 arch=c000003e syscall=open code=0x7ffc0000\n",
+			uid:    1000,
+		},
+		{
+			name:   "NotAudit",
+			record: "6,1235,5678902,-;EXT4-fs (sda1): mounted filesystem with ordered data mode\n",
+			uid:    1000,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseTraceRecord(tt.record, tt.uid)
+			if ok != tt.wantOk {
+				t.Fatalf("got ok %v, want %v", ok, tt.wantOk)
+			}
+			if got != tt.want {
+				t.Errorf("got syscall %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,461 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package syecl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hpcng/sif/pkg/sif"
+	"github.com/hpcng/singularity/internal/pkg/image/squashfs"
+	"github.com/hpcng/singularity/internal/pkg/util/x509sig"
+	"golang.org/x/crypto/openpgp"
+)
+
+const (
+	actionAllow = "allow"
+	actionDeny  = "deny"
+)
+
+var (
+	errDeniedByRule       = errors.New("image denied by ECL")
+	errLabelsNotAvailable = errors.New("labels not available")
+)
+
+// Rule describes an ECL rule. Rules are evaluated in order, and the action of the first rule
+// matching an image applies:
+//	Name: a descriptive identifier
+//	Action: whether images matching the rule are allowed or denied: allow or deny
+//	DirPath: images must be stored in this directory path
+//	Digests: SHA256 digests of images, as hex strings optionally prefixed with "sha256:"
+//	Labels: label names and values of images, values are glob patterns
+//	KeyFPs: fingerprints of PGP keys signing images
+//	Signers: glob patterns matching the user IDs or email addresses of PGP keys, or the
+//		subjects, common names or email addresses of X.509 certificates signing images
+// An image matches a rule when it matches all the set fields of the rule, and any entry of each
+// list. Allow rules match the entities that signed all objects of an image, deny rules those that
+// signed any object. Unsigned images match no signer, and rules with signers can not be evaluated
+// for images with invalid signatures, which are denied.
+type Rule struct {
+	Name    string            `toml:"name"`
+	Action  string            `toml:"action"`
+	DirPath string            `toml:"dirpath,omitempty"`
+	Digests []string          `toml:"digest,omitempty"`
+	Labels  map[string]string `toml:"labels,omitempty"`
+	KeyFPs  []string          `toml:"keyfp,omitempty"`
+	Signers []string          `toml:"signer,omitempty"`
+}
+
+// RuleResult describes the evaluation of an ECL rule, or execgroup, against an image.
+type RuleResult struct {
+	Name    string   // Name of the rule, or tag name of the execgroup.
+	Action  string   // Action of the rule, or list mode of the execgroup.
+	Matched bool     // Whether the rule matched the image.
+	Reasons []string // Why the rule matched the image, or did not.
+}
+
+// Decision describes the outcome of the evaluation of an image against the ECL.
+type Decision struct {
+	Allow   bool         // Whether the image is allowed to run.
+	Default bool         // Whether the default action applied, no rule matching the image.
+	Results []RuleResult // Evaluated rules, in order. The last one decided, unless Default is set.
+}
+
+// Reason returns a short description of the rule that decided d.
+func (d *Decision) Reason() string {
+	action := actionDeny
+	if d.Allow {
+		action = actionAllow
+	}
+
+	if d.Default || len(d.Results) == 0 {
+		return fmt.Sprintf("no rule matched, default action is %s", action)
+	}
+
+	r := d.Results[len(d.Results)-1]
+	return fmt.Sprintf("rule %q matched (%s): %s", r.Name, action, strings.Join(r.Reasons, ", "))
+}
+
+// hasRules returns true if ecl uses ordered rules instead of execgroups.
+func (ecl *EclConfig) hasRules() bool {
+	return len(ecl.Rules) > 0 || ecl.Default != ""
+}
+
+// validateRules makes sure rules and the default action of ecl are logically correct.
+func (ecl *EclConfig) validateRules() error {
+	if ecl.Default != actionAllow && ecl.Default != actionDeny {
+		return fmt.Errorf("the default field is required with rules, and can only be either: allow, deny")
+	}
+
+	for i, r := range ecl.Rules {
+		if r.Action != actionAllow && r.Action != actionDeny {
+			return fmt.Errorf("rule %d: the action field can only be either: allow, deny", i+1)
+		}
+		if err := validateDirPath(r.DirPath); err != nil {
+			return fmt.Errorf("rule %d: %s", i+1, err)
+		}
+		for _, d := range r.Digests {
+			decoded, err := hex.DecodeString(strings.TrimPrefix(d, "sha256:"))
+			if err != nil || len(decoded) != sha256.Size {
+				return fmt.Errorf("rule %d: expecting a 64 chars hex SHA256 digest string", i+1)
+			}
+		}
+		for k, v := range r.Labels {
+			if _, err := path.Match(v, ""); err != nil {
+				return fmt.Errorf("rule %d: invalid pattern for label %s: %s", i+1, k, err)
+			}
+		}
+		if err := validateKeyFPs(r.KeyFPs); err != nil {
+			return fmt.Errorf("rule %d: %s", i+1, err)
+		}
+		for _, p := range r.Signers {
+			if _, err := path.Match(p, ""); err != nil {
+				return fmt.Errorf("rule %d: invalid signer pattern %s: %s", i+1, p, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// imageInfo gives access to the properties of an image matched by rules. They are computed on
+// first use, as computing some of them requires reading the whole image.
+type imageInfo struct {
+	ecl *EclConfig
+	fp  *os.File
+	kr  openpgp.KeyRing
+
+	f *sif.FileImage
+
+	digest string
+
+	labels    map[string]string
+	labelsErr error
+	hasLabels bool
+
+	all, any   signers
+	signersErr error
+	hasSigners bool
+}
+
+// getSIF returns the SIF image.
+func (i *imageInfo) getSIF() (*sif.FileImage, error) {
+	if i.f == nil {
+		f, err := sif.LoadContainerFp(i.fp, true)
+		if err != nil {
+			return nil, err
+		}
+		i.f = &f
+	}
+	return i.f, nil
+}
+
+// getDigest returns the SHA256 digest of the image file, as a hex string.
+func (i *imageInfo) getDigest() (string, error) {
+	if i.digest == "" {
+		fi, err := i.fp.Stat()
+		if err != nil {
+			return "", err
+		}
+
+		h := sha256.New()
+		if _, err := io.Copy(h, io.NewSectionReader(i.fp, 0, fi.Size())); err != nil {
+			return "", fmt.Errorf("while computing image digest: %s", err)
+		}
+		i.digest = hex.EncodeToString(h.Sum(nil))
+	}
+	return i.digest, nil
+}
+
+// readLabels returns the labels stored in the squashfs root filesystem of the image. An error
+// wrapping errLabelsNotAvailable is returned if the root filesystem cannot be read.
+func (i *imageInfo) readLabels() (map[string]string, error) {
+	f, err := i.getSIF()
+	if err != nil {
+		return nil, err
+	}
+
+	od, _, err := f.GetPartPrimSys()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errLabelsNotAvailable, err)
+	}
+	if fstype, err := od.GetFsType(); err != nil || fstype != sif.FsSquash {
+		return nil, fmt.Errorf("%w: root filesystem is not squashfs", errLabelsNotAvailable)
+	}
+
+	fsys, err := squashfs.New(io.NewSectionReader(i.fp, od.Fileoff, od.Filelen), od.Filelen)
+	if err != nil {
+		return nil, fmt.Errorf("while reading root filesystem: %s", err)
+	}
+
+	b, err := fs.ReadFile(fsys, ".singularity.d/labels.json")
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]string{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("while reading labels: %s", err)
+	}
+
+	labels := make(map[string]string)
+	if err := json.Unmarshal(b, &labels); err != nil {
+		return nil, fmt.Errorf("while parsing labels: %s", err)
+	}
+	return labels, nil
+}
+
+// getLabels returns the labels of the image.
+func (i *imageInfo) getLabels() (map[string]string, error) {
+	if !i.hasLabels {
+		i.labels, i.labelsErr = i.readLabels()
+		i.hasLabels = true
+	}
+	return i.labels, i.labelsErr
+}
+
+// getSigners returns the verified identities that signed all, and any, objects of the image.
+func (i *imageInfo) getSigners() (all, any signers, err error) {
+	if !i.hasSigners {
+		if f, err := i.getSIF(); err != nil {
+			i.signersErr = err
+		} else {
+			i.all, i.any, i.signersErr = getSigners(i.ecl, f, i.kr)
+		}
+		i.hasSigners = true
+	}
+	return i.all, i.any, i.signersErr
+}
+
+// identities returns the identities of s: the user IDs and email addresses of PGP entities, and
+// the subjects, common names and email addresses of X.509 certificates.
+func (s signers) identities() []string {
+	var ids []string
+	for _, e := range s.entities {
+		for name, id := range e.Identities {
+			ids = append(ids, name)
+			if id.UserId != nil && id.UserId.Email != "" {
+				ids = append(ids, id.UserId.Email)
+			}
+		}
+	}
+	for _, chain := range s.chains {
+		ids = append(ids, chain[0].Subject.String())
+		if cn := chain[0].Subject.CommonName; cn != "" {
+			ids = append(ids, cn)
+		}
+		ids = append(ids, chain[0].EmailAddresses...)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// matchSigner returns the identity of s matching the glob pattern, ignoring case.
+func (s signers) matchSigner(pattern string) (string, bool) {
+	pattern = strings.ToLower(pattern)
+	for _, id := range s.identities() {
+		if ok, _ := path.Match(pattern, strings.ToLower(id)); ok {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// match evaluates r against the image i. The returned error is set if the image could not be
+// read, or if its signatures could not be verified, in which case the rule can not be evaluated.
+func (r *Rule) match(i *imageInfo) (ok bool, reasons []string, err error) {
+	if r.DirPath != "" {
+		if dir := filepath.Dir(i.fp.Name()); dir != r.DirPath {
+			return false, []string{fmt.Sprintf("image directory %s is not %s", dir, r.DirPath)}, nil
+		}
+		reasons = append(reasons, fmt.Sprintf("image directory is %s", r.DirPath))
+	}
+
+	if len(r.Digests) > 0 {
+		digest, err := i.getDigest()
+		if err != nil {
+			return false, nil, err
+		}
+
+		found := false
+		for _, d := range r.Digests {
+			if strings.EqualFold(strings.TrimPrefix(d, "sha256:"), digest) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, []string{fmt.Sprintf("image digest sha256:%s is not listed", digest)}, nil
+		}
+		reasons = append(reasons, fmt.Sprintf("image digest is sha256:%s", digest))
+	}
+
+	if len(r.Labels) > 0 {
+		labels, err := i.getLabels()
+		if errors.Is(err, errLabelsNotAvailable) {
+			return false, []string{err.Error()}, nil
+		} else if err != nil {
+			return false, nil, err
+		}
+
+		// Sort label names, so that reasons are stable.
+		names := make([]string, 0, len(r.Labels))
+		for k := range r.Labels {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+
+		for _, k := range names {
+			v, found := labels[k]
+			if !found {
+				return false, []string{fmt.Sprintf("label %s is not set", k)}, nil
+			}
+			if ok, _ := path.Match(r.Labels[k], v); !ok {
+				return false, []string{fmt.Sprintf("label %s=%s does not match %q", k, v, r.Labels[k])}, nil
+			}
+			reasons = append(reasons, fmt.Sprintf("label %s=%s matches %q", k, v, r.Labels[k]))
+		}
+	}
+
+	if len(r.KeyFPs) > 0 || len(r.Signers) > 0 {
+		f, err := i.getSIF()
+		if err != nil {
+			return false, nil, err
+		}
+		// X.509 signatures can only be verified with a CA bundle.
+		if !hasPGPSignatures(f) && (i.ecl.CABundle == "" || !x509sig.HasSignatures(f)) {
+			return false, []string{"image is not signed"}, nil
+		}
+
+		// Signatures that do not verify fail closed, so that a deny rule can not be bypassed by
+		// corrupting the signature of an image.
+		all, any, err := i.getSigners()
+		if err != nil {
+			return false, nil, fmt.Errorf("while verifying image signatures: %w", err)
+		}
+
+		s := all
+		if r.Action == actionDeny {
+			s = any
+		}
+
+		if len(r.KeyFPs) > 0 {
+			found := ""
+			for _, fp := range r.KeyFPs {
+				if s.hasKeyFP(fp) {
+					found = fp
+					break
+				}
+			}
+			if found == "" {
+				return false, []string{"not signed by a listed key"}, nil
+			}
+			reasons = append(reasons, fmt.Sprintf("signed by key %s", strings.ToUpper(found)))
+		}
+
+		if len(r.Signers) > 0 {
+			var id, pattern string
+			for _, p := range r.Signers {
+				if v, ok := s.matchSigner(p); ok {
+					id, pattern = v, p
+					break
+				}
+			}
+			if id == "" {
+				return false, []string{"not signed by a matching signer"}, nil
+			}
+			reasons = append(reasons, fmt.Sprintf("signer %q matches %q", id, pattern))
+		}
+	}
+
+	if len(reasons) == 0 {
+		reasons = append(reasons, "rule matches all images")
+	}
+	return true, reasons, nil
+}
+
+// evaluateRules evaluates the rules of ecl in order against the image opened as fp.
+func evaluateRules(ecl *EclConfig, fp *os.File, kr openpgp.KeyRing) (*Decision, error) {
+	i := &imageInfo{ecl: ecl, fp: fp, kr: kr}
+
+	var d Decision
+	for n, r := range ecl.Rules {
+		ok, reasons, err := r.match(i)
+		if err != nil {
+			return nil, err
+		}
+
+		name := r.Name
+		if name == "" {
+			name = fmt.Sprintf("rule %d", n+1)
+		}
+		d.Results = append(d.Results, RuleResult{
+			Name:    name,
+			Action:  r.Action,
+			Matched: ok,
+			Reasons: reasons,
+		})
+
+		if ok {
+			d.Allow = r.Action == actionAllow
+			return &d, nil
+		}
+	}
+
+	d.Default = true
+	d.Allow = ecl.Default == actionAllow
+	return &d, nil
+}
+
+// evaluateExecgroup evaluates the execgroup of ecl the image opened as fp is part of.
+func evaluateExecgroup(ecl *EclConfig, fp *os.File, kr openpgp.KeyRing) (*Decision, error) {
+	egroup, err := getExecgroup(ecl, fp)
+	if err != nil {
+		return nil, err
+	}
+
+	reason := fmt.Sprintf("image directory is %s", egroup.DirPath)
+	if egroup.DirPath == "" {
+		reason = "execgroup applies to images of any directory"
+	}
+
+	ok, err := checkExecgroup(ecl, egroup, fp, kr)
+	if err != nil && !errors.Is(err, errNotSignedByRequired) && !errors.Is(err, errSignedByForbidden) {
+		return nil, err
+	}
+
+	result := RuleResult{
+		Name:    egroup.TagName,
+		Action:  egroup.ListMode,
+		Matched: true,
+		Reasons: []string{reason},
+	}
+	if err != nil {
+		result.Reasons = append(result.Reasons, err.Error())
+	} else if egroup.ListMode == "blacklist" {
+		result.Reasons = append(result.Reasons, "image not signed by a forbidden entity")
+	} else {
+		result.Reasons = append(result.Reasons, "image signed by required entities")
+	}
+
+	return &Decision{Allow: ok, Results: []RuleResult{result}}, nil
+}
+
+// Check evaluates the image opened as fp against ecl, whether or not the ECL is activated, and
+// returns the decision along with the rules evaluated to reach it.
+func (ecl *EclConfig) Check(fp *os.File, kr openpgp.KeyRing) (*Decision, error) {
+	if ecl.hasRules() {
+		return evaluateRules(ecl, fp, kr)
+	}
+	return evaluateExecgroup(ecl, fp, kr)
+}
@@ -0,0 +1,545 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package syecl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/hpcng/sif/pkg/sif"
+	uuid "github.com/satori/go.uuid"
+	"golang.org/x/crypto/openpgp"
+)
+
+// fileDigest returns the SHA256 digest of the file at path.
+func fileDigest(t *testing.T, path string) string {
+	t.Helper()
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestValidateRules(t *testing.T) {
+	dirPath, err := filepath.Abs(filepath.Join("testdata", "images"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		c       EclConfig
+		wantErr bool
+	}{
+		{
+			name: "DefaultOnly",
+			c:    EclConfig{Activated: true, Default: "deny"},
+		},
+		{
+			name: "Rules",
+			c: EclConfig{Activated: true, Default: "deny", Rules: []Rule{
+				{Name: "digest", Action: "allow", Digests: []string{"sha256:" + KeyFP1 + KeyFP1[:24]}},
+				{Name: "labels", Action: "deny", DirPath: dirPath, Labels: map[string]string{"org.team": "hpc*"}},
+				{Name: "signer", Action: "allow", KeyFPs: []string{KeyFP2}, Signers: []string{"*@sylabs.io"}},
+			}},
+		},
+		{
+			name:    "NoDefault",
+			c:       EclConfig{Activated: true, Rules: []Rule{{Action: "allow"}}},
+			wantErr: true,
+		},
+		{
+			name:    "BadDefault",
+			c:       EclConfig{Activated: true, Default: "bad"},
+			wantErr: true,
+		},
+		{
+			name:    "BadAction",
+			c:       EclConfig{Activated: true, Default: "deny", Rules: []Rule{{Action: "whitelist"}}},
+			wantErr: true,
+		},
+		{
+			name:    "RelativePath",
+			c:       EclConfig{Activated: true, Default: "deny", Rules: []Rule{{Action: "allow", DirPath: "testdata"}}},
+			wantErr: true,
+		},
+		{
+			name:    "BadDigest",
+			c:       EclConfig{Activated: true, Default: "deny", Rules: []Rule{{Action: "allow", Digests: []string{KeyFP1}}}},
+			wantErr: true,
+		},
+		{
+			name:    "BadFingerprint",
+			c:       EclConfig{Activated: true, Default: "deny", Rules: []Rule{{Action: "allow", KeyFPs: []string{"bad"}}}},
+			wantErr: true,
+		},
+		{
+			name:    "BadLabelPattern",
+			c:       EclConfig{Activated: true, Default: "deny", Rules: []Rule{{Action: "allow", Labels: map[string]string{"a": "["}}}},
+			wantErr: true,
+		},
+		{
+			name:    "BadSignerPattern",
+			c:       EclConfig{Activated: true, Default: "deny", Rules: []Rule{{Action: "allow", Signers: []string{"["}}}},
+			wantErr: true,
+		},
+		{
+			name: "RulesAndExecgroups",
+			c: EclConfig{
+				Activated:  true,
+				Default:    "deny",
+				ExecGroups: []Execgroup{{ListMode: "whitelist", KeyFPs: []string{KeyFP1}}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.c.ValidateConfig(); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestShouldRunRules(t *testing.T) {
+	dirPath, err := filepath.Abs(filepath.Join("testdata", "images"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unsigned := filepath.Join(dirPath, "one-group.sif")
+	signed := filepath.Join(dirPath, "one-group-signed.sif")
+	signedDigest := fileDigest(t, signed)
+
+	tests := []struct {
+		name        string
+		def         string
+		rules       []Rule
+		path        string
+		wantAllow   bool
+		wantDefault bool
+		wantResults int
+	}{
+		{
+			name:        "DefaultAllow",
+			def:         "allow",
+			path:        unsigned,
+			wantAllow:   true,
+			wantDefault: true,
+		},
+		{
+			name:        "DefaultDeny",
+			def:         "deny",
+			path:        unsigned,
+			wantDefault: true,
+		},
+		{
+			name:        "DigestAllow",
+			def:         "deny",
+			rules:       []Rule{{Name: "digest", Action: "allow", Digests: []string{"sha256:" + signedDigest}}},
+			path:        signed,
+			wantAllow:   true,
+			wantResults: 1,
+		},
+		{
+			name:        "DigestNoMatch",
+			def:         "deny",
+			rules:       []Rule{{Name: "digest", Action: "allow", Digests: []string{signedDigest}}},
+			path:        unsigned,
+			wantDefault: true,
+			wantResults: 1,
+		},
+		{
+			name:        "DirPathDeny",
+			def:         "allow",
+			rules:       []Rule{{Name: "dir", Action: "deny", DirPath: dirPath}},
+			path:        unsigned,
+			wantResults: 1,
+		},
+		{
+			name:        "SignerEmail",
+			def:         "deny",
+			rules:       []Rule{{Name: "signer", Action: "allow", Signers: []string{"*@TEST.com"}}},
+			path:        signed,
+			wantAllow:   true,
+			wantResults: 1,
+		},
+		{
+			name:        "SignerUserID",
+			def:         "deny",
+			rules:       []Rule{{Name: "signer", Action: "allow", Signers: []string{"Unit Test <*>"}}},
+			path:        signed,
+			wantAllow:   true,
+			wantResults: 1,
+		},
+		{
+			name:        "SignerNoMatch",
+			def:         "deny",
+			rules:       []Rule{{Name: "signer", Action: "allow", Signers: []string{"*@sylabs.io"}}},
+			path:        signed,
+			wantDefault: true,
+			wantResults: 1,
+		},
+		{
+			name:        "SignerUnsigned",
+			def:         "deny",
+			rules:       []Rule{{Name: "signer", Action: "allow", Signers: []string{"*"}}},
+			path:        unsigned,
+			wantDefault: true,
+			wantResults: 1,
+		},
+		{
+			name:        "KeyFPDeny",
+			def:         "allow",
+			rules:       []Rule{{Name: "key", Action: "deny", KeyFPs: []string{KeyFP1}}},
+			path:        signed,
+			wantResults: 1,
+		},
+		{
+			name: "FirstMatchApplies",
+			def:  "allow",
+			rules: []Rule{
+				{Name: "other-key", Action: "allow", KeyFPs: []string{KeyFP2}},
+				{Name: "signer", Action: "deny", Signers: []string{"unit@test.com"}},
+				{Name: "digest", Action: "allow", Digests: []string{signedDigest}},
+			},
+			path:        signed,
+			wantResults: 2,
+		},
+		{
+			name:        "AllCriteria",
+			def:         "deny",
+			rules:       []Rule{{Name: "all", Action: "allow", DirPath: dirPath, Digests: []string{signedDigest}, KeyFPs: []string{KeyFP1}, Signers: []string{"unit@test.com"}}},
+			path:        signed,
+			wantAllow:   true,
+			wantResults: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := EclConfig{
+				Activated: true,
+				Default:   tt.def,
+				Rules:     tt.rules,
+			}
+			if err := c.ValidateConfig(); err != nil {
+				t.Fatal(err)
+			}
+
+			kr := openpgp.EntityList{getTestEntity(t)}
+
+			got, err := c.ShouldRun(tt.path, kr)
+			if got != tt.wantAllow {
+				t.Errorf("got run %v, want %v", got, tt.wantAllow)
+			}
+			if tt.wantAllow && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			} else if !tt.wantAllow && !errors.Is(err, errDeniedByRule) {
+				t.Errorf("got error %v, want %v", err, errDeniedByRule)
+			}
+
+			f, err := os.Open(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			d, err := c.Check(f, kr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := d.Allow, tt.wantAllow; got != want {
+				t.Errorf("got allow %v, want %v", got, want)
+			}
+			if got, want := d.Default, tt.wantDefault; got != want {
+				t.Errorf("got default %v, want %v", got, want)
+			}
+			if got, want := len(d.Results), tt.wantResults; got != want {
+				t.Fatalf("got %v results, want %v", got, want)
+			}
+			for i, r := range d.Results {
+				if got, want := r.Matched, i == len(d.Results)-1 && !tt.wantDefault; got != want {
+					t.Errorf("result %d: got matched %v, want %v", i, got, want)
+				}
+				if len(r.Reasons) == 0 {
+					t.Errorf("result %d: no reason", i)
+				}
+			}
+		})
+	}
+}
+
+func TestShouldRunRulesCorrupted(t *testing.T) {
+	// The root filesystem of test images is not a valid squashfs image.
+	c := EclConfig{
+		Activated: true,
+		Default:   "allow",
+		Rules:     []Rule{{Name: "labels", Action: "deny", Labels: map[string]string{"org.team": "*"}}},
+	}
+
+	ok, err := c.ShouldRun(filepath.Join("testdata", "images", "one-group.sif"), openpgp.EntityList{})
+	if ok {
+		t.Errorf("image with unreadable labels allowed")
+	}
+	if err == nil || errors.Is(err, errDeniedByRule) {
+		t.Errorf("got error %v, want read error", err)
+	}
+}
+
+func TestShouldRunRulesCorruptedSignature(t *testing.T) {
+	b, err := ioutil.ReadFile(filepath.Join("testdata", "images", "one-group-signed.sif"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "corrupted.sif")
+	if err := ioutil.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Corrupt the signed root filesystem.
+	f, err := sif.LoadContainer(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	od, _, err := f.GetPartPrimSys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	off := od.Fileoff
+	f.UnloadContainer()
+
+	fp, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fp.WriteAt([]byte{^b[off]}, off); err != nil {
+		t.Fatal(err)
+	}
+	fp.Close()
+
+	kr := openpgp.EntityList{getTestEntity(t)}
+
+	rules := [][]Rule{
+		{{Name: "key", Action: "deny", KeyFPs: []string{KeyFP1}}},
+		{{Name: "signer", Action: "deny", Signers: []string{"unit@test.com"}}},
+	}
+	for _, r := range rules {
+		c := EclConfig{
+			Activated: true,
+			Default:   "allow",
+			Rules:     r,
+		}
+
+		ok, err := c.ShouldRun(path, kr)
+		if ok {
+			t.Errorf("%s: image with corrupted signature allowed", r[0].Name)
+		}
+		if err == nil || errors.Is(err, errDeniedByRule) {
+			t.Errorf("%s: got error %v, want verification error", r[0].Name, err)
+		}
+	}
+}
+
+func TestCheckExecgroup(t *testing.T) {
+	dirPath, err := filepath.Abs(filepath.Join("testdata", "images"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		eg        Execgroup
+		wantAllow bool
+		wantErr   bool
+	}{
+		{"Whitelist", Execgroup{TagName: "wl", ListMode: "whitelist", DirPath: dirPath, KeyFPs: []string{KeyFP1}}, true, false},
+		{"WhitelistDenied", Execgroup{TagName: "wl", ListMode: "whitelist", DirPath: dirPath, KeyFPs: []string{KeyFP2}}, false, false},
+		{"BlacklistDenied", Execgroup{TagName: "bl", ListMode: "blacklist", KeyFPs: []string{KeyFP1}}, false, false},
+		{"NoExecgroup", Execgroup{TagName: "wl", ListMode: "whitelist", DirPath: "/none", KeyFPs: []string{KeyFP1}}, false, true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := EclConfig{Activated: true, ExecGroups: []Execgroup{tt.eg}}
+
+			f, err := os.Open(filepath.Join(dirPath, "one-group-signed.sif"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			d, err := c.Check(f, openpgp.EntityList{getTestEntity(t)})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if got, want := d.Allow, tt.wantAllow; got != want {
+				t.Errorf("got allow %v, want %v", got, want)
+			}
+			if got, want := len(d.Results), 1; got != want {
+				t.Fatalf("got %v results, want %v", got, want)
+			}
+			if got, want := d.Results[0].Name, tt.eg.TagName; got != want {
+				t.Errorf("got name %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestRuleMatchLabels(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "images", "one-group.sif"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	i := &imageInfo{
+		fp:        f,
+		labels:    map[string]string{"org.team": "hpc-apps", "org.site": "lab"},
+		hasLabels: true,
+	}
+
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   bool
+	}{
+		{"Exact", map[string]string{"org.site": "lab"}, true},
+		{"Pattern", map[string]string{"org.team": "hpc*"}, true},
+		{"All", map[string]string{"org.team": "hpc-*", "org.site": "l?b"}, true},
+		{"NotAll", map[string]string{"org.team": "hpc-*", "org.site": "other"}, false},
+		{"Missing", map[string]string{"org.owner": "*"}, false},
+		{"NoMatch", map[string]string{"org.team": "bio*"}, false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			r := Rule{Action: "allow", Labels: tt.labels}
+
+			ok, reasons, err := r.match(i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.want {
+				t.Errorf("got match %v, want %v (%v)", ok, tt.want, reasons)
+			}
+		})
+	}
+}
+
+// createLabelsImage returns the path of a SIF image with a squashfs root filesystem holding
+// labels, it skips the test if mksquashfs is not found.
+func createLabelsImage(t *testing.T, dir, labels string) string {
+	mk, err := exec.LookPath("mksquashfs")
+	if err != nil {
+		t.Skip("mksquashfs not found")
+	}
+
+	rootfs := filepath.Join(t.TempDir(), "rootfs")
+	if err := os.MkdirAll(filepath.Join(rootfs, ".singularity.d"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(rootfs, ".singularity.d", "labels.json"), []byte(labels), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	squashfs := filepath.Join(t.TempDir(), "rootfs.sqfs")
+	if out, err := exec.Command(mk, rootfs, squashfs, "-noappend", "-no-progress").CombinedOutput(); err != nil {
+		t.Fatalf("failed to create squashfs image: %s: %s", err, out)
+	}
+
+	fp, err := os.Open(squashfs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fp.Close()
+
+	fi, err := fp.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := sif.DescriptorInput{
+		Datatype: sif.DataPartition,
+		Groupid:  sif.DescrDefaultGroup,
+		Link:     sif.DescrUnusedLink,
+		Fname:    squashfs,
+		Fp:       fp,
+		Size:     fi.Size(),
+	}
+	if err := in.SetPartExtra(sif.FsSquash, sif.PartPrimSys, sif.GetSIFArch(runtime.GOARCH)); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "labels.sif")
+	f, err := sif.CreateContainer(sif.CreateInfo{
+		Pathname:   path,
+		Launchstr:  sif.HdrLaunch,
+		Sifversion: sif.HdrVersion,
+		ID:         id,
+		InputDescr: []sif.DescriptorInput{in},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.UnloadContainer(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestShouldRunLabels(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := createLabelsImage(t, dir, `{"org.team": "hpc"}`)
+
+	c := EclConfig{
+		Activated: true,
+		Default:   "deny",
+		Rules: []Rule{
+			{Name: "bio", Action: "allow", Labels: map[string]string{"org.team": "bio"}},
+			{Name: "hpc", Action: "allow", DirPath: dir, Labels: map[string]string{"org.team": "hpc"}},
+		},
+	}
+	if err := c.ValidateConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := c.ShouldRun(path, openpgp.EntityList{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Errorf("image with matching labels not allowed")
+	}
+}
@@ -11,6 +11,8 @@
 package syecl
 
 import (
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -21,6 +23,8 @@ import (
 
 	"github.com/hpcng/sif/pkg/integrity"
 	"github.com/hpcng/sif/pkg/sif"
+	"github.com/hpcng/singularity/internal/pkg/util/x509sig"
+	"github.com/hpcng/singularity/pkg/image"
 	toml "github.com/pelletier/go-toml"
 	"golang.org/x/crypto/openpgp"
 )
@@ -32,24 +36,32 @@ var (
 
 // EclConfig describes the structure of an execution control list configuration file
 type EclConfig struct {
-	Activated  bool        `toml:"activated"`      // toggle the activation of the ECL rules
-	Legacy     bool        `toml:"legacyinsecure"` // Legacy (insecure) signature mode
-	ExecGroups []Execgroup `toml:"execgroup"`      // Slice of all execution groups
+	Activated  bool        `toml:"activated"`          // toggle the activation of the ECL rules
+	Legacy     bool        `toml:"legacyinsecure"`     // Legacy (insecure) signature mode
+	CABundle   string      `toml:"cabundle,omitempty"` // PEM file of root certificates for X.509 signatures
+	CRLs       []string    `toml:"crl,omitempty"`      // Certificate revocation list files for X.509 signatures
+	ExecGroups []Execgroup `toml:"execgroup"`          // Slice of all execution groups
+	Default    string      `toml:"default,omitempty"`  // Action for images matching no rule: allow or deny
+	Rules      []Rule      `toml:"rule,omitempty"`     // Ordered rules, the first matching rule applies
 }
 
 // Execgroup describes an execution group, the main unit of configuration:
 //	TagName: a descriptive identifier
 //	ListMode: whether the execgroup follows a whitelist, whitestrict or blacklist model
-//		whitelist: one or more KeyFP's present and verified,
-//		whitestrict: all KeyFP's present and verified,
-//		blacklist: none of the KeyFP should be present
+//		whitelist: one or more KeyFP's, Subjects or CAFPs present and verified,
+//		whitestrict: all KeyFP's, Subjects and CAFPs present and verified,
+//		blacklist: none of the KeyFP's, Subjects or CAFPs should be present
 //	DirPath: containers must be stored in this directory path
 //	KeyFPs: list of Key Fingerprints of entities to verify
+//	Subjects: list of subjects, or common names, of X.509 signing certificates to verify
+//	CAFPs: list of SHA-256 fingerprints of CA certificates in the chains of X.509 signing certificates
 type Execgroup struct {
 	TagName  string   `toml:"tagname"`
 	ListMode string   `toml:"mode"`
 	DirPath  string   `toml:"dirpath"`
 	KeyFPs   []string `toml:"keyfp"`
+	Subjects []string `toml:"subject,omitempty"`
+	CAFPs    []string `toml:"cafp,omitempty"`
 }
 
 // LoadConfig opens an ECL config file and unmarshals it into structures
@@ -80,6 +92,22 @@ func PutConfig(ecl EclConfig, confPath string) (err error) {
 func (ecl *EclConfig) ValidateConfig() error {
 	m := map[string]bool{}
 
+	if ecl.CABundle != "" && !filepath.IsAbs(ecl.CABundle) {
+		return fmt.Errorf("cabundle should be an absolute path")
+	}
+	for _, p := range ecl.CRLs {
+		if !filepath.IsAbs(p) {
+			return fmt.Errorf("crl paths should be absolute paths")
+		}
+	}
+
+	if ecl.hasRules() {
+		if len(ecl.ExecGroups) > 0 {
+			return fmt.Errorf("execgroup and rule entries cannot be used together")
+		}
+		return ecl.validateRules()
+	}
+
 	for _, v := range ecl.ExecGroups {
 		if m[v.DirPath] {
 			return fmt.Errorf("a specific dirpath can only appear in one execgroup: %s", v.DirPath)
@@ -87,51 +115,124 @@ func (ecl *EclConfig) ValidateConfig() error {
 		m[v.DirPath] = true
 
 		// if we allow containers everywhere, don't test dirpath constraint
-		if v.DirPath != "" {
-			path, err := filepath.EvalSymlinks(v.DirPath)
-			if err != nil {
-				return err
-			}
-			abs, err := filepath.Abs(path)
-			if err != nil {
-				return err
-			}
-			if v.DirPath != abs {
-				return fmt.Errorf("all execgroup dirpath`s should be fully cleaned with symlinks resolved")
-			}
+		if err := validateDirPath(v.DirPath); err != nil {
+			return err
 		}
 		if v.ListMode != "whitelist" && v.ListMode != "whitestrict" && v.ListMode != "blacklist" {
 			return fmt.Errorf("the mode field can only be either: whitelist, whitestrict, blacklist")
 		}
-		for _, k := range v.KeyFPs {
+		if err := validateKeyFPs(v.KeyFPs); err != nil {
+			return err
+		}
+		for _, k := range v.CAFPs {
 			decoded, err := hex.DecodeString(k)
-			if err != nil || len(decoded) != 20 {
-				return fmt.Errorf("expecting a 40 chars hex fingerprint string")
+			if err != nil || len(decoded) != 32 {
+				return fmt.Errorf("expecting a 64 chars hex CA fingerprint string")
 			}
 		}
+		if (len(v.Subjects) > 0 || len(v.CAFPs) > 0) && ecl.CABundle == "" {
+			return fmt.Errorf("a cabundle is required to verify subject and cafp entries")
+		}
 	}
 
 	return nil
 }
 
-// checkWhiteList evaluates authorization by requiring at least 1 entity
-func checkWhiteList(v *integrity.Verifier, egroup *Execgroup) (ok bool, err error) {
-	// get signing entities fingerprints that have signed all selected objects
-	keyfps, err := v.AllSignedBy()
+// validateDirPath makes sure path is fully cleaned with symlinks resolved, if set.
+func validateDirPath(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	resolved, err := filepath.EvalSymlinks(path)
 	if err != nil {
-		return
+		return err
+	}
+	abs, err := filepath.Abs(resolved)
+	if err != nil {
+		return err
+	}
+	if path != abs {
+		return fmt.Errorf("all dirpath`s should be fully cleaned with symlinks resolved")
 	}
+	return nil
+}
 
-	// were the selected objects signed by an authorized entity?
+// validateKeyFPs makes sure all fingerprints of keyfps are 40 chars hex strings.
+func validateKeyFPs(keyfps []string) error {
+	for _, k := range keyfps {
+		decoded, err := hex.DecodeString(k)
+		if err != nil || len(decoded) != 20 {
+			return fmt.Errorf("expecting a 40 chars hex fingerprint string")
+		}
+	}
+	return nil
+}
+
+// signers holds the identities of the entities that signed an image.
+type signers struct {
+	keyfps   [][20]byte            // Fingerprints of PGP entities.
+	entities []*openpgp.Entity     // PGP entities of the keyring with these fingerprints.
+	chains   [][]*x509.Certificate // Verified chains of X.509 signing certificates.
+}
+
+// hasKeyFP returns true if s includes the PGP entity with fingerprint fp.
+func (s signers) hasKeyFP(fp string) bool {
+	for _, u := range s.keyfps {
+		if strings.EqualFold(fp, hex.EncodeToString(u[:])) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasSubject returns true if s includes an X.509 certificate with the subject, or the common
+// name, subject.
+func (s signers) hasSubject(subject string) bool {
+	for _, chain := range s.chains {
+		if chain[0].Subject.String() == subject || chain[0].Subject.CommonName == subject {
+			return true
+		}
+	}
+	return false
+}
+
+// hasCAFP returns true if s includes an X.509 certificate issued under the CA with the SHA-256
+// fingerprint fp.
+func (s signers) hasCAFP(fp string) bool {
+	for _, chain := range s.chains {
+		if x509sig.HasCA(chain, fp) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches returns the number of identities of egroup found in s, and the number of identities
+// in egroup.
+func (s signers) matches(egroup *Execgroup) (found, total int) {
 	for _, v := range egroup.KeyFPs {
-		for _, u := range keyfps {
-			if strings.EqualFold(v, hex.EncodeToString(u[:])) {
-				ok = true
-			}
+		if s.hasKeyFP(v) {
+			found++
+		}
+	}
+	for _, v := range egroup.Subjects {
+		if s.hasSubject(v) {
+			found++
+		}
+	}
+	for _, v := range egroup.CAFPs {
+		if s.hasCAFP(v) {
+			found++
 		}
 	}
+	return found, len(egroup.KeyFPs) + len(egroup.Subjects) + len(egroup.CAFPs)
+}
 
-	if !ok {
+// checkWhiteList evaluates authorization by requiring at least 1 entity
+func checkWhiteList(all signers, egroup *Execgroup) (ok bool, err error) {
+	// were the selected objects signed by an authorized entity?
+	if found, _ := all.matches(egroup); found == 0 {
 		return false, errNotSignedByRequired
 	}
 
@@ -139,116 +240,215 @@ func checkWhiteList(v *integrity.Verifier, egroup *Execgroup) (ok bool, err erro
 }
 
 // checkWhiteStrict evaluates authorization by requiring all entities
-func checkWhiteStrict(v *integrity.Verifier, egroup *Execgroup) (ok bool, err error) {
-	// get signing entities fingerprints that have signed all selected objects
-	keyfps, err := v.AllSignedBy()
-	if err != nil {
-		return
+func checkWhiteStrict(all signers, egroup *Execgroup) (ok bool, err error) {
+	// were all selected objects signed by all authorized entity?
+	if found, total := all.matches(egroup); found != total {
+		return false, errNotSignedByRequired
 	}
 
-	// were all selected objects signed by all authorized entity?
-	m := map[string]bool{}
-	for _, v := range egroup.KeyFPs {
-		m[v] = false
-		for _, u := range keyfps {
-			if strings.EqualFold(v, hex.EncodeToString(u[:])) {
-				m[v] = true
-			}
+	return true, nil
+}
+
+// checkBlackList evaluates authorization by requiring all entities to be absent
+func checkBlackList(any signers, egroup *Execgroup) (ok bool, err error) {
+	// was a selected object signed by a forbidden entity?
+	if found, _ := any.matches(egroup); found != 0 {
+		return false, errSignedByForbidden
+	}
+
+	return true, nil
+}
+
+// hasPGPSignatures returns true if f contains a signature object other than an X.509 signature or
+// a time stamp.
+func hasPGPSignatures(f *sif.FileImage) bool {
+	for _, od := range f.DescrArr {
+		if !od.Used || od.Datatype != sif.DataSignature {
+			continue
+		}
+		if name := od.GetName(); name != image.SIFDescX509Signature && name != image.SIFDescTimestamp {
+			return true
 		}
 	}
+	return false
+}
 
-	for _, v := range m {
-		if !v {
-			return false, errNotSignedByRequired
+// verifyPGP verifies the PGP signatures of f with the keyring kr, and returns the entities that
+// signed all, and any, of the selected objects.
+func verifyPGP(ecl *EclConfig, f *sif.FileImage, kr openpgp.KeyRing) (all, any signers, err error) {
+	// Note the entities of valid signatures, to match their identities.
+	entities := make(map[[20]byte]*openpgp.Entity)
+	cb := func(r integrity.VerifyResult) bool {
+		if e := r.Entity(); e != nil && r.Error() == nil {
+			entities[e.PrimaryKey.Fingerprint] = e
 		}
+		return false
 	}
 
-	return true, nil
-}
+	opts := []integrity.VerifierOpt{integrity.OptVerifyWithKeyRing(kr), integrity.OptVerifyCallback(cb)}
+	if ecl.Legacy {
+		// Legacy behavior is to verify the primary partition only.
+		od, _, err := f.GetPartPrimSys()
+		if err != nil {
+			return all, any, fmt.Errorf("get primary system partition: %v", err)
+		}
+		opts = append(opts, integrity.OptVerifyLegacy(), integrity.OptVerifyObject(od.ID))
+	}
 
-// checkBlackList evaluates authorization by requiring all entities to be absent
-func checkBlackList(v *integrity.Verifier, egroup *Execgroup) (ok bool, err error) {
-	// get all signing entities fingerprints that have signed any selected object
-	keyfps, err := v.AnySignedBy()
+	v, err := integrity.NewVerifier(f, opts...)
 	if err != nil {
-		return
+		return all, any, err
 	}
 
-	// was a selected object signed by a forbidden entity?
-	for _, v := range egroup.KeyFPs {
-		for _, u := range keyfps {
-			if strings.EqualFold(v, hex.EncodeToString(u[:])) {
-				return false, errSignedByForbidden
+	// Validate signature.
+	if err := v.Verify(); err != nil {
+		return all, any, fmt.Errorf("image signature not valid: %v", err)
+	}
+
+	// get signing entities fingerprints that have signed all, and any, selected objects
+	if all.keyfps, err = v.AllSignedBy(); err != nil {
+		return all, any, err
+	}
+	if any.keyfps, err = v.AnySignedBy(); err != nil {
+		return all, any, err
+	}
+
+	for _, s := range []*signers{&all, &any} {
+		for _, fp := range s.keyfps {
+			if e, ok := entities[fp]; ok {
+				s.entities = append(s.entities, e)
 			}
 		}
 	}
+	return all, any, nil
+}
 
-	return true, nil
+// verifyX509 verifies the X.509 signatures of f against the certificate bundle and revocation
+// lists of ecl, and returns the certificates that signed all, and any, of the selected objects.
+func verifyX509(ecl *EclConfig, f *sif.FileImage) (all, any signers, err error) {
+	roots, err := x509sig.LoadCertPool(ecl.CABundle)
+	if err != nil {
+		return all, any, fmt.Errorf("while loading CA bundle: %v", err)
+	}
+	opts := []x509sig.VerifierOpt{x509sig.OptVerifyWithRoots(roots)}
+
+	var crls []*pkix.CertificateList
+	for _, p := range ecl.CRLs {
+		crl, err := x509sig.LoadCRL(p)
+		if err != nil {
+			return all, any, err
+		}
+		crls = append(crls, crl)
+	}
+	if len(crls) > 0 {
+		opts = append(opts, x509sig.OptVerifyWithCRLs(crls...))
+	}
+
+	v, err := x509sig.NewVerifier(f, opts...)
+	if err != nil {
+		return all, any, err
+	}
+
+	// Validate signature.
+	if err := v.Verify(); err != nil {
+		return all, any, fmt.Errorf("image X.509 signature not valid: %v", err)
+	}
+
+	all.chains = v.AllSignedBy()
+	any.chains = v.AnySignedBy()
+	return all, any, nil
 }
 
-func shouldRun(ecl *EclConfig, fp *os.File, kr openpgp.KeyRing) (ok bool, err error) {
-	var egroup *Execgroup
+// getSigners verifies the signatures of f, and returns the identities that signed all, and any,
+// of the selected objects. X.509 signatures are verified if a CA bundle is configured, and PGP
+// signatures are verified if present, or if there is no X.509 signature to verify.
+func getSigners(ecl *EclConfig, f *sif.FileImage, kr openpgp.KeyRing) (all, any signers, err error) {
+	checkX509 := ecl.CABundle != "" && x509sig.HasSignatures(f)
+
+	// X.509 signatures are not visible to the PGP verifier.
+	pf := x509sig.HideSignatures(f)
+
+	if hasPGPSignatures(pf) || !checkX509 {
+		if all, any, err = verifyPGP(ecl, pf, kr); err != nil {
+			return all, any, err
+		}
+	}
 
+	if checkX509 {
+		xall, xany, err := verifyX509(ecl, f)
+		if err != nil {
+			return all, any, err
+		}
+		all.chains, any.chains = xall.chains, xany.chains
+	}
+
+	return all, any, nil
+}
+
+// getExecgroup returns the execgroup a container is part of.
+func getExecgroup(ecl *EclConfig, fp *os.File) (*Execgroup, error) {
 	// look what execgroup a container is part of
 	for _, v := range ecl.ExecGroups {
 		if filepath.Dir(fp.Name()) == v.DirPath {
-			egroup = &v
-			break
+			return &v, nil
 		}
 	}
 	// go back at it and this time look for an empty dirpath execgroup to fallback into
-	if egroup == nil {
-		for _, v := range ecl.ExecGroups {
-			if v.DirPath == "" {
-				egroup = &v
-				break
-			}
+	for _, v := range ecl.ExecGroups {
+		if v.DirPath == "" {
+			return &v, nil
 		}
 	}
 
-	if egroup == nil {
-		return false, fmt.Errorf("%s not part of any execgroup", fp.Name())
-	}
+	return nil, fmt.Errorf("%s not part of any execgroup", fp.Name())
+}
 
+// checkExecgroup evaluates authorization of a container according to the rules of egroup.
+func checkExecgroup(ecl *EclConfig, egroup *Execgroup, fp *os.File, kr openpgp.KeyRing) (ok bool, err error) {
 	f, err := sif.LoadContainerFp(fp, true)
 	if err != nil {
 		return false, err
 	}
 
-	opts := []integrity.VerifierOpt{integrity.OptVerifyWithKeyRing(kr)}
-	if ecl.Legacy {
-		// Legacy behavior is to verify the primary partition only.
-		od, _, err := f.GetPartPrimSys()
-		if err != nil {
-			return false, fmt.Errorf("get primary system partition: %v", err)
-		}
-		opts = append(opts, integrity.OptVerifyLegacy(), integrity.OptVerifyObject(od.ID))
-	}
-
-	v, err := integrity.NewVerifier(&f, opts...)
+	// Validate signatures.
+	all, any, err := getSigners(ecl, &f, kr)
 	if err != nil {
 		return false, err
 	}
 
-	// Validate signature.
-	if err := v.Verify(); err != nil {
-		return false, fmt.Errorf("image signature not valid: %v", err)
-	}
-
-	// Check fingerprints against policy.
+	// Check signing identities against policy.
 	switch egroup.ListMode {
 	case "whitelist":
-		return checkWhiteList(v, egroup)
+		return checkWhiteList(all, egroup)
 	case "whitestrict":
-		return checkWhiteStrict(v, egroup)
+		return checkWhiteStrict(all, egroup)
 	case "blacklist":
-		return checkBlackList(v, egroup)
+		return checkBlackList(any, egroup)
 	}
 
 	return false, fmt.Errorf("ecl config file invalid")
 }
 
-// ShouldRun determines if a container should run according to its execgroup rules
+func shouldRun(ecl *EclConfig, fp *os.File, kr openpgp.KeyRing) (ok bool, err error) {
+	if ecl.hasRules() {
+		d, err := evaluateRules(ecl, fp, kr)
+		if err != nil {
+			return false, err
+		}
+		if !d.Allow {
+			return false, fmt.Errorf("%w: %s", errDeniedByRule, d.Reason())
+		}
+		return true, nil
+	}
+
+	egroup, err := getExecgroup(ecl, fp)
+	if err != nil {
+		return false, err
+	}
+	return checkExecgroup(ecl, egroup, fp, kr)
+}
+
+// ShouldRun determines if a container should run according to the ECL rules, or its execgroup rules
 func (ecl *EclConfig) ShouldRun(cpath string, kr openpgp.KeyRing) (ok bool, err error) {
 	// look if ECL rules are activated
 	if !ecl.Activated {
@@ -264,7 +464,8 @@ func (ecl *EclConfig) ShouldRun(cpath string, kr openpgp.KeyRing) (ok bool, err
 	return shouldRun(ecl, fp, kr)
 }
 
-// ShouldRunFp determines if an already opened container should run according to its execgroup rules
+// ShouldRunFp determines if an already opened container should run according to the ECL rules, or
+// its execgroup rules
 func (ecl *EclConfig) ShouldRunFp(fp *os.File, kr openpgp.KeyRing) (ok bool, err error) {
 	// look if ECL rules are activated
 	if !ecl.Activated {
@@ -7,14 +7,28 @@
 package syecl
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math/big"
 	"os"
 	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/hpcng/sif/pkg/sif"
+	"github.com/hpcng/singularity/internal/pkg/util/x509sig"
 	"golang.org/x/crypto/openpgp"
 	"gotest.tools/v3/golden"
 )
@@ -273,6 +287,36 @@ func TestValidateConfig(t *testing.T) {
 			}},
 			wantErr: true,
 		},
+		{
+			name: "BadCAFingerprint",
+			c: EclConfig{CABundle: "/ca.pem", ExecGroups: []Execgroup{
+				{ListMode: "whitelist", CAFPs: []string{KeyFP1}},
+			}},
+			wantErr: true,
+		},
+		{
+			name:    "RelativeCABundle",
+			c:       EclConfig{CABundle: "ca.pem"},
+			wantErr: true,
+		},
+		{
+			name:    "RelativeCRL",
+			c:       EclConfig{CABundle: "/ca.pem", CRLs: []string{"ca.crl"}},
+			wantErr: true,
+		},
+		{
+			name: "SubjectNoCABundle",
+			c: EclConfig{ExecGroups: []Execgroup{
+				{ListMode: "whitelist", Subjects: []string{"Test Signer"}},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "Certificate",
+			c: EclConfig{Activated: true, CABundle: "/ca.pem", CRLs: []string{"/ca.crl"}, ExecGroups: []Execgroup{
+				{ListMode: "whitelist", Subjects: []string{"Test Signer"}, CAFPs: []string{KeyFP1 + KeyFP1[:24]}},
+			}},
+		},
 		{
 			name: "Deactivated",
 			c:    EclConfig{Activated: false},
@@ -465,3 +509,244 @@ func TestShouldRun(t *testing.T) {
 		})
 	}
 }
+
+// testPKI holds a root certificate, and a code signing certificate issued by it.
+type testPKI struct {
+	root, cert       *x509.Certificate
+	rootKey, certKey crypto.Signer
+}
+
+// getTestPKI returns a new code signing certificate, issued by a new root certificate.
+func getTestPKI(t *testing.T) testPKI {
+	t.Helper()
+
+	var p testPKI
+	for _, k := range []*crypto.Signer{&p.rootKey, &p.certKey} {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		*k = key
+	}
+
+	now := time.Now()
+	create := func(tmpl, parent *x509.Certificate, key crypto.Signer) *x509.Certificate {
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), p.rootKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	root := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	p.root = create(root, root, p.rootKey)
+
+	p.cert = create(&x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Test Signer", Organization: []string{"Sylabs"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}, p.root, p.certKey)
+
+	return p
+}
+
+// copyFile copies the file at src to dst.
+func copyFile(t *testing.T, dst, src string) {
+	t.Helper()
+
+	in, err := os.Open(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// signX509 adds an X.509 signature to the image at path, made with the signing certificate of p.
+func signX509(t *testing.T, path string, p testPKI) {
+	t.Helper()
+
+	f, err := sif.LoadContainer(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.UnloadContainer()
+
+	s, err := x509sig.NewSigner(&f, p.certKey, []*x509.Certificate{p.cert})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Sign(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestShouldRunCertificate(t *testing.T) {
+	p := getTestPKI(t)
+	other := getTestPKI(t)
+
+	dir, err := ioutil.TempDir("", "syecl-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// ValidateConfig requires a fully resolved directory path.
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	caBundle := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(caBundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: p.root.Raw}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := p.root.CreateCRL(rand.Reader, p.rootKey, []pkix.RevokedCertificate{
+		{SerialNumber: p.cert.SerialNumber, RevocationTime: time.Now()},
+	}, time.Now(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl := filepath.Join(dir, "ca.crl")
+	if err := ioutil.WriteFile(crl, der, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// One image signed with the X.509 certificate only, and one signed with both PGP and X.509.
+	x509Signed := filepath.Join(dir, "x509-signed.sif")
+	copyFile(t, x509Signed, filepath.Join("testdata", "images", "one-group.sif"))
+	signX509(t, x509Signed, p)
+
+	bothSigned := filepath.Join(dir, "both-signed.sif")
+	copyFile(t, bothSigned, filepath.Join("testdata", "images", "one-group-signed.sif"))
+	signX509(t, bothSigned, p)
+
+	pgpSigned := filepath.Join(dir, "pgp-signed.sif")
+	copyFile(t, pgpSigned, filepath.Join("testdata", "images", "one-group-signed.sif"))
+
+	sum := sha256.Sum256(p.root.Raw)
+	caFP := hex.EncodeToString(sum[:])
+	sum = sha256.Sum256(other.root.Raw)
+	otherCAFP := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name    string
+		crls    []string
+		eg      Execgroup
+		path    string
+		wantErr bool
+	}{
+		{
+			name: "WhitelistSubject",
+			eg:   Execgroup{ListMode: "whitelist", Subjects: []string{"Test Signer"}},
+			path: x509Signed,
+		},
+		{
+			name: "WhitelistFullSubject",
+			eg:   Execgroup{ListMode: "whitelist", Subjects: []string{"CN=Test Signer,O=Sylabs"}},
+			path: x509Signed,
+		},
+		{
+			name: "WhitelistCAFP",
+			eg:   Execgroup{ListMode: "whitelist", CAFPs: []string{strings.ToUpper(caFP)}},
+			path: x509Signed,
+		},
+		{
+			name:    "WhitelistSubjectError",
+			eg:      Execgroup{ListMode: "whitelist", Subjects: []string{"Other Signer"}},
+			path:    x509Signed,
+			wantErr: true,
+		},
+		{
+			name:    "WhitelistCAFPError",
+			eg:      Execgroup{ListMode: "whitelist", CAFPs: []string{otherCAFP}},
+			path:    x509Signed,
+			wantErr: true,
+		},
+		{
+			name:    "WhitelistRevoked",
+			crls:    []string{crl},
+			eg:      Execgroup{ListMode: "whitelist", Subjects: []string{"Test Signer"}},
+			path:    x509Signed,
+			wantErr: true,
+		},
+		{
+			name: "WhitestrictMixed",
+			eg:   Execgroup{ListMode: "whitestrict", KeyFPs: []string{KeyFP1}, CAFPs: []string{caFP}},
+			path: bothSigned,
+		},
+		{
+			name:    "WhitestrictMixedError",
+			eg:      Execgroup{ListMode: "whitestrict", KeyFPs: []string{KeyFP1}, CAFPs: []string{caFP}},
+			path:    pgpSigned,
+			wantErr: true,
+		},
+		{
+			name: "WhitelistKeyFP",
+			eg:   Execgroup{ListMode: "whitelist", KeyFPs: []string{KeyFP1}},
+			path: bothSigned,
+		},
+		{
+			name: "BlacklistOK",
+			eg:   Execgroup{ListMode: "blacklist", CAFPs: []string{otherCAFP}},
+			path: x509Signed,
+		},
+		{
+			name:    "BlacklistError",
+			eg:      Execgroup{ListMode: "blacklist", Subjects: []string{"Test Signer"}},
+			path:    bothSigned,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.eg.DirPath = dir
+
+			c := EclConfig{
+				Activated:  true,
+				CABundle:   caBundle,
+				CRLs:       tt.crls,
+				ExecGroups: []Execgroup{tt.eg},
+			}
+			if err := c.ValidateConfig(); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := c.ShouldRun(tt.path, openpgp.EntityList{getTestEntity(t)})
+
+			if want := !tt.wantErr; got != want {
+				t.Errorf("got run %v, want %v", got, want)
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got err %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -9,9 +9,11 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"syscall"
 
@@ -602,3 +604,52 @@ func FindSize(size int64) string {
 	}
 	return fmt.Sprintf("%.2f %s", float64(size)/factor, unit)
 }
+
+// sizeUnits maps size suffixes to their multiplier, sizes are
+// expressed in powers of 1024.
+var sizeUnits = map[string]int64{
+	"":  1,
+	"K": 1 << 10,
+	"M": 1 << 20,
+	"G": 1 << 30,
+	"T": 1 << 40,
+}
+
+// ParseSize parses a human readable size like "512M" or "20GiB" and
+// returns the corresponding number of bytes. An empty string returns 0.
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+
+	u := strings.ToUpper(s)
+	for _, suffix := range []string{"IB", "B"} {
+		if strings.HasSuffix(u, suffix) {
+			u = strings.TrimSuffix(u, suffix)
+			break
+		}
+	}
+
+	i := strings.IndexFunc(u, func(r rune) bool {
+		return r < '0' || r > '9'
+	})
+	if i < 0 {
+		i = len(u)
+	}
+
+	mult, ok := sizeUnits[u[i:]]
+	if !ok || i == 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	n, err := strconv.ParseInt(u[:i], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %s", s, err)
+	}
+	if n > math.MaxInt64/mult {
+		return 0, fmt.Errorf("invalid size %q: value out of range", s)
+	}
+
+	return n * mult, nil
+}
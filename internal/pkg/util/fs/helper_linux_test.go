@@ -787,3 +787,36 @@ func TestForceRemoveAll(t *testing.T) {
 		t.Errorf("ForceRemoveAll failed to remove %s", testDir)
 	}
 }
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		size        string
+		expected    int64
+		expectError bool
+	}{
+		{size: "", expected: 0},
+		{size: "1024", expected: 1024},
+		{size: "10K", expected: 10 << 10},
+		{size: "512m", expected: 512 << 20},
+		{size: "20GiB", expected: 20 << 30},
+		{size: "1TB", expected: 1 << 40},
+		{size: "G", expectError: true},
+		{size: "10X", expectError: true},
+		{size: "-1G", expectError: true},
+		{size: "8388607T", expected: 8388607 << 40},
+		{size: "8388608T", expectError: true},
+		{size: "9223372036854775807", expected: 9223372036854775807},
+		{size: "9223372036854775808", expectError: true},
+	}
+
+	for _, tt := range tests {
+		size, err := ParseSize(tt.size)
+		if tt.expectError && err == nil {
+			t.Errorf("unexpected success while parsing %q", tt.size)
+		} else if !tt.expectError && err != nil {
+			t.Errorf("unexpected error while parsing %q: %s", tt.size, err)
+		} else if size != tt.expected {
+			t.Errorf("unexpected size for %q: got %d, expected %d", tt.size, size, tt.expected)
+		}
+	}
+}
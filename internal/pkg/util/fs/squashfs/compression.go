@@ -0,0 +1,73 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package squashfs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// compressionLevels holds the supported compression algorithms and their
+// maximum compression level, 0 if the level can't be set.
+var compressionLevels = map[string]int{
+	"gzip": 9,
+	"xz":   0,
+	"lz4":  0,
+	"zstd": 22,
+}
+
+// Compression describes the compression algorithm of a squashfs filesystem.
+type Compression struct {
+	Algorithm string
+	// Level is the compression level, 0 for the default level of the
+	// algorithm.
+	Level int
+}
+
+// ParseCompression parses a compression in the algorithm[:level] format.
+func ParseCompression(s string) (Compression, error) {
+	var c Compression
+
+	split := strings.SplitN(s, ":", 2)
+	c.Algorithm = split[0]
+
+	max, ok := compressionLevels[c.Algorithm]
+	if !ok {
+		return c, fmt.Errorf("unsupported compression algorithm %q, supported algorithms are gzip, xz, lz4 and zstd", c.Algorithm)
+	}
+	if len(split) == 1 {
+		return c, nil
+	}
+
+	if max == 0 {
+		return c, fmt.Errorf("compression level can't be set with %s", c.Algorithm)
+	}
+	level, err := strconv.Atoi(split[1])
+	if err != nil || level < 1 || level > max {
+		return c, fmt.Errorf("invalid %s compression level %q, must be between 1 and %d", c.Algorithm, split[1], max)
+	}
+	c.Level = level
+
+	return c, nil
+}
+
+// Flags returns the mksquashfs options selecting the compression.
+func (c Compression) Flags() []string {
+	flags := []string{"-comp", c.Algorithm}
+	if c.Level != 0 {
+		flags = append(flags, "-Xcompression-level", strconv.Itoa(c.Level))
+	}
+	return flags
+}
+
+// String returns the compression in the algorithm[:level] format.
+func (c Compression) String() string {
+	if c.Level != 0 {
+		return fmt.Sprintf("%s:%d", c.Algorithm, c.Level)
+	}
+	return c.Algorithm
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package squashfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCompression(t *testing.T) {
+	tests := []struct {
+		name        string
+		compression string
+		expectFlags []string
+		expectError bool
+	}{
+		{name: "Gzip", compression: "gzip", expectFlags: []string{"-comp", "gzip"}},
+		{name: "GzipLevel", compression: "gzip:9", expectFlags: []string{"-comp", "gzip", "-Xcompression-level", "9"}},
+		{name: "Xz", compression: "xz", expectFlags: []string{"-comp", "xz"}},
+		{name: "Lz4", compression: "lz4", expectFlags: []string{"-comp", "lz4"}},
+		{name: "Zstd", compression: "zstd", expectFlags: []string{"-comp", "zstd"}},
+		{name: "ZstdLevel", compression: "zstd:19", expectFlags: []string{"-comp", "zstd", "-Xcompression-level", "19"}},
+		{name: "Unsupported", compression: "lzo", expectError: true},
+		{name: "Empty", compression: "", expectError: true},
+		{name: "XzLevel", compression: "xz:6", expectError: true},
+		{name: "GzipLevelTooHigh", compression: "gzip:10", expectError: true},
+		{name: "ZstdLevelZero", compression: "zstd:0", expectError: true},
+		{name: "InvalidLevel", compression: "zstd:fast", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseCompression(tt.compression)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("unexpected success for %q", tt.compression)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error for %q: %s", tt.compression, err)
+			}
+			if flags := c.Flags(); !reflect.DeepEqual(flags, tt.expectFlags) {
+				t.Errorf("unexpected flags %v, expected %v", flags, tt.expectFlags)
+			}
+			if c.String() != tt.compression {
+				t.Errorf("unexpected string %q, expected %q", c.String(), tt.compression)
+			}
+		})
+	}
+}
@@ -56,3 +56,13 @@ func GetMem() (string, error) {
 
 	return mem, err
 }
+
+// GetCompression returns the default compression of SIF images, as
+// set in the configuration file.
+func GetCompression() (Compression, error) {
+	c, err := getConfig()
+	if err != nil {
+		return Compression{}, err
+	}
+	return ParseCompression(c.MksquashfsCompression)
+}
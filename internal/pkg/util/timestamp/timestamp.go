@@ -0,0 +1,501 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package timestamp implements RFC 3161 time-stamp tokens, requested from
+// a time stamping authority (TSA) to prove that data, like a signature,
+// existed at a given time.
+package timestamp
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"time"
+
+	// register the hash functions supported in tokens
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+const (
+	requestContentType = "application/timestamp-query"
+
+	// maxResponseSize is the maximum size of a TSA response.
+	maxResponseSize = 1 << 20
+
+	// generalizedTimeFormat is the format of the token generation time,
+	// fractional seconds are accepted when parsing.
+	generalizedTimeFormat = "20060102150405Z0700"
+)
+
+var (
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	oidRSA       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidRSASHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidRSASHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidRSASHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidECDSA     = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidECDSA256  = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSA384  = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSA512  = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+)
+
+var (
+	// ErrInvalidToken is returned when a time-stamp token is malformed.
+	ErrInvalidToken = errors.New("invalid time-stamp token")
+	// ErrImprintMismatch is returned when a time-stamp token doesn't
+	// cover the expected digest.
+	ErrImprintMismatch = errors.New("time-stamp token doesn't match data")
+)
+
+// hashes are the hash functions supported in tokens.
+var hashes = []struct {
+	oid  asn1.ObjectIdentifier
+	hash crypto.Hash
+}{
+	{oidSHA256, crypto.SHA256},
+	{oidSHA384, crypto.SHA384},
+	{oidSHA512, crypto.SHA512},
+}
+
+func hashOID(h crypto.Hash) (asn1.ObjectIdentifier, error) {
+	for _, v := range hashes {
+		if v.hash == h {
+			return v.oid, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported hash function %s", h)
+}
+
+func oidHash(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	for _, v := range hashes {
+		if v.oid.Equal(oid) {
+			return v.hash, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported hash algorithm %s", oid)
+}
+
+// rawTagged is an optional implicitly tagged field kept encoded.
+type rawTagged struct {
+	Raw asn1.RawContent
+}
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+// request is a TimeStampReq.
+type request struct {
+	Version        int
+	MessageImprint messageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional,default:false"`
+	Extensions     rawTagged             `asn1:"optional,tag:0"`
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []string       `asn1:"optional"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+// response is a TimeStampResp.
+type response struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+// tstInfo is the content signed in a token. The generation time is kept
+// encoded as fractional seconds are rejected by encoding/asn1.
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        asn1.RawValue
+	Accuracy       accuracy  `asn1:"optional"`
+	Ordering       bool      `asn1:"optional,default:false"`
+	Nonce          *big.Int  `asn1:"optional"`
+	TSA            rawTagged `asn1:"optional,tag:0"`
+	Extensions     rawTagged `asn1:"optional,tag:1"`
+}
+
+// contentInfo is a CMS ContentInfo, Content holds the explicit tag of the
+// content as encoding/asn1 ignores it for raw values.
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     rawTagged    `asn1:"optional,tag:0"`
+	CRLs             rawTagged    `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo `asn1:"set"`
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+// signerInfo is a CMS SignerInfo, the signed attributes are mandatory in
+// tokens.
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      rawTagged `asn1:"optional,tag:1"`
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+// Request requests a time-stamp token covering digest, computed with the
+// hash function h, from the TSA at url. It returns the DER encoded token.
+func Request(ctx context.Context, url string, digest []byte, h crypto.Hash) ([]byte, error) {
+	oid, err := hashOID(h)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := asn1.Marshal(request{
+		Version: 1,
+		MessageImprint: messageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oid, Parameters: asn1.NullRawValue},
+			HashedMessage: digest,
+		},
+		Nonce:   nonce,
+		CertReq: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(req))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", requestContentType)
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("time stamping authority returned %s", resp.Status)
+	}
+
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("while reading response: %s", err)
+	} else if len(b) > maxResponseSize {
+		return nil, fmt.Errorf("time stamping authority response is too large")
+	}
+
+	var r response
+	if rest, err := asn1.Unmarshal(b, &r); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("invalid time stamping authority response")
+	}
+	// granted or granted with modifications
+	if r.Status.Status > 1 {
+		return nil, fmt.Errorf("time stamping authority rejected the request with status %d: %v", r.Status.Status, r.Status.StatusString)
+	}
+
+	tsr := r.TimeStampToken.FullBytes
+	t, err := parseToken(tsr)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.checkImprint(digest, h); err != nil {
+		return nil, err
+	}
+	if t.info.Nonce == nil || t.info.Nonce.Cmp(nonce) != 0 {
+		return nil, fmt.Errorf("time-stamp token nonce doesn't match request")
+	}
+
+	return tsr, nil
+}
+
+// token is a parsed time-stamp token.
+type token struct {
+	info tstInfo
+	// content is the encoded TSTInfo signed by the TSA
+	content []byte
+	signer  signerInfo
+	certs   []*x509.Certificate
+}
+
+// parseToken parses the DER encoded time-stamp token b, without checking
+// its signature.
+func parseToken(b []byte) (*token, error) {
+	var ci contentInfo
+	if rest, err := asn1.Unmarshal(b, &ci); err != nil || len(rest) > 0 || !ci.ContentType.Equal(oidSignedData) {
+		return nil, ErrInvalidToken
+	}
+	if ci.Content.Class != asn1.ClassContextSpecific || ci.Content.Tag != 0 {
+		return nil, ErrInvalidToken
+	}
+
+	var sd signedData
+	if rest, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil || len(rest) > 0 {
+		return nil, ErrInvalidToken
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(oidTSTInfo) || len(sd.SignerInfos) != 1 {
+		return nil, ErrInvalidToken
+	}
+
+	t := &token{
+		content: sd.EncapContentInfo.EContent,
+		signer:  sd.SignerInfos[0],
+	}
+	if rest, err := asn1.Unmarshal(t.content, &t.info); err != nil || len(rest) > 0 {
+		return nil, ErrInvalidToken
+	}
+
+	if len(sd.Certificates.Raw) > 0 {
+		var raw asn1.RawValue
+		if _, err := asn1.Unmarshal(sd.Certificates.Raw, &raw); err != nil {
+			return nil, ErrInvalidToken
+		}
+		certs, err := x509.ParseCertificates(raw.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("while parsing time-stamp token certificates: %s", err)
+		}
+		t.certs = certs
+	}
+
+	return t, nil
+}
+
+// genTime returns the generation time of the token.
+func (t *token) genTime() (time.Time, error) {
+	v := t.info.GenTime
+	if v.Class != asn1.ClassUniversal || v.Tag != asn1.TagGeneralizedTime {
+		return time.Time{}, ErrInvalidToken
+	}
+	gt, err := time.Parse(generalizedTimeFormat, string(v.Bytes))
+	if err != nil {
+		return time.Time{}, ErrInvalidToken
+	}
+	return gt, nil
+}
+
+// checkImprint checks that the token covers digest, computed with the
+// hash function h.
+func (t *token) checkImprint(digest []byte, h crypto.Hash) error {
+	mi := t.info.MessageImprint
+	th, err := oidHash(mi.HashAlgorithm.Algorithm)
+	if err != nil {
+		return err
+	}
+	if th != h || !bytes.Equal(mi.HashedMessage, digest) {
+		return ErrImprintMismatch
+	}
+	return nil
+}
+
+// signerCertificate returns the certificate of the token signer.
+func (t *token) signerCertificate() (*x509.Certificate, error) {
+	sid := t.signer.SID
+
+	for _, c := range t.certs {
+		switch {
+		case sid.Class == asn1.ClassUniversal && sid.Tag == asn1.TagSequence:
+			var ias issuerAndSerialNumber
+			if _, err := asn1.Unmarshal(sid.FullBytes, &ias); err != nil {
+				return nil, ErrInvalidToken
+			}
+			if bytes.Equal(ias.Issuer.FullBytes, c.RawIssuer) && ias.SerialNumber.Cmp(c.SerialNumber) == 0 {
+				return c, nil
+			}
+		case sid.Class == asn1.ClassContextSpecific && sid.Tag == 0:
+			if bytes.Equal(sid.Bytes, c.SubjectKeyId) {
+				return c, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("time-stamp token signer certificate not found")
+}
+
+// signatureAlgorithm returns the algorithm of the token signature.
+func (t *token) signatureAlgorithm() (x509.SignatureAlgorithm, error) {
+	h, err := oidHash(t.signer.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return x509.UnknownSignatureAlgorithm, err
+	}
+
+	algs := map[crypto.Hash][2]x509.SignatureAlgorithm{
+		crypto.SHA256: {x509.SHA256WithRSA, x509.ECDSAWithSHA256},
+		crypto.SHA384: {x509.SHA384WithRSA, x509.ECDSAWithSHA384},
+		crypto.SHA512: {x509.SHA512WithRSA, x509.ECDSAWithSHA512},
+	}
+
+	switch oid := t.signer.SignatureAlgorithm.Algorithm; {
+	case oid.Equal(oidRSA),
+		oid.Equal(oidRSASHA256) && h == crypto.SHA256,
+		oid.Equal(oidRSASHA384) && h == crypto.SHA384,
+		oid.Equal(oidRSASHA512) && h == crypto.SHA512:
+		return algs[h][0], nil
+	case oid.Equal(oidECDSA),
+		oid.Equal(oidECDSA256) && h == crypto.SHA256,
+		oid.Equal(oidECDSA384) && h == crypto.SHA384,
+		oid.Equal(oidECDSA512) && h == crypto.SHA512:
+		return algs[h][1], nil
+	}
+	return x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported signature algorithm %s", t.signer.SignatureAlgorithm.Algorithm)
+}
+
+// checkSignature checks the signature of the token with the certificate
+// of the signer.
+func (t *token) checkSignature(cert *x509.Certificate) error {
+	attrs := t.signer.SignedAttrs
+	if attrs.Class != asn1.ClassContextSpecific || attrs.Tag != 0 {
+		return ErrInvalidToken
+	}
+
+	// the signed attributes must include the content type and the digest
+	// of the content
+	h, err := oidHash(t.signer.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return err
+	}
+	hh := h.New()
+	hh.Write(t.content)
+
+	var contentType, digest bool
+	for rest := attrs.Bytes; len(rest) > 0; {
+		var a attribute
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &a); err != nil || len(a.Values) != 1 {
+			return ErrInvalidToken
+		}
+		switch {
+		case a.Type.Equal(oidContentType):
+			var oid asn1.ObjectIdentifier
+			if _, err := asn1.Unmarshal(a.Values[0].FullBytes, &oid); err != nil || !oid.Equal(oidTSTInfo) {
+				return ErrInvalidToken
+			}
+			contentType = true
+		case a.Type.Equal(oidMessageDigest):
+			var d []byte
+			if _, err := asn1.Unmarshal(a.Values[0].FullBytes, &d); err != nil || !bytes.Equal(d, hh.Sum(nil)) {
+				return fmt.Errorf("time-stamp token content digest mismatch")
+			}
+			digest = true
+		}
+	}
+	if !contentType || !digest {
+		return ErrInvalidToken
+	}
+
+	alg, err := t.signatureAlgorithm()
+	if err != nil {
+		return err
+	}
+
+	// the signature covers the DER encoding of the attributes as a SET
+	signed := append([]byte{}, attrs.FullBytes...)
+	signed[0] = 0x31
+
+	if err := cert.CheckSignature(alg, signed, t.signer.Signature); err != nil {
+		return fmt.Errorf("invalid time-stamp token signature: %s", err)
+	}
+	return nil
+}
+
+// Verify verifies the DER encoded time-stamp token b covers digest,
+// computed with the hash function h, and was signed by a TSA certificate
+// issued by roots, or by the system roots if roots is nil. It returns the
+// time of the token.
+func Verify(b []byte, digest []byte, h crypto.Hash, roots *x509.CertPool) (time.Time, error) {
+	t, err := parseToken(b)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := t.checkImprint(digest, h); err != nil {
+		return time.Time{}, err
+	}
+
+	gt, err := t.genTime()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	cert, err := t.signerCertificate()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := t.checkSignature(cert); err != nil {
+		return time.Time{}, err
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range t.certs {
+		if c != cert {
+			intermediates.AddCert(c)
+		}
+	}
+
+	// the certificate must be valid when the token was generated
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   gt,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("untrusted time stamping authority: %s", err)
+	}
+
+	return gt, nil
+}
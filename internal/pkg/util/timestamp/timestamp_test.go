@@ -0,0 +1,173 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package timestamp
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hpcng/singularity/internal/pkg/util/timestamp/timestamptest"
+)
+
+// newCertificate creates a certificate for key, signed by parent or self
+// signed if parent is nil.
+func newCertificate(t *testing.T, tmpl *x509.Certificate, key crypto.Signer, parent *x509.Certificate, parentKey crypto.Signer) *x509.Certificate {
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %s", err)
+	}
+	return cert
+}
+
+// newAuthority returns an authority signing with key, and the pool of its
+// root certificate.
+func newAuthority(t *testing.T, key crypto.Signer) (*timestamptest.Authority, *x509.CertPool) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+
+	now := time.Now()
+
+	ca := newCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, caKey, nil, nil)
+
+	cert := newCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Test TSA"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}, key, ca, caKey)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	return &timestamptest.Authority{Certificate: cert, Key: key}, roots
+}
+
+func TestRequestVerify(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+
+	digest := sha256.Sum256([]byte("signature"))
+	other := sha256.Sum256([]byte("other signature"))
+
+	for _, tt := range []struct {
+		name string
+		key  crypto.Signer
+	}{
+		{"ECDSA", ecKey},
+		{"RSA", rsaKey},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			a, roots := newAuthority(t, tt.key)
+			genTime := time.Now().Add(-time.Minute).Truncate(time.Second)
+			a.Now = func() time.Time { return genTime }
+
+			s := httptest.NewServer(a)
+			defer s.Close()
+
+			tsr, err := Request(context.Background(), s.URL, digest[:], crypto.SHA256)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			got, err := Verify(tsr, digest[:], crypto.SHA256, roots)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !got.Equal(genTime) {
+				t.Errorf("unexpected time %s, want %s", got, genTime)
+			}
+
+			if _, err := Verify(tsr, other[:], crypto.SHA256, roots); !errors.Is(err, ErrImprintMismatch) {
+				t.Errorf("unexpected error with another digest: %v", err)
+			}
+			if _, err := Verify(tsr, digest[:], crypto.SHA256, x509.NewCertPool()); err == nil {
+				t.Errorf("unexpected success with untrusted roots")
+			}
+
+			corrupted := append([]byte{}, tsr...)
+			corrupted[len(corrupted)-1] ^= 0xff
+			if _, err := Verify(corrupted, digest[:], crypto.SHA256, roots); err == nil {
+				t.Errorf("unexpected success with a corrupted token")
+			}
+			if _, err := Verify(tsr[:len(tsr)/2], digest[:], crypto.SHA256, roots); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("unexpected error with a truncated token: %v", err)
+			}
+		})
+	}
+}
+
+func TestNewAuthority(t *testing.T) {
+	a, err := timestamptest.NewAuthority()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	s := httptest.NewServer(a)
+	defer s.Close()
+
+	digest := sha256.Sum256([]byte("signature"))
+
+	tsr, err := Request(context.Background(), s.URL, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(a.Certificate)
+	if _, err := Verify(tsr, digest[:], crypto.SHA256, roots); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestRequestRejected(t *testing.T) {
+	s := httptest.NewServer(&timestamptest.Authority{})
+	defer s.Close()
+
+	digest := sha256.Sum256([]byte("signature"))
+
+	if _, err := Request(context.Background(), s.URL, digest[:], crypto.SHA1); err == nil {
+		t.Errorf("unexpected success with an unsupported hash function")
+	}
+	if _, err := Request(context.Background(), s.URL, digest[:], crypto.SHA256); err == nil {
+		t.Errorf("unexpected success with an authority failure")
+	}
+}
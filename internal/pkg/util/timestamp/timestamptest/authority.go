@@ -0,0 +1,362 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package timestamptest provides a local RFC 3161 time stamping authority,
+// to sign images with time-stamp tokens and verify them in tests.
+package timestamptest
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	requestContentType  = "application/timestamp-query"
+	responseContentType = "application/timestamp-reply"
+
+	// maxRequestSize is the maximum size of a time-stamp request.
+	maxRequestSize = 1 << 20
+)
+
+var (
+	oidSignedData           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidContentType          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningCertificateV2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	oidRSASHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidECDSA256  = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+
+	// authorityPolicy is the arbitrary policy of the tokens of Authority.
+	authorityPolicy = asn1.ObjectIdentifier{1, 2, 3, 4, 1}
+)
+
+// The ASN.1 structures below are the subset of RFC 3161 and CMS structures
+// needed to answer requests, they are kept apart from the ones of the
+// timestamp package so tokens are not only checked against themselves.
+
+// rawTagged is an optional implicitly tagged field kept encoded.
+type rawTagged struct {
+	Raw asn1.RawContent
+}
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+// request is a TimeStampReq.
+type request struct {
+	Version        int
+	MessageImprint messageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional,default:false"`
+	Extensions     rawTagged             `asn1:"optional,tag:0"`
+}
+
+type pkiStatusInfo struct {
+	Status int
+}
+
+// response is a TimeStampResp.
+type response struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+// tstInfo is the content signed in a token.
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        asn1.RawValue
+	Nonce          *big.Int `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     rawTagged    `asn1:"optional,tag:0"`
+	SignerInfos      []signerInfo `asn1:"set"`
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+type essCertIDv2 struct {
+	CertHash []byte
+}
+
+type signingCertificateV2 struct {
+	Certs []essCertIDv2
+}
+
+// Authority is a minimal time stamping authority, answering requests with
+// tokens signed by Key. It stands in for a real TSA to sign and verify
+// images locally in tests, with httptest.NewServer.
+type Authority struct {
+	// Certificate is the TSA certificate, with the time stamping extended
+	// key usage.
+	Certificate *x509.Certificate
+	// Key is the private key of Certificate, RSA and ECDSA keys are
+	// supported.
+	Key crypto.Signer
+	// Now returns the time of the tokens, time.Now is used if nil.
+	Now func() time.Time
+
+	mu     sync.Mutex
+	serial int64
+}
+
+// NewAuthority returns an authority with a new ECDSA key and a self-signed certificate valid for
+// a day, which must be added to the roots used to verify its tokens.
+func NewAuthority() (*Authority, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "Singularity test time stamping authority"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Authority{Certificate: cert, Key: key}, nil
+}
+
+// ServeHTTP answers a time-stamp request.
+func (a *Authority) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.Header.Get("Content-Type") != requestContentType {
+		http.Error(w, "invalid time-stamp request", http.StatusBadRequest)
+		return
+	}
+
+	b, err := ioutil.ReadAll(io.LimitReader(r.Body, maxRequestSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req request
+	if rest, err := asn1.Unmarshal(b, &req); err != nil || len(rest) > 0 {
+		http.Error(w, "invalid time-stamp request", http.StatusBadRequest)
+		return
+	}
+
+	token, err := a.token(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp, err := asn1.Marshal(response{
+		Status:         pkiStatusInfo{Status: 0},
+		TimeStampToken: asn1.RawValue{FullBytes: token},
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", responseContentType)
+	w.Write(resp)
+}
+
+// token returns a token answering req.
+func (a *Authority) token(req *request) ([]byte, error) {
+	alg := req.MessageImprint.HashAlgorithm.Algorithm
+	if !alg.Equal(oidSHA256) && !alg.Equal(oidSHA384) && !alg.Equal(oidSHA512) {
+		return nil, fmt.Errorf("unsupported hash algorithm %s", alg)
+	}
+
+	if a.Certificate == nil || a.Key == nil {
+		return nil, fmt.Errorf("authority certificate or key not set")
+	}
+
+	var sigAlg asn1.ObjectIdentifier
+	switch a.Key.Public().(type) {
+	case *rsa.PublicKey:
+		sigAlg = oidRSASHA256
+	case *ecdsa.PublicKey:
+		sigAlg = oidECDSA256
+	default:
+		return nil, fmt.Errorf("unsupported authority key type %T", a.Key.Public())
+	}
+
+	now := time.Now
+	if a.Now != nil {
+		now = a.Now
+	}
+
+	a.mu.Lock()
+	a.serial++
+	serial := a.serial
+	a.mu.Unlock()
+
+	content, err := asn1.Marshal(tstInfo{
+		Version:        1,
+		Policy:         authorityPolicy,
+		MessageImprint: req.MessageImprint,
+		SerialNumber:   big.NewInt(serial),
+		GenTime: asn1.RawValue{
+			Tag:   asn1.TagGeneralizedTime,
+			Bytes: []byte(now().UTC().Format("20060102150405Z")),
+		},
+		Nonce: req.Nonce,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	contentDigest := sha256.Sum256(content)
+	certDigest := sha256.Sum256(a.Certificate.Raw)
+
+	attrs := make([][]byte, 0, 3)
+	for _, v := range []struct {
+		oid   asn1.ObjectIdentifier
+		value interface{}
+	}{
+		{oidContentType, oidTSTInfo},
+		{oidMessageDigest, contentDigest[:]},
+		{oidSigningCertificateV2, signingCertificateV2{Certs: []essCertIDv2{{CertHash: certDigest[:]}}}},
+	} {
+		value, err := asn1.Marshal(v.value)
+		if err != nil {
+			return nil, err
+		}
+		attr, err := asn1.Marshal(attribute{Type: v.oid, Values: []asn1.RawValue{{FullBytes: value}}})
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, attr)
+	}
+	// DER encoding of a SET OF requires sorted elements
+	sort.Slice(attrs, func(i, j int) bool {
+		return bytes.Compare(attrs[i], attrs[j]) < 0
+	})
+	attrsContent := bytes.Join(attrs, nil)
+
+	signed, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: attrsContent})
+	if err != nil {
+		return nil, err
+	}
+	signedDigest := sha256.Sum256(signed)
+	signature, err := a.Key.Sign(rand.Reader, signedDigest[:], crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+
+	sid, err := asn1.Marshal(issuerAndSerialNumber{
+		Issuer:       asn1.RawValue{FullBytes: a.Certificate.RawIssuer},
+		SerialNumber: a.Certificate.SerialNumber,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	digestAlg := pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue}
+
+	sd := signedData{
+		Version:          3,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{digestAlg},
+		EncapContentInfo: encapsulatedContentInfo{
+			EContentType: oidTSTInfo,
+			EContent:     content,
+		},
+		SignerInfos: []signerInfo{{
+			Version:            1,
+			SID:                asn1.RawValue{FullBytes: sid},
+			DigestAlgorithm:    digestAlg,
+			SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrsContent},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: sigAlg},
+			Signature:          signature,
+		}},
+	}
+	if req.CertReq {
+		certs, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: a.Certificate.Raw})
+		if err != nil {
+			return nil, err
+		}
+		sd.Certificates = rawTagged{Raw: certs}
+	}
+
+	sdBytes, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sdBytes},
+	})
+}
@@ -0,0 +1,270 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+// Package x509sig implements the signing and verification of SIF object groups with X.509
+// certificates.
+//
+// A signature is stored in a signature object linked to the signed object group, alongside the
+// certificate chain of the signing certificate. It covers the integrity-protected fields of the
+// global header, and the descriptors and data of the signed objects, as PGP signatures do.
+package x509sig
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1" //nolint:gosec // SIF descriptors only have room for a 20 byte fingerprint
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/hpcng/sif/pkg/sif"
+	"github.com/hpcng/singularity/pkg/image"
+)
+
+var (
+	errUnsupportedKey   = errors.New("unsupported public key algorithm")
+	errGroupNotFound    = errors.New("object group not found")
+	errNoGroupsFound    = errors.New("no object groups found")
+	errNoCertificate    = errors.New("no certificate found")
+	errInvalidGroupID   = errors.New("invalid group ID")
+	errObjectNotSigned  = errors.New("object not signed")
+	errObjectIDMismatch = errors.New("signed object IDs do not match object group")
+)
+
+// envelope is the content of a signature object.
+type envelope struct {
+	Payload      []byte   `json:"payload"`      // JSON encoded metadata.
+	Signature    []byte   `json:"signature"`    // Signature of the payload.
+	Certificates [][]byte `json:"certificates"` // DER certificate chain, signing certificate first.
+}
+
+// objectMetadata holds the SHA-256 digests of a signed object.
+type objectMetadata struct {
+	RelativeID uint32 `json:"relativeId"`
+	Descriptor string `json:"descriptorDigest"`
+	Object     string `json:"objectDigest"`
+}
+
+// metadata holds the SHA-256 digests of the header and the signed objects of an object group.
+type metadata struct {
+	Header  string           `json:"headerDigest"`
+	Objects []objectMetadata `json:"objects"`
+}
+
+// digest returns the hex encoded SHA-256 digest of the content of r.
+func digest(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// headerDigest returns the digest of the integrity-protected fields of h.
+func headerDigest(h sif.Header) (string, error) {
+	d := sha256.New()
+	for _, v := range []interface{}{h.Launch, h.Magic, h.Version, h.ID} {
+		if err := binary.Write(d, binary.LittleEndian, v); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(d.Sum(nil)), nil
+}
+
+// descriptorDigest returns the digest of the integrity-protected fields of od.
+func descriptorDigest(od *sif.Descriptor, relativeID uint32) (string, error) {
+	d := sha256.New()
+	fields := []interface{}{
+		od.Datatype,
+		od.Used,
+		relativeID,
+		od.Link,
+		od.Filelen,
+		od.Ctime,
+		od.UID,
+		od.Gid,
+		od.Name,
+		od.Extra,
+	}
+	for _, v := range fields {
+		if err := binary.Write(d, binary.LittleEndian, v); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(d.Sum(nil)), nil
+}
+
+// getObjectMetadata returns the metadata of od, with an ID relative to minID.
+func getObjectMetadata(f *sif.FileImage, od *sif.Descriptor, minID uint32) (objectMetadata, error) {
+	relativeID := od.ID - minID
+
+	dd, err := descriptorDigest(od, relativeID)
+	if err != nil {
+		return objectMetadata{}, err
+	}
+	d, err := digest(od.GetReader(f))
+	if err != nil {
+		return objectMetadata{}, err
+	}
+
+	return objectMetadata{RelativeID: relativeID, Descriptor: dd, Object: d}, nil
+}
+
+// getMetadata returns the metadata of the objects ods of the object group with groupID.
+func getMetadata(f *sif.FileImage, groupID uint32, ods []*sif.Descriptor) (metadata, error) {
+	minID, err := getGroupMinObjectID(f, groupID)
+	if err != nil {
+		return metadata{}, err
+	}
+
+	hd, err := headerDigest(f.Header)
+	if err != nil {
+		return metadata{}, err
+	}
+
+	md := metadata{Header: hd}
+	for _, od := range ods {
+		om, err := getObjectMetadata(f, od, minID)
+		if err != nil {
+			return metadata{}, err
+		}
+		md.Objects = append(md.Objects, om)
+	}
+	return md, nil
+}
+
+// getGroupObjects returns the descriptors of the objects in the object group with groupID, sorted
+// by ID.
+func getGroupObjects(f *sif.FileImage, groupID uint32) ([]*sif.Descriptor, error) {
+	if groupID == 0 {
+		return nil, errInvalidGroupID
+	}
+
+	ods, _, err := f.GetFromDescr(sif.Descriptor{Groupid: groupID | sif.DescrGroupMask})
+	if errors.Is(err, sif.ErrNotFound) {
+		return nil, errGroupNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(ods, func(i, j int) bool { return ods[i].ID < ods[j].ID })
+	return ods, nil
+}
+
+// getGroupMinObjectID returns the minimum ID of the objects in the object group with groupID.
+func getGroupMinObjectID(f *sif.FileImage, groupID uint32) (uint32, error) {
+	ods, err := getGroupObjects(f, groupID)
+	if err != nil {
+		return 0, err
+	}
+	return ods[0].ID, nil
+}
+
+// getGroupIDs returns the sorted IDs of all object groups in f.
+func getGroupIDs(f *sif.FileImage) ([]uint32, error) {
+	seen := make(map[uint32]bool)
+
+	var groupIDs []uint32
+	for _, od := range f.DescrArr {
+		if !od.Used || od.Groupid == sif.DescrUnusedGroup {
+			continue
+		}
+		if id := od.Groupid &^ sif.DescrGroupMask; !seen[id] {
+			seen[id] = true
+			groupIDs = append(groupIDs, id)
+		}
+	}
+
+	if len(groupIDs) == 0 {
+		return nil, errNoGroupsFound
+	}
+
+	sort.Slice(groupIDs, func(i, j int) bool { return groupIDs[i] < groupIDs[j] })
+	return groupIDs, nil
+}
+
+// isSignature returns true if od is an X.509 signature object.
+func isSignature(od *sif.Descriptor) bool {
+	return od.Used && od.Datatype == sif.DataSignature && od.GetName() == image.SIFDescX509Signature
+}
+
+// getGroupSignatures returns the X.509 signature objects linked to the object group with groupID.
+func getGroupSignatures(f *sif.FileImage, groupID uint32) ([]*sif.Descriptor, error) {
+	ods, _, err := f.GetLinkedDescrsByType(groupID|sif.DescrGroupMask, sif.DataSignature)
+	if err != nil && !errors.Is(err, sif.ErrNotFound) {
+		return nil, err
+	}
+
+	var sigs []*sif.Descriptor
+	for _, od := range ods {
+		if isSignature(od) {
+			sigs = append(sigs, od)
+		}
+	}
+	return sigs, nil
+}
+
+// HasSignatures returns true if f contains at least one X.509 signature object.
+func HasSignatures(f *sif.FileImage) bool {
+	for i := range f.DescrArr {
+		if isSignature(&f.DescrArr[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// HideSignatures returns a copy of f in which X.509 signature objects are marked unused, so that
+// they are not mistaken for PGP signatures by the integrity package. The copy must only be used
+// to read f.
+func HideSignatures(f *sif.FileImage) *sif.FileImage {
+	c := *f
+	c.DescrArr = make([]sif.Descriptor, len(f.DescrArr))
+	copy(c.DescrArr, f.DescrArr)
+
+	for i := range c.DescrArr {
+		if isSignature(&c.DescrArr[i]) {
+			c.DescrArr[i].Used = false
+		}
+	}
+	return &c
+}
+
+// Fingerprint returns the hex encoded SHA-1 fingerprint of cert, as recorded in the descriptors
+// of the signature objects it made.
+func Fingerprint(cert *x509.Certificate) string {
+	fp := sha1.Sum(cert.Raw) //nolint:gosec
+	return hex.EncodeToString(fp[:])
+}
+
+// signatureAlgorithm returns the algorithm of signatures made with a key of the public key pub.
+func signatureAlgorithm(pub crypto.PublicKey) (x509.SignatureAlgorithm, error) {
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		return x509.SHA256WithRSA, nil
+	case *ecdsa.PublicKey:
+		return x509.ECDSAWithSHA256, nil
+	case ed25519.PublicKey:
+		return x509.PureEd25519, nil
+	}
+	return x509.UnknownSignatureAlgorithm, fmt.Errorf("%w: %T", errUnsupportedKey, pub)
+}
+
+// signPayload signs payload with key, using algorithm alg.
+func signPayload(key crypto.Signer, alg x509.SignatureAlgorithm, payload []byte) ([]byte, error) {
+	if alg == x509.PureEd25519 {
+		return key.Sign(rand.Reader, payload, crypto.Hash(0))
+	}
+	d := sha256.Sum256(payload)
+	return key.Sign(rand.Reader, d[:], crypto.SHA256)
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package x509sig
+
+import (
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+var errNoPrivateKey = errors.New("no private key found")
+
+// LoadCertificates returns the certificates of the PEM file at path, in order.
+func LoadCertificates(path string) ([]*x509.Certificate, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []*x509.Certificate
+	for {
+		var p *pem.Block
+		if p, b = pem.Decode(b); p == nil {
+			break
+		}
+		if p.Type != "CERTIFICATE" {
+			continue
+		}
+
+		c, err := x509.ParseCertificate(p.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("while parsing certificate: %w", err)
+		}
+		certs = append(certs, c)
+	}
+
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("%w in %s", errNoCertificate, path)
+	}
+	return certs, nil
+}
+
+// LoadCertPool returns a pool of the certificates of the PEM file at path.
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	certs, err := LoadCertificates(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	for _, c := range certs {
+		pool.AddCert(c)
+	}
+	return pool, nil
+}
+
+// LoadPrivateKey returns the first unencrypted private key of the PEM file at path, in PKCS #8,
+// PKCS #1 or SEC 1 form.
+func LoadPrivateKey(path string) (crypto.Signer, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		var p *pem.Block
+		if p, b = pem.Decode(b); p == nil {
+			break
+		}
+
+		var key interface{}
+		switch p.Type {
+		case "PRIVATE KEY":
+			key, err = x509.ParsePKCS8PrivateKey(p.Bytes)
+		case "RSA PRIVATE KEY":
+			key, err = x509.ParsePKCS1PrivateKey(p.Bytes)
+		case "EC PRIVATE KEY":
+			key, err = x509.ParseECPrivateKey(p.Bytes)
+		case "ENCRYPTED PRIVATE KEY":
+			return nil, fmt.Errorf("encrypted private keys are not supported")
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("while parsing private key: %w", err)
+		}
+
+		s, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("%w: %T", errUnsupportedKey, key)
+		}
+		return s, nil
+	}
+
+	return nil, fmt.Errorf("%w in %s", errNoPrivateKey, path)
+}
+
+// LoadCRL returns the certificate revocation list of the PEM or DER file at path.
+func LoadCRL(path string) (*pkix.CertificateList, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	crl, err := x509.ParseCRL(b)
+	if err != nil {
+		return nil, fmt.Errorf("while parsing certificate revocation list %s: %w", path, err)
+	}
+	return crl, nil
+}
@@ -0,0 +1,200 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package x509sig
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hpcng/sif/pkg/sif"
+	"github.com/hpcng/singularity/pkg/image"
+)
+
+var errKeyMismatch = errors.New("private key does not match certificate")
+
+// signTask describes the signature of the objects ods of an object group.
+type signTask struct {
+	groupID uint32
+	ods     []*sif.Descriptor
+}
+
+// Signer describes a SIF image signer, using an X.509 certificate.
+type Signer struct {
+	f         *sif.FileImage
+	key       crypto.Signer
+	certs     []*x509.Certificate
+	alg       x509.SignatureAlgorithm
+	groupIDs  []uint32
+	objectIDs [][]uint32
+}
+
+// SignerOpt are used to configure s.
+type SignerOpt func(s *Signer) error
+
+// OptSignGroup specifies that a signature be applied to cover all objects in the group with the
+// specified groupID. This may be called multiple times to add multiple group signatures.
+func OptSignGroup(groupID uint32) SignerOpt {
+	return func(s *Signer) error {
+		s.groupIDs = append(s.groupIDs, groupID)
+		return nil
+	}
+}
+
+// OptSignObjects specifies that one or more signature(s) be applied to cover objects with the
+// specified ids. One signature will be applied for each group ID associated with the object(s).
+// This may be called multiple times to add multiple signatures.
+func OptSignObjects(ids ...uint32) SignerOpt {
+	return func(s *Signer) error {
+		if len(ids) == 0 {
+			return errors.New("no object IDs specified")
+		}
+		s.objectIDs = append(s.objectIDs, ids)
+		return nil
+	}
+}
+
+// NewSigner returns a Signer to add digital signature(s) to f, made with key. The first of certs
+// is the certificate of key, and the others are intermediate certificates stored alongside it to
+// build its chain.
+//
+// By default, one signature is added per object group in f. To override this behavior, consider
+// using OptSignGroup and/or OptSignObjects.
+func NewSigner(f *sif.FileImage, key crypto.Signer, certs []*x509.Certificate, opts ...SignerOpt) (*Signer, error) {
+	if len(certs) == 0 {
+		return nil, errNoCertificate
+	}
+
+	alg, err := signatureAlgorithm(certs[0].PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if pub, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool }); !ok || !pub.Equal(certs[0].PublicKey) {
+		return nil, errKeyMismatch
+	}
+
+	s := Signer{f: f, key: key, certs: certs, alg: alg}
+	for _, opt := range opts {
+		if err := opt(&s); err != nil {
+			return nil, err
+		}
+	}
+	return &s, nil
+}
+
+// getTasks returns the signatures to apply.
+func (s *Signer) getTasks() ([]signTask, error) {
+	groupIDs := s.groupIDs
+	if len(groupIDs) == 0 && len(s.objectIDs) == 0 {
+		ids, err := getGroupIDs(s.f)
+		if err != nil {
+			return nil, err
+		}
+		groupIDs = ids
+	}
+
+	var tasks []signTask
+	for _, groupID := range groupIDs {
+		ods, err := getGroupObjects(s.f, groupID)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, signTask{groupID: groupID, ods: ods})
+	}
+
+	for _, ids := range s.objectIDs {
+		byGroup := make(map[uint32][]*sif.Descriptor)
+
+		var groupIDs []uint32
+		for _, id := range ids {
+			od, _, err := s.f.GetFromDescrID(id)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get descriptor: %w", err)
+			}
+			if od.Groupid == sif.DescrUnusedGroup {
+				return nil, fmt.Errorf("object %v not in an object group", id)
+			}
+
+			groupID := od.Groupid &^ sif.DescrGroupMask
+			if _, ok := byGroup[groupID]; !ok {
+				groupIDs = append(groupIDs, groupID)
+			}
+			byGroup[groupID] = append(byGroup[groupID], od)
+		}
+
+		for _, groupID := range groupIDs {
+			tasks = append(tasks, signTask{groupID: groupID, ods: byGroup[groupID]})
+		}
+	}
+
+	return tasks, nil
+}
+
+// sign returns the content of the signature object of t.
+func (s *Signer) sign(t signTask) ([]byte, error) {
+	md, err := getMetadata(s.f, t.groupID, t.ods)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(md)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := signPayload(s.key, s.alg, payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign metadata: %w", err)
+	}
+
+	env := envelope{Payload: payload, Signature: sig}
+	for _, c := range s.certs {
+		env.Certificates = append(env.Certificates, c.Raw)
+	}
+	return json.Marshal(env)
+}
+
+// Sign adds digital signatures as specified by s.
+func (s *Signer) Sign() error {
+	tasks, err := s.getTasks()
+	if err != nil {
+		return err
+	}
+
+	// Compute all signatures before adding any object to the image.
+	sigs := make([][]byte, 0, len(tasks))
+	for _, t := range tasks {
+		b, err := s.sign(t)
+		if err != nil {
+			return err
+		}
+		sigs = append(sigs, b)
+	}
+
+	fp := Fingerprint(s.certs[0])
+
+	for i, t := range tasks {
+		di := sif.DescriptorInput{
+			Datatype: sif.DataSignature,
+			Groupid:  sif.DescrUnusedGroup,
+			Link:     t.groupID | sif.DescrGroupMask,
+			Size:     int64(len(sigs[i])),
+			Fname:    image.SIFDescX509Signature,
+			Fp:       bytes.NewReader(sigs[i]),
+		}
+		if err := di.SetSignExtra(sif.HashSHA256, fp); err != nil {
+			return err
+		}
+		if err := s.f.AddObject(di); err != nil {
+			return fmt.Errorf("failed to add signature object: %w", err)
+		}
+	}
+
+	return nil
+}
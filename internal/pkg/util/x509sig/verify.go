@@ -0,0 +1,497 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package x509sig
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hpcng/sif/pkg/integrity"
+	"github.com/hpcng/sif/pkg/sif"
+	"golang.org/x/crypto/openpgp"
+)
+
+var (
+	errNoRoots             = errors.New("no root certificates")
+	errFingerprintMismatch = errors.New("fingerprint in descriptor does not correspond to signing certificate")
+	errNonGroupedObject    = errors.New("non-signature object not associated with object group")
+	errCRLExpired          = errors.New("certificate revocation list expired")
+)
+
+// CertificateRevokedError records a certificate listed in a certificate revocation list.
+type CertificateRevokedError struct {
+	Cert *x509.Certificate // Revoked certificate.
+}
+
+func (e *CertificateRevokedError) Error() string {
+	return fmt.Sprintf("certificate %q revoked", e.Cert.Subject)
+}
+
+// VerifyResult describes the verification of an X.509 signature.
+type VerifyResult interface {
+	integrity.VerifyResult
+
+	// Certificates returns the verified chain of the signing certificate, from the signing
+	// certificate to a root certificate, or nil if the chain could not be verified.
+	Certificates() []*x509.Certificate
+}
+
+type result struct {
+	signature uint32              // ID of the signature object.
+	signed    []uint32            // IDs of the objects covered by the signature.
+	verified  []uint32            // IDs of the objects verified.
+	chain     []*x509.Certificate // Verified certificate chain.
+	err       error               // Verification error, if any.
+}
+
+// Signature returns the ID of the signature object associated with the result.
+func (r result) Signature() uint32 {
+	return r.signature
+}
+
+// Signed returns the IDs of data objects that were signed.
+func (r result) Signed() []uint32 {
+	return r.signed
+}
+
+// Verified returns the IDs of data objects that were verified.
+func (r result) Verified() []uint32 {
+	return r.verified
+}
+
+// Entity always returns nil, as X.509 signatures are not made by PGP entities.
+func (r result) Entity() *openpgp.Entity {
+	return nil
+}
+
+// Certificates returns the verified chain of the signing certificate.
+func (r result) Certificates() []*x509.Certificate {
+	return r.chain
+}
+
+// Error returns an error describing the reason verification failed, or nil if verification was
+// successful.
+func (r result) Error() error {
+	return r.err
+}
+
+// VerifyCallback is called immediately after a signature is verified. If r contains a non-nil
+// error, and the callback returns true, the error is ignored, and verification proceeds as if no
+// error occurred.
+type VerifyCallback func(r VerifyResult) (ignoreError bool)
+
+// TimeFunc returns the time at which the certificates of the signature object sig are checked.
+type TimeFunc func(sig *sif.Descriptor) (time.Time, error)
+
+// verifyTask describes the verification of the objects ods of an object group.
+type verifyTask struct {
+	groupID  uint32
+	ods      []*sif.Descriptor
+	subsetOK bool                  // If true, permit ods to be a subset of the signed objects.
+	chains   [][]*x509.Certificate // Verified certificate chains, set by Verify.
+}
+
+// Verifier describes a SIF image verifier, using X.509 certificates.
+type Verifier struct {
+	f         *sif.FileImage
+	roots     *x509.CertPool
+	crls      []*pkix.CertificateList
+	timeFn    TimeFunc
+	cb        VerifyCallback
+	groupIDs  []uint32
+	objectIDs []uint32
+	tasks     []*verifyTask
+}
+
+// VerifierOpt are used to configure v.
+type VerifierOpt func(v *Verifier) error
+
+// OptVerifyWithRoots specifies that certificate chains be verified up to the certificates in
+// roots.
+func OptVerifyWithRoots(roots *x509.CertPool) VerifierOpt {
+	return func(v *Verifier) error {
+		v.roots = roots
+		return nil
+	}
+}
+
+// OptVerifyWithCRLs specifies that the certificates of chains be checked against the certificate
+// revocation lists crls. The signature of each list is checked against the issuing certificate.
+func OptVerifyWithCRLs(crls ...*pkix.CertificateList) VerifierOpt {
+	return func(v *Verifier) error {
+		v.crls = append(v.crls, crls...)
+		return nil
+	}
+}
+
+// OptVerifyTime specifies that certificates be checked at the time returned by fn for each
+// signature object, instead of the current time.
+func OptVerifyTime(fn TimeFunc) VerifierOpt {
+	return func(v *Verifier) error {
+		v.timeFn = fn
+		return nil
+	}
+}
+
+// OptVerifyGroup adds a verification task for the group with the specified groupID. This may be
+// called multiple times to request verification of more than one group.
+func OptVerifyGroup(groupID uint32) VerifierOpt {
+	return func(v *Verifier) error {
+		v.groupIDs = append(v.groupIDs, groupID)
+		return nil
+	}
+}
+
+// OptVerifyObject adds a verification task for the object with the specified id. This may be
+// called multiple times to request verification of more than one object.
+func OptVerifyObject(id uint32) VerifierOpt {
+	return func(v *Verifier) error {
+		v.objectIDs = append(v.objectIDs, id)
+		return nil
+	}
+}
+
+// OptVerifyCallback registers f as the verification callback, which is called after each
+// signature is verified.
+func OptVerifyCallback(cb VerifyCallback) VerifierOpt {
+	return func(v *Verifier) error {
+		v.cb = cb
+		return nil
+	}
+}
+
+// NewVerifier constructs a new X.509 signature verifier for f. Root certificates must be supplied
+// with OptVerifyWithRoots.
+//
+// By default, signatures for all object groups are verified. To override the default behavior,
+// consider using OptVerifyGroup and/or OptVerifyObject.
+func NewVerifier(f *sif.FileImage, opts ...VerifierOpt) (*Verifier, error) {
+	v := Verifier{f: f}
+	for _, opt := range opts {
+		if err := opt(&v); err != nil {
+			return nil, err
+		}
+	}
+
+	if v.roots == nil {
+		return nil, errNoRoots
+	}
+
+	groupIDs := v.groupIDs
+	if len(groupIDs) == 0 && len(v.objectIDs) == 0 {
+		ids, err := getGroupIDs(f)
+		if err != nil {
+			return nil, err
+		}
+		groupIDs = ids
+	}
+
+	for _, groupID := range groupIDs {
+		ods, err := getGroupObjects(f, groupID)
+		if err != nil {
+			return nil, err
+		}
+		v.tasks = append(v.tasks, &verifyTask{groupID: groupID, ods: ods})
+	}
+
+	for _, id := range v.objectIDs {
+		od, _, err := f.GetFromDescrID(id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get descriptor: %w", err)
+		}
+		if od.Groupid == sif.DescrUnusedGroup {
+			return nil, fmt.Errorf("object %v not in an object group", id)
+		}
+		groupID := od.Groupid &^ sif.DescrGroupMask
+		v.tasks = append(v.tasks, &verifyTask{groupID: groupID, ods: []*sif.Descriptor{od}, subsetOK: true})
+	}
+
+	return &v, nil
+}
+
+// checkRevocation checks the certificates of chain against the certificate revocation lists of v,
+// at time t.
+func (v *Verifier) checkRevocation(chain []*x509.Certificate, t time.Time) error {
+	for i := 0; i < len(chain)-1; i++ {
+		cert, issuer := chain[i], chain[i+1]
+
+		for _, crl := range v.crls {
+			if issuer.CheckCRLSignature(crl) != nil {
+				continue
+			}
+			if crl.HasExpired(t) {
+				return fmt.Errorf("%w: issued by %q", errCRLExpired, issuer.Subject)
+			}
+			for _, rc := range crl.TBSCertList.RevokedCertificates {
+				if rc.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+					return &CertificateRevokedError{Cert: cert}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// verifyCertificates verifies that the certificates certs, the first of which made the signature
+// object sig, chain up to a root of v and are not revoked at time t. It returns the verified
+// chain.
+func (v *Verifier) verifyCertificates(sig *sif.Descriptor, certs [][]byte, t time.Time) ([]*x509.Certificate, error) { // nolint:lll
+	if len(certs) == 0 {
+		return nil, errNoCertificate
+	}
+
+	leaf, err := x509.ParseCertificate(certs[0])
+	if err != nil {
+		return nil, err
+	}
+
+	// Ensure signing certificate matches fingerprint in descriptor.
+	fp, err := sig.GetEntity()
+	if err != nil {
+		return nil, err
+	}
+	if Fingerprint(leaf) != hex.EncodeToString(fp[:20]) {
+		return nil, errFingerprintMismatch
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, b := range certs[1:] {
+		c, err := x509.ParseCertificate(b)
+		if err != nil {
+			return nil, err
+		}
+		intermediates.AddCert(c)
+	}
+
+	chains, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         v.roots,
+		Intermediates: intermediates,
+		CurrentTime:   t,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Accept the first chain with no revoked certificate.
+	for _, chain := range chains {
+		if err = v.checkRevocation(chain, t); err == nil {
+			return chain, nil
+		}
+	}
+	return nil, err
+}
+
+// verifySignature verifies the objects of t against the signature object sig. It returns the
+// verified certificate chain, and the IDs of the signed and verified objects.
+//
+// If an invalid signature is encountered, a integrity.SignatureNotValidError is returned.
+//
+// If verification of the SIF global header fails, integrity.ErrHeaderIntegrity is returned. If
+// verification of a data object descriptor fails, an integrity.DescriptorIntegrityError is
+// returned. If verification of a data object fails, an integrity.ObjectIntegrityError is returned.
+func (v *Verifier) verifySignature(t *verifyTask, sig *sif.Descriptor) ([]*x509.Certificate, []uint32, []uint32, error) { // nolint:lll
+	var env envelope
+	if err := json.Unmarshal(sig.GetData(v.f), &env); err != nil {
+		return nil, nil, nil, &integrity.SignatureNotValidError{ID: sig.ID, Err: err}
+	}
+
+	// Check certificates at the current time, or at the time given by the time function.
+	at := time.Now()
+	if v.timeFn != nil {
+		var err error
+		if at, err = v.timeFn(sig); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	chain, err := v.verifyCertificates(sig, env.Certificates, at)
+	if err != nil {
+		return nil, nil, nil, &integrity.SignatureNotValidError{ID: sig.ID, Err: err}
+	}
+
+	// Check the signature of the metadata.
+	alg, err := signatureAlgorithm(chain[0].PublicKey)
+	if err != nil {
+		return nil, nil, nil, &integrity.SignatureNotValidError{ID: sig.ID, Err: err}
+	}
+	if err := chain[0].CheckSignature(alg, env.Payload, env.Signature); err != nil {
+		return nil, nil, nil, &integrity.SignatureNotValidError{ID: sig.ID, Err: err}
+	}
+
+	var md metadata
+	if err := json.Unmarshal(env.Payload, &md); err != nil {
+		return chain, nil, nil, &integrity.SignatureNotValidError{ID: sig.ID, Err: err}
+	}
+
+	minID, err := getGroupMinObjectID(v.f, t.groupID)
+	if err != nil {
+		return chain, nil, nil, err
+	}
+
+	objects := make(map[uint32]objectMetadata)
+	signed := make([]uint32, 0, len(md.Objects))
+	for _, om := range md.Objects {
+		objects[om.RelativeID] = om
+		signed = append(signed, om.RelativeID+minID)
+	}
+
+	// If an object subset is not permitted, the signed objects must be exactly those of the group.
+	if !t.subsetOK && len(md.Objects) != len(t.ods) {
+		return chain, signed, nil, errObjectIDMismatch
+	}
+
+	// Verify header and object integrity.
+	hd, err := headerDigest(v.f.Header)
+	if err != nil {
+		return chain, signed, nil, err
+	}
+	if hd != md.Header {
+		return chain, signed, nil, integrity.ErrHeaderIntegrity
+	}
+
+	verified := make([]uint32, 0, len(t.ods))
+	for _, od := range t.ods {
+		om, ok := objects[od.ID-minID]
+		if !ok {
+			if t.subsetOK {
+				return chain, signed, verified, fmt.Errorf("%w: %v", errObjectNotSigned, od.ID)
+			}
+			return chain, signed, verified, errObjectIDMismatch
+		}
+
+		got, err := getObjectMetadata(v.f, od, minID)
+		if err != nil {
+			return chain, signed, verified, err
+		}
+		if got.Descriptor != om.Descriptor {
+			return chain, signed, verified, &integrity.DescriptorIntegrityError{ID: od.ID}
+		}
+		if got.Object != om.Object {
+			return chain, signed, verified, &integrity.ObjectIntegrityError{ID: od.ID}
+		}
+		verified = append(verified, od.ID)
+	}
+
+	return chain, signed, verified, nil
+}
+
+// Verify performs all cryptographic verification tasks specified by v.
+//
+// If no X.509 signatures are found for an object group, an integrity.SignatureNotFoundError is
+// returned. If a signature is not valid, including when its certificate chain cannot be verified
+// or a certificate is revoked, an integrity.SignatureNotValidError is returned.
+func (v *Verifier) Verify() error {
+	// All non-signature objects must be contained in an object group.
+	ods, _, err := v.f.GetFromDescr(sif.Descriptor{Groupid: sif.DescrUnusedGroup})
+	if err != nil && !errors.Is(err, sif.ErrNotFound) {
+		return err
+	}
+	for _, od := range ods {
+		if od.Datatype != sif.DataSignature {
+			return errNonGroupedObject
+		}
+	}
+
+	for _, t := range v.tasks {
+		sigs, err := getGroupSignatures(v.f, t.groupID)
+		if err != nil {
+			return err
+		}
+		if len(sigs) == 0 {
+			return &integrity.SignatureNotFoundError{ID: t.groupID, IsGroup: true}
+		}
+
+		t.chains = nil
+		for _, sig := range sigs {
+			chain, signed, verified, err := v.verifySignature(t, sig)
+
+			// Call verify callback, if applicable.
+			if v.cb != nil {
+				r := result{signature: sig.ID, signed: signed, verified: verified, chain: chain, err: err}
+				if ignoreError := v.cb(r); ignoreError {
+					err = nil
+				}
+			}
+
+			if err != nil {
+				return err
+			}
+			if chain != nil {
+				t.chains = append(t.chains, chain)
+			}
+		}
+	}
+
+	return nil
+}
+
+// chainID identifies a certificate chain by the SHA-256 digest of its signing certificate.
+func chainID(chain []*x509.Certificate) [sha256.Size]byte {
+	return sha256.Sum256(chain[0].Raw)
+}
+
+// AnySignedBy returns the verified certificate chains of the certificates that signed at least
+// one of the objects specified by v. It must be called after a successful call to Verify.
+func (v *Verifier) AnySignedBy() [][]*x509.Certificate {
+	seen := make(map[[sha256.Size]byte]bool)
+
+	var chains [][]*x509.Certificate
+	for _, t := range v.tasks {
+		for _, chain := range t.chains {
+			if id := chainID(chain); !seen[id] {
+				seen[id] = true
+				chains = append(chains, chain)
+			}
+		}
+	}
+	return chains
+}
+
+// AllSignedBy returns the verified certificate chains of the certificates that signed all of the
+// objects specified by v. It must be called after a successful call to Verify.
+func (v *Verifier) AllSignedBy() [][]*x509.Certificate {
+	var chains [][]*x509.Certificate
+	for _, chain := range v.AnySignedBy() {
+		id := chainID(chain)
+
+		all := true
+		for _, t := range v.tasks {
+			found := false
+			for _, c := range t.chains {
+				if chainID(c) == id {
+					found = true
+					break
+				}
+			}
+			all = all && found
+		}
+
+		if all {
+			chains = append(chains, chain)
+		}
+	}
+	return chains
+}
+
+// HasCA returns true if one of the CA certificates of chain has the hex encoded SHA-256
+// fingerprint fp.
+func HasCA(chain []*x509.Certificate, fp string) bool {
+	for _, c := range chain[1:] {
+		d := sha256.Sum256(c.Raw)
+		if strings.EqualFold(hex.EncodeToString(d[:]), fp) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,564 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package x509sig
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hpcng/sif/pkg/integrity"
+	"github.com/hpcng/sif/pkg/sif"
+	"golang.org/x/crypto/openpgp"
+)
+
+// testPKI holds a root CA, an intermediate CA and a code signing certificate issued by it.
+type testPKI struct {
+	root, intermediate, leaf          *x509.Certificate
+	rootKey, intermediateKey, leafKey crypto.Signer
+}
+
+// newKey returns a new ECDSA P-256 key.
+func newKey(t *testing.T) crypto.Signer {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// newCertificate creates a certificate for key from tmpl, signed by parent, or self signed if
+// parent is nil.
+func newCertificate(t *testing.T, tmpl *x509.Certificate, key crypto.Signer, parent *x509.Certificate, parentKey crypto.Signer) *x509.Certificate { // nolint:lll
+	t.Helper()
+
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// newTestPKI returns a new test PKI, with a signing certificate for leafKey.
+func newTestPKI(t *testing.T, leafKey crypto.Signer) *testPKI {
+	t.Helper()
+
+	now := time.Now()
+	p := testPKI{rootKey: newKey(t), intermediateKey: newKey(t), leafKey: leafKey}
+
+	p.root = newCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, p.rootKey, nil, nil)
+
+	p.intermediate = newCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "Test Intermediate CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, p.intermediateKey, p.root, p.rootKey)
+
+	p.leaf = newCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "Test Signer", Organization: []string{"Test"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}, leafKey, p.intermediate, p.intermediateKey)
+
+	return &p
+}
+
+// roots returns a pool of the root certificate of p.
+func (p *testPKI) roots() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(p.root)
+	return pool
+}
+
+// crl returns a certificate revocation list of the intermediate CA of p, valid until nextUpdate.
+func (p *testPKI) crl(t *testing.T, nextUpdate time.Time, revoked ...*x509.Certificate) *pkix.CertificateList {
+	t.Helper()
+
+	var rcs []pkix.RevokedCertificate
+	for _, c := range revoked {
+		rcs = append(rcs, pkix.RevokedCertificate{SerialNumber: c.SerialNumber, RevocationTime: time.Now()})
+	}
+
+	der, err := p.intermediate.CreateCRL(rand.Reader, p.intermediateKey, rcs, time.Now().Add(-time.Hour), nextUpdate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl, err := x509.ParseCRL(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return crl
+}
+
+// tempFileFrom copies the file at path to a temporary file, and returns its path.
+func tempFileFrom(t *testing.T, path string) string {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tf, err := ioutil.TempFile("", "*.sif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tf.Close()
+
+	if _, err := io.Copy(tf, f); err != nil {
+		t.Fatal(err)
+	}
+	return tf.Name()
+}
+
+// signedImage returns the path of a temporary copy of the test image, signed with p.
+func signedImage(t *testing.T, p *testPKI) string {
+	t.Helper()
+
+	path := tempFileFrom(t, filepath.Join("testdata", "images", "one-group.sif"))
+
+	f, err := sif.LoadContainer(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.UnloadContainer()
+
+	s, err := NewSigner(&f, p.leafKey, []*x509.Certificate{p.leaf, p.intermediate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Sign(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestNewSigner(t *testing.T) {
+	p := newTestPKI(t, newKey(t))
+
+	f, err := sif.LoadContainer(filepath.Join("testdata", "images", "one-group.sif"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.UnloadContainer()
+
+	tests := []struct {
+		name    string
+		key     crypto.Signer
+		certs   []*x509.Certificate
+		wantErr error
+	}{
+		{"OK", p.leafKey, []*x509.Certificate{p.leaf}, nil},
+		{"NoCertificate", p.leafKey, nil, errNoCertificate},
+		{"KeyMismatch", newKey(t), []*x509.Certificate{p.leaf}, errKeyMismatch},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSigner(&f, tt.key, tt.certs); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		key  crypto.Signer
+	}{
+		{"ECDSA", newKey(t)},
+		{"RSA", rsaKey},
+		{"Ed25519", edKey},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPKI(t, tt.key)
+
+			path := signedImage(t, p)
+			defer os.Remove(path)
+
+			f, err := sif.LoadContainer(path, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.UnloadContainer()
+
+			var results int
+			cb := func(r VerifyResult) bool {
+				results++
+
+				if err := r.Error(); err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				if got, want := len(r.Certificates()), 3; got != want {
+					t.Errorf("got chain of %v certificates, want %v", got, want)
+				}
+				if got, want := len(r.Verified()), len(r.Signed()); got != want || got == 0 {
+					t.Errorf("got %v verified objects, want %v", got, want)
+				}
+				return false
+			}
+
+			v, err := NewVerifier(&f, OptVerifyWithRoots(p.roots()), OptVerifyCallback(cb))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := v.Verify(); err != nil {
+				t.Fatalf("failed to verify: %v", err)
+			}
+
+			if got, want := results, 1; got != want {
+				t.Errorf("got %v results, want %v", got, want)
+			}
+
+			chains := v.AllSignedBy()
+			if got, want := len(chains), 1; got != want {
+				t.Fatalf("got %v chains, want %v", got, want)
+			}
+			if !chains[0][0].Equal(p.leaf) {
+				t.Errorf("got signing certificate %v, want %v", chains[0][0].Subject, p.leaf.Subject)
+			}
+
+			fp := func(c *x509.Certificate) string {
+				d := sha256.Sum256(c.Raw)
+				return hex.EncodeToString(d[:])
+			}
+			if !HasCA(chains[0], fp(p.intermediate)) || !HasCA(chains[0], fp(p.root)) {
+				t.Errorf("CA fingerprint not found in chain")
+			}
+			if HasCA(chains[0], fp(p.leaf)) {
+				t.Errorf("signing certificate fingerprint matched as a CA")
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	p := newTestPKI(t, newKey(t))
+	other := newTestPKI(t, newKey(t))
+
+	signed := signedImage(t, p)
+	defer os.Remove(signed)
+
+	// Tamper with the data of the first object of a signed image.
+	tampered := signedImage(t, p)
+	defer os.Remove(tampered)
+	func() {
+		f, err := sif.LoadContainer(tampered, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		off := f.DescrArr[0].Fileoff
+		f.UnloadContainer()
+
+		fp, err := os.OpenFile(tampered, os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fp.Close()
+
+		if _, err := fp.WriteAt([]byte{0xff}, off); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	tests := []struct {
+		name     string
+		path     string
+		opts     []VerifierOpt
+		wantErr  error
+		wantAsFn func(error) bool
+	}{
+		{
+			name: "OK",
+			path: signed,
+			opts: []VerifierOpt{OptVerifyWithRoots(p.roots())},
+		},
+		{
+			name: "Group",
+			path: signed,
+			opts: []VerifierOpt{OptVerifyWithRoots(p.roots()), OptVerifyGroup(1)},
+		},
+		{
+			name: "Object",
+			path: signed,
+			opts: []VerifierOpt{OptVerifyWithRoots(p.roots()), OptVerifyObject(1)},
+		},
+		{
+			name: "CRL",
+			path: signed,
+			opts: []VerifierOpt{
+				OptVerifyWithRoots(p.roots()),
+				OptVerifyWithCRLs(p.crl(t, time.Now().Add(time.Hour))),
+			},
+		},
+		{
+			name:    "Unsigned",
+			path:    filepath.Join("testdata", "images", "one-group.sif"),
+			opts:    []VerifierOpt{OptVerifyWithRoots(p.roots())},
+			wantErr: &integrity.SignatureNotFoundError{},
+		},
+		{
+			name:    "PGPSigned",
+			path:    filepath.Join("testdata", "images", "one-group-signed.sif"),
+			opts:    []VerifierOpt{OptVerifyWithRoots(p.roots())},
+			wantErr: &integrity.SignatureNotFoundError{},
+		},
+		{
+			name:    "UnknownAuthority",
+			path:    signed,
+			opts:    []VerifierOpt{OptVerifyWithRoots(other.roots())},
+			wantErr: &integrity.SignatureNotValidError{},
+			wantAsFn: func(err error) bool {
+				return errors.As(err, &x509.UnknownAuthorityError{})
+			},
+		},
+		{
+			name: "Expired",
+			path: signed,
+			opts: []VerifierOpt{
+				OptVerifyWithRoots(p.roots()),
+				OptVerifyTime(func(*sif.Descriptor) (time.Time, error) {
+					return time.Now().Add(2 * time.Hour), nil
+				}),
+			},
+			wantErr: &integrity.SignatureNotValidError{},
+			wantAsFn: func(err error) bool {
+				var e x509.CertificateInvalidError
+				return errors.As(err, &e) && e.Reason == x509.Expired
+			},
+		},
+		{
+			name: "Revoked",
+			path: signed,
+			opts: []VerifierOpt{
+				OptVerifyWithRoots(p.roots()),
+				OptVerifyWithCRLs(p.crl(t, time.Now().Add(time.Hour), p.leaf)),
+			},
+			wantErr: &integrity.SignatureNotValidError{},
+			wantAsFn: func(err error) bool {
+				var e *CertificateRevokedError
+				return errors.As(err, &e)
+			},
+		},
+		{
+			name: "CRLExpired",
+			path: signed,
+			opts: []VerifierOpt{
+				OptVerifyWithRoots(p.roots()),
+				OptVerifyWithCRLs(p.crl(t, time.Now().Add(-time.Minute))),
+			},
+			wantErr: errCRLExpired,
+		},
+		{
+			name: "OtherCRL",
+			path: signed,
+			opts: []VerifierOpt{
+				OptVerifyWithRoots(p.roots()),
+				OptVerifyWithCRLs(other.crl(t, time.Now().Add(time.Hour), p.leaf)),
+			},
+		},
+		{
+			name:    "Tampered",
+			path:    tampered,
+			opts:    []VerifierOpt{OptVerifyWithRoots(p.roots())},
+			wantErr: &integrity.ObjectIntegrityError{},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := sif.LoadContainer(tt.path, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.UnloadContainer()
+
+			v, err := NewVerifier(&f, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = v.Verify()
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantAsFn != nil && !tt.wantAsFn(err) {
+				t.Errorf("got error %v of unexpected type", err)
+			}
+		})
+	}
+}
+
+func TestNewVerifierNoRoots(t *testing.T) {
+	f, err := sif.LoadContainer(filepath.Join("testdata", "images", "one-group.sif"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.UnloadContainer()
+
+	if _, err := NewVerifier(&f); !errors.Is(err, errNoRoots) {
+		t.Errorf("got error %v, want %v", err, errNoRoots)
+	}
+}
+
+func TestHideSignatures(t *testing.T) {
+	p := newTestPKI(t, newKey(t))
+
+	path := signedImage(t, p)
+	defer os.Remove(path)
+
+	f, err := sif.LoadContainer(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.UnloadContainer()
+
+	if !HasSignatures(&f) {
+		t.Fatal("signature not found")
+	}
+
+	h := HideSignatures(&f)
+	if HasSignatures(h) {
+		t.Error("signature not hidden")
+	}
+	if !HasSignatures(&f) {
+		t.Error("original image modified")
+	}
+
+	// The PGP verifier only finds that the image is not signed with PGP.
+	v, err := integrity.NewVerifier(h, integrity.OptVerifyWithKeyRing(openpgp.EntityList{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Verify(); !errors.Is(err, &integrity.SignatureNotFoundError{}) {
+		t.Errorf("got error %v, want signature not found", err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	p := newTestPKI(t, newKey(t))
+
+	dir, err := ioutil.TempDir("", "x509sig-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writePEM := func(name string, blocks ...*pem.Block) string {
+		path := filepath.Join(dir, name)
+		var b []byte
+		for _, p := range blocks {
+			b = append(b, pem.EncodeToMemory(p)...)
+		}
+		if err := ioutil.WriteFile(path, b, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(p.leafKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecDER, err := x509.MarshalECPrivateKey(p.leafKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certs := writePEM("certs.pem",
+		&pem.Block{Type: "CERTIFICATE", Bytes: p.leaf.Raw},
+		&pem.Block{Type: "CERTIFICATE", Bytes: p.intermediate.Raw},
+	)
+	pkcs8 := writePEM("pkcs8.pem", &pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	sec1 := writePEM("sec1.pem", &pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER})
+	empty := writePEM("empty.pem")
+
+	got, err := LoadCertificates(certs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || !got[0].Equal(p.leaf) || !got[1].Equal(p.intermediate) {
+		t.Errorf("unexpected certificates")
+	}
+	if _, err := LoadCertificates(empty); !errors.Is(err, errNoCertificate) {
+		t.Errorf("got error %v, want %v", err, errNoCertificate)
+	}
+
+	for _, path := range []string{pkcs8, sec1} {
+		key, err := LoadPrivateKey(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !key.(*ecdsa.PrivateKey).Equal(p.leafKey) {
+			t.Errorf("unexpected key from %v", path)
+		}
+	}
+	if _, err := LoadPrivateKey(certs); !errors.Is(err, errNoPrivateKey) {
+		t.Errorf("got error %v, want %v", err, errNoPrivateKey)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package events provides the structured events reported by a local build,
+// so plugins and wrappers can follow the progress of a build.
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Type is the type of a build event.
+type Type string
+
+const (
+	// BuildStart is reported when the build starts.
+	BuildStart Type = "build-start"
+	// BuildEnd is reported when the build completes successfully.
+	BuildEnd Type = "build-end"
+	// BuildFailed is reported when the build fails.
+	BuildFailed Type = "build-failed"
+	// StageStart is reported when a stage starts.
+	StageStart Type = "stage-start"
+	// StageEnd is reported when a stage completes successfully.
+	StageEnd Type = "stage-end"
+	// StepStart is reported when a step of a stage starts.
+	StepStart Type = "step-start"
+	// StepEnd is reported when a step of a stage completes successfully.
+	StepEnd Type = "step-end"
+	// StepFailed is reported when a step of a stage fails.
+	StepFailed Type = "step-failed"
+	// StepCached is reported when a step is skipped as its result
+	// is restored from the build step cache.
+	StepCached Type = "step-cached"
+)
+
+// Step is a build step of a stage.
+type Step string
+
+const (
+	// Get is the retrieval of the bootstrap source by the conveyor.
+	Get Step = "get"
+	// Pack is the unpacking of the bootstrap source into the root filesystem.
+	Pack Step = "pack"
+	// Pre is the %pre section script.
+	Pre Step = "pre"
+	// Setup is the %setup section script.
+	Setup Step = "setup"
+	// FilesFrom is the copy of the %files from a previous stage.
+	FilesFrom Step = "files-from"
+	// Files is the copy of the %files from the host.
+	Files Step = "files"
+	// Post is the %post section script.
+	Post Step = "post"
+	// Test is the %test section script.
+	Test Step = "test"
+	// SBOM is the generation of the software bill of materials.
+	SBOM Step = "sbom"
+	// Assemble is the creation of the final image by the assembler.
+	Assemble Step = "assemble"
+)
+
+// Event is a build event.
+type Event struct {
+	// Type is the event type.
+	Type Type `json:"type"`
+	// Time is the time at which the event occurred.
+	Time time.Time `json:"time"`
+	// Stage is the name of the stage, empty for build events and
+	// unnamed stages.
+	Stage string `json:"stage,omitempty"`
+	// Step is the step of the stage for step events.
+	Step Step `json:"step,omitempty"`
+	// Duration is the duration of the build, stage or step for end
+	// and failure events, in nanoseconds in the JSON stream.
+	Duration time.Duration `json:"duration,omitempty"`
+	// Error is the error message of failure events.
+	Error string `json:"error,omitempty"`
+	// ExitCode is the exit code of a failed script or process.
+	ExitCode int `json:"exit_code,omitempty"`
+}
+
+// Handler handles the events reported by a build.
+type Handler interface {
+	Handle(Event)
+}
+
+// HandlerFunc is a function used as a Handler.
+type HandlerFunc func(Event)
+
+// Handle calls f(e).
+func (f HandlerFunc) Handle(e Event) {
+	f(e)
+}
+
+// jsonHandler writes events as line-delimited JSON.
+type jsonHandler struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONHandler returns a Handler writing events to w, one JSON
+// object per line. It is safe for concurrent use.
+func NewJSONHandler(w io.Writer) Handler {
+	return &jsonHandler{enc: json.NewEncoder(w)}
+}
+
+func (h *jsonHandler) Handle(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// a reporting failure must not abort the build
+	_ = h.enc.Encode(e)
+}
+
+// Failure returns the failure event of type t for err, the exit code is
+// set when err wraps the exit error of a process.
+func Failure(t Type, err error) Event {
+	e := Event{
+		Type:  t,
+		Time:  time.Now(),
+		Error: err.Error(),
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		e.ExitCode = exitErr.ExitCode()
+	}
+	return e
+}
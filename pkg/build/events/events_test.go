@@ -0,0 +1,92 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestJSONHandler(t *testing.T) {
+	var buf bytes.Buffer
+
+	h := NewJSONHandler(&buf)
+	h.Handle(Event{Type: StepStart, Stage: "devel", Step: Post})
+	h.Handle(Event{Type: StepEnd, Stage: "devel", Step: Post, Duration: 2 * time.Second})
+
+	var got []map[string]interface{}
+
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		m := make(map[string]interface{})
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+			t.Fatalf("unexpected error while decoding %q: %s", scanner.Text(), err)
+		}
+		got = append(got, m)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("unexpected number of events: got %d, want 2", len(got))
+	}
+	if got[0]["type"] != string(StepStart) || got[0]["step"] != string(Post) || got[0]["stage"] != "devel" {
+		t.Errorf("unexpected first event: %v", got[0])
+	}
+	if _, ok := got[0]["duration"]; ok {
+		t.Errorf("unexpected duration in start event: %v", got[0])
+	}
+	if got[1]["duration"] != float64(2*time.Second) {
+		t.Errorf("unexpected duration in end event: %v", got[1]["duration"])
+	}
+}
+
+func TestFailure(t *testing.T) {
+	err := exec.Command("/bin/sh", "-c", "exit 3").Run()
+	if err == nil {
+		t.Fatalf("unexpected success")
+	}
+
+	tests := []struct {
+		name         string
+		err          error
+		wantExitCode int
+	}{
+		{
+			name:         "ExitError",
+			err:          err,
+			wantExitCode: 3,
+		},
+		{
+			name:         "WrappedExitError",
+			err:          fmt.Errorf("failed to run %%post script: %w", err),
+			wantExitCode: 3,
+		},
+		{
+			name:         "OtherError",
+			err:          fmt.Errorf("unable to copy files"),
+			wantExitCode: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := Failure(StepFailed, tt.err)
+			if e.Type != StepFailed {
+				t.Errorf("unexpected type: got %s, want %s", e.Type, StepFailed)
+			}
+			if e.Error != tt.err.Error() {
+				t.Errorf("unexpected error: got %q, want %q", e.Error, tt.err.Error())
+			}
+			if e.ExitCode != tt.wantExitCode {
+				t.Errorf("unexpected exit code: got %d, want %d", e.ExitCode, tt.wantExitCode)
+			}
+		})
+	}
+}
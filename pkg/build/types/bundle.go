@@ -1,4 +1,4 @@
-// Copyright (c) 2018-2020, Sylabs Inc. All rights reserved.
+// Copyright (c) 2018-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -7,10 +7,12 @@ package types
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	ocitypes "github.com/containers/image/v5/types"
 	"github.com/hpcng/singularity/internal/pkg/cache"
@@ -68,6 +70,18 @@ type Options struct {
 	NoCleanUp bool `json:"noCleanUp"`
 	// NoCache when true, will not use any cache, or make cache.
 	NoCache bool
+	// StepCache caches the root filesystem after the %files and %post
+	// sections, and reuses it in later builds of unchanged sections.
+	StepCache bool `json:"stepCache"`
+	// Reproducible builds an image which only depends on the build
+	// inputs, its timestamps are set to SourceDateEpoch.
+	Reproducible bool `json:"reproducible"`
+	// SourceDateEpoch is the Unix time of the timestamps of a
+	// reproducible build.
+	SourceDateEpoch int64 `json:"sourceDateEpoch"`
+	// NoSBOM disables the generation of the software bill of materials
+	// of the image.
+	NoSBOM bool `json:"noSBOM"`
 	// FixPerms controls if we will ensure owner rwX on container content
 	// to preserve <=3.4 behavior.
 	// TODO: Deprecate in 3.6, remove in 3.8
@@ -75,6 +89,27 @@ type Options struct {
 	// To warn when the above is needed, we need to know if the target of this
 	// bundle will be a sandbox
 	SandboxTarget bool
+	// Stdout receives the standard output of the section scripts and
+	// of the bootstrap commands, os.Stdout is used when nil.
+	Stdout io.Writer `json:"-"`
+}
+
+// BuildTime returns the time recorded in the image as its build time,
+// which is SourceDateEpoch for reproducible builds.
+func (o Options) BuildTime() time.Time {
+	if o.Reproducible {
+		return time.Unix(o.SourceDateEpoch, 0).UTC()
+	}
+	return time.Now()
+}
+
+// GetStdout returns the writer for the standard output of the section
+// scripts and of the bootstrap commands.
+func (o Options) GetStdout() io.Writer {
+	if o.Stdout == nil {
+		return os.Stdout
+	}
+	return o.Stdout
 }
 
 // NewEncryptedBundle creates an Encrypted Bundle environment.
@@ -1,4 +1,4 @@
-// Copyright (c) 2018-2019, Sylabs Inc. All rights reserved.
+// Copyright (c) 2018-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -41,6 +41,7 @@ type ImageScripts struct {
 	Runscript   Script `json:"runScript"`
 	Test        Script `json:"test"`
 	Startscript Script `json:"startScript"`
+	Healthcheck Script `json:"healthCheck"`
 }
 
 // Data contains any scripts, metadata, etc... that the Builder may
@@ -186,6 +187,7 @@ func populateRaw(d *Definition, w io.Writer) {
 	writeSectionIfExists(w, "runscript", d.ImageData.Runscript)
 	writeSectionIfExists(w, "test", d.ImageData.Test)
 	writeSectionIfExists(w, "startscript", d.ImageData.Startscript)
+	writeSectionIfExists(w, "healthcheck", d.ImageData.Healthcheck)
 	writeSectionIfExists(w, "pre", d.BuildData.Pre)
 	writeSectionIfExists(w, "setup", d.BuildData.Setup)
 	writeSectionIfExists(w, "post", d.BuildData.Post)
@@ -0,0 +1,183 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// Match {{ VAR }} build argument references
+	buildArgRef = regexp.MustCompile(`{{\s*([A-Za-z_][A-Za-z0-9_]*)\s*}}`)
+	// Match valid build argument names
+	buildArgName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// parseBuildArg parses a KEY=VALUE build argument, a missing value is
+// returned with ok set to false.
+func parseBuildArg(s string) (key, val string, ok bool, err error) {
+	split := strings.SplitN(s, "=", 2)
+	key = strings.TrimSpace(split[0])
+	if !buildArgName.MatchString(key) {
+		return "", "", false, fmt.Errorf("invalid build argument name %q", key)
+	}
+	if len(split) == 1 {
+		return key, "", false, nil
+	}
+	val = strings.TrimSpace(split[1])
+	if len(val) > 1 && val[0] == '"' && val[len(val)-1] == '"' {
+		val = val[1 : len(val)-1]
+	}
+	return key, val, true, nil
+}
+
+// ParseBuildArgs parses a list of KEY=VALUE build arguments into a map.
+func ParseBuildArgs(args []string) (map[string]string, error) {
+	m := make(map[string]string)
+	for _, arg := range args {
+		key, val, ok, err := parseBuildArg(arg)
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			return nil, fmt.Errorf("build argument %s: '=' is missing", key)
+		}
+		m[key] = val
+	}
+	return m, nil
+}
+
+// ReadBuildArgs reads KEY=VALUE build arguments from r, one per line.
+// Empty lines and lines starting with # are ignored.
+func ReadBuildArgs(r io.Reader) (map[string]string, error) {
+	var args []string
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		if line := strings.TrimSpace(s.Text()); line != "" && line[0] != '#' {
+			args = append(args, line)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("while reading build arguments: %v", err)
+	}
+
+	return ParseBuildArgs(args)
+}
+
+// SubstituteBuildArgs replaces the {{ VAR }} build arguments referenced in
+// the header and sections of the definition raw with their value. Default
+// values are declared as KEY=VALUE lines in %arguments sections and are
+// overridden by args. The %arguments sections of the returned definition
+// record the resolved values. It returns an error if a referenced argument
+// has no value, and the names of args which are neither declared nor
+// referenced. A definition without %arguments section is returned unchanged
+// if no argument is passed.
+func SubstituteBuildArgs(raw []byte, args map[string]string) ([]byte, []string, error) {
+	lines := bytes.SplitAfter(raw, []byte("\n"))
+
+	// collect argument declarations and their default values
+	values := make(map[string]string)
+	declared := make(map[string]bool)
+	inArguments := false
+
+	for _, line := range lines {
+		if word := firstWord(line); word != "" && word[0] == '%' {
+			inArguments = getSectionName(word) == "arguments"
+			continue
+		} else if !inArguments || word == "" || word[0] == '#' {
+			continue
+		}
+		key, val, ok, err := parseBuildArg(string(line))
+		if err != nil {
+			return nil, nil, fmt.Errorf("in %%arguments section: %v", err)
+		}
+		declared[key] = true
+		if ok {
+			values[key] = val
+		}
+	}
+
+	if len(declared) == 0 && len(args) == 0 {
+		return raw, nil, nil
+	}
+
+	for k, v := range args {
+		values[k] = v
+	}
+
+	var buf bytes.Buffer
+	used := make(map[string]bool)
+	missing := make(map[string]bool)
+	inArguments = false
+
+	for _, line := range lines {
+		word := firstWord(line)
+		if word != "" && word[0] == '%' {
+			inArguments = getSectionName(word) == "arguments"
+		} else if inArguments && word != "" && word[0] != '#' {
+			// record the resolved value
+			key, _, _, _ := parseBuildArg(string(line))
+			indent := line[:len(line)-len(bytes.TrimLeft(line, " \t"))]
+			buf.Write(indent)
+			if val, ok := values[key]; ok {
+				fmt.Fprintf(&buf, "%s=%s", key, val)
+			} else {
+				buf.WriteString(key)
+			}
+			if bytes.HasSuffix(line, []byte("\n")) {
+				buf.WriteString("\n")
+			}
+			continue
+		}
+
+		buf.Write(buildArgRef.ReplaceAllFunc(line, func(ref []byte) []byte {
+			key := string(buildArgRef.FindSubmatch(ref)[1])
+			used[key] = true
+			val, ok := values[key]
+			if !ok {
+				missing[key] = true
+				return ref
+			}
+			return []byte(val)
+		}))
+	}
+
+	if len(missing) > 0 {
+		return nil, nil, fmt.Errorf("build argument(s) without value: %s", strings.Join(sortedKeys(missing), ", "))
+	}
+
+	unused := make(map[string]bool)
+	for k := range args {
+		if !declared[k] && !used[k] {
+			unused[k] = true
+		}
+	}
+
+	return buf.Bytes(), sortedKeys(unused), nil
+}
+
+func firstWord(line []byte) string {
+	fields := strings.Fields(string(line))
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hpcng/singularity/internal/pkg/test"
+)
+
+const argumentsDef = `Bootstrap: docker
+From: alpine:{{ VERSION }}
+
+%arguments
+    VERSION=3.14
+    GREETING="hello world"
+    USER
+
+%post
+    echo {{GREETING}} > /greeting
+    echo {{ USER }}
+`
+
+func TestSubstituteBuildArgs(t *testing.T) {
+	tests := []struct {
+		name         string
+		def          string
+		args         map[string]string
+		expectDef    string
+		expectUnused []string
+		expectError  bool
+	}{
+		{
+			name:      "NoArguments",
+			def:       "Bootstrap: docker\nFrom: {{ .Image }}\n",
+			expectDef: "Bootstrap: docker\nFrom: {{ .Image }}\n",
+		},
+		{
+			name:        "MissingValue",
+			def:         argumentsDef,
+			expectError: true,
+		},
+		{
+			name: "Defaults",
+			def:  argumentsDef,
+			args: map[string]string{"USER": "root"},
+			expectDef: `Bootstrap: docker
+From: alpine:3.14
+
+%arguments
+    VERSION=3.14
+    GREETING=hello world
+    USER=root
+
+%post
+    echo hello world > /greeting
+    echo root
+`,
+		},
+		{
+			name: "Override",
+			def:  argumentsDef,
+			args: map[string]string{"USER": "root", "VERSION": "3.15", "OTHER": "1"},
+			expectDef: `Bootstrap: docker
+From: alpine:3.15
+
+%arguments
+    VERSION=3.15
+    GREETING=hello world
+    USER=root
+
+%post
+    echo hello world > /greeting
+    echo root
+`,
+			expectUnused: []string{"OTHER"},
+		},
+		{
+			name:      "Undeclared",
+			def:       "Bootstrap: docker\nFrom: alpine:{{ VERSION }}\n",
+			args:      map[string]string{"VERSION": "3.14"},
+			expectDef: "Bootstrap: docker\nFrom: alpine:3.14\n",
+		},
+		{
+			name:        "InvalidName",
+			def:         "Bootstrap: docker\n%arguments\n    1VERSION=3.14\n",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, test.WithoutPrivilege(func(t *testing.T) {
+			def, unused, err := SubstituteBuildArgs([]byte(tt.def), tt.args)
+			if tt.expectError {
+				if err == nil {
+					t.Fatalf("unexpected success")
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if string(def) != tt.expectDef {
+				t.Errorf("unexpected definition:\n%s\nexpected:\n%s", def, tt.expectDef)
+			}
+			if len(unused) != 0 || len(tt.expectUnused) != 0 {
+				if !reflect.DeepEqual(unused, tt.expectUnused) {
+					t.Errorf("unexpected unused arguments %v, expected %v", unused, tt.expectUnused)
+				}
+			}
+		}))
+	}
+}
+
+func TestReadBuildArgs(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		expectArgs  map[string]string
+		expectError bool
+	}{
+		{
+			name:       "Valid",
+			content:    "# comment\nVERSION=3.14\n\n  USER = root \nEMPTY=\n",
+			expectArgs: map[string]string{"VERSION": "3.14", "USER": "root", "EMPTY": ""},
+		},
+		{
+			name:        "MissingValue",
+			content:     "VERSION\n",
+			expectError: true,
+		},
+		{
+			name:        "InvalidName",
+			content:     "MY-VERSION=1\n",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, test.WithoutPrivilege(func(t *testing.T) {
+			args, err := ReadBuildArgs(strings.NewReader(tt.content))
+			if tt.expectError {
+				if err == nil {
+					t.Fatalf("unexpected success")
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(args, tt.expectArgs) {
+				t.Errorf("unexpected arguments %v, expected %v", args, tt.expectArgs)
+			}
+		}))
+	}
+}
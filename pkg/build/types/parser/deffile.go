@@ -1,4 +1,4 @@
-// Copyright (c) 2018-2019, Sylabs Inc. All rights reserved.
+// Copyright (c) 2018-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -309,6 +309,7 @@ func populateDefinition(sections map[string]*types.Script, files *[]types.Files,
 			Runscript:   *sections["runscript"],
 			Test:        *sections["test"],
 			Startscript: *sections["startscript"],
+			Healthcheck: *sections["healthcheck"],
 		},
 		Labels: GetLabels(sections["labels"].Script),
 	}
@@ -551,6 +552,8 @@ var validSections = map[string]bool{
 	"runscript":   true,
 	"test":        true,
 	"startscript": true,
+	"healthcheck": true,
+	"arguments":   true,
 }
 
 var appSections = map[string]bool{
@@ -189,6 +189,8 @@ func TestParseDefinitionFile(t *testing.T) {
 		{"MultipleFiles", "testdata_good/multiplefiles/multiplefiles", "testdata_good/multiplefiles/multiplefiles.json"},
 		{"QuotedFiles", "testdata_good/quotedfiles/quotedfiles", "testdata_good/quotedfiles/quotedfiles.json"},
 		{"Shebang", "testdata_good/shebang/shebang", "testdata_good/shebang/shebang.json"},
+		{"Healthcheck", "testdata_good/healthcheck/healthcheck", "testdata_good/healthcheck/healthcheck.json"},
+		{"Arguments", "testdata_good/arguments/arguments", "testdata_good/arguments/arguments.json"},
 	}
 
 	for _, tt := range tests {
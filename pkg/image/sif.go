@@ -20,6 +20,14 @@ const (
 	SIFDescOCIConfigJSON = "oci-config.json"
 	// SIFDescInspectMetadataJSON is the name of the SIF descriptor holding the container metadata.
 	SIFDescInspectMetadataJSON = "inspect-metadata.json"
+	// SIFDescSBOMJSON is the name of the SIF descriptor holding the SPDX software bill of materials.
+	SIFDescSBOMJSON = "sbom.spdx.json"
+	// SIFDescTimestamp is the name of the SIF descriptor holding the RFC 3161 time-stamp token
+	// of the signature it is linked to.
+	SIFDescTimestamp = "timestamp.tsr"
+	// SIFDescX509Signature is the name of the SIF descriptor holding an X.509 signature of the
+	// object group it is linked to.
+	SIFDescX509Signature = "signature.x509.json"
 )
 
 type sifFormat struct{}
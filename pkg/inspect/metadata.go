@@ -1,4 +1,4 @@
-// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// Copyright (c) 2020-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -27,6 +27,8 @@ type Attributes struct {
 	Helpfile    string                    `json:"helpfile,omitempty"`
 	Deffile     string                    `json:"deffile,omitempty"`
 	Startscript string                    `json:"startscript,omitempty"`
+	Healthcheck string                    `json:"healthcheck,omitempty"`
+	Compression string                    `json:"compression,omitempty"`
 }
 
 // Data holds the container metadata attributes.
@@ -0,0 +1,294 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package native creates OCI bundles directly from OCI images, without
+// converting them to SIF images first.
+package native
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	apexlog "github.com/apex/log"
+	"github.com/containers/image/v5/copy"
+	"github.com/containers/image/v5/docker"
+	ociarchive "github.com/containers/image/v5/oci/archive"
+	ocilayout "github.com/containers/image/v5/oci/layout"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/types"
+	"github.com/hpcng/singularity/internal/pkg/build/oci"
+	"github.com/hpcng/singularity/internal/pkg/cache"
+	"github.com/hpcng/singularity/internal/pkg/runtime/engine/config/oci/generate"
+	"github.com/hpcng/singularity/internal/pkg/util/fs"
+	"github.com/hpcng/singularity/pkg/ocibundle"
+	"github.com/hpcng/singularity/pkg/ocibundle/tools"
+	"github.com/hpcng/singularity/pkg/sylog"
+	imageSpecs "github.com/opencontainers/image-spec/specs-go/v1"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/opencontainers/umoci"
+	umocilayer "github.com/opencontainers/umoci/oci/layer"
+	"github.com/opencontainers/umoci/pkg/idtools"
+)
+
+// Supported image reference transports
+const (
+	DockerPrefix     = "docker://"
+	OCILayoutPrefix  = "oci:"
+	OCIArchivePrefix = "oci-archive:"
+)
+
+// layoutTag is the image tag in the temporary OCI layout
+const layoutTag = "bundle"
+
+type nativeBundle struct {
+	imageRef   string
+	bundlePath string
+	imgCache   *cache.Handle
+	sysCtx     *types.SystemContext
+	ocibundle.Bundle
+}
+
+// Option is a functional option to configure a native OCI bundle.
+type Option func(b *nativeBundle) error
+
+// OptImgCache sets the image cache where the image blobs are cached,
+// blobs are not cached if ic is nil or disabled.
+func OptImgCache(ic *cache.Handle) Option {
+	return func(b *nativeBundle) error {
+		b.imgCache = ic
+		return nil
+	}
+}
+
+// OptSysCtx sets the containers/image system context used to fetch the
+// image, for registry authentication or TLS settings.
+func OptSysCtx(sc *types.SystemContext) Option {
+	return func(b *nativeBundle) error {
+		b.sysCtx = sc
+		return nil
+	}
+}
+
+// IsImageRef returns whether ref is an image reference supported by
+// FromImageRef.
+func IsImageRef(ref string) bool {
+	return strings.HasPrefix(ref, DockerPrefix) ||
+		strings.HasPrefix(ref, OCILayoutPrefix) ||
+		strings.HasPrefix(ref, OCIArchivePrefix)
+}
+
+// parseImageRef parses a docker://, oci: or oci-archive: image reference.
+func parseImageRef(ref string) (types.ImageReference, error) {
+	switch {
+	case strings.HasPrefix(ref, DockerPrefix):
+		return docker.ParseReference(strings.TrimPrefix(ref, "docker:"))
+	case strings.HasPrefix(ref, OCILayoutPrefix):
+		return ocilayout.ParseReference(strings.TrimPrefix(ref, OCILayoutPrefix))
+	case strings.HasPrefix(ref, OCIArchivePrefix):
+		return ociarchive.ParseReference(strings.TrimPrefix(ref, OCIArchivePrefix))
+	}
+	return nil, fmt.Errorf("unsupported image reference %s", ref)
+}
+
+// Create creates an OCI bundle from an OCI image, the image layers are
+// unpacked in the bundle root filesystem and the image configuration is
+// applied to the bundle configuration
+func (b *nativeBundle) Create(ociConfig *specs.Spec) error {
+	ctx := context.TODO()
+
+	if b.imageRef == "" {
+		return fmt.Errorf("image wasn't set, need one to create bundle")
+	}
+
+	srcRef, err := parseImageRef(b.imageRef)
+	if err != nil {
+		return fmt.Errorf("failed to parse image reference %s: %s", b.imageRef, err)
+	}
+	if b.imgCache != nil && !b.imgCache.IsDisabled() {
+		srcRef, err = oci.ConvertReference(ctx, b.imgCache, srcRef, b.sysCtx)
+		if err != nil {
+			return fmt.Errorf("failed to convert image reference %s: %s", b.imageRef, err)
+		}
+	}
+
+	// generate OCI bundle directory and config
+	g, err := tools.GenerateBundleConfig(b.bundlePath, ociConfig)
+	if err != nil {
+		return fmt.Errorf("failed to generate OCI bundle/config: %s", err)
+	}
+
+	if err := b.writeBundle(ctx, srcRef, g, ociConfig == nil); err != nil {
+		b.cleanup()
+		return err
+	}
+	return nil
+}
+
+// writeBundle fetches the image srcRef, unpacks its layers in the bundle
+// root filesystem and saves the bundle configuration g, which is the
+// default configuration if defaultConfig is true.
+func (b *nativeBundle) writeBundle(ctx context.Context, srcRef types.ImageReference, g *generate.Generator, defaultConfig bool) error {
+	// the image is copied to a temporary OCI layout to read its manifest,
+	// configuration and layers from the same place whatever the source is
+	layoutDir, err := ioutil.TempDir(b.bundlePath, "layout-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary OCI layout: %s", err)
+	}
+	defer os.RemoveAll(layoutDir)
+
+	layoutRef, err := ocilayout.ParseReference(layoutDir + ":" + layoutTag)
+	if err != nil {
+		return fmt.Errorf("failed to parse temporary OCI layout reference: %s", err)
+	}
+
+	policy := &signature.Policy{Default: []signature.PolicyRequirement{signature.NewPRInsecureAcceptAnything()}}
+	policyCtx, err := signature.NewPolicyContext(policy)
+	if err != nil {
+		return err
+	}
+	defer policyCtx.Destroy()
+
+	_, err = copy.Image(ctx, policyCtx, layoutRef, srcRef, &copy.Options{
+		ReportWriter: sylog.Writer(),
+		SourceCtx:    b.sysCtx,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to fetch image %s: %s", b.imageRef, err)
+	}
+
+	img, err := layoutRef.NewImage(ctx, b.sysCtx)
+	if err != nil {
+		return fmt.Errorf("failed to open image %s: %s", b.imageRef, err)
+	}
+	defer img.Close()
+
+	manifestData, mediaType, err := img.Manifest(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read image manifest: %s", err)
+	}
+	if mediaType != imageSpecs.MediaTypeImageManifest {
+		return fmt.Errorf("unexpected image manifest media type: %s", mediaType)
+	}
+	var manifest imageSpecs.Manifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return fmt.Errorf("failed to decode image manifest: %s", err)
+	}
+
+	imgSpec, err := img.OCIConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read image configuration: %s", err)
+	}
+
+	if err := unpackRootfs(ctx, layoutDir, tools.RootFs(b.bundlePath).Path(), manifest); err != nil {
+		return err
+	}
+
+	if err := tools.ApplyImageConfig(b.bundlePath, g, imgSpec.Config); err != nil {
+		return fmt.Errorf("failed to apply image configuration: %s", err)
+	}
+	// the default configuration working directory is /
+	if defaultConfig && imgSpec.Config.WorkingDir != "" {
+		g.SetProcessCwd(imgSpec.Config.WorkingDir)
+	}
+	// there is no runscript in an OCI image
+	if args := g.Config.Process.Args; len(args) == 1 && args[0] == tools.RunScript {
+		return fmt.Errorf("image %s has no entrypoint or command, process arguments must be set in the OCI configuration", b.imageRef)
+	}
+
+	return tools.SaveBundleConfig(b.bundlePath, g)
+}
+
+// unpackRootfs extracts the layers of the image manifest from the OCI
+// layout layoutDir into rootfs, umoci applies the layer whiteouts.
+func unpackRootfs(ctx context.Context, layoutDir, rootfs string, manifest imageSpecs.Manifest) error {
+	var mapOptions umocilayer.MapOptions
+
+	// set the apex log level, for umoci
+	if sylog.GetLevel() < int(sylog.DebugLevel) {
+		apexlog.SetLevel(apexlog.WarnLevel)
+	} else {
+		apexlog.SetLevel(apexlog.DebugLevel)
+	}
+
+	// Allow unpacking as non-root
+	if os.Geteuid() != 0 {
+		mapOptions.Rootless = true
+
+		uidMap, err := idtools.ParseMapping(fmt.Sprintf("0:%d:1", os.Geteuid()))
+		if err != nil {
+			return fmt.Errorf("error parsing uidmap: %s", err)
+		}
+		mapOptions.UIDMappings = append(mapOptions.UIDMappings, uidMap)
+
+		gidMap, err := idtools.ParseMapping(fmt.Sprintf("0:%d:1", os.Getegid()))
+		if err != nil {
+			return fmt.Errorf("error parsing gidmap: %s", err)
+		}
+		mapOptions.GIDMappings = append(mapOptions.GIDMappings, gidMap)
+	}
+
+	engineExt, err := umoci.OpenLayout(layoutDir)
+	if err != nil {
+		return fmt.Errorf("error opening layout: %s", err)
+	}
+	defer engineExt.Close()
+
+	// UnpackRootfs expects a path to a non-existing directory
+	if err := os.Remove(rootfs); err != nil {
+		return fmt.Errorf("failed to remove %s: %s", rootfs, err)
+	}
+
+	unpackOptions := umocilayer.UnpackOptions{MapOptions: mapOptions}
+	if err := umocilayer.UnpackRootfs(ctx, engineExt, rootfs, manifest, &unpackOptions); err != nil {
+		return fmt.Errorf("error unpacking rootfs: %s", err)
+	}
+	return nil
+}
+
+// cleanup removes a partially created bundle.
+func (b *nativeBundle) cleanup() {
+	rootFsDir := tools.RootFs(b.bundlePath).Path()
+	if err := fs.ForceRemoveAll(rootFsDir); err != nil {
+		sylog.Warningf("failed to remove %s: %s", rootFsDir, err)
+	}
+	if err := tools.DeleteBundle(b.bundlePath); err != nil {
+		sylog.Warningf("failed to remove bundle %s: %s", b.bundlePath, err)
+	}
+}
+
+// Delete erases an OCI bundle created from an OCI image
+func (b *nativeBundle) Delete() error {
+	rootFsDir := tools.RootFs(b.bundlePath).Path()
+	if err := fs.ForceRemoveAll(rootFsDir); err != nil {
+		return fmt.Errorf("failed to delete %s: %s", rootFsDir, err)
+	}
+	// delete bundle directory
+	return tools.DeleteBundle(b.bundlePath)
+}
+
+// FromImageRef returns a bundle interface to create/delete an OCI bundle
+// from a docker://, oci: or oci-archive: image reference
+func FromImageRef(imageRef, bundle string, opts ...Option) (ocibundle.Bundle, error) {
+	var err error
+
+	b := &nativeBundle{
+		imageRef: imageRef,
+	}
+	b.bundlePath, err = filepath.Abs(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine bundle path: %s", err)
+	}
+	for _, opt := range opts {
+		if err := opt(b); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
@@ -0,0 +1,240 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package native
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/hpcng/singularity/internal/pkg/test"
+	"github.com/hpcng/singularity/pkg/ocibundle/tools"
+	"github.com/opencontainers/go-digest"
+	imageSpecsGo "github.com/opencontainers/image-spec/specs-go"
+	imageSpecs "github.com/opencontainers/image-spec/specs-go/v1"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+type layerFile struct {
+	name    string
+	content string
+}
+
+// writeBlob writes data in the blobs directory of the OCI layout dir and
+// returns its descriptor.
+func writeBlob(t *testing.T, dir, mediaType string, data []byte) imageSpecs.Descriptor {
+	d := digest.FromBytes(data)
+	blobs := filepath.Join(dir, "blobs", d.Algorithm().String())
+	if err := os.MkdirAll(blobs, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(blobs, d.Encoded()), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return imageSpecs.Descriptor{MediaType: mediaType, Digest: d, Size: int64(len(data))}
+}
+
+// writeJSONBlob writes v as a JSON blob in the OCI layout dir.
+func writeJSONBlob(t *testing.T, dir, mediaType string, v interface{}) imageSpecs.Descriptor {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writeBlob(t, dir, mediaType, data)
+}
+
+// makeLayer returns a layer tarball containing files, and its diff ID.
+func makeLayer(t *testing.T, files []layerFile) ([]byte, digest.Digest) {
+	var layer bytes.Buffer
+
+	tw := tar.NewWriter(&layer)
+	for _, f := range files {
+		hdr := &tar.Header{
+			Name:     f.name,
+			Mode:     0o644,
+			Size:     int64(len(f.content)),
+			Typeflag: tar.TypeReg,
+		}
+		if f.name[len(f.name)-1] == '/' {
+			hdr.Mode = 0o755
+			hdr.Typeflag = tar.TypeDir
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(f.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var gzLayer bytes.Buffer
+
+	gw := gzip.NewWriter(&gzLayer)
+	if _, err := gw.Write(layer.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return gzLayer.Bytes(), digest.FromBytes(layer.Bytes())
+}
+
+// makeLayout creates an OCI image layout in dir with an image tagged latest
+// made of layers and the image configuration config.
+func makeLayout(t *testing.T, dir string, config imageSpecs.ImageConfig, layers ...[]layerFile) {
+	img := imageSpecs.Image{
+		Architecture: runtime.GOARCH,
+		OS:           "linux",
+		Config:       config,
+		RootFS:       imageSpecs.RootFS{Type: "layers"},
+	}
+	manifest := imageSpecs.Manifest{
+		Versioned: imageSpecsGo.Versioned{SchemaVersion: 2},
+	}
+
+	for _, files := range layers {
+		data, diffID := makeLayer(t, files)
+		manifest.Layers = append(manifest.Layers, writeBlob(t, dir, imageSpecs.MediaTypeImageLayerGzip, data))
+		img.RootFS.DiffIDs = append(img.RootFS.DiffIDs, diffID)
+	}
+	manifest.Config = writeJSONBlob(t, dir, imageSpecs.MediaTypeImageConfig, img)
+
+	desc := writeJSONBlob(t, dir, imageSpecs.MediaTypeImageManifest, manifest)
+	desc.Annotations = map[string]string{imageSpecs.AnnotationRefName: "latest"}
+	index := imageSpecs.Index{
+		Versioned: imageSpecsGo.Versioned{SchemaVersion: 2},
+		Manifests: []imageSpecs.Descriptor{desc},
+	}
+
+	data, err := json.Marshal(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, imageSpecs.ImageIndexFile), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	data, err = json.Marshal(imageSpecs.ImageLayout{Version: imageSpecs.ImageLayoutVersion})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, imageSpecs.ImageLayoutFile), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFromImageRef(t *testing.T) {
+	test.EnsurePrivilege(t)
+
+	tmpDir, err := ioutil.TempDir("", "native-bundle-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	layers := [][]layerFile{
+		{
+			{name: "bin/"},
+			{name: "bin/true", content: "true"},
+			{name: "etc/"},
+			{name: "etc/removed", content: "removed"},
+		},
+		{
+			{name: "etc/.wh.removed"},
+			{name: "etc/added", content: "added"},
+		},
+	}
+
+	layout := filepath.Join(tmpDir, "layout")
+	makeLayout(t, layout, imageSpecs.ImageConfig{
+		Entrypoint: []string{"/bin/true"},
+		Cmd:        []string{"arg"},
+		Env:        []string{"FOO=bar"},
+		WorkingDir: "/etc",
+	}, layers...)
+
+	noCmdLayout := filepath.Join(tmpDir, "nocmd")
+	makeLayout(t, noCmdLayout, imageSpecs.ImageConfig{}, layers...)
+
+	bundlePath := filepath.Join(tmpDir, "bundle")
+
+	// test with an unsupported image reference
+	bundle, err := FromImageRef("library://alpine", bundlePath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := bundle.Create(nil); err == nil {
+		t.Errorf("unexpected success with an unsupported image reference")
+	}
+
+	// test with an image without process arguments
+	bundle, err = FromImageRef("oci:"+noCmdLayout+":latest", bundlePath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := bundle.Create(nil); err == nil {
+		t.Errorf("unexpected success with an image without entrypoint or command")
+	}
+	if _, err := os.Stat(bundlePath); !os.IsNotExist(err) {
+		t.Errorf("bundle %s not cleaned up after failure", bundlePath)
+	}
+
+	bundle, err = FromImageRef("oci:"+layout+":latest", bundlePath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := bundle.Create(nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	rootfs := tools.RootFs(bundlePath).Path()
+	for _, f := range []string{"bin/true", "etc/added"} {
+		if _, err := os.Stat(filepath.Join(rootfs, f)); err != nil {
+			t.Errorf("file %s missing from bundle: %s", f, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(rootfs, "etc/removed")); !os.IsNotExist(err) {
+		t.Errorf("whiteout file etc/removed present in bundle")
+	}
+
+	data, err := ioutil.ReadFile(tools.Config(bundlePath).Path())
+	if err != nil {
+		t.Fatalf("while reading bundle configuration: %s", err)
+	}
+	var config specs.Spec
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatalf("while decoding bundle configuration: %s", err)
+	}
+	if args := []string{"/bin/true", "arg"}; !reflect.DeepEqual(config.Process.Args, args) {
+		t.Errorf("unexpected process arguments %v, expected %v", config.Process.Args, args)
+	}
+	if config.Process.Cwd != "/etc" {
+		t.Errorf("unexpected process working directory %s, expected /etc", config.Process.Cwd)
+	}
+	found := false
+	for _, e := range config.Process.Env {
+		found = found || e == "FOO=bar"
+	}
+	if !found {
+		t.Errorf("FOO=bar missing from process environment %v", config.Process.Env)
+	}
+
+	if err := bundle.Delete(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if _, err := os.Stat(bundlePath); !os.IsNotExist(err) {
+		t.Errorf("bundle %s not deleted", bundlePath)
+	}
+}
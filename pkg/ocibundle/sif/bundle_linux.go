@@ -1,4 +1,4 @@
-// Copyright (c) 2019-2020, Sylabs Inc. All rights reserved.
+// Copyright (c) 2019-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -8,9 +8,7 @@ package sifbundle
 import (
 	"encoding/json"
 	"fmt"
-	"os"
 	"path/filepath"
-	"strings"
 	"syscall"
 
 	"github.com/hpcng/singularity/internal/pkg/runtime/engine/config/oci/generate"
@@ -44,44 +42,8 @@ func (s *sifBundle) writeConfig(img *image.Image, g *generate.Generator) error {
 		return fmt.Errorf("failed to decode %s: %s", image.SIFDescOCIConfigJSON, err)
 	}
 
-	if len(g.Config.Process.Args) == 1 && g.Config.Process.Args[0] == tools.RunScript {
-		args := imgConfig.Entrypoint
-		args = append(args, imgConfig.Cmd...)
-		if len(args) > 0 {
-			g.SetProcessArgs(args)
-		}
-	}
-
-	if g.Config.Process.Cwd == "" && imgConfig.WorkingDir != "" {
-		g.SetProcessCwd(imgConfig.WorkingDir)
-	}
-	for _, e := range imgConfig.Env {
-		found := false
-		k := strings.SplitN(e, "=", 2)
-		for _, pe := range g.Config.Process.Env {
-			if strings.HasPrefix(pe, k[0]+"=") {
-				found = true
-				break
-			}
-		}
-		if !found {
-			g.AddProcessEnv(k[0], k[1])
-		}
-	}
-
-	volumes := tools.Volumes(s.bundlePath).Path()
-	for dst := range imgConfig.Volumes {
-		replacer := strings.NewReplacer(string(os.PathSeparator), "_")
-		src := filepath.Join(volumes, replacer.Replace(dst))
-		if err := os.MkdirAll(src, 0o755); err != nil {
-			return fmt.Errorf("failed to create volume directory %s: %s", src, err)
-		}
-		g.AddMount(specs.Mount{
-			Source:      src,
-			Destination: dst,
-			Type:        "none",
-			Options:     []string{"bind", "rw"},
-		})
+	if err := tools.ApplyImageConfig(s.bundlePath, g, imgConfig); err != nil {
+		return err
 	}
 
 	return tools.SaveBundleConfig(s.bundlePath, g)
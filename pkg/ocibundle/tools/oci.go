@@ -1,4 +1,4 @@
-// Copyright (c) 2019-2020, Sylabs Inc. All rights reserved.
+// Copyright (c) 2019-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -9,10 +9,12 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"syscall"
 
 	"github.com/hpcng/singularity/internal/pkg/runtime/engine/config/oci"
 	"github.com/hpcng/singularity/internal/pkg/runtime/engine/config/oci/generate"
+	imageSpecs "github.com/opencontainers/image-spec/specs-go/v1"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 )
 
@@ -81,6 +83,54 @@ func GenerateBundleConfig(bundlePath string, config *specs.Spec) (*generate.Gene
 	return g, nil
 }
 
+// ApplyImageConfig applies an OCI image configuration to the bundle
+// configuration: the image entrypoint and command replace the default
+// process arguments, the image working directory and environment variables
+// are set if not already present, and a bundle volume directory is bind
+// mounted for each image volume
+func ApplyImageConfig(bundlePath string, g *generate.Generator, imgConfig imageSpecs.ImageConfig) error {
+	if len(g.Config.Process.Args) == 1 && g.Config.Process.Args[0] == RunScript {
+		args := imgConfig.Entrypoint
+		args = append(args, imgConfig.Cmd...)
+		if len(args) > 0 {
+			g.SetProcessArgs(args)
+		}
+	}
+
+	if g.Config.Process.Cwd == "" && imgConfig.WorkingDir != "" {
+		g.SetProcessCwd(imgConfig.WorkingDir)
+	}
+	for _, e := range imgConfig.Env {
+		found := false
+		k := strings.SplitN(e, "=", 2)
+		for _, pe := range g.Config.Process.Env {
+			if strings.HasPrefix(pe, k[0]+"=") {
+				found = true
+				break
+			}
+		}
+		if !found {
+			g.AddProcessEnv(k[0], k[1])
+		}
+	}
+
+	volumes := Volumes(bundlePath).Path()
+	for dst := range imgConfig.Volumes {
+		replacer := strings.NewReplacer(string(os.PathSeparator), "_")
+		src := filepath.Join(volumes, replacer.Replace(dst))
+		if err := os.MkdirAll(src, 0o755); err != nil {
+			return fmt.Errorf("failed to create volume directory %s: %s", src, err)
+		}
+		g.AddMount(specs.Mount{
+			Source:      src,
+			Destination: dst,
+			Type:        "none",
+			Options:     []string{"bind", "rw"},
+		})
+	}
+	return nil
+}
+
 // SaveBundleConfig creates config.json in OCI bundle directory and
 // saves OCI configuration
 func SaveBundleConfig(bundlePath string, g *generate.Generator) error {
@@ -92,10 +142,10 @@ func DeleteBundle(bundlePath string) error {
 	if err := os.RemoveAll(Volumes(bundlePath).Path()); err != nil {
 		return fmt.Errorf("failed to delete volumes directory: %s", err)
 	}
-	if err := os.Remove(RootFs(bundlePath).Path()); err != nil {
+	if err := os.Remove(RootFs(bundlePath).Path()); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to delete rootfs directory: %s", err)
 	}
-	if err := os.Remove(Config(bundlePath).Path()); err != nil {
+	if err := os.Remove(Config(bundlePath).Path()); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to delete config.json file: %s", err)
 	}
 	if err := os.Remove(bundlePath); err != nil && !os.IsExist(err) {
@@ -9,6 +9,7 @@ import (
 	"os"
 	"syscall"
 
+	"github.com/hpcng/singularity/internal/pkg/audit"
 	"github.com/hpcng/singularity/pkg/runtime/engine/config"
 )
 
@@ -32,3 +33,11 @@ type PostStartProcess func(config *config.Common, pid int) error
 // This callback is called in:
 // - internal/pkg/runtime/engine/singularity/container_linux.go
 type RegisterImageDriver func(unprivileged bool) error
+
+// AuditRecord callback is called with the audit record of the container
+// when it is started and when it exits, see audit.EventStart and
+// audit.EventExit. It allows to send records to custom sinks, in addition
+// to the 'audit log' sink configured in singularity.conf.
+// This callback is called in:
+// - internal/pkg/runtime/engine/singularity/audit_linux.go
+type AuditRecord func(config *config.Common, record *audit.Record) error
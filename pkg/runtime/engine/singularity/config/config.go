@@ -10,10 +10,13 @@ import (
 	"os/exec"
 	"regexp"
 	"strings"
+	"time"
 
+	"github.com/hpcng/singularity/internal/pkg/audit"
 	"github.com/hpcng/singularity/internal/pkg/runtime/engine/config/oci"
 	"github.com/hpcng/singularity/pkg/image"
 	"github.com/hpcng/singularity/pkg/util/singularityconf"
+	"github.com/opencontainers/runtime-spec/specs-go"
 )
 
 // Name is the name of the runtime.
@@ -141,6 +144,7 @@ type JSONConfig struct {
 	NvCCLI            bool              `json:"nvCCLI,omitempty"`
 	NvCCLIEnv         []string          `json:"NvCCLIEnv,omitempty"`
 	Rocm              bool              `json:"rocm,omitempty"`
+	CDIDevices        []string          `json:"cdiDevices,omitempty"`
 	CustomHome        bool              `json:"customHome,omitempty"`
 	Instance          bool              `json:"instance,omitempty"`
 	InstanceJoin      bool              `json:"instanceJoin,omitempty"`
@@ -163,6 +167,13 @@ type JSONConfig struct {
 	RestoreUmask      bool              `json:"restoreUmask,omitempty"`
 	DeleteTempDir     string            `json:"deleteTempDir,omitempty"`
 	Umask             int               `json:"umask,omitempty"`
+	RestartPolicy     string            `json:"restartPolicy,omitempty"`
+	RestartCount      int               `json:"restartCount,omitempty"`
+	SupervisorPid     int               `json:"supervisorPid,omitempty"`
+	HealthCmd         string            `json:"healthCmd,omitempty"`
+	HealthInterval    time.Duration     `json:"healthInterval,omitempty"`
+	HealthRetries     int               `json:"healthRetries,omitempty"`
+	Audit             *audit.Record     `json:"audit,omitempty"`
 }
 
 // SetImage sets the container image path to be used by EngineConfig.JSON.
@@ -561,6 +572,80 @@ func (e *EngineConfig) GetInstance() bool {
 	return e.JSON.Instance
 }
 
+// SetRestartPolicy sets the restart policy of an instance.
+func (e *EngineConfig) SetRestartPolicy(policy string) {
+	e.JSON.RestartPolicy = policy
+}
+
+// GetRestartPolicy returns the restart policy of an instance.
+func (e *EngineConfig) GetRestartPolicy() string {
+	return e.JSON.RestartPolicy
+}
+
+// SetRestartCount sets the number of times an instance was restarted.
+func (e *EngineConfig) SetRestartCount(count int) {
+	e.JSON.RestartCount = count
+}
+
+// GetRestartCount returns the number of times an instance was restarted.
+func (e *EngineConfig) GetRestartCount() int {
+	return e.JSON.RestartCount
+}
+
+// SetSupervisorPid sets the PID of the process restarting an instance.
+func (e *EngineConfig) SetSupervisorPid(pid int) {
+	e.JSON.SupervisorPid = pid
+}
+
+// GetSupervisorPid returns the PID of the process restarting an instance.
+func (e *EngineConfig) GetSupervisorPid() int {
+	return e.JSON.SupervisorPid
+}
+
+// SetHealthCmd sets the command checking the health of an instance.
+func (e *EngineConfig) SetHealthCmd(cmd string) {
+	e.JSON.HealthCmd = cmd
+}
+
+// GetHealthCmd returns the command checking the health of an instance.
+func (e *EngineConfig) GetHealthCmd() string {
+	return e.JSON.HealthCmd
+}
+
+// SetHealthInterval sets the interval between two health checks of an instance.
+func (e *EngineConfig) SetHealthInterval(interval time.Duration) {
+	e.JSON.HealthInterval = interval
+}
+
+// GetHealthInterval returns the interval between two health checks of an instance.
+func (e *EngineConfig) GetHealthInterval() time.Duration {
+	return e.JSON.HealthInterval
+}
+
+// SetHealthRetries sets the number of consecutive failed health checks
+// for an instance to be unhealthy.
+func (e *EngineConfig) SetHealthRetries(retries int) {
+	e.JSON.HealthRetries = retries
+}
+
+// GetHealthRetries returns the number of consecutive failed health checks
+// for an instance to be unhealthy.
+func (e *EngineConfig) GetHealthRetries() int {
+	return e.JSON.HealthRetries
+}
+
+// SetCDIDevices sets the fully-qualified names of the CDI devices
+// added to the container.
+func (e *EngineConfig) SetCDIDevices(devices []string) {
+	e.JSON.CDIDevices = devices
+}
+
+// GetCDIDevices returns the fully-qualified names of the CDI devices
+// added to the container.
+func (e *EngineConfig) GetCDIDevices() []string {
+	return e.JSON.CDIDevices
+}
+
 // SetInstanceJoin sets if process joins an instance or not.
 func (e *EngineConfig) SetInstanceJoin(join bool) {
 	e.JSON.InstanceJoin = join
@@ -827,6 +912,15 @@ func (e *EngineConfig) GetCgroupsPath() string {
 	return e.JSON.CgroupsPath
 }
 
+// GetCgroupsResources returns the cgroups resource limits set in the
+// OCI configuration, if any.
+func (e *EngineConfig) GetCgroupsResources() *specs.LinuxResources {
+	if e.OciConfig == nil || e.OciConfig.Linux == nil {
+		return nil
+	}
+	return e.OciConfig.Linux.Resources
+}
+
 // SetTargetUID sets target UID to execute the container process as user ID.
 func (e *EngineConfig) SetTargetUID(uid int) {
 	e.JSON.TargetUID = uid
@@ -1030,3 +1124,14 @@ func (e *EngineConfig) SetUmask(umask int) {
 func (e *EngineConfig) GetUmask() int {
 	return e.JSON.Umask
 }
+
+// SetAudit sets the audit record of the container, or nil if
+// audit logging is disabled.
+func (e *EngineConfig) SetAudit(record *audit.Record) {
+	e.JSON.Audit = record
+}
+
+// GetAudit returns the audit record of the container.
+func (e *EngineConfig) GetAudit() *audit.Record {
+	return e.JSON.Audit
+}
@@ -27,6 +27,28 @@ func Exclusive(path string) (fd int, err error) {
 	return fd, nil
 }
 
+// ErrLocked corresponds to the error returned by TryExclusive
+// when the lock is already held.
+var ErrLocked = errors.New("file is already locked")
+
+// TryExclusive applies an exclusive lock on path without waiting,
+// it returns ErrLocked if the lock is already held.
+func TryExclusive(path string) (fd int, err error) {
+	fd, err = unix.Open(path, os.O_RDONLY, 0)
+	if err != nil {
+		return fd, err
+	}
+	err = unix.Flock(fd, unix.LOCK_EX|unix.LOCK_NB)
+	if err != nil {
+		unix.Close(fd)
+		if err == unix.EWOULDBLOCK {
+			return fd, ErrLocked
+		}
+		return fd, err
+	}
+	return fd, nil
+}
+
 // Release removes a lock on path referenced by fd
 func Release(fd int) error {
 	defer unix.Close(fd)
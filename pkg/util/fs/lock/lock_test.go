@@ -45,6 +45,41 @@ func TestExclusive(t *testing.T) {
 	}
 }
 
+func TestTryExclusive(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	if _, err := TryExclusive(""); err == nil {
+		t.Errorf("unexpected success with empty path")
+	}
+
+	f, err := ioutil.TempFile("", "lock-")
+	if err != nil {
+		t.Fatalf("failed to create temporary lock file: %s", err)
+	}
+	testFile := f.Name()
+	defer os.Remove(testFile)
+
+	f.Close()
+
+	fd, err := TryExclusive(testFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := TryExclusive(testFile); err != ErrLocked {
+		t.Errorf("unexpected error for locked file: %v", err)
+	}
+
+	Release(fd)
+
+	fd, err = TryExclusive(testFile)
+	if err != nil {
+		t.Fatalf("unexpected error after release: %s", err)
+	}
+	Release(fd)
+}
+
 func TestByteRange(t *testing.T) {
 	test.DropPrivilege(t)
 	defer test.ResetPrivilege(t)
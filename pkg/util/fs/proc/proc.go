@@ -1,4 +1,4 @@
-// Copyright (c) 2018-2019, Sylabs Inc. All rights reserved.
+// Copyright (c) 2018-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -7,7 +7,9 @@ package proc
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -337,3 +339,28 @@ func Getppid(pid int) (int, error) {
 
 	return -1, fmt.Errorf("no parent process ID found")
 }
+
+// StartTime returns the time the process started after system boot,
+// in clock ticks, as reported in /proc/<pid>/stat. Along with the process
+// ID, it identifies a process as process IDs are reused.
+func StartTime(pid int) (uint64, error) {
+	path := fmt.Sprintf("/proc/%d/stat", pid)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("could not read %s: %s", path, err)
+	}
+
+	// the command name is enclosed in parentheses and may contain
+	// spaces or parentheses, fields are counted from the last one
+	i := bytes.LastIndexByte(b, ')')
+	if i < 0 {
+		return 0, fmt.Errorf("could not parse %s", path)
+	}
+	// starttime is the 22nd field, the state is the 3rd one
+	fields := strings.Fields(string(b[i+1:]))
+	if len(fields) < 20 {
+		return 0, fmt.Errorf("could not parse %s", path)
+	}
+
+	return strconv.ParseUint(fields[19], 10, 64)
+}
@@ -1,4 +1,4 @@
-// Copyright (c) 2018-2019, Sylabs Inc. All rights reserved.
+// Copyright (c) 2018-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -512,3 +512,37 @@ func TestGetppid(t *testing.T) {
 		}
 	}
 }
+
+func TestStartTime(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	cmd := exec.Command("/bin/cat")
+	if _, err := cmd.StdinPipe(); err != nil {
+		t.Fatalf("failed to create standard input pipe: %s", err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start %s: %s", cmd.Path, err)
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+
+	self, err := StartTime(os.Getpid())
+	if err != nil {
+		t.Fatalf("unexpected failure for current process: %s", err)
+	}
+	child, err := StartTime(cmd.Process.Pid)
+	if err != nil {
+		t.Fatalf("unexpected failure for child process: %s", err)
+	}
+	if child < self {
+		t.Errorf("child process start time %d is before parent start time %d", child, self)
+	}
+	if st, err := StartTime(os.Getpid()); err != nil || st != self {
+		t.Errorf("unexpected start time %d for current process, expected %d: %v", st, self, err)
+	}
+
+	if _, err := StartTime(0); err == nil {
+		t.Errorf("unexpected success for process zero")
+	}
+}
@@ -67,9 +67,12 @@ type File struct {
 	MksquashfsPath          string   `directive:"mksquashfs path"`
 	MksquashfsProcs         uint     `default:"0" directive:"mksquashfs procs"`
 	MksquashfsMem           string   `directive:"mksquashfs mem"`
+	MksquashfsCompression   string   `default:"gzip" directive:"mksquashfs compression"`
 	NvidiaContainerCliPath  string   `directive:"nvidia-container-cli path"`
 	UnsquashfsPath          string   `directive:"unsquashfs path"`
 	ImageDriver             string   `directive:"image driver"`
+	AuditLog                string   `default:"none" authorized:"none,syslog,file,socket" directive:"audit log"`
+	AuditLogPath            string   `directive:"audit log path"`
 }
 
 const TemplateAsset = `# SINGULARITY.CONF
@@ -411,6 +414,16 @@ mksquashfs procs = {{ .MksquashfsProcs }}
 # mksquashfs mem = 1G
 {{ if ne .MksquashfsMem "" }}mksquashfs mem = {{ .MksquashfsMem }}{{ end }}
 
+# MKSQUASHFS COMPRESSION: [STRING]
+# DEFAULT: gzip
+# The compression algorithm used by default to create the SquashFS filesystem
+# of SIF images, when the --compression option of build is not specified.
+# Supported algorithms are gzip, xz, lz4 and zstd, gzip and zstd accept a
+# compression level with the algorithm:level format (e.g. zstd:19). The
+# algorithm must be supported by mksquashfs, and by the kernel squashfs
+# driver of the hosts running the images.
+mksquashfs compression = {{ .MksquashfsCompression }}
+
 # NVIDIA-CONTAINER-CLI PATH: [STRING]
 # DEFAULT: Undefined
 # Path to the nvidia-container-cli executable, used to find GPU libraries.
@@ -442,4 +455,30 @@ shared loop devices = {{ if eq .SharedLoopDevices true }}yes{{ else }}no{{ end }
 # If the driver name specified has not been registered via a plugin installation
 # the run-time will abort.
 image driver = {{ .ImageDriver }}
+
+# AUDIT LOG: [STRING]
+# DEFAULT: none
+# Record container launches: for each action command and instance, the user,
+# image path, digest and signers, bind paths, namespaces, fakeroot and setuid
+# mode are logged when the container starts, along with the exit status when
+# it stops. Records are JSON objects, sent to the given sink:
+# - none: no audit log is recorded
+# - syslog: records are sent to the local syslog daemon, with facility authpriv
+# - file: records are appended as JSON lines to 'audit log path', which must be
+#   writable by all users when the setuid workflow is disabled
+# - socket: records are sent as JSON lines to the listener of the Unix stream
+#   socket 'audit log path'
+# The signers of a SIF image are the fingerprints of the keys of the global
+# keyring whose PGP signatures of all image objects verify, signatures from
+# other keys are not recorded. They are not an execution policy, use the ECL
+# to restrict the images allowed to run.
+# Note that computing the image digest and verifying signatures require
+# reading the whole image file at each container launch.
+audit log = {{ .AuditLog }}
+
+# AUDIT LOG PATH: [STRING]
+# DEFAULT: Undefined
+# Path of the JSON lines file or Unix socket used by 'audit log'.
+# audit log path =
+{{ if ne .AuditLogPath "" }}audit log path = {{ .AuditLogPath }}{{ end }}
 `